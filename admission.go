@@ -0,0 +1,160 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	errors "github.com/Softwarekang/knetty/pkg/err"
+	"github.com/Softwarekang/knetty/pkg/ipfilter"
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/pkg/ratelimit"
+
+	"go.uber.org/atomic"
+	"golang.org/x/sys/unix"
+)
+
+// AcceptFunc decides by the remote address whether an accepted connection is served,
+// the connection is rejected before its session is created if a non-nil error is returned.
+type AcceptFunc func(remoteAddr netip.AddrPort) error
+
+// RejectMode how a rejected connection is closed.
+type RejectMode int
+
+const (
+	// RejectClose closes the rejected connection gracefully after writing the farewell payload if any.
+	RejectClose RejectMode = iota
+	// RejectReset resets the rejected connection with a RST.
+	RejectReset
+)
+
+// errIPDenied the remote ip is denied by the ip filter.
+var errIPDenied = errors.ConnRejectedErr("ip denied")
+
+// admissionOptions the admission control of the accepted connections, zero values mean unlimited.
+type admissionOptions struct {
+	maxConns      int
+	maxConnsPerIP int
+	acceptRate    float64
+	acceptBurst   int
+	ipFilter      *ipfilter.Filter
+	onAccept      AcceptFunc
+	rejectMode    RejectMode
+	farewell      []byte
+}
+
+// admission admits the accepted connections within the limits before their sessions are created.
+type admission struct {
+	admissionOptions
+	limiter *ratelimit.Limiter
+
+	mu         sync.Mutex
+	conns      int
+	connsPerIP map[netip.Addr]int
+	rejected   atomic.Uint64
+	denied     atomic.Uint64
+}
+
+func newAdmission(opts admissionOptions) *admission {
+	a := &admission{admissionOptions: opts, connsPerIP: make(map[netip.Addr]int)}
+	if opts.acceptRate > 0 {
+		a.limiter = ratelimit.New(opts.acceptRate, opts.acceptBurst)
+	}
+	return a
+}
+
+// admit implements listener.AdmitFunc, the admitted connections are counted until released.
+func (a *admission) admit(fd int, remoteAddr net.Addr) bool {
+	addr := addrPort(remoteAddr)
+	if err := a.acquire(addr); err != nil {
+		a.rejected.Inc()
+		if err == errIPDenied {
+			a.denied.Inc()
+		}
+		log.Log(log.DebugLevel, "server rejected conn", log.Any("remote_addr", addr), log.Err(err))
+		a.reject(fd)
+		return false
+	}
+
+	return true
+}
+
+func (a *admission) acquire(addr netip.AddrPort) error {
+	if a.ipFilter != nil && !a.ipFilter.Allowed(addr.Addr()) {
+		return errIPDenied
+	}
+	if a.onAccept != nil {
+		if err := a.onAccept(addr); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.maxConns > 0 && a.conns >= a.maxConns {
+		return errors.ConnRejectedErr("too many connections")
+	}
+	if a.maxConnsPerIP > 0 && a.connsPerIP[addr.Addr()] >= a.maxConnsPerIP {
+		return errors.ConnRejectedErr("too many connections from " + addr.Addr().String())
+	}
+	if a.limiter != nil && !a.limiter.Allow() {
+		return errors.ConnRejectedErr("accept rate exceeded")
+	}
+
+	a.conns++
+	a.connsPerIP[addr.Addr()]++
+	return nil
+}
+
+// release the connection admitted from ip.
+func (a *admission) release(ip netip.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conns--
+	if a.connsPerIP[ip]--; a.connsPerIP[ip] <= 0 {
+		delete(a.connsPerIP, ip)
+	}
+}
+
+func (a *admission) reject(fd int) {
+	if a.rejectMode == RejectReset {
+		// closing with a zero linger timeout aborts the connection with a RST.
+		_ = unix.SetsockoptLinger(fd, unix.SOL_SOCKET, unix.SO_LINGER, &unix.Linger{Onoff: 1, Linger: 0})
+		_ = unix.Close(fd)
+		return
+	}
+
+	// the farewell is small enough to fit in the empty send buffer of the new socket.
+	if len(a.farewell) > 0 {
+		_, _ = unix.Write(fd, a.farewell)
+	}
+	_ = unix.Shutdown(fd, unix.SHUT_WR)
+	_ = unix.Close(fd)
+}
+
+// addrPort return the ip and port of a tcp address, the IPv4-mapped IPv6 addresses are unmapped.
+func addrPort(addr net.Addr) netip.AddrPort {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.AddrPort{}
+	}
+
+	ap := tcpAddr.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
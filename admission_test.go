@@ -0,0 +1,288 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/pkg/ipfilter"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCodec struct{}
+
+func (nopCodec) Encode(pkg interface{}) ([]byte, error) {
+	return pkg.([]byte), nil
+}
+
+func (nopCodec) Decode(data []byte) (interface{}, int, error) {
+	return data, len(data), nil
+}
+
+type nopEventListener struct{}
+
+func (nopEventListener) OnConnect(session.Session) {}
+
+func (nopEventListener) OnMessage(session.Session, interface{}) session.ExecStatus {
+	return session.Normal
+}
+
+func (nopEventListener) OnError(session.Session, error) {}
+
+func (nopEventListener) OnClose(session.Session) {}
+
+func TestAdmission_Acquire(t *testing.T) {
+	a := newAdmission(admissionOptions{maxConns: 3, maxConnsPerIP: 2})
+	ip1, ip2 := netip.MustParseAddrPort("10.0.0.1:1000"), netip.MustParseAddrPort("[::1]:1000")
+	assert.Nil(t, a.acquire(ip1))
+	assert.Nil(t, a.acquire(ip1))
+	assert.NotNil(t, a.acquire(ip1))
+	assert.Nil(t, a.acquire(ip2))
+	// the global limit is reached.
+	assert.NotNil(t, a.acquire(ip2))
+
+	a.release(ip1.Addr())
+	assert.Nil(t, a.acquire(ip2))
+	assert.NotNil(t, a.acquire(ip1))
+	a.release(ip2.Addr())
+	a.release(ip2.Addr())
+	assert.Equal(t, map[netip.Addr]int{ip1.Addr(): 1}, a.connsPerIP)
+
+	errDenied := errors.New("denied")
+	a = newAdmission(admissionOptions{acceptRate: 1, acceptBurst: 1, onAccept: func(addr netip.AddrPort) error {
+		if addr == ip2 {
+			return errDenied
+		}
+		return nil
+	}})
+	assert.Equal(t, errDenied, a.acquire(ip2))
+	assert.Nil(t, a.acquire(ip1))
+	// the burst of the accept rate is used up.
+	assert.NotNil(t, a.acquire(ip1))
+
+	filter, err := ipfilter.New([]string{"10.0.0.0/24"}, nil)
+	assert.Nil(t, err)
+	a = newAdmission(admissionOptions{ipFilter: filter})
+	assert.Nil(t, a.acquire(ip1))
+	assert.Equal(t, errIPDenied, a.acquire(ip2))
+}
+
+// connectListener notify the connected sessions.
+type connectListener struct {
+	nopEventListener
+	connected chan struct{}
+}
+
+func (l connectListener) OnConnect(session.Session) {
+	l.connected <- struct{}{}
+}
+
+func TestServer_Admission(t *testing.T) {
+	connected := make(chan struct{}, 2)
+	server := serve(t, WithServerMaxConns(1), WithServerRejectMode(RejectClose, []byte("busy\n")),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			s.SetCodec(nopCodec{})
+			s.SetEventListener(connectListener{connected: connected})
+			return nil
+		}))
+	addr := server.Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	waitConnected(t, connected)
+	assert.Equal(t, 1, server.Stats().ActiveSessions)
+
+	// the connection beyond the limit reads the farewell before the graceful close.
+	rejected, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_ = rejected.SetReadDeadline(time.Now().Add(3 * time.Second))
+	data, err := io.ReadAll(rejected)
+	assert.Nil(t, err)
+	assert.Equal(t, "busy\n", string(data))
+	assert.Nil(t, rejected.Close())
+	assert.Equal(t, uint64(1), server.Stats().Rejected)
+
+	// the closed connection makes room for a new one.
+	assert.Nil(t, conn.Close())
+	waitSessionsClosed(server)
+	conn, err = net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	waitConnected(t, connected)
+	stats := server.Stats()
+	assert.Equal(t, 1, stats.ActiveSessions)
+	assert.Equal(t, uint64(2), stats.Accepts)
+	assert.Equal(t, uint64(1), stats.Rejected)
+}
+
+func TestServer_OnAccept(t *testing.T) {
+	server := serve(t, WithServerRejectMode(RejectReset, []byte("ignored")),
+		WithServerOnAccept(func(remoteAddr netip.AddrPort) error {
+			if !remoteAddr.Addr().IsLoopback() {
+				t.Errorf("unexpected remote address %s", remoteAddr)
+			}
+			return errors.New("denied")
+		}),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			t.Error("the session of the rejected connection is created")
+			return nil
+		}))
+
+	// the connection may be reset before the dial returns.
+	conn, err := net.Dial("tcp", server.Addr())
+	if err == nil {
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = conn.Read(make([]byte, 16))
+	}
+	assert.True(t, errors.Is(err, syscall.ECONNRESET), err)
+	assert.Equal(t, uint64(0), server.Stats().Accepts)
+	assert.Equal(t, uint64(1), server.Stats().Rejected)
+}
+
+func TestServer_NewSessionErr(t *testing.T) {
+	server := serve(t, WithServerMaxConns(1),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			return errors.New("setup failed")
+		}))
+
+	// the connection of the session failing to set up is closed, and its admission is released.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", server.Addr())
+		if !assert.Nil(t, err) {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = conn.Read(make([]byte, 16))
+		assert.Equal(t, io.EOF, err)
+		assert.Nil(t, conn.Close())
+	}
+	stats := server.Stats()
+	assert.Equal(t, uint64(2), stats.Accepts)
+	assert.Equal(t, uint64(0), stats.Rejected)
+}
+
+func TestServer_SessionRunErr(t *testing.T) {
+	// the session without codec fails to run.
+	server := serve(t, WithServerMaxConns(1),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			s.SetEventListener(nopEventListener{})
+			return nil
+		}))
+
+	// the connection of the session failing to run is closed, and its admission is released.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", server.Addr())
+		if !assert.Nil(t, err) {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = conn.Read(make([]byte, 16))
+		assert.Equal(t, io.EOF, err)
+		assert.Nil(t, conn.Close())
+	}
+	stats := server.Stats()
+	assert.Equal(t, uint64(2), stats.Accepts)
+	assert.Equal(t, uint64(0), stats.Rejected)
+	assert.Equal(t, 0, stats.ActiveSessions)
+}
+
+func TestServer_IPFilter(t *testing.T) {
+	filter, err := ipfilter.New(nil, []string{"127.0.0.0/8"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	connected := make(chan struct{}, 1)
+	server := serve(t, WithServerIPFilter(filter),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			s.SetCodec(nopCodec{})
+			s.SetEventListener(connectListener{connected: connected})
+			return nil
+		}))
+	addr := server.Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = conn.Read(make([]byte, 16))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, conn.Close())
+	stats := server.Stats()
+	assert.Equal(t, uint64(1), stats.Rejected)
+	assert.Equal(t, uint64(1), stats.Denied)
+
+	// the reloaded lists admit the next connection.
+	assert.Nil(t, filter.Update([]string{"127.0.0.1", "::1"}, nil))
+	conn, err = net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	waitConnected(t, connected)
+	stats = server.Stats()
+	assert.Equal(t, 1, stats.ActiveSessions)
+	assert.Equal(t, uint64(1), stats.Denied)
+}
+
+// serve run a server listening on a free port of the loopback, it is shut down when the test ends.
+func serve(t *testing.T, opts ...ServerOption) *Server {
+	server := NewServer("tcp", "127.0.0.1:0", opts...)
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = server.Server()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown(context.Background())
+	})
+	return server
+}
+
+func waitConnected(t *testing.T, connected <-chan struct{}) {
+	select {
+	case <-connected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the session is not connected")
+	}
+}
+
+// waitSessionsClosed wait for the server to forget the closed sessions, it happens after their listeners
+// are notified, so the statistics are polled.
+func waitSessionsClosed(server *Server) {
+	for i := 0; i < 300 && server.Stats().ActiveSessions != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -19,6 +19,7 @@ package knetty
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/Softwarekang/knetty/internal/net"
 	"github.com/Softwarekang/knetty/internal/net/connection"
@@ -31,8 +32,12 @@ import (
 type Client struct {
 	ClientOptions
 
-	session session.Session
-	closeCh chan struct{}
+	session  session.Session
+	loops    *poll.EventLoopGroup
+	ownLoops bool
+	closeCh  chan struct{}
+	// releaseLoops close the owned loops once, however the client ends.
+	releaseLoops sync.Once
 }
 
 // NewClient init the client
@@ -51,51 +56,98 @@ func NewClient(network, address string, opts ...ClientOption) *Client {
 	return c
 }
 
+// Run the client and block until the session is closed.
 func (c *Client) Run() error {
+	if _, err := c.Connect(); err != nil {
+		return err
+	}
+
+	c.waitQuit()
+	return nil
+}
+
+// Connect dial the server and run the session without blocking, the client quits when the session is closed.
+// the session is returned after it is registered in the poller, so the data can be written at once.
+func (c *Client) Connect() (session.Session, error) {
 	if !c.isActive() {
-		return errors.ClientClosedErr
+		return nil, errors.ClientClosedErr
 	}
 
 	switch c.network {
 	case "tcp":
-		return c.tcpEventloop()
+		return c.connectTcp()
 	default:
-		return fmt.Errorf("client not support network:%v", c.network)
+		return nil, fmt.Errorf("client not support network:%v", c.network)
 	}
 }
 
-func (c *Client) tcpEventloop() error {
+func (c *Client) connectTcp() (session.Session, error) {
 	conn, err := c.dicTcp()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	newSession := session.NewSession(conn)
 	newSession.SetCloseCallBackFunc(c.quit)
 	if err := c.newSession(newSession); err != nil {
-		return err
+		_ = conn.Close()
+		return nil, err
 	}
 
 	c.session = newSession
 	if err := newSession.Run(); err != nil {
-		log.Errorf("session run err:%s", err.Error())
-		return err
+		newSession.Logger().Log(log.ErrorLevel, "session run err", log.Err(err))
+		_ = conn.Close()
+		return nil, err
 	}
-	c.waitQuit()
-	return nil
+
+	// register the connection after the session runs, so the data arriving at once is handled by the session.
+	if err := conn.Register(poll.Read); err != nil {
+		_ = newSession.Close()
+		return nil, err
+	}
+
+	reportMetrics(c.metrics, c, c.closeCh)
+	return newSession, nil
 }
 
 func (c *Client) dicTcp() (connection.Connection, error) {
-	netConn, err := net.Dial(c.network, c.address)
-	if err != nil {
+	if err := c.initLoops(); err != nil {
 		return nil, err
 	}
 
-	if err := netConn.Register(poll.Read); err != nil {
-		return nil, err
+	return net.Dial(c.network, c.address, c.loops)
+}
+
+// initLoops create the loops serving the client once, the owned loops are kept for the next Connect if dialing
+// fails, and closed when the client quits.
+func (c *Client) initLoops() error {
+	if c.loops != nil {
+		return nil
 	}
 
-	return netConn, nil
+	loops, ownLoops, err := c.eventLoops.newLoops()
+	if err != nil {
+		return err
+	}
+
+	c.loops, c.ownLoops = loops, ownLoops
+	if ownLoops {
+		// the session may be closed on the event loop, so the loops are closed by another goroutine.
+		go func() {
+			c.waitQuit()
+			c.closeLoops()
+		}()
+	}
+	return nil
+}
+
+func (c *Client) closeLoops() {
+	c.releaseLoops.Do(func() {
+		if err := c.loops.Close(); err != nil {
+			log.Errorf("client close loops err:%v", err)
+		}
+	})
 }
 
 func (c *Client) waitQuit() {
@@ -122,11 +174,20 @@ func (c *Client) Shutdown(ctx context.Context) error {
 		case <-ctx.Done():
 			return fmt.Errorf("server shutdown caused by:%s", ctx.Err())
 		case <-c.closeCh:
+			// the session closed by the peer has quit the client, wait for the owned loops to be closed.
+			if c.ownLoops {
+				c.closeLoops()
+			}
 			return errors.ClientClosedErr
 		default:
 			c.quit(nil)
 			if c.session != nil {
-				return c.session.Close()
+				if err := c.session.Close(); err != nil {
+					return err
+				}
+			}
+			if c.ownLoops {
+				c.closeLoops()
 			}
 			return nil
 		}
@@ -0,0 +1,74 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	errors "github.com/Softwarekang/knetty/pkg/err"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ReleaseLoops(t *testing.T) {
+	lsr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer lsr.Close()
+	go func() {
+		// the peer closes the session at once.
+		if conn, err := lsr.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	client := NewClient("tcp", lsr.Addr().String(), WithClientEventLoops(1),
+		WithClientNewSessionCallBackFunc(func(s session.Session) error {
+			s.SetCodec(lineCodec{})
+			s.SetEventListener(nopEventListener{})
+			return nil
+		}))
+	assert.Nil(t, client.Run())
+	assert.Equal(t, errors.ClientClosedErr, client.Shutdown(context.Background()))
+	assert.Empty(t, client.loops.Stats())
+}
+
+func TestClient_ConnectRetry(t *testing.T) {
+	lsr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	addr := lsr.Addr().String()
+	assert.Nil(t, lsr.Close())
+
+	// the loops are created once and kept for the next Connect.
+	client := NewClient("tcp", addr, WithClientEventLoops(1))
+	_, err = client.Connect()
+	assert.NotNil(t, err)
+	loops := client.loops
+	_, err = client.Connect()
+	assert.NotNil(t, err)
+	assert.Same(t, loops, client.loops)
+	assert.Len(t, loops.Stats(), 1)
+
+	assert.Nil(t, client.Shutdown(context.Background()))
+	assert.Empty(t, loops.Stats())
+}
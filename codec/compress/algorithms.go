@@ -0,0 +1,173 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// maxZstdWindow the maximum window of the zstd frames, the frames of larger windows are rejected.
+const maxZstdWindow = 8 << 20
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderOnce sync.Once
+
+	zstdDecoders = sync.Pool{New: func() interface{} {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(maxZstdWindow))
+		return d
+	}}
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}
+	gzipReaders  sync.Pool
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	flateReaders = sync.Pool{New: func() interface{} {
+		return flate.NewReader(nil)
+	}}
+	lz4Compressors = sync.Pool{New: func() interface{} {
+		return &lz4.Compressor{}
+	}}
+)
+
+// compress return the compressed data, nil if the data is incompressible.
+func compress(algorithm Algorithm, data []byte) ([]byte, error) {
+	switch algorithm {
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	case Zstd:
+		zstdEncoderOnce.Do(func() {
+			// EncodeAll is safe for concurrent use.
+			zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		})
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case Gzip:
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		return compressStream(w, w.Reset, data)
+	case Deflate:
+		w := flateWriters.Get().(*flate.Writer)
+		defer flateWriters.Put(w)
+		return compressStream(w, w.Reset, data)
+	case LZ4:
+		c := lz4Compressors.Get().(*lz4.Compressor)
+		defer lz4Compressors.Put(c)
+		dst := make([]byte, lz4.CompressBlockBound(len(data)))
+		n, err := c.CompressBlock(data, dst)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		return dst[:n], nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+func compressStream(w io.WriteCloser, reset func(io.Writer), data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress return the decompressed payload, the decompressed data must be exactly size bytes,
+// the decompression stops after size bytes so the zip bombs never allocate more.
+func decompress(algorithm Algorithm, payload []byte, size int) ([]byte, error) {
+	switch algorithm {
+	case None:
+		return append(make([]byte, 0, size), payload...), nil
+	case Snappy:
+		if n, err := snappy.DecodedLen(payload); err != nil || n != size {
+			return nil, fmt.Errorf("%w: snappy decoded length", ErrMalformed)
+		}
+		data, err := snappy.Decode(make([]byte, size), payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return data, nil
+	case Zstd:
+		d := zstdDecoders.Get().(*zstd.Decoder)
+		defer func() {
+			_ = d.Reset(nil)
+			zstdDecoders.Put(d)
+		}()
+		if err := d.Reset(bytes.NewReader(payload)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return readExactly(d, size)
+	case Gzip:
+		r, _ := gzipReaders.Get().(*gzip.Reader)
+		var err error
+		if r == nil {
+			r, err = gzip.NewReader(bytes.NewReader(payload))
+		} else {
+			err = r.Reset(bytes.NewReader(payload))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		defer gzipReaders.Put(r)
+		return readExactly(r, size)
+	case Deflate:
+		r := flateReaders.Get().(io.ReadCloser)
+		defer flateReaders.Put(r)
+		if err := r.(flate.Resetter).Reset(bytes.NewReader(payload), nil); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return readExactly(r, size)
+	case LZ4:
+		data := make([]byte, size)
+		n, err := lz4.UncompressBlock(payload, data)
+		if err != nil || n != size {
+			return nil, fmt.Errorf("%w: lz4 block", ErrMalformed)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+}
+
+// readExactly read size bytes from r, and make sure r has no more data.
+func readExactly(r io.Reader, size int) ([]byte, error) {
+	data := make([]byte, size+1)
+	n, err := io.ReadFull(r, data)
+	switch {
+	case n > size:
+		return nil, fmt.Errorf("%w: decompressed data exceeds the declared size %d", ErrMalformed, size)
+	case n < size || err != io.ErrUnexpectedEOF && err != io.EOF:
+		return nil, fmt.Errorf("%w: decompressed %d of %d bytes: %v", ErrMalformed, n, size, err)
+	}
+	return data[:size], nil
+}
@@ -0,0 +1,177 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package compress impl the compression stage of the sessions, each message or each written chunk of the
+// byte stream is compressed independently into a frame carrying the algorithm and the sizes, so the receiver
+// decodes any supported algorithm and checks the decompressed size before decompressing.
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Algorithm the compression algorithm of the frames.
+type Algorithm byte
+
+const (
+	// None the payload is stored without compression.
+	None Algorithm = iota
+	Snappy
+	Zstd
+	Gzip
+	Deflate
+	LZ4
+)
+
+var algorithmNames = [...]string{"none", "snappy", "zstd", "gzip", "deflate", "lz4"}
+
+// String implements fmt.Stringer.
+func (a Algorithm) String() string {
+	if int(a) < len(algorithmNames) {
+		return algorithmNames[a]
+	}
+	return fmt.Sprintf("unknown(%d)", byte(a))
+}
+
+const (
+	// DefaultMinSize the default minimum size of the payloads to compress.
+	DefaultMinSize = 256
+	// DefaultMaxDecompressedSize the default maximum decompressed size of a frame.
+	DefaultMaxDecompressedSize = 4 << 20
+)
+
+var (
+	// ErrMalformed the frame violates the format.
+	ErrMalformed = errors.New("compress: malformed frame")
+	// ErrTooLarge the decompressed size of the frame exceeds the limit.
+	ErrTooLarge = errors.New("compress: decompressed size exceeds the limit")
+	// ErrUnsupportedAlgorithm the algorithm of the frame is unknown.
+	ErrUnsupportedAlgorithm = errors.New("compress: unsupported algorithm")
+)
+
+// Option option for the compression stage.
+type Option func(*Options)
+
+// Options options for the compression stage.
+type Options struct {
+	// Algorithm the algorithm compressing the outbound payloads, None disables the outbound compression,
+	// the inbound frames of all the algorithms are accepted.
+	Algorithm Algorithm
+	// MinSize the payloads smaller than MinSize are stored without compression
+	MinSize int
+	// MaxDecompressedSize the maximum decompressed size of the inbound frames
+	MaxDecompressedSize int
+}
+
+// WithAlgorithm set the algorithm of the outbound payloads, default Snappy.
+func WithAlgorithm(algorithm Algorithm) Option {
+	return func(opt *Options) {
+		opt.Algorithm = algorithm
+	}
+}
+
+// WithMinSize set the minimum size of the payloads to compress.
+func WithMinSize(n int) Option {
+	return func(opt *Options) {
+		if n >= 0 {
+			opt.MinSize = n
+		}
+	}
+}
+
+// WithMaxDecompressedSize set the maximum decompressed size of the inbound frames, it protects against the zip bombs.
+func WithMaxDecompressedSize(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxDecompressedSize = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{Algorithm: Snappy, MinSize: DefaultMinSize, MaxDecompressedSize: DefaultMaxDecompressedSize}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// appendFrame append the frame of the payload to dst, the frame is
+// algorithm(1 byte) | decompressed size(uvarint) | payload size(uvarint) | payload.
+// the payload is stored if it is smaller than MinSize or the compression does not reduce its size.
+func appendFrame(dst, data []byte, options *Options) ([]byte, error) {
+	algorithm, payload := None, data
+	if options.Algorithm != None && len(data) >= options.MinSize && len(data) > 0 {
+		compressed, err := compress(options.Algorithm, data)
+		if err != nil {
+			return nil, err
+		}
+		if compressed != nil && len(compressed) < len(data) {
+			algorithm, payload = options.Algorithm, compressed
+		}
+	}
+
+	dst = append(dst, byte(algorithm))
+	dst = appendUvarint(dst, uint64(len(data)))
+	dst = appendUvarint(dst, uint64(len(payload)))
+	return append(dst, payload...), nil
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(dst, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// parseFrame parse the frame at the beginning of data, return the decompressed payload and the frame length,
+// or nil,0,nil if data is not a whole frame.
+func parseFrame(data []byte, options *Options) ([]byte, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	algorithm := Algorithm(data[0])
+	size, n := binary.Uvarint(data[1:])
+	if n == 0 {
+		return nil, 0, nil
+	}
+	if n < 0 {
+		return nil, 0, ErrMalformed
+	}
+	if size > uint64(options.MaxDecompressedSize) {
+		return nil, 0, fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+	offset := 1 + n
+	payloadSize, n := binary.Uvarint(data[offset:])
+	if n == 0 {
+		return nil, 0, nil
+	}
+	// the payload is only compressed when the compression reduces its size.
+	if n < 0 || payloadSize > size || algorithm == None && payloadSize != size {
+		return nil, 0, ErrMalformed
+	}
+	offset += n
+	if uint64(len(data)-offset) < payloadSize {
+		return nil, 0, nil
+	}
+	end := offset + int(payloadSize)
+
+	plain, err := decompress(algorithm, data[offset:end], int(size))
+	if err != nil {
+		return nil, 0, err
+	}
+	return plain, end, nil
+}
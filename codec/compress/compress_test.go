@@ -0,0 +1,159 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var algorithms = []Algorithm{None, Snappy, Zstd, Gzip, Deflate, LZ4}
+
+func TestFrame(t *testing.T) {
+	text := []byte(strings.Repeat("knetty compression ", 100))
+	for _, algorithm := range algorithms {
+		options := newOptions(WithAlgorithm(algorithm))
+		frame, err := appendFrame(nil, text, options)
+		assert.Nil(t, err)
+		assert.Equal(t, algorithm, Algorithm(frame[0]), algorithm.String())
+		if algorithm != None {
+			assert.Less(t, len(frame), len(text)/2, algorithm.String())
+		}
+
+		// the half frames.
+		for i := 0; i < len(frame); i++ {
+			plain, n, err := parseFrame(frame[:i], options)
+			assert.Nil(t, err)
+			assert.Nil(t, plain)
+			assert.Equal(t, 0, n)
+		}
+		plain, n, err := parseFrame(append(frame, 0), options)
+		assert.Nil(t, err)
+		assert.Equal(t, len(frame), n)
+		assert.Equal(t, text, plain, algorithm.String())
+	}
+
+	// the small and the incompressible payloads are stored.
+	frame, err := appendFrame(nil, []byte("small"), newOptions(WithAlgorithm(Zstd)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{byte(None), 5, 5, 's', 'm', 'a', 'l', 'l'}, frame)
+	random := make([]byte, 1024)
+	for i := range random {
+		random[i] = byte(i*7919>>3) ^ byte(i*31)
+	}
+	frame, err = appendFrame(nil, random, newOptions(WithAlgorithm(Gzip), WithMinSize(0)))
+	assert.Nil(t, err)
+	assert.Equal(t, None, Algorithm(frame[0]))
+}
+
+func TestFrame_Limits(t *testing.T) {
+	bomb := make([]byte, 1<<20)
+	for _, algorithm := range algorithms[1:] {
+		compressed, err := compress(algorithm, bomb)
+		assert.Nil(t, err)
+
+		// the declared size exceeds the limit.
+		frame := append(appendUvarint(appendUvarint([]byte{byte(algorithm)}, 1<<20), uint64(len(compressed))), compressed...)
+		_, _, err = parseFrame(frame, newOptions(WithMaxDecompressedSize(64<<10)))
+		assert.True(t, errors.Is(err, ErrTooLarge), algorithm.String())
+
+		// the declared size lies.
+		frame = append(appendUvarint(appendUvarint([]byte{byte(algorithm)}, 64<<10), uint64(len(compressed))), compressed...)
+		_, _, err = parseFrame(frame, newOptions(WithMaxDecompressedSize(64<<10)))
+		assert.True(t, errors.Is(err, ErrMalformed), algorithm.String())
+	}
+
+	_, _, err := parseFrame([]byte{9, 1, 1, 0}, newOptions())
+	assert.True(t, errors.Is(err, ErrUnsupportedAlgorithm))
+	_, _, err = parseFrame([]byte{byte(None), 1, 2, 0, 0}, newOptions())
+	assert.True(t, errors.Is(err, ErrMalformed))
+	_, _, err = parseFrame([]byte{byte(Gzip), 3, 2, 0, 0}, newOptions())
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
+
+func TestCodec(t *testing.T) {
+	line := strings.Repeat("abc", 200)
+	for _, algorithm := range algorithms {
+		codec := NewCodec(knettytest.LineCodec{}, WithAlgorithm(algorithm))
+		data, err := codec.Encode(line)
+		assert.Nil(t, err)
+		pkg, n, err := codec.Decode(append(data, data...))
+		assert.Nil(t, err)
+		assert.Equal(t, len(data), n)
+		assert.Equal(t, line, pkg)
+	}
+
+	// the frame of half a message.
+	frame, err := appendFrame(nil, []byte("half"), newOptions())
+	assert.Nil(t, err)
+	_, _, err = NewCodec(knettytest.LineCodec{}).Decode(frame)
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
+
+func TestHandler(t *testing.T) {
+	addr := knettytest.Serve(t, func(s session.Session) error {
+		s.SetEventListener(knettytest.EchoListener{})
+		if err := s.Pipeline().AddLast("compress", NewHandler(WithAlgorithm(Zstd), WithMinSize(16))); err != nil {
+			return err
+		}
+		return s.Pipeline().AddLast("codec", session.NewCodecHandler(knettytest.LineCodec{}))
+	}).Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// the messages span the frames.
+	long := strings.Repeat("zstd ", 100)
+	options := newOptions(WithAlgorithm(Snappy), WithMinSize(16))
+	var data []byte
+	for _, chunk := range []string{"hi\n" + long[:200], long[200:] + "\nbye\n"} {
+		if data, err = appendFrame(data, []byte(chunk), options); !assert.Nil(t, err) {
+			return
+		}
+	}
+	_, err = conn.Write(data)
+	assert.Nil(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	reader := bufio.NewReader(conn)
+	var buf, stream []byte
+	for strings.Count(string(stream), "\n") < 3 {
+		b, err := reader.ReadByte()
+		if !assert.Nil(t, err) {
+			return
+		}
+		buf = append(buf, b)
+		plain, n, err := parseFrame(buf, newOptions())
+		assert.Nil(t, err)
+		if n > 0 {
+			stream, buf = append(stream, plain...), buf[n:]
+		}
+	}
+	assert.Equal(t, "hi\n"+long+"\nbye\n", string(stream))
+}
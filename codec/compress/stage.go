@@ -0,0 +1,125 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package compress
+
+import (
+	"fmt"
+
+	"github.com/Softwarekang/knetty/session"
+)
+
+// Codec the framed mode, it compresses each message encoded by the inner codec into a frame,
+// and decodes the decompressed frame by the inner codec, which must be a whole message.
+type Codec struct {
+	codec   session.Codec
+	options *Options
+}
+
+// NewCodec return the compression codec around codec.
+func NewCodec(codec session.Codec, opts ...Option) *Codec {
+	return &Codec{codec: codec, options: newOptions(opts...)}
+}
+
+// Encode implements session.Codec.
+func (c *Codec) Encode(pkg interface{}) ([]byte, error) {
+	data, err := c.codec.Encode(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return appendFrame(nil, data, c.options)
+}
+
+// Decode implements session.Codec.
+func (c *Codec) Decode(data []byte) (interface{}, int, error) {
+	plain, n, err := parseFrame(data, c.options)
+	if err != nil || n == 0 {
+		return nil, 0, err
+	}
+	pkg, pkgLen, err := c.codec.Decode(plain)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pkg == nil || pkgLen != len(plain) {
+		return nil, 0, fmt.Errorf("%w: the frame is not a whole message", ErrMalformed)
+	}
+	return pkg, n, nil
+}
+
+// handler the streaming mode, it works on the byte stream of the pipeline.
+type handler struct {
+	options *Options
+	// cumulation the inbound data not yet parsed as a whole frame.
+	cumulation []byte
+}
+
+// NewHandler return the pipeline stage of the streaming mode, it compresses each []byte written to the network
+// into a frame and passes the decompressed bytes of the inbound frames as a stream, the messages may span frames.
+// the session must have no codec, the codec is added behind the stage by session.NewCodecHandler:
+//
+//	s.Pipeline().AddLast("compress", compress.NewHandler(compress.WithAlgorithm(compress.Zstd)))
+//	s.Pipeline().AddLast("codec", session.NewCodecHandler(codec))
+func NewHandler(opts ...Option) session.Handler {
+	return &handler{options: newOptions(opts...)}
+}
+
+// HandleRead implements session.InboundHandler.
+func (h *handler) HandleRead(ctx session.HandlerContext, msg interface{}) error {
+	data, ok := msg.([]byte)
+	if !ok {
+		return ctx.FireRead(msg)
+	}
+
+	if len(h.cumulation) > 0 {
+		data = append(h.cumulation, data...)
+	}
+	for len(data) > 0 {
+		plain, n, err := parseFrame(data, h.options)
+		if err != nil {
+			h.cumulation = nil
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		data = data[n:]
+		if len(plain) == 0 {
+			continue
+		}
+		if err := ctx.FireRead(plain); err != nil {
+			h.cumulation = append(h.cumulation[:0], data...)
+			return err
+		}
+	}
+
+	// copy the half frame, data may be reused by the previous handler.
+	h.cumulation = append(h.cumulation[:0], data...)
+	return nil
+}
+
+// HandleWrite implements session.OutboundHandler.
+func (h *handler) HandleWrite(ctx session.HandlerContext, msg interface{}) error {
+	data, ok := msg.([]byte)
+	if !ok {
+		return fmt.Errorf("compress handler can't write %T, add the codec behind the handler", msg)
+	}
+	frame, err := appendFrame(nil, data, h.options)
+	if err != nil {
+		return err
+	}
+	return ctx.Write(frame)
+}
@@ -0,0 +1,432 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Softwarekang/knetty"
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/session"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost the default maximum idle connections kept for each host.
+	DefaultMaxIdleConnsPerHost = 2
+	// DefaultIdleConnTimeout the default time an idle connection is kept.
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+var (
+	// ErrClientClosed the client is closed.
+	ErrClientClosed = errors.New("http client closed")
+	// ErrConnClosed the connection is closed before the response is received.
+	ErrConnClosed = errors.New("http connection closed before response")
+)
+
+// ClientOption option for Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	codecOptions        []Option
+	knettyOptions       []knetty.ClientOption
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	timeout             time.Duration
+}
+
+// WithCodecOptions set the options for the codecs of the connections.
+func WithCodecOptions(opts ...Option) ClientOption {
+	return func(opt *clientOptions) {
+		opt.codecOptions = opts
+	}
+}
+
+// WithKnettyClientOptions set the options for the knetty clients of the connections, e.g. the event loops.
+func WithKnettyClientOptions(opts ...knetty.ClientOption) ClientOption {
+	return func(opt *clientOptions) {
+		opt.knettyOptions = opts
+	}
+}
+
+// WithMaxIdleConnsPerHost set the maximum idle connections kept for each host, 0 means no connection is reused.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(opt *clientOptions) {
+		opt.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout set the time an idle connection is kept.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(opt *clientOptions) {
+		opt.idleConnTimeout = d
+	}
+}
+
+// WithRequestTimeout set the timeout of each request including dialing and reading the response,
+// 0 means the request is only limited by its context.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(opt *clientOptions) {
+		opt.timeout = d
+	}
+}
+
+// Client an HTTP/1.1 client over knetty sessions, the connections are served by the knetty event loops,
+// and the idle connections to the same address are reused.
+// Client implements http.RoundTripper, so it can be used as the Transport of http.Client.
+type Client struct {
+	options clientOptions
+	mu      sync.Mutex
+	idle    map[string][]*clientConn
+	closed  bool
+}
+
+// NewClient return a client with opts.
+func NewClient(opts ...ClientOption) *Client {
+	options := clientOptions{maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost, idleConnTimeout: DefaultIdleConnTimeout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Client{options: options, idle: make(map[string][]*clientConn)}
+}
+
+// Do send req to addr and return the response, the Host of req is addr if it is empty.
+func (c *Client) Do(ctx context.Context, addr string, req *Request) (*Response, error) {
+	if c.options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.timeout)
+		defer cancel()
+	}
+
+	if req.Host == "" {
+		req.Host = addr
+	}
+
+	for {
+		conn, reused, err := c.getConn(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := conn.roundTrip(ctx, req)
+		// the idle connection may be closed by the server before the request, retry the idempotent request.
+		if errors.Is(err, ErrConnClosed) && reused && idempotent(req.Method) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Close || req.Close {
+			conn.close()
+		} else {
+			c.putConn(conn)
+		}
+		return resp, nil
+	}
+}
+
+// RoundTrip implements http.RoundTripper, only the http scheme is supported.
+func (c *Client) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "http" {
+		closeBody(r)
+		return nil, fmt.Errorf("http1: unsupported protocol scheme %q", r.URL.Scheme)
+	}
+
+	req := &Request{
+		Method:     r.Method,
+		RequestURI: r.URL.RequestURI(),
+		Proto:      "HTTP/1.1",
+		Header:     r.Header.Clone(),
+		Host:       r.Host,
+		Close:      r.Close,
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if req.Host == "" {
+		req.Host = r.URL.Host
+	}
+
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		closeBody(r)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	resp, err := c.Do(r.Context(), canonicalAddr(r.URL.Host), req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, resp.Status),
+		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        resp.Header,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: resp.ContentLength,
+		Close:         resp.Close,
+		Trailer:       resp.Trailer,
+		Request:       r,
+	}
+	if resp.Chunked {
+		httpResp.TransferEncoding = []string{"chunked"}
+	}
+	return httpResp, nil
+}
+
+// CloseIdleConnections close the idle connections.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = make(map[string][]*clientConn)
+	c.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, conn := range conns {
+			conn.close()
+		}
+	}
+}
+
+// Close the client and its idle connections, the requests in flight are not affected.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.CloseIdleConnections()
+	return nil
+}
+
+// getConn return an idle connection to addr or dial a new one, reused is true if the connection is idle.
+func (c *Client) getConn(ctx context.Context, addr string) (conn *clientConn, reused bool, err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false, ErrClientClosed
+	}
+
+	var expired []*clientConn
+	for conns := c.idle[addr]; len(conns) > 0; conns = c.idle[addr] {
+		conn, c.idle[addr] = conns[len(conns)-1], conns[:len(conns)-1]
+		if !conn.isClosed() && time.Since(conn.idleAt) < c.options.idleConnTimeout {
+			break
+		}
+		expired, conn = append(expired, conn), nil
+	}
+	c.mu.Unlock()
+
+	for _, conn := range expired {
+		conn.close()
+	}
+	if conn != nil {
+		return conn, true, nil
+	}
+
+	conn, err = c.dial(ctx, addr)
+	return conn, false, err
+}
+
+func (c *Client) putConn(conn *clientConn) {
+	c.mu.Lock()
+	if !c.closed && !conn.isClosed() && len(c.idle[conn.addr]) < c.options.maxIdleConnsPerHost {
+		conn.idleAt = time.Now()
+		c.idle[conn.addr] = append(c.idle[conn.addr], conn)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	conn.close()
+}
+
+func (c *Client) dial(ctx context.Context, addr string) (*clientConn, error) {
+	conn := &clientConn{
+		addr:      addr,
+		codec:     NewClientCodec(c.options.codecOptions...),
+		responses: make(chan *Response, 1),
+		done:      make(chan struct{}),
+	}
+	opts := append([]knetty.ClientOption{knetty.WithClientNewSessionCallBackFunc(func(s session.Session) error {
+		s.SetCodec(conn.codec)
+		s.SetEventListener(conn)
+		return nil
+	})}, c.options.knettyOptions...)
+	client := knetty.NewClient("tcp", addr, opts...)
+
+	type result struct {
+		session session.Session
+		err     error
+	}
+	connected := make(chan result, 1)
+	go func() {
+		s, err := client.Connect()
+		connected <- result{session: s, err: err}
+	}()
+
+	select {
+	case r := <-connected:
+		if r.err != nil {
+			// release the loops the client may own.
+			_ = client.Shutdown(context.Background())
+			return nil, r.err
+		}
+		conn.client, conn.session = client, r.session
+		return conn, nil
+	case <-ctx.Done():
+		// close the connection established after the request is canceled.
+		go func() {
+			<-connected
+			_ = client.Shutdown(context.Background())
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// clientConn a connection of the client, at most one request is in flight.
+type clientConn struct {
+	addr      string
+	client    *knetty.Client
+	session   session.Session
+	codec     *ClientCodec
+	responses chan *Response
+	done      chan struct{}
+	closeOnce sync.Once
+	idleAt    time.Time
+}
+
+func (c *clientConn) roundTrip(ctx context.Context, req *Request) (*Response, error) {
+	if _, err := c.session.WritePkg(req); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	if err := c.session.FlushBuffer(); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	select {
+	case resp := <-c.responses:
+		return resp, nil
+	case <-c.done:
+		// the response delimited by closing the connection is delivered before done.
+		select {
+		case resp := <-c.responses:
+			return resp, nil
+		default:
+			return nil, ErrConnClosed
+		}
+	case <-ctx.Done():
+		c.close()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *clientConn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close the connection, the client releases its loops by itself if the connection is closed by the server.
+func (c *clientConn) close() {
+	_ = c.client.Shutdown(context.Background())
+}
+
+// OnConnect implements session.EventListener.
+func (c *clientConn) OnConnect(session.Session) {}
+
+// OnMessage implements session.EventListener.
+func (c *clientConn) OnMessage(_ session.Session, pkg interface{}) session.ExecStatus {
+	resp, ok := pkg.(*Response)
+	// the body parts and the informational responses are skipped.
+	if !ok || (resp.StatusCode >= 100 && resp.StatusCode <= 199 && resp.StatusCode != http.StatusSwitchingProtocols) {
+		return session.Normal
+	}
+
+	c.deliver(resp)
+	return session.Normal
+}
+
+// OnError implements session.EventListener.
+func (c *clientConn) OnError(s session.Session, e error) {
+	log.Errorf("http client session:%s err:%v", s.Info(), e)
+	_ = s.Close()
+}
+
+// OnClose implements session.EventListener.
+func (c *clientConn) OnClose(session.Session) {
+	c.closeOnce.Do(func() {
+		if resp := c.codec.Finish(); resp != nil {
+			c.deliver(resp)
+		}
+		close(c.done)
+	})
+}
+
+func (c *clientConn) deliver(resp *Response) {
+	select {
+	case c.responses <- resp:
+	default:
+		log.Warnf("http client drop the unexpected response from:%s", c.addr)
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		_ = r.Body.Close()
+	}
+}
+
+// canonicalAddr return host:port of the host in url, the port is 80 by default.
+func canonicalAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), "80")
+}
@@ -0,0 +1,171 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// bodyPart the decoded pkg of the body data delimited by closing the connection,
+// the whole response is returned by ClientCodec.Finish after the connection is closed.
+type bodyPart struct{}
+
+// ClientCodec the codec of the HTTP/1.1 client session, it encodes *Request and decodes *Response.
+// the responses are matched with the requests in order, so the response of HEAD is decoded without body.
+type ClientCodec struct {
+	options Options
+	mu      sync.Mutex
+	// methods the methods of the requests waiting for responses
+	methods []string
+	// reading the response whose body is delimited by closing the connection
+	reading *Response
+}
+
+// NewClientCodec return a client codec with opts.
+func NewClientCodec(opts ...Option) *ClientCodec {
+	return &ClientCodec{options: newOptions(opts...)}
+}
+
+// Encode implements session.Codec, pkg must be *Request or []byte.
+func (c *ClientCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch pkg := pkg.(type) {
+	case *Request:
+		c.mu.Lock()
+		c.methods = append(c.methods, pkg.Method)
+		c.mu.Unlock()
+		return pkg.Append(nil), nil
+	case []byte:
+		return pkg, nil
+	default:
+		return nil, malformed("unsupported request type %T", pkg)
+	}
+}
+
+// Decode implements session.Codec.
+func (c *ClientCodec) Decode(data []byte) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reading != nil {
+		if len(c.reading.Body)+len(data) > c.options.MaxBodyBytes {
+			return nil, 0, ErrBodyTooLarge
+		}
+		c.reading.Body = append(c.reading.Body, data...)
+		return bodyPart{}, len(data), nil
+	}
+
+	startLine, headerLines, n, ok, err := splitHead(data, c.options.MaxHeaderBytes)
+	if err != nil || !ok {
+		return nil, 0, err
+	}
+
+	resp := &Response{Header: make(http.Header)}
+	if err := resp.parseStatusLine(startLine); err != nil {
+		return nil, 0, err
+	}
+
+	if err := parseHeaders(headerLines, resp.Header); err != nil {
+		return nil, 0, err
+	}
+
+	// the informational responses precede the final response of the request.
+	if resp.StatusCode >= 100 && resp.StatusCode <= 199 && resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, n, nil
+	}
+
+	length, chunked, err := bodyLength(resp.Header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var method string
+	if len(c.methods) > 0 {
+		method = c.methods[0]
+	}
+	resp.Close = shouldClose(resp.ProtoMajor, resp.ProtoMinor, resp.Header)
+	switch {
+	case method == http.MethodHead || !bodyAllowed(resp.StatusCode):
+		resp.ContentLength = length
+	case chunked:
+		body, trailer, bodyLen, ok, err := parseChunked(data[n:], c.options.MaxBodyBytes)
+		if err != nil || !ok {
+			return nil, 0, err
+		}
+		resp.ContentLength, resp.Chunked, resp.Body, resp.Trailer = -1, true, body, trailer
+		n += bodyLen
+	case length > int64(c.options.MaxBodyBytes):
+		return nil, 0, ErrBodyTooLarge
+	case length >= 0:
+		if int64(len(data)-n) < length {
+			return nil, 0, nil
+		}
+		resp.ContentLength, resp.Body = length, append([]byte{}, data[n:n+int(length)]...)
+		n += int(length)
+	default:
+		// the body is delimited by closing the connection.
+		if len(data)-n > c.options.MaxBodyBytes {
+			return nil, 0, ErrBodyTooLarge
+		}
+		resp.ContentLength, resp.Close, resp.Body = -1, true, append([]byte{}, data[n:]...)
+		c.reading, n = resp, len(data)
+	}
+
+	if len(c.methods) > 0 {
+		c.methods = c.methods[1:]
+	}
+
+	if c.reading != nil {
+		return bodyPart{}, n, nil
+	}
+	return resp, n, nil
+}
+
+// Finish return the response whose body is delimited by closing the connection, it should be called
+// after the session is closed, nil means there is no such response.
+func (c *ClientCodec) Finish() *Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp := c.reading
+	c.reading = nil
+	return resp
+}
+
+func (r *Response) parseStatusLine(line []byte) error {
+	proto, rest, ok := cut(line, ' ')
+	if !ok {
+		return malformed("invalid status line %q", line)
+	}
+
+	code, reason, _ := cut(rest, ' ')
+	major, minor, ok := http.ParseHTTPVersion(string(proto))
+	if !ok || major != 1 {
+		return malformed("unsupported protocol %q", proto)
+	}
+
+	status, err := strconv.Atoi(string(code))
+	if err != nil || len(code) != 3 || status < 100 {
+		return malformed("invalid status code %q", code)
+	}
+
+	r.Proto, r.ProtoMajor, r.ProtoMinor, r.StatusCode, r.Status = string(proto), major, minor, status, string(reason)
+	return nil
+}
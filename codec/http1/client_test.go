@@ -0,0 +1,124 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var remotes []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remotes = append(remotes, r.RemoteAddr)
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/chunked":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte("chunked "))
+			_, _ = w.Write(body)
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		default:
+			w.Header().Set("X-Method", r.Method)
+			_, _ = w.Write(body)
+		}
+	}))
+	defer backend.Close()
+
+	client := NewClient(WithRequestTimeout(200 * time.Millisecond))
+	defer client.Close()
+	addr := strings.TrimPrefix(backend.URL, "http://")
+
+	resp, err := client.Do(context.Background(), addr, &Request{Method: http.MethodPost, RequestURI: "/", Body: []byte("hello")})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "POST", resp.Header.Get("X-Method"))
+	assert.Equal(t, "hello", string(resp.Body))
+
+	resp, err = client.Do(context.Background(), addr, &Request{Method: http.MethodPost, RequestURI: "/chunked", Body: []byte("body")})
+	assert.Nil(t, err)
+	assert.True(t, resp.Chunked)
+	assert.Equal(t, "chunked body", string(resp.Body))
+
+	resp, err = client.Do(context.Background(), addr, &Request{Method: http.MethodHead, RequestURI: "/", Header: http.Header{}})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Body)
+
+	// the connection is reused.
+	assert.Len(t, remotes, 3)
+	assert.Equal(t, remotes[0], remotes[1])
+	assert.Equal(t, remotes[0], remotes[2])
+
+	_, err = client.Do(context.Background(), addr, &Request{Method: http.MethodGet, RequestURI: "/slow"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_CloseDelimited(t *testing.T) {
+	lsr, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsr.Close()
+	go func() {
+		for {
+			conn, err := lsr.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 1024)
+			_, _ = conn.Read(buf)
+			_, _ = conn.Write([]byte("HTTP/1.0 200 OK\r\n\r\nclose "))
+			time.Sleep(10 * time.Millisecond)
+			_, _ = conn.Write([]byte("delimited"))
+			_ = conn.Close()
+		}
+	}()
+
+	client := NewClient()
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Do(context.Background(), lsr.Addr().String(), &Request{Method: http.MethodGet})
+		assert.Nil(t, err)
+		assert.True(t, resp.Close)
+		assert.Equal(t, "close delimited", string(resp.Body))
+	}
+}
+
+func TestClient_RoundTrip(t *testing.T) {
+	addr := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + r.URL.RequestURI()))
+	}))
+
+	client := NewClient()
+	defer client.Close()
+	httpClient := &http.Client{Transport: client}
+	resp, err := httpClient.Get("http://" + addr + "/a?b=1")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "200 OK", resp.Status)
+	assert.Equal(t, addr+"/a?b=1", string(body))
+
+	_, err = httpClient.Get("https://" + addr)
+	assert.NotNil(t, err)
+}
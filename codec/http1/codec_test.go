@@ -0,0 +1,156 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerCodec_Decode(t *testing.T) {
+	codec := NewServerCodec()
+
+	// half package.
+	pkg, n, err := codec.Decode([]byte("GET / HTTP/1.1\r\nHost: a"))
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	data := []byte("\r\nGET /index?a=1 HTTP/1.1\r\nHost: example.com\r\nX-Id:  1 \r\nX-Id: 2\r\n\r\n")
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	req := pkg.(*Request)
+	assert.Equal(t, "GET", req.Method)
+	assert.Equal(t, "/index?a=1", req.RequestURI)
+	assert.Equal(t, "example.com", req.Host)
+	assert.Equal(t, []string{"1", "2"}, req.Header["X-Id"])
+	assert.False(t, req.Close)
+	assert.Empty(t, req.Body)
+
+	// pipelined requests with Content-Length.
+	data = []byte("POST /a HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET /b HTTP/1.0\r\n\r\n")
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(pkg.(*Request).Body))
+	pkg, _, err = codec.Decode(data[n:])
+	assert.Nil(t, err)
+	assert.Equal(t, "/b", pkg.(*Request).RequestURI)
+	// HTTP/1.0 closes the connection by default.
+	assert.True(t, pkg.(*Request).Close)
+
+	// chunked body with trailer.
+	data = []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n6\r\n world\r\n0\r\nX-Sum: 1\r\n\r\n")
+	for i := 1; i < len(data); i++ {
+		pkg, _, err = codec.Decode(data[:i])
+		assert.Nil(t, pkg)
+		assert.Nil(t, err)
+	}
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	req = pkg.(*Request)
+	assert.True(t, req.Chunked)
+	assert.Equal(t, "hello world", string(req.Body))
+	assert.Equal(t, "1", req.Trailer.Get("X-Sum"))
+}
+
+func TestServerCodec_DecodeErr(t *testing.T) {
+	for name, data := range map[string]string{
+		"request line":      "GET /\r\n\r\n",
+		"protocol":          "GET / HTTP/2.0\r\n\r\n",
+		"header":            "GET / HTTP/1.1\r\nbad header\r\n\r\n",
+		"folding":           "GET / HTTP/1.1\r\nA: 1\r\n 2\r\n\r\n",
+		"content length":    "POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n",
+		"transfer encoding": "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+		"chunk size":        "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nz\r\n",
+	} {
+		_, _, err := NewServerCodec().Decode([]byte(data))
+		assert.ErrorIs(t, err, ErrMalformed, name)
+	}
+
+	_, _, err := NewServerCodec(WithMaxHeaderBytes(8)).Decode([]byte("GET / HTTP/1.1\r\n"))
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+	_, _, err = NewServerCodec(WithMaxBodyBytes(4)).Decode([]byte("POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	// the huge chunk size following the data.
+	_, _, err = NewServerCodec().Decode([]byte(hugeChunkRequest))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+const hugeChunkRequest = "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n1\r\na\r\n7fffffffffffffff\r\nxx"
+
+// FuzzH1C the server codec never panics, and the decoded length is within the data.
+func FuzzH1C(f *testing.F) {
+	for _, seed := range []string{
+		"GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 2\r\n\r\nhi",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nX-Sum: 1\r\n\r\n",
+		hugeChunkRequest,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, n, err := NewServerCodec().Decode(data)
+		if err == nil && (n < 0 || n > len(data)) {
+			t.Fatalf("decoded length %d of %d bytes", n, len(data))
+		}
+	})
+}
+
+func TestResponse_Append(t *testing.T) {
+	resp := &Response{StatusCode: http.StatusOK, Header: http.Header{"Date": {"now"}}, Body: []byte("hi"), Close: true}
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nDate: now\r\nConnection: close\r\nContent-Length: 2\r\n\r\nhi", string(resp.Append(nil)))
+
+	resp = &Response{StatusCode: http.StatusOK, Header: http.Header{"Date": {"now"}}, Body: []byte("hi"), Chunked: true}
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nDate: now\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n", string(resp.Append(nil)))
+
+	resp = &Response{StatusCode: http.StatusNotModified, Header: http.Header{"Date": {"now"}}, Body: []byte("hi")}
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nDate: now\r\n\r\n", string(resp.Append(nil)))
+}
+
+func TestClientCodec(t *testing.T) {
+	codec := NewClientCodec()
+	data, err := codec.Encode(&Request{Method: http.MethodHead, RequestURI: "/a", Host: "example.com", Header: http.Header{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "HEAD /a HTTP/1.1\r\nHost: example.com\r\n\r\n", string(data))
+	data, err = codec.Encode(&Request{Method: http.MethodPost, Body: []byte("hi"), Close: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "POST / HTTP/1.1\r\nConnection: close\r\nContent-Length: 2\r\n\r\nhi", string(data))
+
+	// the response of HEAD has no body, and the informational response is skipped.
+	data = []byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok")
+	pkg, n, err := codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusContinue, pkg.(*Response).StatusCode)
+	data = data[n:]
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), pkg.(*Response).ContentLength)
+	assert.Empty(t, pkg.(*Response).Body)
+	pkg, _, err = codec.Decode(data[n:])
+	assert.Nil(t, err)
+	assert.Equal(t, "Created", pkg.(*Response).Status)
+	assert.Equal(t, "ok", string(pkg.(*Response).Body))
+	assert.Nil(t, codec.Finish())
+
+	// the huge chunk size of the upstream server following the data.
+	_, _, err = NewClientCodec().Decode([]byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n1\r\na\r\n7fffffffffffffff\r\nxx"))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
@@ -0,0 +1,323 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package http1 impl the HTTP/1.1 codecs for knetty sessions, and the adapter serving net/http.Handler.
+package http1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMaxHeaderBytes the default maximum bytes of the start line and the headers.
+	DefaultMaxHeaderBytes = 1 << 20
+	// DefaultMaxBodyBytes the default maximum bytes of the body.
+	DefaultMaxBodyBytes = 4 << 20
+	// DefaultMaxPipelinedRequests the default maximum pipelined requests of a connection waiting to be served.
+	DefaultMaxPipelinedRequests = 64
+)
+
+var (
+	// ErrMalformed the message violates the HTTP/1.1 syntax.
+	ErrMalformed = errors.New("malformed http message")
+	// ErrHeaderTooLarge the start line and the headers exceed the limit.
+	ErrHeaderTooLarge = errors.New("http header too large")
+	// ErrBodyTooLarge the body exceeds the limit.
+	ErrBodyTooLarge = errors.New("http body too large")
+)
+
+var (
+	crlf          = []byte("\r\n")
+	headerEnd     = []byte("\r\n\r\n")
+	chunkedSuffix = []byte("0\r\n\r\n")
+)
+
+// Option option for codecs.
+type Option func(*Options)
+
+// Options options for codecs.
+type Options struct {
+	// MaxHeaderBytes the maximum bytes of the start line and the headers
+	MaxHeaderBytes int
+	// MaxBodyBytes the maximum bytes of the body, for the chunked body it is the sum of the chunks
+	MaxBodyBytes int
+	// MaxPipelinedRequests the maximum pipelined requests of a connection waiting to be served by the server,
+	// the request beyond it is replied with 503 and the connection is closed.
+	MaxPipelinedRequests int
+}
+
+// WithMaxHeaderBytes set the maximum bytes of the start line and the headers.
+func WithMaxHeaderBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxHeaderBytes = n
+		}
+	}
+}
+
+// WithMaxBodyBytes set the maximum bytes of the body.
+func WithMaxBodyBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxBodyBytes = n
+		}
+	}
+}
+
+// WithMaxPipelinedRequests set the maximum pipelined requests of a connection waiting to be served.
+func WithMaxPipelinedRequests(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxPipelinedRequests = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		MaxHeaderBytes:       DefaultMaxHeaderBytes,
+		MaxBodyBytes:         DefaultMaxBodyBytes,
+		MaxPipelinedRequests: DefaultMaxPipelinedRequests,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+}
+
+// splitHead return the start line and the header lines of data, ok is false if the head is incomplete.
+// the empty lines before the start line are skipped, the skipped bytes are counted in n.
+func splitHead(data []byte, maxHeaderBytes int) (startLine []byte, headerLines []byte, n int, ok bool, err error) {
+	// RFC 7230 3.5: ignore at least one empty line received prior to the request-line.
+	for bytes.HasPrefix(data[n:], crlf) {
+		n += len(crlf)
+	}
+
+	head := data[n:]
+	end := bytes.Index(head, headerEnd)
+	// the message without headers ends with the first CRLF CRLF too.
+	if end < 0 {
+		if len(head) > maxHeaderBytes {
+			return nil, nil, 0, false, ErrHeaderTooLarge
+		}
+		return nil, nil, 0, false, nil
+	}
+
+	if end > maxHeaderBytes {
+		return nil, nil, 0, false, ErrHeaderTooLarge
+	}
+
+	head = head[:end+len(crlf)]
+	lineEnd := bytes.Index(head, crlf)
+	return head[:lineEnd], head[lineEnd+len(crlf):], n + end + len(headerEnd), true, nil
+}
+
+// parseHeaders parse the header lines ending with CRLF into header.
+func parseHeaders(lines []byte, header http.Header) error {
+	for len(lines) > 0 {
+		idx := bytes.Index(lines, crlf)
+		line := lines[:idx]
+		lines = lines[idx+len(crlf):]
+		if len(line) == 0 {
+			continue
+		}
+
+		// RFC 7230 3.2.4: obsolete line folding is rejected.
+		if line[0] == ' ' || line[0] == '\t' {
+			return malformed("obsolete line folding")
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			return malformed("invalid header line %q", line)
+		}
+
+		name := line[:colon]
+		if !validHeaderName(name) {
+			return malformed("invalid header name %q", name)
+		}
+
+		value := strings.TrimSpace(string(line[colon+1:]))
+		key := textproto.CanonicalMIMEHeaderKey(string(name))
+		header[key] = append(header[key], value)
+	}
+	return nil
+}
+
+func validHeaderName(name []byte) bool {
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("\"(),/:;<=>?@[\\]{}", c) >= 0 {
+			return false
+		}
+	}
+	return len(name) > 0
+}
+
+// headerHasToken return whether the comma-separated header values contain token case-insensitively.
+func headerHasToken(header http.Header, key, token string) bool {
+	for _, value := range header[key] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bodyLength decide the body framing by the headers, chunked is true if the body is chunked,
+// otherwise length is the Content-Length or -1 if it is absent.
+func bodyLength(header http.Header) (length int64, chunked bool, err error) {
+	if te := header["Transfer-Encoding"]; len(te) > 0 {
+		codings := strings.Split(strings.Join(te, ","), ",")
+		// RFC 7230 3.3.3: the chunked coding must be the final one.
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			return 0, false, malformed("unsupported transfer encoding %q", te)
+		}
+		// Content-Length is ignored if Transfer-Encoding is present.
+		header.Del("Content-Length")
+		return -1, true, nil
+	}
+
+	values := header["Content-Length"]
+	if len(values) == 0 {
+		return -1, false, nil
+	}
+
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return 0, false, malformed("conflicting content length %q", values)
+		}
+	}
+
+	length, err = strconv.ParseInt(values[0], 10, 64)
+	if err != nil || length < 0 {
+		return 0, false, malformed("invalid content length %q", values[0])
+	}
+	return length, false, nil
+}
+
+// parseChunked parse the chunked body of data, ok is false if the body is incomplete.
+// n is the bytes of the chunked body including the trailer section.
+func parseChunked(data []byte, maxBodyBytes int) (body []byte, trailer http.Header, n int, ok bool, err error) {
+	for {
+		lineEnd := bytes.Index(data[n:], crlf)
+		if lineEnd < 0 {
+			if len(data)-n > maxChunkLineBytes {
+				return nil, nil, 0, false, malformed("chunk size line too long")
+			}
+			return nil, nil, 0, false, nil
+		}
+
+		line := data[n : n+lineEnd]
+		// chunk extensions are ignored.
+		if idx := bytes.IndexByte(line, ';'); idx >= 0 {
+			line = line[:idx]
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(line)), 16, 64)
+		if err != nil || size < 0 {
+			return nil, nil, 0, false, malformed("invalid chunk size %q", line)
+		}
+
+		if size == 0 {
+			n += lineEnd + len(crlf)
+			break
+		}
+
+		// the sizes are compared without the additions overflowing by the huge chunk size.
+		if size > int64(maxBodyBytes-len(body)) {
+			return nil, nil, 0, false, ErrBodyTooLarge
+		}
+
+		start := n + lineEnd + len(crlf)
+		if size > int64(len(data)-start-len(crlf)) {
+			return nil, nil, 0, false, nil
+		}
+
+		end := start + int(size)
+		if !bytes.Equal(data[end:end+len(crlf)], crlf) {
+			return nil, nil, 0, false, malformed("chunk data without CRLF")
+		}
+		body = append(body, data[start:end]...)
+		n = end + len(crlf)
+	}
+
+	// the trailer section ends with an empty line.
+	if bytes.HasPrefix(data[n:], crlf) {
+		return nonNilBody(body), nil, n + len(crlf), true, nil
+	}
+
+	end := bytes.Index(data[n:], headerEnd)
+	if end < 0 {
+		return nil, nil, 0, false, nil
+	}
+
+	trailer = make(http.Header)
+	if err := parseHeaders(data[n:n+end+len(crlf)], trailer); err != nil {
+		return nil, nil, 0, false, err
+	}
+	return nonNilBody(body), trailer, n + end + len(headerEnd), true, nil
+}
+
+const maxChunkLineBytes = 4096
+
+func nonNilBody(body []byte) []byte {
+	if body == nil {
+		return []byte{}
+	}
+	return body
+}
+
+// appendHeaders append the headers in the wire format.
+func appendHeaders(dst []byte, header http.Header) []byte {
+	for key, values := range header {
+		for _, value := range values {
+			dst = append(dst, key...)
+			dst = append(dst, ": "...)
+			dst = append(dst, value...)
+			dst = append(dst, crlf...)
+		}
+	}
+	return dst
+}
+
+// appendChunked append body as one chunk and the last chunk with trailer.
+func appendChunked(dst, body []byte, trailer http.Header) []byte {
+	if len(body) > 0 {
+		dst = strconv.AppendInt(dst, int64(len(body)), 16)
+		dst = append(dst, crlf...)
+		dst = append(dst, body...)
+		dst = append(dst, crlf...)
+	}
+
+	if len(trailer) == 0 {
+		return append(dst, chunkedSuffix...)
+	}
+
+	dst = append(dst, "0\r\n"...)
+	dst = appendHeaders(dst, trailer)
+	return append(dst, crlf...)
+}
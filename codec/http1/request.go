@@ -0,0 +1,216 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+)
+
+// Request an HTTP/1.x request.
+type Request struct {
+	// Method e.g. GET
+	Method string
+	// RequestURI the request-target of the request line, e.g. /index.html?a=1
+	RequestURI string
+	// Proto e.g. HTTP/1.1
+	Proto      string
+	ProtoMajor int
+	ProtoMinor int
+	Header     http.Header
+	// Host the Host header, which is removed from Header
+	Host string
+	// ContentLength the length of Body, -1 means the body is chunked
+	ContentLength int64
+	// Chunked whether the body is transferred in the chunked coding
+	Chunked bool
+	Body    []byte
+	Trailer http.Header
+	// Close whether the connection is closed after the response, according to the protocol version and
+	// the Connection header
+	Close bool
+}
+
+// ServerCodec the codec of the HTTP/1.1 server session, it decodes *Request and encodes *Response.
+// the pipelined requests are decoded one by one, and the responses must be written in the order of the requests.
+type ServerCodec struct {
+	options Options
+}
+
+// NewServerCodec return a server codec with opts.
+func NewServerCodec(opts ...Option) *ServerCodec {
+	return &ServerCodec{options: newOptions(opts...)}
+}
+
+// Decode implements session.Codec.
+func (c *ServerCodec) Decode(data []byte) (interface{}, int, error) {
+	startLine, headerLines, n, ok, err := splitHead(data, c.options.MaxHeaderBytes)
+	if err != nil || !ok {
+		return nil, 0, err
+	}
+
+	req := &Request{Header: make(http.Header)}
+	if err := req.parseRequestLine(startLine); err != nil {
+		return nil, 0, err
+	}
+
+	if err := parseHeaders(headerLines, req.Header); err != nil {
+		return nil, 0, err
+	}
+
+	if hosts := req.Header["Host"]; len(hosts) > 0 {
+		if len(hosts) > 1 {
+			return nil, 0, malformed("too many Host headers")
+		}
+		req.Host = hosts[0]
+		delete(req.Header, "Host")
+	}
+
+	length, chunked, err := bodyLength(req.Header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Close = shouldClose(req.ProtoMajor, req.ProtoMinor, req.Header)
+	switch {
+	case chunked:
+		body, trailer, bodyLen, ok, err := parseChunked(data[n:], c.options.MaxBodyBytes)
+		if err != nil || !ok {
+			return nil, 0, err
+		}
+		req.ContentLength, req.Chunked, req.Body, req.Trailer = -1, true, body, trailer
+		return req, n + bodyLen, nil
+	case length > int64(c.options.MaxBodyBytes):
+		return nil, 0, ErrBodyTooLarge
+	case length > 0:
+		if int64(len(data)-n) < length {
+			return nil, 0, nil
+		}
+		// copy the body, data is owned by the session.
+		req.ContentLength, req.Body = length, append([]byte(nil), data[n:n+int(length)]...)
+		return req, n + int(length), nil
+	default:
+		// a request without Content-Length and Transfer-Encoding has no body.
+		req.ContentLength = 0
+		return req, n, nil
+	}
+}
+
+// Encode implements session.Codec, pkg must be *Response or []byte.
+func (c *ServerCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch pkg := pkg.(type) {
+	case *Response:
+		return pkg.Append(nil), nil
+	case []byte:
+		return pkg, nil
+	default:
+		return nil, malformed("unsupported response type %T", pkg)
+	}
+}
+
+func (r *Request) parseRequestLine(line []byte) error {
+	method, rest, ok1 := cut(line, ' ')
+	uri, proto, ok2 := cut(rest, ' ')
+	if !ok1 || !ok2 || len(method) == 0 || len(uri) == 0 {
+		return malformed("invalid request line %q", line)
+	}
+
+	if !validHeaderName(method) {
+		return malformed("invalid method %q", method)
+	}
+
+	major, minor, ok := http.ParseHTTPVersion(string(proto))
+	if !ok || major != 1 {
+		return malformed("unsupported protocol %q", proto)
+	}
+
+	r.Method, r.RequestURI, r.Proto, r.ProtoMajor, r.ProtoMinor = string(method), string(uri), string(proto), major, minor
+	return nil
+}
+
+// shouldClose return whether the connection is closed after the message.
+func shouldClose(major, minor int, header http.Header) bool {
+	if headerHasToken(header, "Connection", "close") {
+		return true
+	}
+
+	// HTTP/1.0 connections are not persistent unless keep-alive is requested.
+	if major == 1 && minor == 0 {
+		return !headerHasToken(header, "Connection", "keep-alive")
+	}
+	return false
+}
+
+func cut(s []byte, sep byte) (before, after []byte, found bool) {
+	if i := bytes.IndexByte(s, sep); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, nil, false
+}
+
+// KeepAlive return whether the connection is kept alive after the response of the request.
+func (r *Request) KeepAlive() bool {
+	return !r.Close
+}
+
+// Append append the request in the wire format to dst.
+// Content-Length is added by the length of Body unless it is set in Header or the body is chunked.
+func (r *Request) Append(dst []byte) []byte {
+	proto := r.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	uri := r.RequestURI
+	if uri == "" {
+		uri = "/"
+	}
+
+	dst = append(dst, r.Method...)
+	dst = append(dst, ' ')
+	dst = append(dst, uri...)
+	dst = append(dst, ' ')
+	dst = append(dst, proto...)
+	dst = append(dst, crlf...)
+	if r.Host != "" {
+		dst = append(dst, "Host: "...)
+		dst = append(dst, r.Host...)
+		dst = append(dst, crlf...)
+	}
+	dst = appendHeaders(dst, r.Header)
+
+	if r.Close && !headerHasToken(r.Header, "Connection", "close") {
+		dst = append(dst, "Connection: close\r\n"...)
+	}
+
+	switch {
+	case r.Chunked:
+		dst = append(dst, "Transfer-Encoding: chunked\r\n\r\n"...)
+		return appendChunked(dst, r.Body, r.Trailer)
+	case r.Header.Get("Content-Length") == "" && (len(r.Body) > 0 || methodHasBody(r.Method)):
+		dst = append(dst, "Content-Length: "...)
+		dst = strconv.AppendInt(dst, int64(len(r.Body)), 10)
+		dst = append(dst, crlf...)
+	}
+	dst = append(dst, crlf...)
+	return append(dst, r.Body...)
+}
+
+// methodHasBody return whether the request of method is expected to have a body.
+func methodHasBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
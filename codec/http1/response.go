@@ -0,0 +1,101 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Response an HTTP/1.x response.
+type Response struct {
+	// Proto e.g. HTTP/1.1, it is HTTP/1.1 by default when encoding
+	Proto      string
+	ProtoMajor int
+	ProtoMinor int
+	StatusCode int
+	// Status the reason phrase, it is http.StatusText(StatusCode) by default when encoding
+	Status string
+	Header http.Header
+	// ContentLength the length of Body, -1 means the body is chunked or delimited by closing the connection
+	ContentLength int64
+	// Chunked whether the body is transferred in the chunked coding
+	Chunked bool
+	Body    []byte
+	Trailer http.Header
+	// Close whether the connection is closed after the response
+	Close bool
+}
+
+// bodyAllowed return whether a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return (status < 100 || status > 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// Append append the response in the wire format to dst.
+// Content-Length is added by the length of Body unless it is set in Header or the body is chunked,
+// so the response of HEAD can declare the length without the body.
+func (r *Response) Append(dst []byte) []byte {
+	proto := r.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	status := r.Status
+	if status == "" {
+		status = http.StatusText(r.StatusCode)
+	}
+
+	dst = append(dst, proto...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, int64(r.StatusCode), 10)
+	dst = append(dst, ' ')
+	dst = append(dst, status...)
+	dst = append(dst, crlf...)
+	dst = appendHeaders(dst, r.Header)
+
+	if _, ok := r.Header["Date"]; !ok {
+		dst = append(dst, "Date: "...)
+		dst = time.Now().UTC().AppendFormat(dst, http.TimeFormat)
+		dst = append(dst, crlf...)
+	}
+
+	if r.Close && !headerHasToken(r.Header, "Connection", "close") {
+		dst = append(dst, "Connection: close\r\n"...)
+	}
+
+	allowed := bodyAllowed(r.StatusCode)
+	switch {
+	case !allowed:
+	case r.Chunked:
+		dst = append(dst, "Transfer-Encoding: chunked\r\n"...)
+	case r.Header.Get("Content-Length") == "":
+		dst = append(dst, "Content-Length: "...)
+		dst = strconv.AppendInt(dst, int64(len(r.Body)), 10)
+		dst = append(dst, crlf...)
+	}
+	dst = append(dst, crlf...)
+
+	switch {
+	case !allowed:
+		return dst
+	case r.Chunked:
+		return appendChunked(dst, r.Body, r.Trailer)
+	default:
+		return append(dst, r.Body...)
+	}
+}
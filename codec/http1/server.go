@@ -0,0 +1,305 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/session"
+)
+
+// Server serves a net/http.Handler over knetty sessions.
+// the handler runs in a goroutine of the session instead of the event loop, and the pipelined requests
+// of a session are served one by one, so the responses are written in the order of the requests.
+type Server struct {
+	handler http.Handler
+	opts    []Option
+	options Options
+}
+
+// NewServer return a server serving handler, opts are used to create the codecs of the sessions.
+func NewServer(handler http.Handler, opts ...Option) *Server {
+	return &Server{handler: handler, opts: opts, options: newOptions(opts...)}
+}
+
+// Setup install the codec and the eventListener serving the handler for the session,
+// it can be used in NewSessionCallBackFunc or as the setup of a sniffed protocol.
+func (srv *Server) Setup(s session.Session) error {
+	s.SetCodec(NewServerCodec(srv.opts...))
+	s.SetEventListener(&serverConn{server: srv})
+	return nil
+}
+
+// serverConn the eventListener of a session serving the handler.
+type serverConn struct {
+	server  *Server
+	mu      sync.Mutex
+	queue   []serverTask
+	running bool
+	closed  bool
+}
+
+// serverTask a request to serve, or the status to reply for the malformed request.
+type serverTask struct {
+	req    *Request
+	status int
+}
+
+// OnConnect implements session.EventListener.
+func (c *serverConn) OnConnect(session.Session) {}
+
+// OnMessage implements session.EventListener.
+func (c *serverConn) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	c.enqueue(s, serverTask{req: pkg.(*Request)})
+	return session.Normal
+}
+
+// OnError implements session.EventListener, the malformed request is replied with an error status
+// and the session is closed.
+func (c *serverConn) OnError(s session.Session, e error) {
+	switch {
+	case errors.Is(e, ErrHeaderTooLarge):
+		c.enqueue(s, serverTask{status: http.StatusRequestHeaderFieldsTooLarge})
+	case errors.Is(e, ErrBodyTooLarge):
+		c.enqueue(s, serverTask{status: http.StatusRequestEntityTooLarge})
+	case errors.Is(e, ErrMalformed):
+		c.enqueue(s, serverTask{status: http.StatusBadRequest})
+	default:
+		log.Errorf("http session:%s err:%v", s.Info(), e)
+	}
+}
+
+// OnClose implements session.EventListener.
+func (c *serverConn) OnClose(session.Session) {
+	c.mu.Lock()
+	c.closed, c.queue = true, nil
+	c.mu.Unlock()
+}
+
+func (c *serverConn) enqueue(s session.Session, task serverTask) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+
+	// the client pipelining too many requests is refused rather than queuing them without limit.
+	if task.req != nil && len(c.queue) >= c.server.options.MaxPipelinedRequests {
+		task = serverTask{status: http.StatusServiceUnavailable}
+	}
+
+	// the requests after the one closing the connection are dropped.
+	if task.status != 0 || task.req.Close {
+		c.closed = true
+	}
+
+	c.queue = append(c.queue, task)
+	if !c.running {
+		c.running = true
+		go c.serve(s)
+	}
+}
+
+func (c *serverConn) serve(s session.Session) {
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		task := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		var resp *Response
+		if task.req != nil {
+			resp = c.server.serveRequest(s, task.req)
+		} else {
+			resp = &Response{StatusCode: task.status, Close: true}
+		}
+
+		// the handler aborted the request.
+		if resp == nil {
+			_ = s.Close()
+			return
+		}
+
+		if _, err := s.WritePkg(resp); err != nil {
+			log.Errorf("http session:%s write response err:%v", s.Info(), err)
+			_ = s.Close()
+			return
+		}
+
+		if err := s.FlushBuffer(); err != nil {
+			log.Errorf("http session:%s flush response err:%v", s.Info(), err)
+			_ = s.Close()
+			return
+		}
+
+		if resp.Close {
+			_ = s.Close()
+			return
+		}
+	}
+}
+
+// serveRequest run the handler for req, it returns nil if the handler panics.
+func (srv *Server) serveRequest(s session.Session, req *Request) (resp *Response) {
+	httpReq, err := newHTTPRequest(s, req)
+	if err != nil {
+		return &Response{StatusCode: http.StatusBadRequest, Close: true}
+	}
+
+	ctx, cancel := context.WithCancel(httpReq.Context())
+	defer cancel()
+	httpReq = httpReq.WithContext(ctx)
+
+	w := &responseWriter{header: make(http.Header)}
+	defer func() {
+		if err := recover(); err != nil {
+			if err != http.ErrAbortHandler {
+				log.Errorf("http: panic serving %s: %v", s.RemoteAddr(), err)
+			}
+			resp = nil
+		}
+	}()
+
+	srv.handler.ServeHTTP(w, httpReq)
+	return w.response(req)
+}
+
+func newHTTPRequest(s session.Session, req *Request) (*http.Request, error) {
+	var u *url.URL
+	var err error
+	// the authority form of CONNECT, e.g. CONNECT example.com:443 HTTP/1.1
+	if req.Method == http.MethodConnect && !strings.HasPrefix(req.RequestURI, "/") {
+		u = &url.URL{Host: req.RequestURI}
+	} else if u, err = url.ParseRequestURI(req.RequestURI); err != nil {
+		return nil, err
+	}
+
+	host := req.Host
+	if host == "" {
+		host = u.Host
+	}
+
+	httpReq := &http.Request{
+		Method:        req.Method,
+		URL:           u,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        req.Header,
+		Body:          io.NopCloser(bytes.NewReader(req.Body)),
+		ContentLength: req.ContentLength,
+		Close:         req.Close,
+		Host:          host,
+		Trailer:       req.Trailer,
+		RemoteAddr:    s.RemoteAddr(),
+		RequestURI:    req.RequestURI,
+	}
+	if req.Chunked {
+		httpReq.TransferEncoding = []string{"chunked"}
+	}
+	if len(req.Body) == 0 {
+		httpReq.Body = http.NoBody
+	}
+
+	ctx := context.Background()
+	if addr, err := net.ResolveTCPAddr("tcp", s.LocalAddr()); err == nil {
+		ctx = context.WithValue(ctx, http.LocalAddrContextKey, addr)
+	}
+	return httpReq.WithContext(ctx), nil
+}
+
+// responseWriter buffers the response written by the handler.
+type responseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(statusCode int) {
+	// the informational responses are not supported, as the request has been read entirely.
+	if w.wroteHeader || (statusCode >= 100 && statusCode <= 199) {
+		return
+	}
+	w.wroteHeader, w.status = true, statusCode
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !bodyAllowed(w.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	return w.body.Write(data)
+}
+
+// response build the response of req.
+func (w *responseWriter) response(req *Request) *Response {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	resp := &Response{
+		StatusCode:    w.status,
+		Header:        w.header,
+		Body:          w.body.Bytes(),
+		ContentLength: int64(w.body.Len()),
+		Close:         req.Close || headerHasToken(w.header, "Connection", "close"),
+	}
+
+	if _, ok := w.header["Content-Type"]; !ok && w.body.Len() > 0 {
+		w.header.Set("Content-Type", http.DetectContentType(resp.Body))
+	}
+
+	// the handler may declare the length without writing the body of HEAD.
+	if req.Method == http.MethodHead {
+		if w.header.Get("Content-Length") == "" && w.body.Len() > 0 {
+			w.header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+		}
+		resp.Body = nil
+	}
+
+	// HTTP/1.0 clients need the response to declare the connection persistent.
+	if req.ProtoMinor == 0 && !resp.Close {
+		w.header.Set("Connection", "keep-alive")
+	}
+	return resp
+}
@@ -0,0 +1,191 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http1
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve run a knetty server serving handler, it returns the address of the server.
+func serve(t *testing.T, handler http.Handler, opts ...Option) string {
+	return knettytest.Serve(t, NewServer(handler, opts...).Setup).Addr()
+}
+
+func TestServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		_, _ = fmt.Fprintf(w, "%s %s", r.URL.Query().Get("v"), body)
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	addr := serve(t, mux)
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Post("http://"+addr+"/echo?v=knetty", "text/plain", strings.NewReader(fmt.Sprint(i)))
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "POST", resp.Header.Get("X-Method"))
+		assert.Equal(t, fmt.Sprintf("knetty %d", i), string(body))
+	}
+
+	resp, err := client.Get("http://" + addr + "/missing")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = client.Get("http://" + addr + "/panic")
+	assert.NotNil(t, err)
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	addr := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// the chunked request and the request closing the connection are pipelined.
+	_, err = conn.Write([]byte("POST /1 HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n" +
+		"GET /2 HTTP/1.1\r\nHost: a\r\n\r\nGET /3 HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\nGET /4 HTTP/1.1\r\n\r\n"))
+	assert.Nil(t, err)
+
+	reader := bufio.NewReader(conn)
+	for _, path := range []string{"/1", "/2", "/3"} {
+		resp, err := http.ReadResponse(reader, nil)
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, path, string(body))
+	}
+
+	// the connection is closed after /3.
+	_, err = reader.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_PipeliningLimit(t *testing.T) {
+	serving, release := make(chan struct{}, 1), make(chan struct{})
+	addr := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1" {
+			serving <- struct{}{}
+			<-release
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}), WithMaxPipelinedRequests(2))
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// the requests are queued while /1 is being served, the one beyond the limit is refused.
+	_, err = conn.Write([]byte("GET /1 HTTP/1.1\r\nHost: a\r\n\r\n"))
+	assert.Nil(t, err)
+	<-serving
+	_, err = conn.Write([]byte("GET /2 HTTP/1.1\r\nHost: a\r\n\r\nGET /3 HTTP/1.1\r\nHost: a\r\n\r\n" +
+		"GET /4 HTTP/1.1\r\nHost: a\r\n\r\nGET /5 HTTP/1.1\r\nHost: a\r\n\r\n"))
+	assert.Nil(t, err)
+	// wait for the requests being decoded.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	reader := bufio.NewReader(conn)
+	for _, path := range []string{"/1", "/2", "/3"} {
+		resp, err := http.ReadResponse(reader, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, path, string(body))
+	}
+
+	resp, err := http.ReadResponse(reader, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.True(t, resp.Close)
+	_, err = reader.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_BadRequest(t *testing.T) {
+	addr := serve(t, http.NotFoundHandler(), WithMaxBodyBytes(4))
+	for request, status := range map[string]int{
+		"GET / HTTP/1.1\r\nbad\r\n\r\n":                     http.StatusBadRequest,
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello": http.StatusRequestEntityTooLarge,
+	} {
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(t, err)
+		_, err = conn.Write([]byte(request))
+		assert.Nil(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, status, resp.StatusCode)
+		assert.True(t, resp.Close)
+		_ = conn.Close()
+	}
+}
+
+func TestServer_SlowReader(t *testing.T) {
+	addr := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte(r.URL.Path[1:]), 32<<10))
+	}))
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// the responses are written by the handler goroutine while the event loop flushes the previous ones.
+	var requests strings.Builder
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&requests, "GET /%c HTTP/1.1\r\nHost: a\r\n\r\n", 'a'+i%26)
+	}
+	_, err = conn.Write([]byte(requests.String()))
+	assert.Nil(t, err)
+
+	reader := bufio.NewReaderSize(conn, 1024)
+	for i := 0; i < 64; i++ {
+		resp, err := http.ReadResponse(reader, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, bytes.Repeat([]byte{byte('a' + i%26)}, 32<<10), body)
+		if i%8 == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,714 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/session"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// serverConn the server side of a HTTP/2 connection, it is the eventListener of the session,
+// the frames are handled in the event loop and the responses are written by the handler goroutines.
+// mu serializes the frames, the session output is serialized with the event loop flushing it by the connection.
+type serverConn struct {
+	server   *Server
+	options  *Options
+	t        transport
+	tlsState *tls.ConnectionState
+
+	mu               sync.Mutex
+	hdec             *hpack.Decoder
+	henc             *hpack.Encoder
+	hbuf             bytes.Buffer
+	streams          map[uint32]*stream
+	lastStreamID     uint32
+	settingsReceived bool
+	// the header block continued by CONTINUATION frames.
+	headerStreamID uint32
+	headerFlags    Flags
+	headerSelfDep  bool
+	headerBlock    []byte
+
+	peerMaxFrameSize uint32
+	peerWindowSize   int64
+	sendWindow       int64
+	recvWindow       int64
+
+	goingAway   bool
+	dirty       bool
+	closing     bool
+	closeCalled bool
+	closed      bool
+}
+
+// OnConnect implements session.EventListener, the server preface is sent at once.
+func (sc *serverConn) OnConnect(session.Session) {
+	sc.mu.Lock()
+	defer sc.unlock()
+
+	sc.writeFrame(NewSettingsFrame(
+		Setting{ID: SettingMaxFrameSize, Val: sc.options.MaxFrameSize},
+		Setting{ID: SettingMaxConcurrentStreams, Val: sc.options.MaxConcurrentStreams},
+		Setting{ID: SettingInitialWindowSize, Val: sc.options.InitialWindowSize},
+		Setting{ID: SettingMaxHeaderListSize, Val: sc.options.MaxHeaderListSize},
+	))
+	if diff := int64(sc.options.InitialWindowSize) - sc.recvWindow; diff > 0 {
+		sc.writeFrame(NewWindowUpdateFrame(0, uint32(diff)))
+		sc.recvWindow += diff
+	}
+}
+
+// OnMessage implements session.EventListener.
+func (sc *serverConn) OnMessage(_ session.Session, pkg interface{}) session.ExecStatus {
+	sc.mu.Lock()
+	defer sc.unlock()
+	if sc.closed {
+		return session.Normal
+	}
+
+	if f, ok := pkg.(*Frame); ok {
+		if err := sc.handleFrame(f); err != nil {
+			sc.handleError(err)
+		}
+	}
+	return session.Normal
+}
+
+// OnError implements session.EventListener, the connection is closed by GOAWAY.
+func (sc *serverConn) OnError(_ session.Session, e error) {
+	sc.mu.Lock()
+	defer sc.unlock()
+	sc.handleError(e)
+}
+
+// OnClose implements session.EventListener, the requests of the active streams are canceled.
+func (sc *serverConn) OnClose(session.Session) {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return
+	}
+
+	sc.closed = true
+	for id, st := range sc.streams {
+		st.cancel()
+		delete(sc.streams, id)
+	}
+	sc.mu.Unlock()
+	sc.server.removeConn(sc)
+}
+
+func (sc *serverConn) isClosed() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.closing || sc.closed
+}
+
+// unlock flush the written frames and unlock the connection, the transport is closed after unlocking
+// as closing it notifies OnClose.
+func (sc *serverConn) unlock() {
+	if sc.dirty && !sc.closed {
+		sc.dirty = false
+		if err := sc.t.FlushBuffer(); err != nil {
+			log.Errorf("http2 conn:%s flush err:%v", sc.t.RemoteAddr(), err)
+			sc.closing = true
+		}
+	}
+
+	closeNow := sc.closing && !sc.closeCalled && !sc.closed
+	if closeNow {
+		sc.closeCalled = true
+	}
+	sc.mu.Unlock()
+
+	if closeNow {
+		if err := sc.t.Close(); err != nil {
+			log.Errorf("http2 conn:%s close err:%v", sc.t.RemoteAddr(), err)
+		}
+	}
+}
+
+func (sc *serverConn) writeFrame(f *Frame) {
+	if sc.closeCalled || sc.closed {
+		return
+	}
+
+	if _, err := sc.t.WriteBuffer(f.Append(make([]byte, 0, frameHeaderLen+len(f.Payload)))); err != nil {
+		log.Errorf("http2 conn:%s write frame:%s err:%v", sc.t.RemoteAddr(), f, err)
+		sc.closing = true
+		return
+	}
+	sc.dirty = true
+}
+
+// handleError reset the stream of StreamError, or send GOAWAY and close the connection for the other errors.
+func (sc *serverConn) handleError(err error) {
+	var se StreamError
+	if errors.As(err, &se) {
+		sc.writeFrame(NewRSTStreamFrame(se.StreamID, se.Code))
+		if st, ok := sc.streams[se.StreamID]; ok {
+			sc.closeStream(st)
+		}
+		return
+	}
+
+	var ce ConnectionError
+	if !errors.As(err, &ce) {
+		ce = ConnectionError{Code: ErrCodeInternal, Reason: err.Error()}
+	}
+	log.Errorf("http2 conn:%s err:%v", sc.t.RemoteAddr(), err)
+	sc.writeFrame(NewGoAwayFrame(sc.lastStreamID, ce.Code, []byte(ce.Reason)))
+	sc.goingAway, sc.closing = true, true
+}
+
+// goAway send GOAWAY for the graceful shutdown, the connection is closed after the active streams are served.
+func (sc *serverConn) goAway() {
+	sc.mu.Lock()
+	defer sc.unlock()
+	if sc.closed || sc.goingAway {
+		return
+	}
+
+	sc.goingAway = true
+	sc.writeFrame(NewGoAwayFrame(sc.lastStreamID, ErrCodeNo, nil))
+	if len(sc.streams) == 0 {
+		sc.closing = true
+	}
+}
+
+func (sc *serverConn) handleFrame(f *Frame) error {
+	// the client preface ends with a SETTINGS frame.
+	if !sc.settingsReceived {
+		if f.Type != FrameSettings || f.Flags.Has(FlagAck) {
+			return connError(ErrCodeProtocol, "expect SETTINGS, got %s", f.Type)
+		}
+		sc.settingsReceived = true
+	}
+
+	if sc.headerStreamID != 0 && (f.Type != FrameContinuation || f.StreamID != sc.headerStreamID) {
+		return connError(ErrCodeProtocol, "expect CONTINUATION of stream %d, got %s", sc.headerStreamID, f)
+	}
+
+	switch f.Type {
+	case FrameData:
+		return sc.handleData(f)
+	case FrameHeaders:
+		return sc.handleHeaders(f)
+	case FrameContinuation:
+		return sc.handleContinuation(f)
+	case FramePriority:
+		return sc.handlePriority(f)
+	case FrameRSTStream:
+		return sc.handleRSTStream(f)
+	case FrameSettings:
+		return sc.handleSettings(f)
+	case FramePushPromise:
+		return connError(ErrCodeProtocol, "PUSH_PROMISE from client")
+	case FramePing:
+		return sc.handlePing(f)
+	case FrameGoAway:
+		return sc.handleGoAway(f)
+	case FrameWindowUpdate:
+		return sc.handleWindowUpdate(f)
+	default:
+		// the frames of unknown types are ignored.
+		return nil
+	}
+}
+
+func (sc *serverConn) handleSettings(f *Frame) error {
+	if f.StreamID != 0 {
+		return connError(ErrCodeProtocol, "SETTINGS on stream %d", f.StreamID)
+	}
+
+	if f.Flags.Has(FlagAck) {
+		if len(f.Payload) != 0 {
+			return connError(ErrCodeFrameSize, "SETTINGS ack length %d", len(f.Payload))
+		}
+		return nil
+	}
+
+	settings, err := f.Settings()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range settings {
+		if err := s.Valid(); err != nil {
+			return err
+		}
+
+		switch s.ID {
+		case SettingHeaderTableSize:
+			sc.henc.SetMaxDynamicTableSizeLimit(s.Val)
+		case SettingInitialWindowSize:
+			// the change applies to the send windows of all the streams.
+			delta := int64(s.Val) - sc.peerWindowSize
+			sc.peerWindowSize = int64(s.Val)
+			for _, st := range sc.streams {
+				st.sendWindow += delta
+				if st.sendWindow > maxWindowSize {
+					return connError(ErrCodeFlowControl, "stream %d window overflow", st.id)
+				}
+			}
+		case SettingMaxFrameSize:
+			sc.peerMaxFrameSize = s.Val
+		}
+	}
+
+	sc.writeFrame(NewSettingsAckFrame())
+	sc.sendPendingAll()
+	return nil
+}
+
+func (sc *serverConn) handlePing(f *Frame) error {
+	if f.StreamID != 0 {
+		return connError(ErrCodeProtocol, "PING on stream %d", f.StreamID)
+	}
+	if len(f.Payload) != 8 {
+		return connError(ErrCodeFrameSize, "PING length %d", len(f.Payload))
+	}
+
+	if !f.Flags.Has(FlagAck) {
+		var data [8]byte
+		copy(data[:], f.Payload)
+		sc.writeFrame(NewPingFrame(data, true))
+	}
+	return nil
+}
+
+func (sc *serverConn) handleGoAway(f *Frame) error {
+	if f.StreamID != 0 {
+		return connError(ErrCodeProtocol, "GOAWAY on stream %d", f.StreamID)
+	}
+
+	_, code, debug, err := f.GoAway()
+	if err != nil {
+		return err
+	}
+	if code != ErrCodeNo {
+		log.Warnf("http2 conn:%s GOAWAY %s:%s", sc.t.RemoteAddr(), code, debug)
+	}
+
+	// the client opens no new streams, the connection is closed after the active streams are served.
+	sc.goingAway = true
+	if len(sc.streams) == 0 {
+		sc.closing = true
+	}
+	return nil
+}
+
+func (sc *serverConn) handleWindowUpdate(f *Frame) error {
+	increment, err := f.WindowIncrement()
+	if err != nil {
+		return err
+	}
+
+	if f.StreamID == 0 {
+		if increment == 0 {
+			return connError(ErrCodeProtocol, "WINDOW_UPDATE increment 0")
+		}
+		sc.sendWindow += int64(increment)
+		if sc.sendWindow > maxWindowSize {
+			return connError(ErrCodeFlowControl, "connection window overflow")
+		}
+		sc.sendPendingAll()
+		return nil
+	}
+
+	st, ok := sc.streams[f.StreamID]
+	if !ok {
+		if f.StreamID > sc.lastStreamID {
+			return connError(ErrCodeProtocol, "WINDOW_UPDATE on idle stream %d", f.StreamID)
+		}
+		return nil
+	}
+
+	if increment == 0 {
+		return streamError(st.id, ErrCodeProtocol, "WINDOW_UPDATE increment 0")
+	}
+	st.sendWindow += int64(increment)
+	if st.sendWindow > maxWindowSize {
+		return streamError(st.id, ErrCodeFlowControl, "stream window overflow")
+	}
+	sc.sendPending(st)
+	return nil
+}
+
+func (sc *serverConn) handleRSTStream(f *Frame) error {
+	if f.StreamID == 0 {
+		return connError(ErrCodeProtocol, "RST_STREAM on stream 0")
+	}
+	if _, err := f.ErrCode(); err != nil {
+		return err
+	}
+
+	st, ok := sc.streams[f.StreamID]
+	if !ok {
+		if f.StreamID > sc.lastStreamID {
+			return connError(ErrCodeProtocol, "RST_STREAM on idle stream %d", f.StreamID)
+		}
+		return nil
+	}
+	sc.closeStream(st)
+	return nil
+}
+
+func (sc *serverConn) handlePriority(f *Frame) error {
+	if f.StreamID == 0 {
+		return connError(ErrCodeProtocol, "PRIORITY on stream 0")
+	}
+
+	// the priority is advisory and ignored by the server.
+	priority, err := f.Priority()
+	if err != nil {
+		return err
+	}
+	if priority.StreamDep == f.StreamID {
+		return streamError(f.StreamID, ErrCodeProtocol, "stream depends on itself")
+	}
+	return nil
+}
+
+func (sc *serverConn) handleHeaders(f *Frame) error {
+	id := f.StreamID
+	if id == 0 || id%2 == 0 {
+		return connError(ErrCodeProtocol, "HEADERS on invalid stream %d", id)
+	}
+	if _, ok := sc.streams[id]; !ok && id <= sc.lastStreamID {
+		return connError(ErrCodeStreamClosed, "HEADERS on closed stream %d", id)
+	}
+
+	block, priority, err := f.HeaderBlock()
+	if err != nil {
+		return err
+	}
+
+	sc.headerStreamID, sc.headerFlags = id, f.Flags
+	sc.headerSelfDep = priority != nil && priority.StreamDep == id
+	sc.headerBlock = append(sc.headerBlock[:0], block...)
+	if f.Flags.Has(FlagEndHeaders) {
+		return sc.endHeaders()
+	}
+	return nil
+}
+
+func (sc *serverConn) handleContinuation(f *Frame) error {
+	if sc.headerStreamID == 0 {
+		return connError(ErrCodeProtocol, "unexpected CONTINUATION on stream %d", f.StreamID)
+	}
+
+	sc.headerBlock = append(sc.headerBlock, f.Payload...)
+	if len(sc.headerBlock) > int(sc.options.MaxHeaderListSize) {
+		return connError(ErrCodeEnhanceYourCalm, "header block of stream %d too large", sc.headerStreamID)
+	}
+	if f.Flags.Has(FlagEndHeaders) {
+		return sc.endHeaders()
+	}
+	return nil
+}
+
+// endHeaders decode the complete header block, which opens a stream or carries the trailers.
+func (sc *serverConn) endHeaders() error {
+	id, endStream, selfDep := sc.headerStreamID, sc.headerFlags.Has(FlagEndStream), sc.headerSelfDep
+	sc.headerStreamID = 0
+
+	// the block is decoded even if the stream is refused, to keep the state of the decoder.
+	fields, err := sc.hdec.DecodeFull(sc.headerBlock)
+	if err != nil {
+		return connError(ErrCodeCompression, "decode header block err:%v", err)
+	}
+
+	if st, ok := sc.streams[id]; ok {
+		if st.state != stateOpen {
+			return streamError(id, ErrCodeStreamClosed, "HEADERS on half closed stream")
+		}
+		if !endStream {
+			return streamError(id, ErrCodeProtocol, "trailers without END_STREAM")
+		}
+
+		if _, st.trailer, err = parseFields(id, fields, sc.options.MaxHeaderListSize, true); err != nil {
+			return err
+		}
+		return sc.endStream(st)
+	}
+
+	sc.lastStreamID = id
+	if selfDep {
+		return streamError(id, ErrCodeProtocol, "stream depends on itself")
+	}
+	if sc.goingAway {
+		return streamError(id, ErrCodeRefusedStream, "connection is going away")
+	}
+	if uint32(len(sc.streams)) >= sc.options.MaxConcurrentStreams {
+		return streamError(id, ErrCodeRefusedStream, "too many concurrent streams")
+	}
+
+	st, err := newStream(id, fields, sc.options)
+	if err != nil {
+		if errors.Is(err, errHeaderTooLarge) {
+			sc.writeEarlyResponse(id, http.StatusRequestHeaderFieldsTooLarge, endStream)
+			return nil
+		}
+		return err
+	}
+
+	st.recvWindow, st.sendWindow = int64(sc.options.InitialWindowSize), sc.peerWindowSize
+	sc.streams[id] = st
+	if endStream {
+		return sc.endStream(st)
+	}
+	return nil
+}
+
+func (sc *serverConn) handleData(f *Frame) error {
+	if f.StreamID == 0 {
+		return connError(ErrCodeProtocol, "DATA on stream 0")
+	}
+
+	// the padding is counted by the flow control.
+	n := int64(len(f.Payload))
+	if n > sc.recvWindow {
+		return connError(ErrCodeFlowControl, "connection window exceeded")
+	}
+	// the connection window is replenished at once, the buffered request bodies are limited by MaxBodyBytes.
+	if n > 0 {
+		sc.writeFrame(NewWindowUpdateFrame(0, uint32(n)))
+	}
+
+	st, ok := sc.streams[f.StreamID]
+	if !ok {
+		if f.StreamID > sc.lastStreamID {
+			return connError(ErrCodeProtocol, "DATA on idle stream %d", f.StreamID)
+		}
+		return streamError(f.StreamID, ErrCodeStreamClosed, "DATA on closed stream")
+	}
+	if st.state != stateOpen {
+		return streamError(st.id, ErrCodeStreamClosed, "DATA on half closed stream")
+	}
+	if n > st.recvWindow {
+		return streamError(st.id, ErrCodeFlowControl, "stream window exceeded")
+	}
+	st.recvWindow -= n
+
+	data, err := f.Data()
+	if err != nil {
+		return err
+	}
+
+	endStream := f.Flags.Has(FlagEndStream)
+	if st.body.Len()+len(data) > sc.options.MaxBodyBytes {
+		sc.writeEarlyResponse(st.id, http.StatusRequestEntityTooLarge, endStream)
+		sc.closeStream(st)
+		return nil
+	}
+
+	st.body.Write(data)
+	if endStream {
+		return sc.endStream(st)
+	}
+
+	if n > 0 {
+		sc.writeFrame(NewWindowUpdateFrame(st.id, uint32(n)))
+		st.recvWindow += n
+	}
+	return nil
+}
+
+// endStream the request is received entirely, it is served in a new goroutine.
+func (sc *serverConn) endStream(st *stream) error {
+	st.state = stateHalfClosedRemote
+	if st.contentLength >= 0 && st.contentLength != int64(st.body.Len()) {
+		return streamError(st.id, ErrCodeProtocol, "content-length %d mismatches body length %d",
+			st.contentLength, st.body.Len())
+	}
+
+	req, err := st.newRequest(sc)
+	if err != nil {
+		return err
+	}
+	go sc.serve(st, req)
+	return nil
+}
+
+func (sc *serverConn) serve(st *stream, req *http.Request) {
+	w := &responseWriter{header: make(http.Header)}
+	defer func() {
+		if err := recover(); err != nil {
+			if err != http.ErrAbortHandler {
+				log.Errorf("http2: panic serving %s: %v", req.RemoteAddr, err)
+			}
+			sc.resetStream(st, ErrCodeInternal)
+		}
+	}()
+
+	sc.server.handler.ServeHTTP(w, req)
+	status, header, body, trailer := w.response(req)
+	sc.writeResponse(st, status, header, body, trailer)
+}
+
+func (sc *serverConn) resetStream(st *stream, code ErrCode) {
+	sc.mu.Lock()
+	defer sc.unlock()
+	if sc.streams[st.id] != st {
+		return
+	}
+
+	sc.writeFrame(NewRSTStreamFrame(st.id, code))
+	sc.closeStream(st)
+}
+
+func (sc *serverConn) writeResponse(st *stream, status int, header http.Header, body []byte, trailer http.Header) {
+	sc.mu.Lock()
+	defer sc.unlock()
+	// the stream is reset by the client, or the connection is closed.
+	if sc.streams[st.id] != st {
+		return
+	}
+
+	endStream := len(body) == 0 && len(trailer) == 0
+	sc.writeHeaderBlock(st.id, sc.encodeHeaders(status, header), endStream)
+	if endStream {
+		sc.closeStream(st)
+		return
+	}
+
+	st.pending, st.pendingTrailer, st.pendingEnd = body, trailer, true
+	sc.sendPending(st)
+}
+
+// writeEarlyResponse reply the error status before the request is received entirely,
+// the client stops sending the request by RST_STREAM NO_ERROR.
+func (sc *serverConn) writeEarlyResponse(id uint32, status int, endStream bool) {
+	sc.writeHeaderBlock(id, sc.encodeHeaders(status, http.Header{"Content-Length": {"0"}}), true)
+	if !endStream {
+		sc.writeFrame(NewRSTStreamFrame(id, ErrCodeNo))
+	}
+}
+
+// sendPending send the pending response data allowed by the flow control windows, and the trailers after it.
+func (sc *serverConn) sendPending(st *stream) {
+	for len(st.pending) > 0 {
+		n := int64(len(st.pending))
+		for _, limit := range []int64{int64(sc.peerMaxFrameSize), st.sendWindow, sc.sendWindow} {
+			if limit < n {
+				n = limit
+			}
+		}
+		if n <= 0 {
+			return
+		}
+
+		data := st.pending[:n]
+		st.pending = st.pending[n:]
+		st.sendWindow -= n
+		sc.sendWindow -= n
+		sc.writeFrame(NewDataFrame(st.id, data, len(st.pending) == 0 && len(st.pendingTrailer) == 0))
+	}
+
+	if !st.pendingEnd {
+		return
+	}
+	if len(st.pendingTrailer) > 0 {
+		sc.writeHeaderBlock(st.id, sc.encodeHeaders(0, st.pendingTrailer), true)
+	}
+	sc.closeStream(st)
+}
+
+func (sc *serverConn) sendPendingAll() {
+	ids := make([]uint32, 0, len(sc.streams))
+	for id, st := range sc.streams {
+		if st.pendingEnd {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if sc.sendWindow <= 0 {
+			return
+		}
+		sc.sendPending(sc.streams[id])
+	}
+}
+
+func (sc *serverConn) closeStream(st *stream) {
+	delete(sc.streams, st.id)
+	st.cancel()
+	if sc.goingAway && len(sc.streams) == 0 {
+		sc.closing = true
+	}
+}
+
+// encodeHeaders encode the status and the header by HPACK, the status 0 means the trailers.
+func (sc *serverConn) encodeHeaders(status int, header http.Header) []byte {
+	sc.hbuf.Reset()
+	if status != 0 {
+		_ = sc.henc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
+	}
+
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := strings.ToLower(k)
+		if connectionHeaders[name] {
+			continue
+		}
+		for _, v := range header[k] {
+			_ = sc.henc.WriteField(hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	return sc.hbuf.Bytes()
+}
+
+// writeHeaderBlock write the block by a HEADERS frame and the CONTINUATION frames limited by the peer frame size.
+func (sc *serverConn) writeHeaderBlock(id uint32, block []byte, endStream bool) {
+	first := true
+	for {
+		fragment := block
+		if len(fragment) > int(sc.peerMaxFrameSize) {
+			fragment = fragment[:sc.peerMaxFrameSize]
+		}
+		block = block[len(fragment):]
+
+		if first {
+			sc.writeFrame(NewHeadersFrame(id, fragment, endStream, len(block) == 0))
+			first = false
+		} else {
+			sc.writeFrame(NewContinuationFrame(id, fragment, len(block) == 0))
+		}
+
+		if len(block) == 0 {
+			return
+		}
+	}
+}
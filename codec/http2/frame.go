@@ -0,0 +1,428 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"go.uber.org/atomic"
+)
+
+const frameHeaderLen = 9
+
+// FrameType the type of frames.
+type FrameType uint8
+
+const (
+	FrameData         FrameType = 0x0
+	FrameHeaders      FrameType = 0x1
+	FramePriority     FrameType = 0x2
+	FrameRSTStream    FrameType = 0x3
+	FrameSettings     FrameType = 0x4
+	FramePushPromise  FrameType = 0x5
+	FramePing         FrameType = 0x6
+	FrameGoAway       FrameType = 0x7
+	FrameWindowUpdate FrameType = 0x8
+	FrameContinuation FrameType = 0x9
+)
+
+var frameNames = map[FrameType]string{
+	FrameData:         "DATA",
+	FrameHeaders:      "HEADERS",
+	FramePriority:     "PRIORITY",
+	FrameRSTStream:    "RST_STREAM",
+	FrameSettings:     "SETTINGS",
+	FramePushPromise:  "PUSH_PROMISE",
+	FramePing:         "PING",
+	FrameGoAway:       "GOAWAY",
+	FrameWindowUpdate: "WINDOW_UPDATE",
+	FrameContinuation: "CONTINUATION",
+}
+
+// String implements fmt.Stringer.
+func (t FrameType) String() string {
+	if name, ok := frameNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_%d", uint8(t))
+}
+
+// Flags the flags of frames.
+type Flags uint8
+
+const (
+	// FlagEndStream the last frame of the stream sent by the endpoint, in DATA and HEADERS
+	FlagEndStream Flags = 0x1
+	// FlagAck the acknowledgement of SETTINGS and PING
+	FlagAck Flags = 0x1
+	// FlagEndHeaders the header block ends in the frame, in HEADERS and CONTINUATION
+	FlagEndHeaders Flags = 0x4
+	// FlagPadded the payload is padded, in DATA and HEADERS
+	FlagPadded Flags = 0x8
+	// FlagPriority the priority fields are present, in HEADERS
+	FlagPriority Flags = 0x20
+)
+
+// Has return whether the flags contain v.
+func (f Flags) Has(v Flags) bool {
+	return f&v == v
+}
+
+// SettingID the identifier of SETTINGS parameters.
+type SettingID uint16
+
+const (
+	SettingHeaderTableSize      SettingID = 0x1
+	SettingEnablePush           SettingID = 0x2
+	SettingMaxConcurrentStreams SettingID = 0x3
+	SettingInitialWindowSize    SettingID = 0x4
+	SettingMaxFrameSize         SettingID = 0x5
+	SettingMaxHeaderListSize    SettingID = 0x6
+)
+
+// Setting a SETTINGS parameter.
+type Setting struct {
+	ID  SettingID
+	Val uint32
+}
+
+// Valid check the value of the setting, the unknown settings are valid as they are ignored.
+func (s Setting) Valid() error {
+	switch s.ID {
+	case SettingEnablePush:
+		if s.Val > 1 {
+			return connError(ErrCodeProtocol, "invalid ENABLE_PUSH %d", s.Val)
+		}
+	case SettingInitialWindowSize:
+		if s.Val > maxWindowSize {
+			return connError(ErrCodeFlowControl, "invalid INITIAL_WINDOW_SIZE %d", s.Val)
+		}
+	case SettingMaxFrameSize:
+		if s.Val < DefaultMaxFrameSize || s.Val > maxFrameSizeLimit {
+			return connError(ErrCodeProtocol, "invalid MAX_FRAME_SIZE %d", s.Val)
+		}
+	}
+	return nil
+}
+
+// Priority the priority fields of HEADERS and PRIORITY frames.
+type Priority struct {
+	StreamDep uint32
+	Exclusive bool
+	Weight    uint8
+}
+
+// FrameHeader the fixed 9 bytes header of frames.
+type FrameHeader struct {
+	// Length the length of the payload, it is ignored when encoding
+	Length   uint32
+	Type     FrameType
+	Flags    Flags
+	StreamID uint32
+}
+
+// Frame a HTTP/2 frame, the payload is interpreted by the helpers of the frame type.
+type Frame struct {
+	FrameHeader
+	Payload []byte
+}
+
+// String implements fmt.Stringer.
+func (f *Frame) String() string {
+	return fmt.Sprintf("[%s flags=0x%x stream=%d len=%d]", f.Type, uint8(f.Flags), f.StreamID, len(f.Payload))
+}
+
+// Append append the encoded frame to dst.
+func (f *Frame) Append(dst []byte) []byte {
+	n := len(f.Payload)
+	dst = append(dst, byte(n>>16), byte(n>>8), byte(n), byte(f.Type), byte(f.Flags))
+	dst = appendUint32(dst, f.StreamID&(1<<31-1))
+	return append(dst, f.Payload...)
+}
+
+// unpad strip the padding of DATA and HEADERS frames.
+func (f *Frame) unpad() ([]byte, error) {
+	payload := f.Payload
+	if !f.Flags.Has(FlagPadded) {
+		return payload, nil
+	}
+
+	if len(payload) == 0 {
+		return nil, connError(ErrCodeFrameSize, "%s without pad length", f.Type)
+	}
+	padLen := int(payload[0])
+	payload = payload[1:]
+	if padLen > len(payload) {
+		return nil, connError(ErrCodeProtocol, "%s pad length %d exceeds the payload", f.Type, padLen)
+	}
+	return payload[:len(payload)-padLen], nil
+}
+
+// Data return the data of DATA frames without padding.
+func (f *Frame) Data() ([]byte, error) {
+	return f.unpad()
+}
+
+// HeaderBlock return the header block fragment of HEADERS and CONTINUATION frames,
+// and the priority fields of HEADERS frames if present.
+func (f *Frame) HeaderBlock() ([]byte, *Priority, error) {
+	if f.Type == FrameContinuation {
+		return f.Payload, nil, nil
+	}
+
+	payload, err := f.unpad()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !f.Flags.Has(FlagPriority) {
+		return payload, nil, nil
+	}
+
+	if len(payload) < 5 {
+		return nil, nil, connError(ErrCodeFrameSize, "HEADERS priority fields too short")
+	}
+	priority := parsePriority(payload)
+	return payload[5:], &priority, nil
+}
+
+// Priority return the priority fields of PRIORITY frames.
+func (f *Frame) Priority() (Priority, error) {
+	if len(f.Payload) != 5 {
+		return Priority{}, streamError(f.StreamID, ErrCodeFrameSize, "PRIORITY length %d", len(f.Payload))
+	}
+	return parsePriority(f.Payload), nil
+}
+
+func parsePriority(payload []byte) Priority {
+	dep := binary.BigEndian.Uint32(payload)
+	return Priority{StreamDep: dep & (1<<31 - 1), Exclusive: dep>>31 == 1, Weight: payload[4]}
+}
+
+// Settings return the parameters of SETTINGS frames.
+func (f *Frame) Settings() ([]Setting, error) {
+	if len(f.Payload)%6 != 0 {
+		return nil, connError(ErrCodeFrameSize, "SETTINGS length %d", len(f.Payload))
+	}
+
+	settings := make([]Setting, 0, len(f.Payload)/6)
+	for payload := f.Payload; len(payload) > 0; payload = payload[6:] {
+		settings = append(settings, Setting{
+			ID:  SettingID(binary.BigEndian.Uint16(payload)),
+			Val: binary.BigEndian.Uint32(payload[2:]),
+		})
+	}
+	return settings, nil
+}
+
+// WindowIncrement return the window size increment of WINDOW_UPDATE frames.
+func (f *Frame) WindowIncrement() (uint32, error) {
+	if len(f.Payload) != 4 {
+		return 0, connError(ErrCodeFrameSize, "WINDOW_UPDATE length %d", len(f.Payload))
+	}
+	return binary.BigEndian.Uint32(f.Payload) & (1<<31 - 1), nil
+}
+
+// ErrCode return the error code of RST_STREAM frames.
+func (f *Frame) ErrCode() (ErrCode, error) {
+	if len(f.Payload) != 4 {
+		return 0, connError(ErrCodeFrameSize, "RST_STREAM length %d", len(f.Payload))
+	}
+	return ErrCode(binary.BigEndian.Uint32(f.Payload)), nil
+}
+
+// GoAway return the last stream id, the error code and the debug data of GOAWAY frames.
+func (f *Frame) GoAway() (uint32, ErrCode, []byte, error) {
+	if len(f.Payload) < 8 {
+		return 0, 0, nil, connError(ErrCodeFrameSize, "GOAWAY length %d", len(f.Payload))
+	}
+	lastStreamID := binary.BigEndian.Uint32(f.Payload) & (1<<31 - 1)
+	return lastStreamID, ErrCode(binary.BigEndian.Uint32(f.Payload[4:])), f.Payload[8:], nil
+}
+
+// NewDataFrame return a DATA frame.
+func NewDataFrame(streamID uint32, data []byte, endStream bool) *Frame {
+	f := &Frame{FrameHeader: FrameHeader{Type: FrameData, StreamID: streamID}, Payload: data}
+	if endStream {
+		f.Flags |= FlagEndStream
+	}
+	return f
+}
+
+// NewHeadersFrame return a HEADERS frame carrying the header block fragment.
+func NewHeadersFrame(streamID uint32, block []byte, endStream, endHeaders bool) *Frame {
+	f := &Frame{FrameHeader: FrameHeader{Type: FrameHeaders, StreamID: streamID}, Payload: block}
+	if endStream {
+		f.Flags |= FlagEndStream
+	}
+	if endHeaders {
+		f.Flags |= FlagEndHeaders
+	}
+	return f
+}
+
+// NewContinuationFrame return a CONTINUATION frame carrying the header block fragment.
+func NewContinuationFrame(streamID uint32, block []byte, endHeaders bool) *Frame {
+	f := &Frame{FrameHeader: FrameHeader{Type: FrameContinuation, StreamID: streamID}, Payload: block}
+	if endHeaders {
+		f.Flags |= FlagEndHeaders
+	}
+	return f
+}
+
+// NewSettingsFrame return a SETTINGS frame.
+func NewSettingsFrame(settings ...Setting) *Frame {
+	payload := make([]byte, 0, 6*len(settings))
+	for _, s := range settings {
+		payload = appendUint16(payload, uint16(s.ID))
+		payload = appendUint32(payload, s.Val)
+	}
+	return &Frame{FrameHeader: FrameHeader{Type: FrameSettings}, Payload: payload}
+}
+
+// NewSettingsAckFrame return the acknowledgement of SETTINGS.
+func NewSettingsAckFrame() *Frame {
+	return &Frame{FrameHeader: FrameHeader{Type: FrameSettings, Flags: FlagAck}}
+}
+
+// NewPingFrame return a PING frame.
+func NewPingFrame(data [8]byte, ack bool) *Frame {
+	f := &Frame{FrameHeader: FrameHeader{Type: FramePing}, Payload: data[:]}
+	if ack {
+		f.Flags |= FlagAck
+	}
+	return f
+}
+
+// NewWindowUpdateFrame return a WINDOW_UPDATE frame, the stream id 0 updates the window of the connection.
+func NewWindowUpdateFrame(streamID, increment uint32) *Frame {
+	return &Frame{
+		FrameHeader: FrameHeader{Type: FrameWindowUpdate, StreamID: streamID},
+		Payload:     appendUint32(nil, increment),
+	}
+}
+
+// NewRSTStreamFrame return a RST_STREAM frame.
+func NewRSTStreamFrame(streamID uint32, code ErrCode) *Frame {
+	return &Frame{
+		FrameHeader: FrameHeader{Type: FrameRSTStream, StreamID: streamID},
+		Payload:     appendUint32(nil, uint32(code)),
+	}
+}
+
+// NewGoAwayFrame return a GOAWAY frame.
+func NewGoAwayFrame(lastStreamID uint32, code ErrCode, debug []byte) *Frame {
+	payload := appendUint32(nil, lastStreamID)
+	payload = appendUint32(payload, uint32(code))
+	return &Frame{FrameHeader: FrameHeader{Type: FrameGoAway}, Payload: append(payload, debug...)}
+}
+
+// Preface the connection preface of the client, it is decoded by the server codec before the frames.
+type Preface struct{}
+
+// FrameCodec the codec of HTTP/2 frames, the packages are *Frame, Preface or encoded []byte.
+type FrameCodec struct {
+	maxFrameSize atomic.Uint32
+	// preface the connection preface is expected before the frames
+	preface atomic.Bool
+}
+
+// NewServerCodec return a codec decoding the client preface and the frames.
+func NewServerCodec(opts ...Option) *FrameCodec {
+	c := NewFrameCodec(opts...)
+	c.preface.Store(true)
+	return c
+}
+
+// NewFrameCodec return a codec decoding the frames only, e.g. the client side, or the server side
+// after the preface is received.
+func NewFrameCodec(opts ...Option) *FrameCodec {
+	c := &FrameCodec{}
+	c.maxFrameSize.Store(newOptions(opts...).MaxFrameSize)
+	return c
+}
+
+// SetMaxFrameSize set the maximum payload size of the received frames.
+func (c *FrameCodec) SetMaxFrameSize(n uint32) {
+	c.maxFrameSize.Store(n)
+}
+
+// Encode implements session.Codec.
+func (c *FrameCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch p := pkg.(type) {
+	case *Frame:
+		return p.Append(make([]byte, 0, frameHeaderLen+len(p.Payload))), nil
+	case Preface:
+		return []byte(ClientPreface), nil
+	case []byte:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("http2 codec can not encode pkg type:%T", pkg)
+	}
+}
+
+// Decode implements session.Codec.
+func (c *FrameCodec) Decode(data []byte) (interface{}, int, error) {
+	if c.preface.Load() {
+		n := len(ClientPreface)
+		if len(data) < n {
+			if !bytes.HasPrefix([]byte(ClientPreface), data) {
+				return nil, 0, connError(ErrCodeProtocol, "invalid connection preface")
+			}
+			return nil, 0, nil
+		}
+
+		if string(data[:n]) != ClientPreface {
+			return nil, 0, connError(ErrCodeProtocol, "invalid connection preface")
+		}
+		c.preface.Store(false)
+		return Preface{}, n, nil
+	}
+
+	if len(data) < frameHeaderLen {
+		return nil, 0, nil
+	}
+
+	header := FrameHeader{
+		Length:   uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]),
+		Type:     FrameType(data[3]),
+		Flags:    Flags(data[4]),
+		StreamID: binary.BigEndian.Uint32(data[5:]) & (1<<31 - 1),
+	}
+	if header.Length > c.maxFrameSize.Load() {
+		return nil, 0, connError(ErrCodeFrameSize, "%s length %d exceeds the limit", header.Type, header.Length)
+	}
+
+	n := frameHeaderLen + int(header.Length)
+	if len(data) < n {
+		return nil, 0, nil
+	}
+
+	// the network buffer is reused after decoding.
+	payload := make([]byte, header.Length)
+	copy(payload, data[frameHeaderLen:n])
+	return &Frame{FrameHeader: header, Payload: payload}, n, nil
+}
+
+func appendUint16(dst []byte, v uint16) []byte {
+	return append(dst, byte(v>>8), byte(v))
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
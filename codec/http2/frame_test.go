@@ -0,0 +1,110 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameCodec(t *testing.T) {
+	codec := NewServerCodec()
+
+	// half preface.
+	pkg, n, err := codec.Decode([]byte(ClientPreface[:10]))
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	data := append([]byte(ClientPreface), NewSettingsFrame(Setting{ID: SettingMaxFrameSize, Val: 1 << 15}).Append(nil)...)
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, Preface{}, pkg)
+	data = data[n:]
+
+	// half frame.
+	pkg, n, err = codec.Decode(data[:frameHeaderLen+1])
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	f := pkg.(*Frame)
+	assert.Equal(t, FrameSettings, f.Type)
+	settings, err := f.Settings()
+	assert.Nil(t, err)
+	assert.Equal(t, []Setting{{ID: SettingMaxFrameSize, Val: 1 << 15}}, settings)
+
+	// the frame exceeds the max frame size.
+	_, _, err = codec.Decode(NewDataFrame(1, make([]byte, DefaultMaxFrameSize+1), false).Append(nil))
+	assert.Equal(t, ErrCodeFrameSize, err.(ConnectionError).Code)
+	codec.SetMaxFrameSize(DefaultMaxFrameSize + 1)
+	pkg, _, err = codec.Decode(NewDataFrame(1, make([]byte, DefaultMaxFrameSize+1), true).Append(nil))
+	assert.Nil(t, err)
+	assert.True(t, pkg.(*Frame).Flags.Has(FlagEndStream))
+
+	// invalid preface.
+	_, _, err = NewServerCodec().Decode([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, ErrCodeProtocol, err.(ConnectionError).Code)
+
+	encoded, err := codec.Encode(NewRSTStreamFrame(3, ErrCodeCancel))
+	assert.Nil(t, err)
+	pkg, _, err = NewFrameCodec().Decode(encoded)
+	assert.Nil(t, err)
+	code, err := pkg.(*Frame).ErrCode()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrCodeCancel, code)
+	assert.Equal(t, uint32(3), pkg.(*Frame).StreamID)
+}
+
+func TestFrame_Payload(t *testing.T) {
+	// padded DATA.
+	f := &Frame{FrameHeader: FrameHeader{Type: FrameData, Flags: FlagPadded}, Payload: []byte{2, 'h', 'i', 0, 0}}
+	data, err := f.Data()
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", string(data))
+	f.Payload = []byte{5, 'h', 'i'}
+	_, err = f.Data()
+	assert.Equal(t, ErrCodeProtocol, err.(ConnectionError).Code)
+
+	// padded HEADERS with priority.
+	f = &Frame{
+		FrameHeader: FrameHeader{Type: FrameHeaders, Flags: FlagPadded | FlagPriority, StreamID: 3},
+		Payload:     []byte{1, 0x80, 0, 0, 1, 15, 'b', 0},
+	}
+	block, priority, err := f.HeaderBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(block))
+	assert.Equal(t, &Priority{StreamDep: 1, Exclusive: true, Weight: 15}, priority)
+
+	lastStreamID, code, debug, err := NewGoAwayFrame(5, ErrCodeProtocol, []byte("bye")).GoAway()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), lastStreamID)
+	assert.Equal(t, ErrCodeProtocol, code)
+	assert.Equal(t, "bye", string(debug))
+
+	increment, err := NewWindowUpdateFrame(1, 1024).WindowIncrement()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1024), increment)
+
+	assert.NotNil(t, Setting{ID: SettingMaxFrameSize, Val: 1024}.Valid())
+	assert.NotNil(t, Setting{ID: SettingInitialWindowSize, Val: 1 << 31}.Valid())
+	assert.Nil(t, Setting{ID: 0xff, Val: 1}.Valid())
+}
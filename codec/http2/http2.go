@@ -0,0 +1,201 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package http2 impl the HTTP/2 frame codec for knetty sessions, and the server multiplexing the streams
+// of a connection to net/http.Handler, over h2c with prior knowledge or TLS negotiating h2 by ALPN.
+package http2
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ClientPreface the connection preface sent by the client before the frames.
+	ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// NextProtoTLS the ALPN protocol identifier of HTTP/2 over TLS.
+	NextProtoTLS = "h2"
+
+	// DefaultMaxFrameSize the default maximum payload size of the received frames.
+	DefaultMaxFrameSize = 1 << 14
+	// DefaultInitialWindowSize the default flow control window of the connection and the streams.
+	DefaultInitialWindowSize = 65535
+	// DefaultMaxConcurrentStreams the default maximum number of concurrent streams of a connection.
+	DefaultMaxConcurrentStreams = 250
+	// DefaultMaxHeaderListSize the default maximum size of the decoded header list of a request.
+	DefaultMaxHeaderListSize = 1 << 20
+	// DefaultMaxBodyBytes the default maximum bytes of a request body.
+	DefaultMaxBodyBytes = 4 << 20
+
+	maxFrameSizeLimit = 1<<24 - 1
+	maxWindowSize     = 1<<31 - 1
+	headerTableSize   = 4096
+)
+
+// ErrCode the error code of RST_STREAM and GOAWAY frames.
+type ErrCode uint32
+
+const (
+	ErrCodeNo                 ErrCode = 0x0
+	ErrCodeProtocol           ErrCode = 0x1
+	ErrCodeInternal           ErrCode = 0x2
+	ErrCodeFlowControl        ErrCode = 0x3
+	ErrCodeSettingsTimeout    ErrCode = 0x4
+	ErrCodeStreamClosed       ErrCode = 0x5
+	ErrCodeFrameSize          ErrCode = 0x6
+	ErrCodeRefusedStream      ErrCode = 0x7
+	ErrCodeCancel             ErrCode = 0x8
+	ErrCodeCompression        ErrCode = 0x9
+	ErrCodeConnect            ErrCode = 0xa
+	ErrCodeEnhanceYourCalm    ErrCode = 0xb
+	ErrCodeInadequateSecurity ErrCode = 0xc
+	ErrCodeHTTP11Required     ErrCode = 0xd
+)
+
+var errCodeNames = map[ErrCode]string{
+	ErrCodeNo:                 "NO_ERROR",
+	ErrCodeProtocol:           "PROTOCOL_ERROR",
+	ErrCodeInternal:           "INTERNAL_ERROR",
+	ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	ErrCodeStreamClosed:       "STREAM_CLOSED",
+	ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	ErrCodeRefusedStream:      "REFUSED_STREAM",
+	ErrCodeCancel:             "CANCEL",
+	ErrCodeCompression:        "COMPRESSION_ERROR",
+	ErrCodeConnect:            "CONNECT_ERROR",
+	ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+// String implements fmt.Stringer.
+func (c ErrCode) String() string {
+	if name, ok := errCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint32(c))
+}
+
+// ConnectionError the error terminating the connection, it is sent to the peer by GOAWAY.
+type ConnectionError struct {
+	Code   ErrCode
+	Reason string
+}
+
+// Error implements error.
+func (e ConnectionError) Error() string {
+	return fmt.Sprintf("http2 connection error %s: %s", e.Code, e.Reason)
+}
+
+// StreamError the error terminating a stream, it is sent to the peer by RST_STREAM.
+type StreamError struct {
+	StreamID uint32
+	Code     ErrCode
+	Reason   string
+}
+
+// Error implements error.
+func (e StreamError) Error() string {
+	return fmt.Sprintf("http2 stream %d error %s: %s", e.StreamID, e.Code, e.Reason)
+}
+
+// ErrServerClosed is returned by ServeConn after the server is shut down.
+var ErrServerClosed = errors.New("http2: server closed")
+
+func connError(code ErrCode, format string, args ...interface{}) error {
+	return ConnectionError{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+func streamError(id uint32, code ErrCode, format string, args ...interface{}) error {
+	return StreamError{StreamID: id, Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Option option for the codec and the server.
+type Option func(*Options)
+
+// Options options for the codec and the server.
+type Options struct {
+	// MaxFrameSize the maximum payload size of the received frames, advertised by SETTINGS_MAX_FRAME_SIZE
+	MaxFrameSize uint32
+	// InitialWindowSize the flow control window of the connection and the streams for receiving
+	InitialWindowSize uint32
+	// MaxConcurrentStreams the maximum number of concurrent streams, advertised by SETTINGS_MAX_CONCURRENT_STREAMS
+	MaxConcurrentStreams uint32
+	// MaxHeaderListSize the maximum size of the header list, advertised by SETTINGS_MAX_HEADER_LIST_SIZE
+	MaxHeaderListSize uint32
+	// MaxBodyBytes the maximum bytes of a request body
+	MaxBodyBytes int
+}
+
+// WithMaxFrameSize set the maximum payload size of the received frames, it is between 16KB and 16MB.
+func WithMaxFrameSize(n uint32) Option {
+	return func(opt *Options) {
+		if n >= DefaultMaxFrameSize && n <= maxFrameSizeLimit {
+			opt.MaxFrameSize = n
+		}
+	}
+}
+
+// WithInitialWindowSize set the flow control window for receiving, it is between 64KB and 2GB.
+func WithInitialWindowSize(n uint32) Option {
+	return func(opt *Options) {
+		if n >= DefaultInitialWindowSize && n <= maxWindowSize {
+			opt.InitialWindowSize = n
+		}
+	}
+}
+
+// WithMaxConcurrentStreams set the maximum number of concurrent streams of a connection.
+func WithMaxConcurrentStreams(n uint32) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxConcurrentStreams = n
+		}
+	}
+}
+
+// WithMaxHeaderListSize set the maximum size of the header list of a request.
+func WithMaxHeaderListSize(n uint32) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxHeaderListSize = n
+		}
+	}
+}
+
+// WithMaxBodyBytes set the maximum bytes of a request body.
+func WithMaxBodyBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxBodyBytes = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		MaxFrameSize:         DefaultMaxFrameSize,
+		InitialWindowSize:    DefaultInitialWindowSize,
+		MaxConcurrentStreams: DefaultMaxConcurrentStreams,
+		MaxHeaderListSize:    DefaultMaxHeaderListSize,
+		MaxBodyBytes:         DefaultMaxBodyBytes,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
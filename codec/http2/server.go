@@ -0,0 +1,248 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Softwarekang/knetty/session"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// Server serves a net/http.Handler over HTTP/2 connections, the streams of a connection are served concurrently,
+// each handler runs in its own goroutine instead of the event loop.
+type Server struct {
+	handler http.Handler
+	opts    []Option
+	options *Options
+
+	mu       sync.Mutex
+	conns    map[*serverConn]struct{}
+	shutdown bool
+}
+
+// NewServer return a server serving handler, opts are used to create the codecs and the connections.
+func NewServer(handler http.Handler, opts ...Option) *Server {
+	return &Server{
+		handler: handler,
+		opts:    opts,
+		options: newOptions(opts...),
+		conns:   make(map[*serverConn]struct{}),
+	}
+}
+
+// Setup install the codec and the eventListener serving h2c with prior knowledge for the session,
+// it can be used in NewSessionCallBackFunc or as the setup of a sniffed protocol.
+func (srv *Server) Setup(s session.Session) error {
+	sc, err := srv.newConn(s, nil)
+	if err != nil {
+		return err
+	}
+
+	s.SetCodec(NewServerCodec(srv.opts...))
+	s.SetEventListener(sc)
+	return nil
+}
+
+// MatchPreface return a session.Matcher matching the client connection preface, it sniffs h2c with prior knowledge.
+func MatchPreface() session.Matcher {
+	return session.MatchPrefix([]byte(ClientPreface))
+}
+
+// ConfigureTLS add h2 to the ALPN protocols of cfg, the connections negotiating h2 are served by ServeConn.
+func ConfigureTLS(cfg *tls.Config) *tls.Config {
+	for _, proto := range cfg.NextProtos {
+		if proto == NextProtoTLS {
+			return cfg
+		}
+	}
+	cfg.NextProtos = append([]string{NextProtoTLS}, cfg.NextProtos...)
+	return cfg
+}
+
+// ServeConn serve HTTP/2 over c until the connection is closed, c is usually a *tls.Conn negotiating h2 by ALPN,
+// or a net.Conn speaking h2c with prior knowledge.
+func (srv *Server) ServeConn(c net.Conn) error {
+	defer c.Close()
+
+	var state *tls.ConnectionState
+	if tc, ok := c.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return err
+		}
+
+		cs := tc.ConnectionState()
+		if cs.NegotiatedProtocol != NextProtoTLS {
+			return fmt.Errorf("http2: negotiated protocol %q", cs.NegotiatedProtocol)
+		}
+		state = &cs
+	}
+
+	sc, err := srv.newConn(&connTransport{conn: c}, state)
+	if err != nil {
+		return err
+	}
+
+	sc.OnConnect(nil)
+	defer sc.OnClose(nil)
+	if state != nil && state.Version < tls.VersionTLS12 {
+		sc.OnError(nil, connError(ErrCodeInadequateSecurity, "TLS version 0x%x", state.Version))
+		return nil
+	}
+
+	codec := NewServerCodec(srv.opts...)
+	var buf []byte
+	readBuf := make([]byte, 32<<10)
+	for {
+		n, err := c.Read(readBuf)
+		buf = append(buf, readBuf[:n]...)
+		for len(buf) > 0 {
+			pkg, pkgLen, err := codec.Decode(buf)
+			if err != nil {
+				sc.OnError(nil, err)
+				return nil
+			}
+			if pkg == nil {
+				break
+			}
+
+			buf = buf[pkgLen:]
+			sc.OnMessage(nil, pkg)
+		}
+
+		if err != nil || sc.isClosed() {
+			if err == nil || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Shutdown send GOAWAY to the connections and wait for them closing after the active streams are served,
+// or until ctx is done.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	srv.shutdown = true
+	conns := make([]*serverConn, 0, len(srv.conns))
+	for sc := range srv.conns {
+		conns = append(conns, sc)
+	}
+	srv.mu.Unlock()
+
+	for _, sc := range conns {
+		sc.goAway()
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		srv.mu.Lock()
+		n := len(srv.conns)
+		srv.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srv *Server) newConn(t transport, state *tls.ConnectionState) (*serverConn, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.shutdown {
+		return nil, ErrServerClosed
+	}
+
+	sc := &serverConn{
+		server:           srv,
+		options:          srv.options,
+		t:                t,
+		tlsState:         state,
+		streams:          make(map[uint32]*stream),
+		peerMaxFrameSize: DefaultMaxFrameSize,
+		peerWindowSize:   DefaultInitialWindowSize,
+		sendWindow:       DefaultInitialWindowSize,
+		recvWindow:       DefaultInitialWindowSize,
+	}
+	sc.hdec = hpack.NewDecoder(headerTableSize, nil)
+	sc.hdec.SetMaxStringLength(int(srv.options.MaxHeaderListSize))
+	sc.henc = hpack.NewEncoder(&sc.hbuf)
+	srv.conns[sc] = struct{}{}
+	return sc, nil
+}
+
+func (srv *Server) removeConn(sc *serverConn) {
+	srv.mu.Lock()
+	delete(srv.conns, sc)
+	srv.mu.Unlock()
+}
+
+// transport the connection written by the server, it is implemented by session.Session.
+type transport interface {
+	LocalAddr() string
+	RemoteAddr() string
+	WriteBuffer([]byte) (int, error)
+	FlushBuffer() error
+	Close() error
+}
+
+// connTransport a transport of net.Conn, the writes are serialized by the serverConn.
+type connTransport struct {
+	conn net.Conn
+	buf  []byte
+}
+
+func (t *connTransport) LocalAddr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *connTransport) RemoteAddr() string {
+	return t.conn.RemoteAddr().String()
+}
+
+func (t *connTransport) WriteBuffer(data []byte) (int, error) {
+	t.buf = append(t.buf, data...)
+	return len(data), nil
+}
+
+func (t *connTransport) FlushBuffer() error {
+	if len(t.buf) == 0 {
+		return nil
+	}
+	_, err := t.conn.Write(t.buf)
+	t.buf = t.buf[:0]
+	return err
+}
+
+func (t *connTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,394 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/codec/http1"
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+	xhttp2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// serve run a knetty server calling setup for the sessions, it returns the address of the server.
+func serve(t *testing.T, setup func(session.Session) error) string {
+	return knettytest.Serve(t, setup).Addr()
+}
+
+// h2cClient return a client speaking h2c with prior knowledge.
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &xhttp2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+}
+
+func echoHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Proto", r.Proto)
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("/trailer", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Sum")
+		_, _ = w.Write([]byte("body"))
+		w.Header().Set("X-Sum", "4")
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	return mux
+}
+
+func TestServer_H2C(t *testing.T) {
+	addr := serve(t, NewServer(echoHandler()).Setup)
+	client := h2cClient()
+
+	resp, err := client.Get("http://" + addr + "/echo")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	// the bodies exceeding the flow control windows in both directions.
+	large := bytes.Repeat([]byte("knetty"), 100<<10)
+	resp, err = client.Post("http://"+addr+"/echo", "text/plain", bytes.NewReader(large))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, large, body)
+
+	// the concurrent streams of a connection.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Post("http://"+addr+"/echo", "text/plain", strings.NewReader(fmt.Sprint(i)))
+			if !assert.Nil(t, err) {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			assert.Equal(t, fmt.Sprint(i), string(body))
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err = client.Get("http://" + addr + "/trailer")
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "body", string(body))
+	assert.Equal(t, "4", resp.Trailer.Get("X-Sum"))
+
+	resp, err = client.Head("http://" + addr + "/echo")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "HEAD", resp.Header.Get("X-Method"))
+
+	// the stream is reset, the connection is still usable.
+	_, err = client.Get("http://" + addr + "/panic")
+	assert.NotNil(t, err)
+	resp, err = client.Get("http://" + addr + "/echo")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestServer_SlowReader(t *testing.T) {
+	addr := serve(t, NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte(r.URL.Path[1:]), 256<<10))
+	})).Setup)
+	client := h2cClient()
+
+	// the handler goroutines write the streams while the event loop flushes the connection to the slow reader.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := client.Get("http://" + addr + "/" + path)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			var body bytes.Buffer
+			buf := make([]byte, 16<<10)
+			for {
+				n, err := resp.Body.Read(buf)
+				body.Write(buf[:n])
+				if err != nil {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			assert.Equal(t, bytes.Repeat([]byte(path), 256<<10), body.Bytes())
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+}
+
+func TestServer_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	lsr, err := tls.Listen("tcp", "127.0.0.1:0", ConfigureTLS(&tls.Config{Certificates: []tls.Certificate{cert}}))
+	assert.Nil(t, err)
+	defer lsr.Close()
+
+	srv := NewServer(echoHandler())
+	go func() {
+		for {
+			conn, err := lsr.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = srv.ServeConn(conn)
+			}()
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Post("https://"+lsr.Addr().String()+"/echo", "text/plain", strings.NewReader("knetty"))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	assert.Equal(t, "knetty", string(body))
+	assert.NotNil(t, resp.TLS)
+}
+
+func TestServer_Sniff(t *testing.T) {
+	handler := echoHandler()
+	addr := serve(t, func(s session.Session) error {
+		session.Sniff(s, []session.Protocol{
+			{Name: "h2c", Match: MatchPreface(), Setup: NewServer(handler).Setup},
+			{Name: "http1", Match: session.MatchHTTP(), Setup: http1.NewServer(handler).Setup},
+		})
+		return nil
+	})
+
+	resp, err := h2cClient().Get("http://" + addr + "/echo")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	resp, err = http.Get("http://" + addr + "/echo")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "HTTP/1.1", resp.Header.Get("X-Proto"))
+}
+
+// rawConn a client connection writing and reading frames.
+type rawConn struct {
+	t     *testing.T
+	conn  net.Conn
+	codec *FrameCodec
+	buf   []byte
+	henc  *hpack.Encoder
+	hbuf  bytes.Buffer
+}
+
+func dialRaw(t *testing.T, addr string) *rawConn {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	c := &rawConn{t: t, conn: conn, codec: NewFrameCodec()}
+	c.henc = hpack.NewEncoder(&c.hbuf)
+	_, err = conn.Write([]byte(ClientPreface))
+	assert.Nil(t, err)
+	c.write(NewSettingsFrame())
+	return c
+}
+
+func (c *rawConn) write(f *Frame) {
+	_, err := c.conn.Write(f.Append(nil))
+	assert.Nil(c.t, err)
+}
+
+func (c *rawConn) headers(fields ...string) []byte {
+	c.hbuf.Reset()
+	for i := 0; i < len(fields); i += 2 {
+		_ = c.henc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	return append([]byte(nil), c.hbuf.Bytes()...)
+}
+
+// readUntil read the frames until the frame of typ, it returns nil if the connection is closed.
+func (c *rawConn) readUntil(typ FrameType) *Frame {
+	_ = c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	readBuf := make([]byte, 4096)
+	for {
+		for {
+			pkg, n, err := c.codec.Decode(c.buf)
+			assert.Nil(c.t, err)
+			if pkg == nil {
+				break
+			}
+			c.buf = c.buf[n:]
+			if f := pkg.(*Frame); f.Type == typ {
+				return f
+			}
+		}
+
+		n, err := c.conn.Read(readBuf)
+		if err != nil {
+			return nil
+		}
+		c.buf = append(c.buf, readBuf[:n]...)
+	}
+}
+
+func TestServer_ProtocolErrors(t *testing.T) {
+	addr := serve(t, NewServer(echoHandler(), WithMaxConcurrentStreams(1), WithMaxBodyBytes(4)).Setup)
+
+	tests := []struct {
+		name  string
+		frame func(c *rawConn) *Frame
+		code  ErrCode
+	}{
+		{name: "data on stream 0", frame: func(*rawConn) *Frame {
+			return NewDataFrame(0, []byte("a"), true)
+		}, code: ErrCodeProtocol},
+		{name: "data on idle stream", frame: func(*rawConn) *Frame {
+			return NewDataFrame(1, []byte("a"), true)
+		}, code: ErrCodeProtocol},
+		{name: "even stream id", frame: func(c *rawConn) *Frame {
+			return NewHeadersFrame(2, c.headers(":method", "GET", ":scheme", "http", ":path", "/"), true, true)
+		}, code: ErrCodeProtocol},
+		{name: "invalid header block", frame: func(*rawConn) *Frame {
+			return NewHeadersFrame(1, []byte{0xff}, true, true)
+		}, code: ErrCodeCompression},
+		{name: "ping on stream", frame: func(*rawConn) *Frame {
+			f := NewPingFrame([8]byte{}, false)
+			f.StreamID = 1
+			return f
+		}, code: ErrCodeProtocol},
+		{name: "invalid settings", frame: func(*rawConn) *Frame {
+			return NewSettingsFrame(Setting{ID: SettingMaxFrameSize, Val: 1})
+		}, code: ErrCodeProtocol},
+		{name: "window overflow", frame: func(*rawConn) *Frame {
+			return NewWindowUpdateFrame(0, maxWindowSize)
+		}, code: ErrCodeFlowControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dialRaw(t, addr)
+			c.write(tt.frame(c))
+			f := c.readUntil(FrameGoAway)
+			if assert.NotNil(t, f) {
+				_, code, _, err := f.GoAway()
+				assert.Nil(t, err)
+				assert.Equal(t, tt.code, code)
+			}
+			// the connection is closed after GOAWAY.
+			assert.Nil(t, c.readUntil(FrameGoAway))
+		})
+	}
+
+	c := dialRaw(t, addr)
+	// the stream errors reset the stream only.
+	c.write(NewHeadersFrame(1, c.headers(":method", "GET", ":path", "/"), true, true))
+	f := c.readUntil(FrameRSTStream)
+	code, _ := f.ErrCode()
+	assert.Equal(t, ErrCodeProtocol, code)
+
+	// the concurrent streams exceed the limit.
+	c.write(NewHeadersFrame(3, c.headers(":method", "POST", ":scheme", "http", ":path", "/echo"), false, true))
+	c.write(NewHeadersFrame(5, c.headers(":method", "GET", ":scheme", "http", ":path", "/echo"), true, true))
+	f = c.readUntil(FrameRSTStream)
+	code, _ = f.ErrCode()
+	assert.Equal(t, uint32(5), f.StreamID)
+	assert.Equal(t, ErrCodeRefusedStream, code)
+
+	// the body exceeds the limit.
+	c.write(NewDataFrame(3, []byte("hello"), true))
+	f = c.readUntil(FrameHeaders)
+	assert.Equal(t, uint32(3), f.StreamID)
+	fields, err := hpack.NewDecoder(4096, nil).DecodeFull(f.Payload)
+	assert.Nil(t, err)
+	assert.Equal(t, hpack.HeaderField{Name: ":status", Value: "413"}, fields[0])
+
+	// the connection is still usable after the stream errors.
+	data := [8]byte{1, 2, 3}
+	c.write(NewPingFrame(data, false))
+	f = c.readUntil(FramePing)
+	assert.True(t, f.Flags.Has(FlagAck))
+	assert.Equal(t, data[:], f.Payload)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	}))
+	addr := serve(t, srv.Setup)
+
+	c := dialRaw(t, addr)
+	c.write(NewHeadersFrame(1, c.headers(":method", "GET", ":scheme", "http", ":path", "/"), true, true))
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Shutdown(context.Background())
+	}()
+
+	f := c.readUntil(FrameGoAway)
+	lastStreamID, code, _, _ := f.GoAway()
+	assert.Equal(t, uint32(1), lastStreamID)
+	assert.Equal(t, ErrCodeNo, code)
+
+	// the active stream is served before closing.
+	close(release)
+	f = c.readUntil(FrameData)
+	assert.Equal(t, "done", string(f.Payload))
+	assert.True(t, f.Flags.Has(FlagEndStream))
+	assert.Nil(t, <-done)
+	assert.Nil(t, c.readUntil(FrameGoAway))
+
+	assert.Equal(t, ErrServerClosed, srv.Setup(nil))
+}
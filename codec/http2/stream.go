@@ -0,0 +1,306 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package http2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+var errHeaderTooLarge = errors.New("http2 header list too large")
+
+// connectionHeaders the connection specific headers prohibited in HTTP/2.
+var connectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+type streamState int
+
+const (
+	stateOpen streamState = iota
+	// stateHalfClosedRemote the request is received entirely, the stream is waiting for the response.
+	stateHalfClosedRemote
+)
+
+// stream a request and its response multiplexed on the connection.
+type stream struct {
+	id            uint32
+	state         streamState
+	pseudo        pseudoHeaders
+	header        http.Header
+	trailer       http.Header
+	contentLength int64
+	body          bytes.Buffer
+	ctx           context.Context
+	cancel        context.CancelFunc
+
+	recvWindow     int64
+	sendWindow     int64
+	pending        []byte
+	pendingTrailer http.Header
+	// pendingEnd the response is written by the handler, the stream ends after the pending data.
+	pendingEnd bool
+}
+
+// pseudoHeaders the pseudo header fields of a request.
+type pseudoHeaders struct {
+	method    string
+	scheme    string
+	path      string
+	authority string
+}
+
+// newStream open a stream of the request header fields.
+func newStream(id uint32, fields []hpack.HeaderField, options *Options) (*stream, error) {
+	pseudo, header, err := parseFields(id, fields, options.MaxHeaderListSize, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if pseudo.method == "" {
+		return nil, streamError(id, ErrCodeProtocol, "missing :method")
+	}
+	if pseudo.method == http.MethodConnect {
+		if pseudo.scheme != "" || pseudo.path != "" || pseudo.authority == "" {
+			return nil, streamError(id, ErrCodeProtocol, "invalid CONNECT pseudo headers")
+		}
+	} else if pseudo.scheme == "" || pseudo.path == "" {
+		return nil, streamError(id, ErrCodeProtocol, "missing :scheme or :path")
+	}
+
+	st := &stream{id: id, pseudo: pseudo, header: header, contentLength: -1}
+	if v := header.Get("Content-Length"); v != "" {
+		if st.contentLength, err = strconv.ParseInt(v, 10, 64); err != nil || st.contentLength < 0 {
+			return nil, streamError(id, ErrCodeProtocol, "invalid content-length %q", v)
+		}
+	}
+	st.ctx, st.cancel = context.WithCancel(context.Background())
+	return st, nil
+}
+
+// parseFields validate the decoded header fields, the trailers have no pseudo header fields.
+func parseFields(id uint32, fields []hpack.HeaderField, limit uint32, trailer bool) (pseudoHeaders, http.Header, error) {
+	var pseudo pseudoHeaders
+	var cookies []string
+	var size uint32
+	header := make(http.Header)
+	regular := false
+	for _, hf := range fields {
+		size += hf.Size()
+		if hf.IsPseudo() {
+			if trailer || regular {
+				return pseudo, nil, streamError(id, ErrCodeProtocol, "unexpected pseudo header %s", hf.Name)
+			}
+
+			var dst *string
+			switch hf.Name {
+			case ":method":
+				dst = &pseudo.method
+			case ":scheme":
+				dst = &pseudo.scheme
+			case ":path":
+				dst = &pseudo.path
+			case ":authority":
+				dst = &pseudo.authority
+			default:
+				return pseudo, nil, streamError(id, ErrCodeProtocol, "invalid pseudo header %s", hf.Name)
+			}
+			if *dst != "" || hf.Value == "" {
+				return pseudo, nil, streamError(id, ErrCodeProtocol, "invalid pseudo header %s", hf.Name)
+			}
+			*dst = hf.Value
+			continue
+		}
+
+		regular = true
+		if !validFieldName(hf.Name) || !validFieldValue(hf.Value) || connectionHeaders[hf.Name] ||
+			(hf.Name == "te" && hf.Value != "trailers") {
+			return pseudo, nil, streamError(id, ErrCodeProtocol, "invalid header %s", hf.Name)
+		}
+
+		// the cookie may be split into several fields to compress better.
+		if hf.Name == "cookie" {
+			cookies = append(cookies, hf.Value)
+			continue
+		}
+		header.Add(http.CanonicalHeaderKey(hf.Name), hf.Value)
+	}
+
+	if size > limit {
+		if trailer {
+			return pseudo, nil, streamError(id, ErrCodeProtocol, "trailers too large")
+		}
+		return pseudo, nil, errHeaderTooLarge
+	}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return pseudo, header, nil
+}
+
+// validFieldName check the name is a lowercase token.
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func validFieldValue(value string) bool {
+	return strings.IndexAny(value, "\x00\r\n") < 0
+}
+
+// newRequest build the http.Request of the stream received entirely.
+func (st *stream) newRequest(sc *serverConn) (*http.Request, error) {
+	var u *url.URL
+	var err error
+	if st.pseudo.method == http.MethodConnect {
+		u = &url.URL{Host: st.pseudo.authority}
+	} else if u, err = url.ParseRequestURI(st.pseudo.path); err != nil {
+		return nil, streamError(st.id, ErrCodeProtocol, "invalid :path %q", st.pseudo.path)
+	}
+
+	host := st.pseudo.authority
+	if host == "" {
+		host = st.header.Get("Host")
+	}
+
+	req := &http.Request{
+		Method:        st.pseudo.method,
+		URL:           u,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        st.header,
+		Body:          io.NopCloser(bytes.NewReader(st.body.Bytes())),
+		ContentLength: int64(st.body.Len()),
+		Host:          host,
+		Trailer:       st.trailer,
+		RemoteAddr:    sc.t.RemoteAddr(),
+		RequestURI:    st.pseudo.path,
+		TLS:           sc.tlsState,
+	}
+	if st.body.Len() == 0 {
+		req.Body = http.NoBody
+	}
+
+	ctx := st.ctx
+	if addr, err := net.ResolveTCPAddr("tcp", sc.t.LocalAddr()); err == nil {
+		ctx = context.WithValue(ctx, http.LocalAddrContextKey, addr)
+	}
+	return req.WithContext(ctx), nil
+}
+
+// responseWriter buffers the response written by the handler.
+type responseWriter struct {
+	header http.Header
+	// snapshot the header when the status is written, the headers set after it are the trailers.
+	snapshot    http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(statusCode int) {
+	// the informational responses are not supported, as the request has been read entirely.
+	if w.wroteHeader || (statusCode >= 100 && statusCode <= 199) {
+		return
+	}
+	w.wroteHeader, w.status = true, statusCode
+	w.snapshot = w.header.Clone()
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !bodyAllowed(w.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	return w.body.Write(data)
+}
+
+// response return the status, the header, the body and the trailers of the response to req.
+func (w *responseWriter) response(req *http.Request) (int, http.Header, []byte, http.Header) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	header, body := w.snapshot, w.body.Bytes()
+	if _, ok := header["Content-Type"]; !ok && len(body) > 0 {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+	if header.Get("Content-Length") == "" && bodyAllowed(w.status) && (len(body) > 0 || req.Method != http.MethodHead) {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	trailer := make(http.Header)
+	for _, v := range header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if values, ok := w.header[k]; ok && k != "" {
+				trailer[k] = values
+			}
+		}
+	}
+	for k, values := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = values
+		}
+	}
+	for k := range header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			delete(header, k)
+		}
+	}
+
+	if req.Method == http.MethodHead || !bodyAllowed(w.status) {
+		body = nil
+	}
+	return w.status, header, body, trailer
+}
+
+func bodyAllowed(status int) bool {
+	return !(status >= 100 && status <= 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,312 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package memcache
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// MagicRequest the magic byte of the binary requests.
+	MagicRequest = 0x80
+	// MagicResponse the magic byte of the binary responses.
+	MagicResponse = 0x81
+
+	binaryHeaderLen = 24
+)
+
+// Opcode the command of the binary protocol.
+type Opcode uint8
+
+const (
+	OpGet        Opcode = 0x00
+	OpSet        Opcode = 0x01
+	OpAdd        Opcode = 0x02
+	OpReplace    Opcode = 0x03
+	OpDelete     Opcode = 0x04
+	OpIncrement  Opcode = 0x05
+	OpDecrement  Opcode = 0x06
+	OpQuit       Opcode = 0x07
+	OpFlush      Opcode = 0x08
+	OpGetQ       Opcode = 0x09
+	OpNoop       Opcode = 0x0a
+	OpVersion    Opcode = 0x0b
+	OpGetK       Opcode = 0x0c
+	OpGetKQ      Opcode = 0x0d
+	OpAppend     Opcode = 0x0e
+	OpPrepend    Opcode = 0x0f
+	OpStat       Opcode = 0x10
+	OpSetQ       Opcode = 0x11
+	OpAddQ       Opcode = 0x12
+	OpReplaceQ   Opcode = 0x13
+	OpDeleteQ    Opcode = 0x14
+	OpIncrementQ Opcode = 0x15
+	OpDecrementQ Opcode = 0x16
+	OpQuitQ      Opcode = 0x17
+	OpFlushQ     Opcode = 0x18
+	OpAppendQ    Opcode = 0x19
+	OpPrependQ   Opcode = 0x1a
+	OpTouch      Opcode = 0x1c
+	OpGAT        Opcode = 0x1d
+	OpGATQ       Opcode = 0x1e
+)
+
+// Quiet return whether the successful response of the command is omitted.
+func (op Opcode) Quiet() bool {
+	switch op {
+	case OpGetQ, OpGetKQ, OpSetQ, OpAddQ, OpReplaceQ, OpDeleteQ, OpIncrementQ, OpDecrementQ, OpQuitQ, OpFlushQ,
+		OpAppendQ, OpPrependQ, OpGATQ:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status the status of the binary responses.
+type Status uint16
+
+const (
+	StatusNoError          Status = 0x00
+	StatusKeyNotFound      Status = 0x01
+	StatusKeyExists        Status = 0x02
+	StatusValueTooLarge    Status = 0x03
+	StatusInvalidArguments Status = 0x04
+	StatusItemNotStored    Status = 0x05
+	StatusNonNumericValue  Status = 0x06
+	StatusUnknownCommand   Status = 0x81
+	StatusOutOfMemory      Status = 0x82
+)
+
+var statusNames = map[Status]string{
+	StatusNoError:          "No error",
+	StatusKeyNotFound:      "Key not found",
+	StatusKeyExists:        "Key exists",
+	StatusValueTooLarge:    "Value too large",
+	StatusInvalidArguments: "Invalid arguments",
+	StatusItemNotStored:    "Item not stored",
+	StatusNonNumericValue:  "Incr/Decr on non-numeric value",
+	StatusUnknownCommand:   "Unknown command",
+	StatusOutOfMemory:      "Out of memory",
+}
+
+// String implements fmt.Stringer.
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown status 0x%x", uint16(s))
+}
+
+// BinaryRequest a request of the binary protocol.
+type BinaryRequest struct {
+	Opcode   Opcode
+	DataType uint8
+	VBucket  uint16
+	// Opaque the value copied to the response, e.g. to match the pipelined requests
+	Opaque uint32
+	CAS    uint64
+	Extras []byte
+	Key    []byte
+	Value  []byte
+}
+
+// BinaryResponse a response of the binary protocol.
+type BinaryResponse struct {
+	Opcode   Opcode
+	DataType uint8
+	Status   Status
+	Opaque   uint32
+	CAS      uint64
+	Extras   []byte
+	Key      []byte
+	Value    []byte
+}
+
+// Append append the encoded request to dst.
+func (r *BinaryRequest) Append(dst []byte) []byte {
+	return appendPacket(dst, MagicRequest, r.Opcode, r.DataType, r.VBucket, r.Opaque, r.CAS, r.Extras, r.Key, r.Value)
+}
+
+// Append append the encoded response to dst.
+func (r *BinaryResponse) Append(dst []byte) []byte {
+	return appendPacket(dst, MagicResponse, r.Opcode, r.DataType, uint16(r.Status), r.Opaque, r.CAS,
+		r.Extras, r.Key, r.Value)
+}
+
+// NewBinaryResponse return the response of req with status, the opcode and the opaque are copied from req.
+func NewBinaryResponse(req *BinaryRequest, status Status) *BinaryResponse {
+	resp := &BinaryResponse{Opcode: req.Opcode, Status: status, Opaque: req.Opaque}
+	// the error responses carry the message as the value.
+	if status != StatusNoError {
+		resp.Value = []byte(status.String())
+	}
+	return resp
+}
+
+func appendPacket(dst []byte, magic uint8, op Opcode, dataType uint8, vbucket uint16, opaque uint32, cas uint64,
+	extras, key, value []byte) []byte {
+	var header [binaryHeaderLen]byte
+	header[0], header[1] = magic, byte(op)
+	binary.BigEndian.PutUint16(header[2:], uint16(len(key)))
+	header[4], header[5] = uint8(len(extras)), dataType
+	binary.BigEndian.PutUint16(header[6:], vbucket)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(header[12:], opaque)
+	binary.BigEndian.PutUint64(header[16:], cas)
+
+	dst = append(dst, header[:]...)
+	dst = append(dst, extras...)
+	dst = append(dst, key...)
+	return append(dst, value...)
+}
+
+// StorageExtras return the extras of set, add and replace.
+func StorageExtras(flags, exptime uint32) []byte {
+	extras := make([]byte, 8)
+	binary.BigEndian.PutUint32(extras, flags)
+	binary.BigEndian.PutUint32(extras[4:], exptime)
+	return extras
+}
+
+// ParseStorageExtras return the flags and the exptime of the extras of set, add and replace.
+func ParseStorageExtras(extras []byte) (flags, exptime uint32, err error) {
+	if len(extras) != 8 {
+		return 0, 0, fmt.Errorf("%w: storage extras length %d", ErrMalformed, len(extras))
+	}
+	return binary.BigEndian.Uint32(extras), binary.BigEndian.Uint32(extras[4:]), nil
+}
+
+// CounterExtras return the extras of increment and decrement, the exptime 0xffffffff means the missing key
+// is not created by initial.
+func CounterExtras(delta, initial uint64, exptime uint32) []byte {
+	extras := make([]byte, 20)
+	binary.BigEndian.PutUint64(extras, delta)
+	binary.BigEndian.PutUint64(extras[8:], initial)
+	binary.BigEndian.PutUint32(extras[16:], exptime)
+	return extras
+}
+
+// ParseCounterExtras return the delta, the initial value and the exptime of the extras of increment and decrement.
+func ParseCounterExtras(extras []byte) (delta, initial uint64, exptime uint32, err error) {
+	if len(extras) != 20 {
+		return 0, 0, 0, fmt.Errorf("%w: counter extras length %d", ErrMalformed, len(extras))
+	}
+	return binary.BigEndian.Uint64(extras), binary.BigEndian.Uint64(extras[8:]), binary.BigEndian.Uint32(extras[16:]), nil
+}
+
+// FlagsExtras return the extras of the get responses.
+func FlagsExtras(flags uint32) []byte {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, flags)
+	return extras
+}
+
+// BinaryCodec the codec of the binary protocol, it decodes *BinaryRequest on the server side and
+// *BinaryResponse on the client side, and encodes both of them.
+type BinaryCodec struct {
+	options *Options
+	magic   uint8
+}
+
+// NewBinaryServerCodec return a server side binary protocol codec.
+func NewBinaryServerCodec(opts ...Option) *BinaryCodec {
+	return &BinaryCodec{options: newOptions(opts...), magic: MagicRequest}
+}
+
+// NewBinaryClientCodec return a client side binary protocol codec.
+func NewBinaryClientCodec(opts ...Option) *BinaryCodec {
+	return &BinaryCodec{options: newOptions(opts...), magic: MagicResponse}
+}
+
+// Encode implements session.Codec.
+func (c *BinaryCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch p := pkg.(type) {
+	case *BinaryRequest:
+		return p.Append(nil), nil
+	case *BinaryResponse:
+		return p.Append(nil), nil
+	case []byte:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("memcache codec can not encode pkg type:%T", pkg)
+	}
+}
+
+// Decode implements session.Codec.
+func (c *BinaryCodec) Decode(data []byte) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	if data[0] != c.magic {
+		return nil, 0, fmt.Errorf("%w: invalid magic 0x%x", ErrMalformed, data[0])
+	}
+	if len(data) < binaryHeaderLen {
+		return nil, 0, nil
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(data[2:]))
+	extrasLen := int(data[4])
+	bodyLen := int(binary.BigEndian.Uint32(data[8:]))
+	if keyLen+extrasLen > bodyLen {
+		return nil, 0, fmt.Errorf("%w: body length %d", ErrMalformed, bodyLen)
+	}
+	if bodyLen-keyLen-extrasLen > c.options.MaxValueBytes {
+		return nil, 0, ErrTooLarge
+	}
+
+	n := binaryHeaderLen + bodyLen
+	if len(data) < n {
+		return nil, 0, nil
+	}
+
+	// the network buffer is reused after decoding.
+	body := make([]byte, bodyLen)
+	copy(body, data[binaryHeaderLen:n])
+	extras, key, value := body[:extrasLen], body[extrasLen:extrasLen+keyLen], body[extrasLen+keyLen:]
+	opaque, cas := binary.BigEndian.Uint32(data[12:]), binary.BigEndian.Uint64(data[16:])
+	if c.magic == MagicRequest {
+		return &BinaryRequest{
+			Opcode:   Opcode(data[1]),
+			DataType: data[5],
+			VBucket:  binary.BigEndian.Uint16(data[6:]),
+			Opaque:   opaque,
+			CAS:      cas,
+			Extras:   nilIfEmpty(extras),
+			Key:      nilIfEmpty(key),
+			Value:    nilIfEmpty(value),
+		}, n, nil
+	}
+
+	return &BinaryResponse{
+		Opcode:   Opcode(data[1]),
+		DataType: data[5],
+		Status:   Status(binary.BigEndian.Uint16(data[6:])),
+		Opaque:   opaque,
+		CAS:      cas,
+		Extras:   nilIfEmpty(extras),
+		Key:      nilIfEmpty(key),
+		Value:    nilIfEmpty(value),
+	}, n, nil
+}
+
+func nilIfEmpty(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package memcache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryCodec(t *testing.T) {
+	req := &BinaryRequest{
+		Opcode:  OpSet,
+		VBucket: 3,
+		Opaque:  0xdeadbeef,
+		CAS:     9,
+		Extras:  StorageExtras(1, 60),
+		Key:     []byte("k"),
+		Value:   []byte("value"),
+	}
+	data, err := NewBinaryClientCodec().Encode(req)
+	assert.Nil(t, err)
+	assert.Equal(t, binaryHeaderLen+8+1+5, len(data))
+
+	server := NewBinaryServerCodec()
+	// half package.
+	pkg, n, err := server.Decode(data[:binaryHeaderLen+3])
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	pkg, n, err = server.Decode(append(data, MagicRequest))
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, req, pkg)
+	flags, exptime, err := ParseStorageExtras(pkg.(*BinaryRequest).Extras)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), flags)
+	assert.Equal(t, uint32(60), exptime)
+
+	resp := NewBinaryResponse(req, StatusKeyExists)
+	data = resp.Append(nil)
+	pkg, _, err = NewBinaryClientCodec().Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, &BinaryResponse{Opcode: OpSet, Status: StatusKeyExists, Opaque: 0xdeadbeef, Value: []byte("Key exists")}, pkg)
+
+	// the server codec decodes no response.
+	_, _, err = server.Decode(data)
+	assert.True(t, errors.Is(err, ErrMalformed))
+
+	_, _, err = NewBinaryServerCodec(WithMaxValueBytes(4)).Decode(req.Append(nil))
+	assert.True(t, errors.Is(err, ErrTooLarge))
+
+	delta, initial, exptime, err := ParseCounterExtras(CounterExtras(2, 10, 0xffffffff))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2, 10}, []uint64{delta, initial})
+	assert.Equal(t, uint32(0xffffffff), exptime)
+	_, _, _, err = ParseCounterExtras(FlagsExtras(1))
+	assert.True(t, errors.Is(err, ErrMalformed))
+
+	assert.True(t, OpGetKQ.Quiet())
+	assert.False(t, OpGetK.Quiet())
+}
@@ -0,0 +1,89 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package memcache impl the codecs of the memcached text and binary protocols for knetty sessions,
+// e.g. building the cache servers and proxies on the event loops.
+package memcache
+
+import (
+	"errors"
+)
+
+const (
+	// DefaultMaxLineBytes the default maximum bytes of a command line or a reply line of the text protocol.
+	DefaultMaxLineBytes = 64 << 10
+	// DefaultMaxValueBytes the default maximum bytes of a value, it is the default item size of memcached.
+	DefaultMaxValueBytes = 1 << 20
+	// MaxKeyLength the maximum length of keys.
+	MaxKeyLength = 250
+)
+
+var (
+	// ErrMalformed the message violates the protocol.
+	ErrMalformed = errors.New("malformed memcache message")
+	// ErrTooLarge the line or the value exceeds the limit.
+	ErrTooLarge = errors.New("memcache message too large")
+)
+
+// Option option for codecs.
+type Option func(*Options)
+
+// Options options for codecs.
+type Options struct {
+	// MaxLineBytes the maximum bytes of a command line or a reply line of the text protocol
+	MaxLineBytes int
+	// MaxValueBytes the maximum bytes of a value
+	MaxValueBytes int
+}
+
+// WithMaxLineBytes set the maximum bytes of a command line or a reply line of the text protocol.
+func WithMaxLineBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxLineBytes = n
+		}
+	}
+}
+
+// WithMaxValueBytes set the maximum bytes of a value.
+func WithMaxValueBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxValueBytes = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{MaxLineBytes: DefaultMaxLineBytes, MaxValueBytes: DefaultMaxValueBytes}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// validKey check the key is not empty, not longer than MaxKeyLength and has no control characters or spaces.
+func validKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
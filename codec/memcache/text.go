@@ -0,0 +1,434 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package memcache
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the status lines of the text protocol.
+const (
+	StatusStored      = "STORED"
+	StatusNotStored   = "NOT_STORED"
+	StatusExists      = "EXISTS"
+	StatusNotFound    = "NOT_FOUND"
+	StatusDeleted     = "DELETED"
+	StatusTouched     = "TOUCHED"
+	StatusOK          = "OK"
+	StatusEnd         = "END"
+	StatusError       = "ERROR"
+	StatusClientError = "CLIENT_ERROR"
+	StatusServerError = "SERVER_ERROR"
+)
+
+// Item an item of the retrieval responses.
+type Item struct {
+	Key   string
+	Flags uint32
+	Value []byte
+	// CasUnique the cas unique of the item, it is written for gets and gats
+	CasUnique uint64
+}
+
+// Request a command of the text protocol.
+type Request struct {
+	// Command the command name in lower case, e.g. get, set, cas, delete, incr
+	Command string
+	// Keys the keys of get, gets, gat and gats
+	Keys []string
+	// Key the key of the storage commands, delete, incr, decr and touch
+	Key     string
+	Flags   uint32
+	Exptime int64
+	// Value the data block of the storage commands
+	Value     []byte
+	CasUnique uint64
+	// Delta the value of incr and decr
+	Delta   uint64
+	NoReply bool
+	// Args the arguments of the other commands, e.g. stats, flush_all, version
+	Args []string
+}
+
+// storageCommand return whether cmd carries a data block.
+func storageCommand(cmd string) bool {
+	switch cmd {
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return true
+	default:
+		return false
+	}
+}
+
+// Append append the encoded request to dst.
+func (r *Request) Append(dst []byte) []byte {
+	dst = append(dst, r.Command...)
+	switch {
+	case storageCommand(r.Command):
+		dst = append(dst, ' ')
+		dst = append(dst, r.Key...)
+		dst = appendUint(dst, uint64(r.Flags))
+		dst = append(append(dst, ' '), strconv.FormatInt(r.Exptime, 10)...)
+		dst = appendUint(dst, uint64(len(r.Value)))
+		if r.Command == "cas" {
+			dst = appendUint(dst, r.CasUnique)
+		}
+	case r.Command == "gat" || r.Command == "gats":
+		dst = append(append(dst, ' '), strconv.FormatInt(r.Exptime, 10)...)
+		fallthrough
+	case r.Command == "get" || r.Command == "gets":
+		for _, key := range r.Keys {
+			dst = append(append(dst, ' '), key...)
+		}
+	case r.Command == "incr" || r.Command == "decr":
+		dst = append(append(dst, ' '), r.Key...)
+		dst = appendUint(dst, r.Delta)
+	case r.Command == "touch":
+		dst = append(append(dst, ' '), r.Key...)
+		dst = append(append(dst, ' '), strconv.FormatInt(r.Exptime, 10)...)
+	case r.Command == "delete":
+		dst = append(append(dst, ' '), r.Key...)
+	default:
+		for _, arg := range r.Args {
+			dst = append(append(dst, ' '), arg...)
+		}
+	}
+
+	if r.NoReply {
+		dst = append(dst, " noreply"...)
+	}
+	dst = append(dst, '\r', '\n')
+	if storageCommand(r.Command) {
+		dst = append(append(dst, r.Value...), '\r', '\n')
+	}
+	return dst
+}
+
+// Response a reply of the text protocol.
+// the retrieval and the stats replies have the status END, the replies of incr and decr have the empty status.
+type Response struct {
+	// Status the status line, e.g. STORED, NOT_FOUND, CLIENT_ERROR bad data chunk, VERSION 1.6.21
+	Status string
+	// Items the items before END
+	Items []Item
+	// Stats the name and the value in turn of the STAT lines before END
+	Stats []string
+	// Number the value after incr and decr
+	Number uint64
+}
+
+// NewErrorResponse return the reply of the malformed command, ERROR for the unknown commands,
+// otherwise CLIENT_ERROR with msg.
+func NewErrorResponse(msg string) *Response {
+	if msg == "" {
+		return &Response{Status: StatusError}
+	}
+	return &Response{Status: StatusClientError + " " + msg}
+}
+
+// Append append the encoded response to dst.
+func (r *Response) Append(dst []byte) []byte {
+	switch r.Status {
+	case StatusEnd:
+		for _, item := range r.Items {
+			dst = append(append(dst, "VALUE "...), item.Key...)
+			dst = appendUint(dst, uint64(item.Flags))
+			dst = appendUint(dst, uint64(len(item.Value)))
+			if item.CasUnique != 0 {
+				dst = appendUint(dst, item.CasUnique)
+			}
+			dst = append(append(append(dst, '\r', '\n'), item.Value...), '\r', '\n')
+		}
+		for i := 0; i+1 < len(r.Stats); i += 2 {
+			dst = append(append(dst, "STAT "...), r.Stats[i]...)
+			dst = append(append(append(dst, ' '), r.Stats[i+1]...), '\r', '\n')
+		}
+		return append(dst, "END\r\n"...)
+	case "":
+		dst = strconv.AppendUint(dst, r.Number, 10)
+		return append(dst, '\r', '\n')
+	default:
+		return append(append(dst, r.Status...), '\r', '\n')
+	}
+}
+
+func appendUint(dst []byte, n uint64) []byte {
+	return strconv.AppendUint(append(dst, ' '), n, 10)
+}
+
+// TextServerCodec the codec of the server side text protocol, it decodes *Request and encodes *Response.
+type TextServerCodec struct {
+	options *Options
+}
+
+// NewTextServerCodec return a server side text protocol codec.
+func NewTextServerCodec(opts ...Option) *TextServerCodec {
+	return &TextServerCodec{options: newOptions(opts...)}
+}
+
+// Encode implements session.Codec.
+func (c *TextServerCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch p := pkg.(type) {
+	case *Response:
+		return p.Append(nil), nil
+	case []byte:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("memcache codec can not encode pkg type:%T", pkg)
+	}
+}
+
+// Decode implements session.Codec, the unknown commands are decoded with Args,
+// the malformed commands return ErrMalformed and the session should reply CLIENT_ERROR.
+func (c *TextServerCodec) Decode(data []byte) (interface{}, int, error) {
+	line, n, err := readLine(data, c.options.MaxLineBytes)
+	if err != nil || n == 0 {
+		return nil, 0, err
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil, 0, fmt.Errorf("%w: empty command line", ErrMalformed)
+	}
+
+	req := &Request{Command: strings.ToLower(fields[0])}
+	args := fields[1:]
+	if storageCommand(req.Command) || req.Command == "delete" || req.Command == "incr" || req.Command == "decr" ||
+		req.Command == "touch" {
+		req.NoReply = len(args) > 0 && args[len(args)-1] == "noreply"
+		if req.NoReply {
+			args = args[:len(args)-1]
+		}
+	}
+
+	if err := c.parseArgs(req, args); err != nil {
+		return nil, 0, err
+	}
+	if !storageCommand(req.Command) {
+		return req, n, nil
+	}
+
+	// the data block follows the command line.
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		return nil, 0, fmt.Errorf("%w: bad data chunk", ErrMalformed)
+	}
+	if size > c.options.MaxValueBytes {
+		return nil, 0, fmt.Errorf("%w: object too large for cache", ErrTooLarge)
+	}
+	end := n + size + 2
+	if len(data) < end {
+		return nil, 0, nil
+	}
+	if data[end-2] != '\r' || data[end-1] != '\n' {
+		return nil, 0, fmt.Errorf("%w: bad data chunk", ErrMalformed)
+	}
+
+	req.Value = make([]byte, size)
+	copy(req.Value, data[n:end-2])
+	return req, end, nil
+}
+
+func (c *TextServerCodec) parseArgs(req *Request, args []string) error {
+	var err error
+	switch req.Command {
+	case "set", "add", "replace", "append", "prepend", "cas":
+		want := 4
+		if req.Command == "cas" {
+			want = 5
+		}
+		if len(args) != want || !validKey(args[0]) {
+			return fmt.Errorf("%w: bad command line format", ErrMalformed)
+		}
+
+		req.Key = args[0]
+		var flags uint64
+		if flags, err = strconv.ParseUint(args[1], 10, 32); err == nil {
+			req.Flags = uint32(flags)
+			if req.Exptime, err = strconv.ParseInt(args[2], 10, 64); err == nil && req.Command == "cas" {
+				req.CasUnique, err = strconv.ParseUint(args[4], 10, 64)
+			}
+		}
+	case "get", "gets", "gat", "gats":
+		if req.Command == "gat" || req.Command == "gats" {
+			if len(args) == 0 {
+				return fmt.Errorf("%w: bad command line format", ErrMalformed)
+			}
+			if req.Exptime, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+				break
+			}
+			args = args[1:]
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("%w: bad command line format", ErrMalformed)
+		}
+		for _, key := range args {
+			if !validKey(key) {
+				return fmt.Errorf("%w: bad command line format", ErrMalformed)
+			}
+		}
+		req.Keys = args
+	case "delete":
+		// the legacy delete time 0 is accepted.
+		if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "0") || !validKey(args[0]) {
+			return fmt.Errorf("%w: bad command line format", ErrMalformed)
+		}
+		req.Key = args[0]
+	case "incr", "decr":
+		if len(args) != 2 || !validKey(args[0]) {
+			return fmt.Errorf("%w: bad command line format", ErrMalformed)
+		}
+		req.Key = args[0]
+		if req.Delta, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+			return fmt.Errorf("%w: invalid numeric delta argument", ErrMalformed)
+		}
+	case "touch":
+		if len(args) != 2 || !validKey(args[0]) {
+			return fmt.Errorf("%w: bad command line format", ErrMalformed)
+		}
+		req.Key = args[0]
+		req.Exptime, err = strconv.ParseInt(args[1], 10, 64)
+	default:
+		req.Args = args
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: bad command line format", ErrMalformed)
+	}
+	return nil
+}
+
+// TextClientCodec the codec of the client side text protocol, it encodes *Request and decodes *Response.
+type TextClientCodec struct {
+	options *Options
+}
+
+// NewTextClientCodec return a client side text protocol codec.
+func NewTextClientCodec(opts ...Option) *TextClientCodec {
+	return &TextClientCodec{options: newOptions(opts...)}
+}
+
+// Encode implements session.Codec.
+func (c *TextClientCodec) Encode(pkg interface{}) ([]byte, error) {
+	switch p := pkg.(type) {
+	case *Request:
+		return p.Append(nil), nil
+	case []byte:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("memcache codec can not encode pkg type:%T", pkg)
+	}
+}
+
+// Decode implements session.Codec.
+func (c *TextClientCodec) Decode(data []byte) (interface{}, int, error) {
+	resp := &Response{}
+	var n int
+	for {
+		line, lineLen, err := readLine(data[n:], c.options.MaxLineBytes)
+		if err != nil || lineLen == 0 {
+			return nil, 0, err
+		}
+		n += lineLen
+
+		switch {
+		case bytes.HasPrefix(line, []byte("VALUE ")):
+			item, valueLen, err := c.parseValue(string(line), data[n:])
+			if err != nil || valueLen == 0 {
+				return nil, 0, err
+			}
+			resp.Items = append(resp.Items, item)
+			n += valueLen
+		case bytes.HasPrefix(line, []byte("STAT ")):
+			fields := strings.SplitN(string(line), " ", 3)
+			if len(fields) != 3 {
+				return nil, 0, fmt.Errorf("%w: invalid stat line %q", ErrMalformed, line)
+			}
+			resp.Stats = append(resp.Stats, fields[1], fields[2])
+		case len(resp.Items) > 0 || len(resp.Stats) > 0:
+			// the items and the stats end with END.
+			if string(line) != StatusEnd {
+				return nil, 0, fmt.Errorf("%w: unexpected line %q", ErrMalformed, line)
+			}
+			resp.Status = StatusEnd
+			return resp, n, nil
+		default:
+			if number, err := strconv.ParseUint(string(line), 10, 64); err == nil {
+				resp.Number = number
+			} else {
+				resp.Status = string(line)
+			}
+			return resp, n, nil
+		}
+	}
+}
+
+// parseValue parse the item of the VALUE line, the length is 0 if the data block is incomplete.
+func (c *TextClientCodec) parseValue(line string, data []byte) (Item, int, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 && len(fields) != 5 {
+		return Item{}, 0, fmt.Errorf("%w: invalid value line %q", ErrMalformed, line)
+	}
+
+	item := Item{Key: fields[1]}
+	flags, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return Item{}, 0, fmt.Errorf("%w: invalid value line %q", ErrMalformed, line)
+	}
+	item.Flags = uint32(flags)
+	size, err := strconv.Atoi(fields[3])
+	if err != nil || size < 0 {
+		return Item{}, 0, fmt.Errorf("%w: invalid value line %q", ErrMalformed, line)
+	}
+	if size > c.options.MaxValueBytes {
+		return Item{}, 0, ErrTooLarge
+	}
+	if len(fields) == 5 {
+		if item.CasUnique, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+			return Item{}, 0, fmt.Errorf("%w: invalid value line %q", ErrMalformed, line)
+		}
+	}
+
+	if len(data) < size+2 {
+		return Item{}, 0, nil
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		return Item{}, 0, fmt.Errorf("%w: bad data chunk", ErrMalformed)
+	}
+	item.Value = make([]byte, size)
+	copy(item.Value, data[:size])
+	return item, size + 2, nil
+}
+
+// readLine return the line without CRLF and the length including CRLF, the length is 0 for the half line.
+func readLine(data []byte, limit int) ([]byte, int, error) {
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx < 0 {
+		if len(data) > limit {
+			return nil, 0, fmt.Errorf("%w: line too long", ErrTooLarge)
+		}
+		return nil, 0, nil
+	}
+	if idx > limit {
+		return nil, 0, fmt.Errorf("%w: line too long", ErrTooLarge)
+	}
+	return data[:idx], idx + 2, nil
+}
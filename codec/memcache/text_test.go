@@ -0,0 +1,200 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextServerCodec_Decode(t *testing.T) {
+	codec := NewTextServerCodec(WithMaxValueBytes(8))
+
+	data := []byte("set k 5 60 5 noreply\r\nhello\r\ncas k 0 0 1 42\r\nx\r\n")
+	// every prefix of the storage command is a half package.
+	for i := 1; i < 29; i++ {
+		pkg, n, err := codec.Decode(data[:i])
+		assert.Nil(t, pkg)
+		assert.Equal(t, 0, n)
+		assert.Nil(t, err)
+	}
+
+	pkg, n, err := codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, &Request{Command: "set", Key: "k", Flags: 5, Exptime: 60, Value: []byte("hello"), NoReply: true}, pkg)
+	pkg, _, err = codec.Decode(data[n:])
+	assert.Nil(t, err)
+	assert.Equal(t, &Request{Command: "cas", Key: "k", Value: []byte("x"), CasUnique: 42}, pkg)
+
+	tests := []struct {
+		line string
+		req  *Request
+		err  error
+	}{
+		{line: "get a b\r\n", req: &Request{Command: "get", Keys: []string{"a", "b"}}},
+		{line: "gats 10 a\r\n", req: &Request{Command: "gats", Exptime: 10, Keys: []string{"a"}}},
+		{line: "delete a noreply\r\n", req: &Request{Command: "delete", Key: "a", NoReply: true}},
+		{line: "incr a 3\r\n", req: &Request{Command: "incr", Key: "a", Delta: 3}},
+		{line: "touch a 100\r\n", req: &Request{Command: "touch", Key: "a", Exptime: 100}},
+		{line: "stats slabs\r\n", req: &Request{Command: "stats", Args: []string{"slabs"}}},
+		{line: "get\r\n", err: ErrMalformed},
+		{line: "incr a -1\r\n", err: ErrMalformed},
+		{line: "set a b 0 1\r\n", err: ErrMalformed},
+		{line: "set a 0 0 9\r\n", err: ErrTooLarge},
+		{line: "set a 0 0 1\r\nxy\r\n", err: ErrMalformed},
+	}
+	for _, tt := range tests {
+		pkg, n, err := codec.Decode([]byte(tt.line))
+		if tt.err != nil {
+			assert.True(t, errors.Is(err, tt.err), tt.line)
+			continue
+		}
+		assert.Nil(t, err, tt.line)
+		assert.Equal(t, len(tt.line), n, tt.line)
+		assert.Equal(t, tt.req, pkg, tt.line)
+		// the request is encoded back to the same line.
+		assert.Equal(t, tt.line, string(tt.req.Append(nil)), tt.line)
+	}
+}
+
+func TestTextClientCodec_Decode(t *testing.T) {
+	codec := NewTextClientCodec()
+	resp := &Response{Status: StatusEnd, Items: []Item{
+		{Key: "a", Flags: 1, Value: []byte("x\r\ny")},
+		{Key: "b", Value: []byte(""), CasUnique: 7},
+	}}
+	data := resp.Append(nil)
+	assert.Equal(t, "VALUE a 1 4\r\nx\r\ny\r\nVALUE b 0 0 7\r\n\r\nEND\r\n", string(data))
+	for i := 1; i < len(data); i++ {
+		pkg, _, err := codec.Decode(data[:i])
+		assert.Nil(t, pkg)
+		assert.Nil(t, err)
+	}
+	pkg, n, err := codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, resp, pkg)
+
+	for _, resp := range []*Response{
+		{Status: StatusEnd},
+		{Status: StatusStored},
+		{Status: "VERSION 1.6.21"},
+		{Number: 42},
+		{Status: StatusEnd, Stats: []string{"pid", "1", "version", "1.6.21"}},
+		NewErrorResponse("bad data chunk"),
+	} {
+		pkg, _, err := codec.Decode(resp.Append(nil))
+		assert.Nil(t, err)
+		assert.Equal(t, resp, pkg)
+	}
+
+	_, _, err = codec.Decode([]byte("VALUE a 0 1\r\nx\r\nSTORED\r\n"))
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
+
+// cacheListener serve a tiny cache by the text protocol.
+type cacheListener struct {
+	mu    sync.Mutex
+	items map[string]Item
+	cas   uint64
+}
+
+func (l *cacheListener) OnConnect(session.Session) {}
+
+func (l *cacheListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	req := pkg.(*Request)
+	l.mu.Lock()
+	resp := &Response{Status: StatusError}
+	switch req.Command {
+	case "set":
+		l.cas++
+		l.items[req.Key] = Item{Key: req.Key, Flags: req.Flags, Value: req.Value, CasUnique: l.cas}
+		resp.Status = StatusStored
+	case "get", "gets":
+		resp.Status = StatusEnd
+		for _, key := range req.Keys {
+			if item, ok := l.items[key]; ok {
+				if req.Command == "get" {
+					item.CasUnique = 0
+				}
+				resp.Items = append(resp.Items, item)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	if !req.NoReply {
+		_, _ = s.WritePkg(resp)
+		_ = s.FlushBuffer()
+	}
+	return session.Normal
+}
+
+func (l *cacheListener) OnError(s session.Session, e error) {
+	_, _ = s.WritePkg(NewErrorResponse(e.Error()))
+	_ = s.FlushBuffer()
+	_ = s.Close()
+}
+
+func (l *cacheListener) OnClose(session.Session) {}
+
+func TestTextCodec_Server(t *testing.T) {
+	cache := &cacheListener{items: make(map[string]Item)}
+	addr := knettytest.Serve(t, func(s session.Session) error {
+		s.SetCodec(NewTextServerCodec())
+		s.SetEventListener(cache)
+		return nil
+	}).Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// the pipelined commands.
+	_, err = conn.Write(append((&Request{Command: "set", Key: "k", Flags: 3, Value: []byte("v")}).Append(nil),
+		(&Request{Command: "gets", Keys: []string{"k", "missing"}}).Append(nil)...))
+	assert.Nil(t, err)
+
+	codec, reader := NewTextClientCodec(), bufio.NewReader(conn)
+	var buf []byte
+	var responses []interface{}
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for len(responses) < 2 {
+		b, err := reader.ReadByte()
+		if !assert.Nil(t, err) {
+			return
+		}
+		buf = append(buf, b)
+		if pkg, n, err := codec.Decode(buf); assert.Nil(t, err) && pkg != nil {
+			responses, buf = append(responses, pkg), buf[n:]
+		}
+	}
+	assert.Equal(t, &Response{Status: StatusStored}, responses[0])
+	assert.Equal(t, &Response{Status: StatusEnd, Items: []Item{{Key: "k", Flags: 3, Value: []byte("v"), CasUnique: 1}}},
+		responses[1])
+}
@@ -0,0 +1,375 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Codec the MQTT packet codec of a session, it decodes the received bytes into Packet and encodes Packet.
+// The server side codec learns the protocol version from the CONNECT packet, the client side codec
+// learns it from the encoded CONNECT packet, it can also be set by SetVersion.
+type Codec struct {
+	options *Options
+	version uint32
+}
+
+// NewCodec return a MQTT codec.
+func NewCodec(opts ...Option) *Codec {
+	return &Codec{options: newOptions(opts...)}
+}
+
+// SetVersion set the protocol version, Version311 or Version5.
+func (c *Codec) SetVersion(version byte) {
+	atomic.StoreUint32(&c.version, uint32(version))
+}
+
+// Version return the protocol version, zero before CONNECT.
+func (c *Codec) Version() byte {
+	return byte(atomic.LoadUint32(&c.version))
+}
+
+// Encode encode the Packet, the pkg must be a Packet.
+func (c *Codec) Encode(pkg interface{}) ([]byte, error) {
+	p, ok := pkg.(Packet)
+	if !ok {
+		return nil, fmt.Errorf("mqtt codec can't encode %T", pkg)
+	}
+	if connect, ok := p.(*Connect); ok {
+		c.SetVersion(connect.ProtocolVersion)
+	}
+	version := c.Version()
+	if version == 0 {
+		version = Version311
+	}
+	return Append(nil, p, version)
+}
+
+// Decode decode a Packet, return nil when the data is not a whole packet.
+func (c *Codec) Decode(data []byte) (interface{}, int, error) {
+	if len(data) < 2 {
+		return nil, 0, nil
+	}
+	length, n, err := decodeVarint(data[1:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if n == 0 {
+		return nil, 0, nil
+	}
+	size := 1 + n + length
+	if size > c.options.MaxPacketSize {
+		return nil, 0, ErrPacketTooLarge
+	}
+	if len(data) < size {
+		return nil, 0, nil
+	}
+	version := c.Version()
+	if version == 0 {
+		version = Version311
+	}
+	p, err := decodePacket(data[0], data[1+n:size], version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if connect, ok := p.(*Connect); ok {
+		c.SetVersion(connect.ProtocolVersion)
+	}
+	return p, size, nil
+}
+
+// Append append the encoded packet of the protocol version to dst.
+func Append(dst []byte, p Packet, version byte) ([]byte, error) {
+	var body encoder
+	flags, err := p.encode(&body, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(body.buf) > maxRemainingLength {
+		return nil, ErrPacketTooLarge
+	}
+	dst = append(dst, byte(p.Type())<<4|flags)
+	dst = appendVarint(dst, len(body.buf))
+	return append(dst, body.buf...), nil
+}
+
+func decodePacket(header byte, body []byte, version byte) (Packet, error) {
+	var p Packet
+	typ, flags := PacketType(header>>4), header&0x0F
+	switch typ {
+	case CONNECT:
+		p = &Connect{}
+	case CONNACK:
+		p = &ConnAck{}
+	case PUBLISH:
+		p = &Publish{}
+	case PUBACK, PUBREC, PUBREL, PUBCOMP:
+		p = &Ack{PacketType: typ}
+	case SUBSCRIBE:
+		p = &Subscribe{}
+	case SUBACK:
+		p = &SubAck{}
+	case UNSUBSCRIBE:
+		p = &Unsubscribe{}
+	case UNSUBACK:
+		p = &UnsubAck{}
+	case PINGREQ:
+		p = &PingReq{}
+	case PINGRESP:
+		p = &PingResp{}
+	case DISCONNECT:
+		p = &Disconnect{}
+	case AUTH:
+		if version < Version5 {
+			return nil, fmt.Errorf("%w: AUTH packet of MQTT 3.1.1", ErrMalformed)
+		}
+		p = &Auth{}
+	default:
+		return nil, fmt.Errorf("%w: reserved packet type %d", ErrMalformed, typ)
+	}
+	if typ != PUBLISH && flags != requiredFlags(typ) {
+		return nil, fmt.Errorf("%w: invalid flags %#x of %s", ErrMalformed, flags, typ)
+	}
+	d := &decoder{data: body}
+	if err := p.decode(d, flags, version); err != nil {
+		return nil, err
+	}
+	if d.err == nil && len(d.data) > 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %s", d.err, typ)
+	}
+	return p, nil
+}
+
+func requiredFlags(typ PacketType) byte {
+	switch typ {
+	case PUBREL, SUBSCRIBE, UNSUBSCRIBE:
+		return 0x02
+	default:
+		return 0
+	}
+}
+
+func appendVarint(dst []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		dst = append(dst, b)
+		if n == 0 {
+			return dst
+		}
+	}
+}
+
+// decodeVarint return the value and the size of the variable byte integer, zero size means a half integer.
+func decodeVarint(data []byte) (int, int, error) {
+	var value, multiplier = 0, 1
+	for i := 0; i < 4; i++ {
+		if i >= len(data) {
+			return 0, 0, nil
+		}
+		value += int(data[i]&0x7F) * multiplier
+		if data[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+		multiplier *= 128
+	}
+	return 0, 0, fmt.Errorf("%w: variable byte integer exceeds 4 bytes", ErrMalformed)
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) writeByte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) writeUint16(v uint16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) writeUint32(v uint32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) writeVarint(n int) {
+	e.buf = appendVarint(e.buf, n)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeUint16(uint16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) writeBinary(b []byte) {
+	e.writeUint16(uint16(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) byteProp(id byte, v *byte) {
+	if v != nil {
+		e.buf = append(e.buf, id, *v)
+	}
+}
+
+func (e *encoder) uint16Prop(id byte, v *uint16) {
+	if v != nil {
+		e.writeByte(id)
+		e.writeUint16(*v)
+	}
+}
+
+func (e *encoder) uint32Prop(id byte, v *uint32) {
+	if v != nil {
+		e.writeByte(id)
+		e.writeUint32(*v)
+	}
+}
+
+func (e *encoder) stringProp(id byte, s string) {
+	if s != "" {
+		e.writeByte(id)
+		e.writeString(s)
+	}
+}
+
+func (e *encoder) binaryProp(id byte, b []byte) {
+	if b != nil {
+		e.writeByte(id)
+		e.writeBinary(b)
+	}
+}
+
+// decoder reads the fields of the packet body, the first error sticks and the later reads return zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrMalformed
+	}
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.fail()
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) readByte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) readUint16() uint16 {
+	if b := d.next(2); b != nil {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return 0
+}
+
+func (d *decoder) readUint32() uint32 {
+	if b := d.next(4); b != nil {
+		return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	}
+	return 0
+}
+
+func (d *decoder) readVarint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n, err := decodeVarint(d.data)
+	if err != nil || n == 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) readBinary() []byte {
+	n := int(d.readUint16())
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, n), b...)
+}
+
+// readString read a UTF-8 encoded string, which must not include the null character.
+func (d *decoder) readString() string {
+	n := int(d.readUint16())
+	b := d.next(n)
+	if b == nil {
+		return ""
+	}
+	if !validUTF8(b) {
+		d.fail()
+		return ""
+	}
+	return string(b)
+}
+
+func (d *decoder) bytePtr(prev *byte) *byte {
+	if prev != nil {
+		d.fail()
+	}
+	return Byte(d.readByte())
+}
+
+func (d *decoder) uint16Ptr(prev *uint16) *uint16 {
+	if prev != nil {
+		d.fail()
+	}
+	return Uint16(d.readUint16())
+}
+
+func (d *decoder) uint32Ptr(prev *uint32) *uint32 {
+	if prev != nil {
+		d.fail()
+	}
+	return Uint32(d.readUint32())
+}
+
+func validUTF8(b []byte) bool {
+	for _, c := range b {
+		if c == 0 {
+			return false
+		}
+	}
+	return utf8.Valid(b)
+}
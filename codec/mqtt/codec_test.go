@@ -0,0 +1,236 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVarint(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152, maxRemainingLength} {
+		data := appendVarint(nil, n)
+		v, size, err := decodeVarint(data)
+		assert.Nil(t, err)
+		assert.Equal(t, len(data), size)
+		assert.Equal(t, n, v)
+	}
+	assert.Equal(t, []byte{0x80, 0x01}, appendVarint(nil, 128))
+
+	// half integer.
+	_, size, err := decodeVarint([]byte{0x80, 0x80})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, size)
+
+	_, _, err = decodeVarint([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x01})
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
+
+func roundTrip(t *testing.T, version byte, p Packet) {
+	data, err := Append(nil, p, version)
+	assert.Nil(t, err)
+
+	codec := NewCodec()
+	codec.SetVersion(version)
+	// the half packets.
+	for i := 0; i < len(data); i++ {
+		pkg, n, err := codec.Decode(data[:i])
+		assert.Nil(t, err)
+		assert.Nil(t, pkg)
+		assert.Equal(t, 0, n)
+	}
+	pkg, n, err := codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, p, pkg, p.Type().String())
+}
+
+func TestCodec_RoundTripV311(t *testing.T) {
+	for _, p := range []Packet{
+		&Connect{ProtocolVersion: Version311, CleanStart: true, KeepAlive: 60, ClientID: "c1"},
+		&Connect{ProtocolVersion: Version311, KeepAlive: 10, ClientID: "c2",
+			Will:         &Will{Topic: "will", Payload: []byte("bye"), QoS: 1, Retain: true},
+			UsernameFlag: true, Username: "user", PasswordFlag: true, Password: []byte("pass")},
+		&ConnAck{SessionPresent: true, ReasonCode: ConnAcceptedV3},
+		&Publish{Topic: "a/b", Payload: []byte("hello")},
+		&Publish{Dup: true, QoS: 2, Retain: true, Topic: "a/b", PacketID: 7, Payload: []byte("x")},
+		&Ack{PacketType: PUBACK, PacketID: 1},
+		&Ack{PacketType: PUBREC, PacketID: 2},
+		&Ack{PacketType: PUBREL, PacketID: 3},
+		&Ack{PacketType: PUBCOMP, PacketID: 4},
+		&Subscribe{PacketID: 5, Subscriptions: []Subscription{{Topic: "a/+", QoS: 1}, {Topic: "#", QoS: 2}}},
+		&SubAck{PacketID: 5, ReasonCodes: []ReasonCode{ReasonGrantedQoS1, SubAckFailureV3}},
+		&Unsubscribe{PacketID: 6, Topics: []string{"a/+", "#"}},
+		&UnsubAck{PacketID: 6},
+		&PingReq{},
+		&PingResp{},
+		&Disconnect{},
+	} {
+		roundTrip(t, Version311, p)
+	}
+}
+
+func TestCodec_RoundTripV5(t *testing.T) {
+	props := Properties{
+		PayloadFormatIndicator: Byte(1),
+		MessageExpiryInterval:  Uint32(30),
+		ContentType:            "text/plain",
+		ResponseTopic:          "reply",
+		CorrelationData:        []byte{1, 2},
+		UserProperties:         []UserProperty{{Key: "k", Value: "v"}, {Key: "k", Value: "v2"}},
+	}
+	for _, p := range []Packet{
+		&Connect{ProtocolVersion: Version5, CleanStart: true, KeepAlive: 30, ClientID: "c1",
+			Properties: Properties{SessionExpiryInterval: Uint32(120), ReceiveMaximum: Uint16(10),
+				MaximumPacketSize: Uint32(4096), TopicAliasMaximum: Uint16(5), RequestResponseInformation: Byte(1),
+				RequestProblemInformation: Byte(0), AuthenticationMethod: "SCRAM", AuthenticationData: []byte("d")},
+			Will: &Will{Topic: "will", Payload: []byte("bye"), QoS: 2,
+				Properties: Properties{WillDelayInterval: Uint32(5), ContentType: "text/plain"}},
+			UsernameFlag: true, Username: ""},
+		&ConnAck{ReasonCode: ReasonSuccess, Properties: Properties{AssignedClientIdentifier: "auto-1",
+			ServerKeepAlive: Uint16(20), MaximumQoS: Byte(1), RetainAvailable: Byte(0),
+			WildcardSubscriptionAvailable: Byte(1), SubscriptionIdentifierAvailable: Byte(1),
+			SharedSubscriptionAvailable: Byte(0), ResponseInformation: "resp", ServerReference: "other"}},
+		&Publish{QoS: 1, Topic: "a/b", PacketID: 9, Payload: []byte("hello"), Properties: props},
+		&Publish{Topic: "", Properties: Properties{TopicAlias: Uint16(3), SubscriptionIdentifiers: []int{1, 268435455}}},
+		&Ack{PacketType: PUBACK, PacketID: 1},
+		&Ack{PacketType: PUBREC, PacketID: 2, ReasonCode: ReasonNoMatchingSubscribers},
+		&Ack{PacketType: PUBREL, PacketID: 3, ReasonCode: ReasonPacketIdentifierNotFound,
+			Properties: Properties{ReasonString: "gone"}},
+		&Subscribe{PacketID: 5, Properties: Properties{SubscriptionIdentifiers: []int{42}},
+			Subscriptions: []Subscription{{Topic: "a/+", QoS: 1, NoLocal: true, RetainAsPublished: true, RetainHandling: 2}}},
+		&SubAck{PacketID: 5, ReasonCodes: []ReasonCode{ReasonGrantedQoS1, ReasonTopicFilterInvalid}},
+		&Unsubscribe{PacketID: 6, Topics: []string{"a/+"}},
+		&UnsubAck{PacketID: 6, ReasonCodes: []ReasonCode{ReasonSuccess, ReasonNoSubscriptionExisted}},
+		&PingReq{},
+		&Disconnect{},
+		&Disconnect{ReasonCode: ReasonDisconnectWithWill},
+		&Disconnect{ReasonCode: ReasonServerShuttingDown, Properties: Properties{SessionExpiryInterval: Uint32(0)}},
+		&Auth{},
+		&Auth{ReasonCode: ReasonContinueAuthentication, Properties: Properties{AuthenticationMethod: "SCRAM",
+			AuthenticationData: []byte("challenge")}},
+	} {
+		roundTrip(t, Version5, p)
+	}
+}
+
+func TestCodec_Encoding(t *testing.T) {
+	data, err := Append(nil, &Connect{ProtocolVersion: Version311, CleanStart: true, KeepAlive: 60, ClientID: "id"}, Version311)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x10, 14, 0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 60, 0, 2, 'i', 'd'}, data)
+
+	data, err = Append(nil, &Ack{PacketType: PUBREL, PacketID: 1}, Version5)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x62, 2, 0, 1}, data)
+
+	data, err = Append(nil, &Disconnect{}, Version5)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xE0, 0}, data)
+
+	data, err = Append(nil, &PingReq{}, Version311)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xC0, 0}, data)
+
+	// the properties and the reason codes are dropped in MQTT 3.1.1.
+	data, err = Append(nil, &Disconnect{ReasonCode: ReasonServerBusy}, Version311)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xE0, 0}, data)
+
+	_, err = Append(nil, &Auth{}, Version311)
+	assert.NotNil(t, err)
+	_, err = Append(nil, &Publish{QoS: 1, Topic: "a"}, Version311)
+	assert.NotNil(t, err)
+	_, err = NewCodec().Encode("not a packet")
+	assert.NotNil(t, err)
+}
+
+func TestCodec_LearnVersion(t *testing.T) {
+	client, server := NewCodec(), NewCodec()
+	data, err := client.Encode(&Connect{ProtocolVersion: Version5, ClientID: "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, Version5, client.Version())
+
+	pkg, _, err := server.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, Version5, pkg.(*Connect).ProtocolVersion)
+	assert.Equal(t, Version5, server.Version())
+
+	data, err = server.Encode(&ConnAck{Properties: Properties{ReasonString: "hi"}})
+	assert.Nil(t, err)
+	pkg, _, err = client.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", pkg.(*ConnAck).Properties.ReasonString)
+}
+
+func TestCodec_Malformed(t *testing.T) {
+	cases := map[string][]byte{
+		"reserved type":            {0x00, 0},
+		"pingreq flags":            {0xC1, 0},
+		"pubrel flags":             {0x60, 2, 0, 1},
+		"subscribe flags":          {0x80, 6, 0, 1, 0, 1, 'a', 0},
+		"publish qos 3":            {0x36, 5, 0, 1, 'a', 0, 1},
+		"publish dup with qos 0":   {0x38, 3, 0, 1, 'a'},
+		"publish wildcard":         {0x30, 3, 0, 1, '#'},
+		"publish zero packet id":   {0x32, 5, 0, 1, 'a', 0, 0},
+		"publish empty topic":      {0x30, 2, 0, 0},
+		"publish invalid utf8":     {0x30, 3, 0, 1, 0xFF},
+		"publish null character":   {0x30, 3, 0, 1, 0x00},
+		"string overflow":          {0x30, 3, 0, 9, 'a'},
+		"subscribe empty":          {0x82, 2, 0, 1},
+		"subscribe reserved bits":  {0x82, 6, 0, 1, 0, 1, 'a', 0x04},
+		"subscribe qos 3":          {0x82, 6, 0, 1, 0, 1, 'a', 0x03},
+		"unsubscribe empty":        {0xA2, 2, 0, 1},
+		"pingreq trailing bytes":   {0xC0, 1, 0},
+		"connack flags":            {0x20, 2, 0x02, 0},
+		"auth in 3.1.1":            {0xF0, 0},
+		"connect reserved flag":    append([]byte{0x10, 12}, connectHeader(Version311, 0x01)...),
+		"connect will qos no will": append([]byte{0x10, 12}, connectHeader(Version311, 0x08)...),
+		"connect password only":    append([]byte{0x10, 12}, connectHeader(Version311, 0x40)...),
+		"connect protocol name":    {0x10, 12, 0, 4, 'M', 'Q', 'T', 'X', 4, 0, 0, 0, 0, 0},
+	}
+	for name, data := range cases {
+		_, _, err := NewCodec().Decode(data)
+		assert.True(t, errors.Is(err, ErrMalformed), name)
+	}
+
+	v5 := map[string][]byte{
+		"unknown property":     {0x30, 6, 0, 1, 'a', 2, 0x7F, 0},
+		"duplicate property":   {0x30, 8, 0, 1, 'a', 4, 0x01, 0, 0x01, 1},
+		"zero receive maximum": {0x20, 6, 0, 0, 3, 0x21, 0, 0},
+		"properties overflow":  {0x30, 5, 0, 1, 'a', 5, 0},
+		"subscribe reserved":   {0x82, 7, 0, 1, 0, 0, 1, 'a', 0xC0},
+	}
+	for name, data := range v5 {
+		codec := NewCodec()
+		codec.SetVersion(Version5)
+		_, _, err := codec.Decode(data)
+		assert.True(t, errors.Is(err, ErrMalformed), name)
+	}
+
+	_, _, err := NewCodec().Decode(append([]byte{0x10, 12}, connectHeader(3, 0)...))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+
+	_, _, err = NewCodec(WithMaxPacketSize(16)).Decode([]byte{0x30, 20})
+	assert.True(t, errors.Is(err, ErrPacketTooLarge))
+}
+
+// connectHeader return the body of CONNECT with the empty client identifier.
+func connectHeader(version, flags byte) []byte {
+	return []byte{0, 4, 'M', 'Q', 'T', 'T', version, flags, 0, 0, 0, 0}
+}
@@ -0,0 +1,146 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Softwarekang/knetty/session"
+)
+
+// KeepAliveOption option for KeepAlive.
+type KeepAliveOption func(*KeepAlive)
+
+// WithServerKeepAlive set the keep alive seconds chosen by the server, it overrides the value of CONNECT
+// and is sent to the MQTT 5.0 clients by the ServerKeepAlive property of CONNACK.
+func WithServerKeepAlive(seconds uint16) KeepAliveOption {
+	return func(k *KeepAlive) {
+		k.server = Uint16(seconds)
+	}
+}
+
+// KeepAlive the pipeline handler keeping the MQTT session alive, it must be added behind the codec stage,
+// or to the session whose codec is a mqtt Codec, one handler for each session:
+//
+//	s.SetCodec(mqtt.NewCodec())
+//	s.Pipeline().AddLast("keepalive", mqtt.NewKeepAlive())
+//
+// it answers PINGREQ with PINGRESP without passing it on, and closes the session if no packet is
+// received within one and a half times the keep alive of CONNECT. zero keep alive disables the timer.
+type KeepAlive struct {
+	server *uint16
+
+	mu       sync.Mutex
+	version  byte
+	interval time.Duration
+	timer    *time.Timer
+	stopped  bool
+}
+
+// NewKeepAlive return a KeepAlive handler.
+func NewKeepAlive(opts ...KeepAliveOption) *KeepAlive {
+	k := &KeepAlive{}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k
+}
+
+// Interval return the keep alive in use, zero before CONNECT or when it is disabled.
+func (k *KeepAlive) Interval() time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.interval
+}
+
+// HandleRead implements session.InboundHandler.
+func (k *KeepAlive) HandleRead(ctx session.HandlerContext, msg interface{}) error {
+	switch p := msg.(type) {
+	case *Connect:
+		seconds := p.KeepAlive
+		if k.server != nil && p.ProtocolVersion >= Version5 {
+			seconds = *k.server
+		}
+		k.start(ctx.Session(), p.ProtocolVersion, time.Duration(seconds)*time.Second)
+	case *PingReq:
+		k.reset()
+		if err := ctx.Write(&PingResp{}); err != nil {
+			return err
+		}
+		return ctx.Session().FlushBuffer()
+	case *Disconnect:
+		k.Stop()
+	default:
+		k.reset()
+	}
+	return ctx.FireRead(msg)
+}
+
+// HandleWrite implements session.OutboundHandler, it sets the ServerKeepAlive property of the MQTT 5.0 CONNACK.
+func (k *KeepAlive) HandleWrite(ctx session.HandlerContext, msg interface{}) error {
+	if ack, ok := msg.(*ConnAck); ok && k.server != nil {
+		k.mu.Lock()
+		version := k.version
+		k.mu.Unlock()
+		if version >= Version5 && ack.Properties.ServerKeepAlive == nil {
+			ack.Properties.ServerKeepAlive = Uint16(*k.server)
+		}
+	}
+	return ctx.Write(msg)
+}
+
+// Stop stop the timer, the session is never closed by the handler after Stop.
+func (k *KeepAlive) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.stopped = true
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+}
+
+func (k *KeepAlive) start(s session.Session, version byte, interval time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.version = version
+	k.interval = interval
+	if interval <= 0 || k.stopped || k.timer != nil {
+		return
+	}
+	k.timer = time.AfterFunc(k.timeout(), func() {
+		k.mu.Lock()
+		stopped := k.stopped
+		k.stopped = true
+		k.mu.Unlock()
+		if !stopped {
+			_ = s.Close()
+		}
+	})
+}
+
+func (k *KeepAlive) reset() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.timer != nil && !k.stopped {
+		k.timer.Reset(k.timeout())
+	}
+}
+
+func (k *KeepAlive) timeout() time.Duration {
+	return k.interval * 3 / 2
+}
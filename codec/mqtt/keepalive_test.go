@@ -0,0 +1,119 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// brokerListener accept the connections and record the received packets.
+type brokerListener struct {
+	mu      sync.Mutex
+	packets []PacketType
+	closed  chan struct{}
+}
+
+func (l *brokerListener) OnConnect(session.Session) {}
+
+func (l *brokerListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	p := pkg.(Packet)
+	l.mu.Lock()
+	l.packets = append(l.packets, p.Type())
+	l.mu.Unlock()
+	if p.Type() == CONNECT {
+		_, _ = s.WritePkg(&ConnAck{})
+		_ = s.FlushBuffer()
+	}
+	return session.Normal
+}
+
+func (l *brokerListener) OnError(s session.Session, e error) {
+	_ = s.Close()
+}
+
+func (l *brokerListener) OnClose(session.Session) {
+	close(l.closed)
+}
+
+func TestKeepAlive(t *testing.T) {
+	broker := &brokerListener{closed: make(chan struct{})}
+	addr := knettytest.Serve(t, func(s session.Session) error {
+		s.SetCodec(NewCodec())
+		s.SetEventListener(broker)
+		return s.Pipeline().AddLast("keepalive", NewKeepAlive(WithServerKeepAlive(1)))
+	}).Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	codec, reader := NewCodec(), bufio.NewReader(conn)
+	write := func(p Packet) {
+		data, err := codec.Encode(p)
+		assert.Nil(t, err)
+		_, err = conn.Write(data)
+		assert.Nil(t, err)
+	}
+	read := func() Packet {
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		var buf []byte
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return nil
+			}
+			buf = append(buf, b)
+			if pkg, _, err := codec.Decode(buf); err != nil || pkg != nil {
+				assert.Nil(t, err)
+				return pkg.(Packet)
+			}
+		}
+	}
+
+	// the server keep alive overrides the keep alive of CONNECT.
+	write(&Connect{ProtocolVersion: Version5, KeepAlive: 60, ClientID: "c"})
+	assert.Equal(t, &ConnAck{Properties: Properties{ServerKeepAlive: Uint16(1)}}, read())
+	write(&PingReq{})
+	assert.Equal(t, &PingResp{}, read())
+	write(&Publish{Topic: "a", Payload: []byte("x")})
+
+	// the session is closed after one and a half times the keep alive without packets.
+	start := time.Now()
+	select {
+	case <-broker.closed:
+		assert.True(t, time.Since(start) >= time.Second)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the session is not closed by the keep alive")
+	}
+	assert.Nil(t, read())
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	// PINGREQ is answered by the handler.
+	assert.Equal(t, []PacketType{CONNECT, PUBLISH}, broker.packets)
+}
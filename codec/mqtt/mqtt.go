@@ -0,0 +1,167 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package mqtt impl the MQTT 3.1.1 and 5.0 packet codec for knetty sessions, the keep alive handler of the
+// session pipeline, and the helpers of the topic names, the topic filters and the subscriptions.
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PacketType the type of control packets.
+type PacketType byte
+
+const (
+	CONNECT     PacketType = 1
+	CONNACK     PacketType = 2
+	PUBLISH     PacketType = 3
+	PUBACK      PacketType = 4
+	PUBREC      PacketType = 5
+	PUBREL      PacketType = 6
+	PUBCOMP     PacketType = 7
+	SUBSCRIBE   PacketType = 8
+	SUBACK      PacketType = 9
+	UNSUBSCRIBE PacketType = 10
+	UNSUBACK    PacketType = 11
+	PINGREQ     PacketType = 12
+	PINGRESP    PacketType = 13
+	DISCONNECT  PacketType = 14
+	AUTH        PacketType = 15
+)
+
+var packetNames = [...]string{
+	"RESERVED", "CONNECT", "CONNACK", "PUBLISH", "PUBACK", "PUBREC", "PUBREL", "PUBCOMP",
+	"SUBSCRIBE", "SUBACK", "UNSUBSCRIBE", "UNSUBACK", "PINGREQ", "PINGRESP", "DISCONNECT", "AUTH",
+}
+
+// String implements fmt.Stringer.
+func (t PacketType) String() string {
+	if int(t) < len(packetNames) {
+		return packetNames[t]
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", byte(t))
+}
+
+const (
+	// Version311 the protocol level of MQTT 3.1.1.
+	Version311 byte = 4
+	// Version5 the protocol level of MQTT 5.0.
+	Version5 byte = 5
+
+	// DefaultMaxPacketSize the default maximum size of the received packets.
+	DefaultMaxPacketSize = 1 << 20
+	// maxRemainingLength the maximum value of the remaining length, 4 bytes of varint.
+	maxRemainingLength = 268435455
+)
+
+// ReasonCode the reason code of MQTT 5.0, the return code of CONNACK and SUBACK in MQTT 3.1.1.
+type ReasonCode byte
+
+const (
+	ReasonSuccess                             ReasonCode = 0x00
+	ReasonGrantedQoS1                         ReasonCode = 0x01
+	ReasonGrantedQoS2                         ReasonCode = 0x02
+	ReasonDisconnectWithWill                  ReasonCode = 0x04
+	ReasonNoMatchingSubscribers               ReasonCode = 0x10
+	ReasonNoSubscriptionExisted               ReasonCode = 0x11
+	ReasonContinueAuthentication              ReasonCode = 0x18
+	ReasonReAuthenticate                      ReasonCode = 0x19
+	ReasonUnspecifiedError                    ReasonCode = 0x80
+	ReasonMalformedPacket                     ReasonCode = 0x81
+	ReasonProtocolError                       ReasonCode = 0x82
+	ReasonImplementationSpecificError         ReasonCode = 0x83
+	ReasonUnsupportedProtocolVersion          ReasonCode = 0x84
+	ReasonClientIdentifierNotValid            ReasonCode = 0x85
+	ReasonBadUserNameOrPassword               ReasonCode = 0x86
+	ReasonNotAuthorized                       ReasonCode = 0x87
+	ReasonServerUnavailable                   ReasonCode = 0x88
+	ReasonServerBusy                          ReasonCode = 0x89
+	ReasonBanned                              ReasonCode = 0x8A
+	ReasonServerShuttingDown                  ReasonCode = 0x8B
+	ReasonBadAuthenticationMethod             ReasonCode = 0x8C
+	ReasonKeepAliveTimeout                    ReasonCode = 0x8D
+	ReasonSessionTakenOver                    ReasonCode = 0x8E
+	ReasonTopicFilterInvalid                  ReasonCode = 0x8F
+	ReasonTopicNameInvalid                    ReasonCode = 0x90
+	ReasonPacketIdentifierInUse               ReasonCode = 0x91
+	ReasonPacketIdentifierNotFound            ReasonCode = 0x92
+	ReasonReceiveMaximumExceeded              ReasonCode = 0x93
+	ReasonTopicAliasInvalid                   ReasonCode = 0x94
+	ReasonPacketTooLarge                      ReasonCode = 0x95
+	ReasonMessageRateTooHigh                  ReasonCode = 0x96
+	ReasonQuotaExceeded                       ReasonCode = 0x97
+	ReasonAdministrativeAction                ReasonCode = 0x98
+	ReasonPayloadFormatInvalid                ReasonCode = 0x99
+	ReasonRetainNotSupported                  ReasonCode = 0x9A
+	ReasonQoSNotSupported                     ReasonCode = 0x9B
+	ReasonUseAnotherServer                    ReasonCode = 0x9C
+	ReasonServerMoved                         ReasonCode = 0x9D
+	ReasonSharedSubscriptionsNotSupported     ReasonCode = 0x9E
+	ReasonConnectionRateExceeded              ReasonCode = 0x9F
+	ReasonMaximumConnectTime                  ReasonCode = 0xA0
+	ReasonSubscriptionIdentifiersNotSupported ReasonCode = 0xA1
+	ReasonWildcardSubscriptionsNotSupported   ReasonCode = 0xA2
+)
+
+// the return codes of CONNACK in MQTT 3.1.1.
+const (
+	ConnAcceptedV3                 ReasonCode = 0x00
+	ConnRefusedProtocolVersionV3   ReasonCode = 0x01
+	ConnRefusedIdentifierRejected  ReasonCode = 0x02
+	ConnRefusedServerUnavailable   ReasonCode = 0x03
+	ConnRefusedBadUsernamePassword ReasonCode = 0x04
+	ConnRefusedNotAuthorizedV3     ReasonCode = 0x05
+	// SubAckFailureV3 the return code of the failed subscription in SUBACK of MQTT 3.1.1.
+	SubAckFailureV3 ReasonCode = 0x80
+)
+
+var (
+	// ErrMalformed the packet violates the MQTT syntax, the connection must be closed.
+	ErrMalformed = errors.New("malformed mqtt packet")
+	// ErrPacketTooLarge the packet exceeds the maximum packet size.
+	ErrPacketTooLarge = errors.New("mqtt packet too large")
+	// ErrUnsupportedVersion the protocol version of CONNECT is not supported,
+	// the server should reply CONNACK with ReasonUnsupportedProtocolVersion or ConnRefusedProtocolVersionV3.
+	ErrUnsupportedVersion = errors.New("unsupported mqtt protocol version")
+)
+
+// Option option for codecs.
+type Option func(*Options)
+
+// Options options for codecs.
+type Options struct {
+	// MaxPacketSize the maximum size of the received packets, including the fixed header
+	MaxPacketSize int
+}
+
+// WithMaxPacketSize set the maximum size of the received packets.
+func WithMaxPacketSize(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxPacketSize = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{MaxPacketSize: DefaultMaxPacketSize}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
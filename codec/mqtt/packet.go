@@ -0,0 +1,569 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Packet the MQTT control packet, the Codec decodes the received bytes into the pointers of
+// Connect, ConnAck, Publish, Ack, Subscribe, SubAck, Unsubscribe, UnsubAck, PingReq, PingResp, Disconnect and Auth.
+type Packet interface {
+	// Type return the type of the packet.
+	Type() PacketType
+	encode(e *encoder, version byte) (byte, error)
+	decode(d *decoder, flags, version byte) error
+}
+
+// Will the will message of CONNECT.
+type Will struct {
+	Topic      string
+	Payload    []byte
+	QoS        byte
+	Retain     bool
+	Properties Properties
+}
+
+// Connect the CONNECT packet, the ProtocolVersion decides the version of the codec.
+type Connect struct {
+	// ProtocolVersion Version311 or Version5.
+	ProtocolVersion byte
+	CleanStart      bool
+	KeepAlive       uint16
+	Properties      Properties
+	ClientID        string
+	Will            *Will
+	// UsernameFlag the username is present, it is implied by a non-empty Username.
+	UsernameFlag bool
+	Username     string
+	// PasswordFlag the password is present, it is implied by a non-nil Password.
+	PasswordFlag bool
+	Password     []byte
+}
+
+// Type implements Packet.
+func (p *Connect) Type() PacketType { return CONNECT }
+
+func (p *Connect) encode(e *encoder, version byte) (byte, error) {
+	if p.ProtocolVersion != 0 {
+		version = p.ProtocolVersion
+	}
+	if version != Version311 && version != Version5 {
+		return 0, ErrUnsupportedVersion
+	}
+	var flags byte
+	if p.CleanStart {
+		flags |= 0x02
+	}
+	if w := p.Will; w != nil {
+		if w.QoS > 2 {
+			return 0, fmt.Errorf("invalid will qos %d", w.QoS)
+		}
+		flags |= 0x04 | w.QoS<<3
+		if w.Retain {
+			flags |= 0x20
+		}
+	}
+	if p.PasswordFlag || p.Password != nil {
+		flags |= 0x40
+	}
+	if p.UsernameFlag || p.Username != "" {
+		flags |= 0x80
+	}
+	e.writeString("MQTT")
+	e.writeByte(version)
+	e.writeByte(flags)
+	e.writeUint16(p.KeepAlive)
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	e.writeString(p.ClientID)
+	if w := p.Will; w != nil {
+		if version >= Version5 {
+			w.Properties.encode(e)
+		}
+		e.writeString(w.Topic)
+		e.writeBinary(w.Payload)
+	}
+	if flags&0x80 != 0 {
+		e.writeString(p.Username)
+	}
+	if flags&0x40 != 0 {
+		e.writeBinary(p.Password)
+	}
+	return 0, nil
+}
+
+func (p *Connect) decode(d *decoder, _, _ byte) error {
+	name := d.readString()
+	version := d.readByte()
+	if d.err != nil {
+		return nil
+	}
+	if name != "MQTT" {
+		return fmt.Errorf("%w: protocol name %q", ErrMalformed, name)
+	}
+	if version != Version311 && version != Version5 {
+		return fmt.Errorf("%w: protocol level %d", ErrUnsupportedVersion, version)
+	}
+	p.ProtocolVersion = version
+	flags := d.readByte()
+	willQoS := flags >> 3 & 0x03
+	if flags&0x01 != 0 || willQoS > 2 || flags&0x04 == 0 && flags&0x38 != 0 {
+		return fmt.Errorf("%w: connect flags %#x", ErrMalformed, flags)
+	}
+	if version == Version311 && flags&0xC0 == 0x40 {
+		return fmt.Errorf("%w: password without username", ErrMalformed)
+	}
+	p.CleanStart = flags&0x02 != 0
+	p.KeepAlive = d.readUint16()
+	if version >= Version5 {
+		p.Properties.decode(d)
+	}
+	p.ClientID = d.readString()
+	if flags&0x04 != 0 {
+		p.Will = &Will{QoS: willQoS, Retain: flags&0x20 != 0}
+		if version >= Version5 {
+			p.Will.Properties.decode(d)
+		}
+		p.Will.Topic = d.readString()
+		p.Will.Payload = d.readBinary()
+	}
+	if p.UsernameFlag = flags&0x80 != 0; p.UsernameFlag {
+		p.Username = d.readString()
+	}
+	if p.PasswordFlag = flags&0x40 != 0; p.PasswordFlag {
+		p.Password = d.readBinary()
+	}
+	return nil
+}
+
+// ConnAck the CONNACK packet.
+type ConnAck struct {
+	SessionPresent bool
+	// ReasonCode the reason code of MQTT 5.0 or the return code of MQTT 3.1.1.
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Type implements Packet.
+func (p *ConnAck) Type() PacketType { return CONNACK }
+
+func (p *ConnAck) encode(e *encoder, version byte) (byte, error) {
+	var flags byte
+	if p.SessionPresent {
+		flags = 0x01
+	}
+	e.writeByte(flags)
+	e.writeByte(byte(p.ReasonCode))
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	return 0, nil
+}
+
+func (p *ConnAck) decode(d *decoder, _, version byte) error {
+	flags := d.readByte()
+	if flags&0xFE != 0 {
+		return fmt.Errorf("%w: connack flags %#x", ErrMalformed, flags)
+	}
+	p.SessionPresent = flags == 0x01
+	p.ReasonCode = ReasonCode(d.readByte())
+	if version >= Version5 {
+		p.Properties.decode(d)
+	}
+	return nil
+}
+
+// Publish the PUBLISH packet.
+type Publish struct {
+	Dup    bool
+	QoS    byte
+	Retain bool
+	Topic  string
+	// PacketID the packet identifier, only present when QoS > 0.
+	PacketID   uint16
+	Properties Properties
+	Payload    []byte
+}
+
+// Type implements Packet.
+func (p *Publish) Type() PacketType { return PUBLISH }
+
+func (p *Publish) encode(e *encoder, version byte) (byte, error) {
+	if p.QoS > 2 {
+		return 0, fmt.Errorf("invalid publish qos %d", p.QoS)
+	}
+	if p.QoS > 0 && p.PacketID == 0 {
+		return 0, fmt.Errorf("publish of qos %d without packet identifier", p.QoS)
+	}
+	flags := p.QoS << 1
+	if p.Dup {
+		flags |= 0x08
+	}
+	if p.Retain {
+		flags |= 0x01
+	}
+	e.writeString(p.Topic)
+	if p.QoS > 0 {
+		e.writeUint16(p.PacketID)
+	}
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	e.buf = append(e.buf, p.Payload...)
+	return flags, nil
+}
+
+func (p *Publish) decode(d *decoder, flags, version byte) error {
+	p.Dup = flags&0x08 != 0
+	p.QoS = flags >> 1 & 0x03
+	p.Retain = flags&0x01 != 0
+	if p.QoS > 2 || p.QoS == 0 && p.Dup {
+		return fmt.Errorf("%w: publish flags %#x", ErrMalformed, flags)
+	}
+	p.Topic = d.readString()
+	if strings.ContainsAny(p.Topic, "+#") {
+		return fmt.Errorf("%w: wildcard in topic name %q", ErrMalformed, p.Topic)
+	}
+	if p.QoS > 0 {
+		if p.PacketID = d.readUint16(); p.PacketID == 0 && d.err == nil {
+			return fmt.Errorf("%w: zero packet identifier", ErrMalformed)
+		}
+	}
+	if version >= Version5 {
+		p.Properties.decode(d)
+	} else if p.Topic == "" && d.err == nil {
+		return fmt.Errorf("%w: empty topic name", ErrMalformed)
+	}
+	if d.err == nil && len(d.data) > 0 {
+		p.Payload = append(make([]byte, 0, len(d.data)), d.data...)
+		d.data = nil
+	}
+	return nil
+}
+
+// Ack the PUBACK, PUBREC, PUBREL and PUBCOMP packets.
+type Ack struct {
+	// PacketType PUBACK, PUBREC, PUBREL or PUBCOMP.
+	PacketType PacketType
+	PacketID   uint16
+	// ReasonCode the reason code of MQTT 5.0.
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Type implements Packet.
+func (p *Ack) Type() PacketType { return p.PacketType }
+
+func (p *Ack) encode(e *encoder, version byte) (byte, error) {
+	switch p.PacketType {
+	case PUBACK, PUBREC, PUBREL, PUBCOMP:
+	default:
+		return 0, fmt.Errorf("invalid ack packet type %s", p.PacketType)
+	}
+	e.writeUint16(p.PacketID)
+	if version >= Version5 {
+		encodeReason(e, p.ReasonCode, &p.Properties)
+	}
+	return requiredFlags(p.PacketType), nil
+}
+
+func (p *Ack) decode(d *decoder, _, version byte) error {
+	p.PacketID = d.readUint16()
+	if version >= Version5 {
+		p.ReasonCode = decodeReason(d, &p.Properties)
+	}
+	return nil
+}
+
+// Subscription the topic filter and the subscription options of SUBSCRIBE.
+type Subscription struct {
+	Topic string
+	QoS   byte
+	// NoLocal RetainAsPublished and RetainHandling are the subscription options of MQTT 5.0.
+	NoLocal           bool
+	RetainAsPublished bool
+	RetainHandling    byte
+}
+
+func (s Subscription) options() byte {
+	b := s.QoS | s.RetainHandling<<4
+	if s.NoLocal {
+		b |= 0x04
+	}
+	if s.RetainAsPublished {
+		b |= 0x08
+	}
+	return b
+}
+
+// Subscribe the SUBSCRIBE packet.
+type Subscribe struct {
+	PacketID      uint16
+	Properties    Properties
+	Subscriptions []Subscription
+}
+
+// Type implements Packet.
+func (p *Subscribe) Type() PacketType { return SUBSCRIBE }
+
+func (p *Subscribe) encode(e *encoder, version byte) (byte, error) {
+	if len(p.Subscriptions) == 0 {
+		return 0, fmt.Errorf("subscribe without subscriptions")
+	}
+	e.writeUint16(p.PacketID)
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	for _, sub := range p.Subscriptions {
+		e.writeString(sub.Topic)
+		if version >= Version5 {
+			e.writeByte(sub.options())
+		} else {
+			e.writeByte(sub.QoS)
+		}
+	}
+	return requiredFlags(SUBSCRIBE), nil
+}
+
+func (p *Subscribe) decode(d *decoder, _, version byte) error {
+	p.PacketID = d.readUint16()
+	if version >= Version5 {
+		p.Properties.decode(d)
+	}
+	for d.err == nil && len(d.data) > 0 {
+		sub := Subscription{Topic: d.readString()}
+		b := d.readByte()
+		reserved := byte(0xFC)
+		if version >= Version5 {
+			reserved = 0xC0
+		}
+		sub.QoS = b & 0x03
+		sub.NoLocal = b&0x04 != 0
+		sub.RetainAsPublished = b&0x08 != 0
+		sub.RetainHandling = b >> 4 & 0x03
+		if b&reserved != 0 || sub.QoS > 2 || sub.RetainHandling > 2 {
+			return fmt.Errorf("%w: subscription options %#x", ErrMalformed, b)
+		}
+		p.Subscriptions = append(p.Subscriptions, sub)
+	}
+	if d.err == nil && (p.PacketID == 0 || len(p.Subscriptions) == 0) {
+		d.fail()
+	}
+	return nil
+}
+
+// SubAck the SUBACK packet, a ReasonCode for each subscription of SUBSCRIBE.
+type SubAck struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []ReasonCode
+}
+
+// Type implements Packet.
+func (p *SubAck) Type() PacketType { return SUBACK }
+
+func (p *SubAck) encode(e *encoder, version byte) (byte, error) {
+	e.writeUint16(p.PacketID)
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	for _, code := range p.ReasonCodes {
+		e.writeByte(byte(code))
+	}
+	return 0, nil
+}
+
+func (p *SubAck) decode(d *decoder, _, version byte) error {
+	p.PacketID = d.readUint16()
+	if version >= Version5 {
+		p.Properties.decode(d)
+	}
+	p.ReasonCodes = decodeReasonCodes(d)
+	return nil
+}
+
+// Unsubscribe the UNSUBSCRIBE packet.
+type Unsubscribe struct {
+	PacketID   uint16
+	Properties Properties
+	Topics     []string
+}
+
+// Type implements Packet.
+func (p *Unsubscribe) Type() PacketType { return UNSUBSCRIBE }
+
+func (p *Unsubscribe) encode(e *encoder, version byte) (byte, error) {
+	if len(p.Topics) == 0 {
+		return 0, fmt.Errorf("unsubscribe without topics")
+	}
+	e.writeUint16(p.PacketID)
+	if version >= Version5 {
+		p.Properties.encode(e)
+	}
+	for _, topic := range p.Topics {
+		e.writeString(topic)
+	}
+	return requiredFlags(UNSUBSCRIBE), nil
+}
+
+func (p *Unsubscribe) decode(d *decoder, _, version byte) error {
+	p.PacketID = d.readUint16()
+	if version >= Version5 {
+		p.Properties.decode(d)
+	}
+	for d.err == nil && len(d.data) > 0 {
+		p.Topics = append(p.Topics, d.readString())
+	}
+	if d.err == nil && (p.PacketID == 0 || len(p.Topics) == 0) {
+		d.fail()
+	}
+	return nil
+}
+
+// UnsubAck the UNSUBACK packet, the ReasonCodes and the Properties are only present in MQTT 5.0.
+type UnsubAck struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []ReasonCode
+}
+
+// Type implements Packet.
+func (p *UnsubAck) Type() PacketType { return UNSUBACK }
+
+func (p *UnsubAck) encode(e *encoder, version byte) (byte, error) {
+	e.writeUint16(p.PacketID)
+	if version >= Version5 {
+		p.Properties.encode(e)
+		for _, code := range p.ReasonCodes {
+			e.writeByte(byte(code))
+		}
+	}
+	return 0, nil
+}
+
+func (p *UnsubAck) decode(d *decoder, _, version byte) error {
+	p.PacketID = d.readUint16()
+	if version >= Version5 {
+		p.Properties.decode(d)
+		p.ReasonCodes = decodeReasonCodes(d)
+	}
+	return nil
+}
+
+// PingReq the PINGREQ packet.
+type PingReq struct{}
+
+// Type implements Packet.
+func (p *PingReq) Type() PacketType { return PINGREQ }
+
+func (p *PingReq) encode(*encoder, byte) (byte, error) { return 0, nil }
+
+func (p *PingReq) decode(*decoder, byte, byte) error { return nil }
+
+// PingResp the PINGRESP packet.
+type PingResp struct{}
+
+// Type implements Packet.
+func (p *PingResp) Type() PacketType { return PINGRESP }
+
+func (p *PingResp) encode(*encoder, byte) (byte, error) { return 0, nil }
+
+func (p *PingResp) decode(*decoder, byte, byte) error { return nil }
+
+// Disconnect the DISCONNECT packet, the ReasonCode and the Properties are only present in MQTT 5.0.
+type Disconnect struct {
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Type implements Packet.
+func (p *Disconnect) Type() PacketType { return DISCONNECT }
+
+func (p *Disconnect) encode(e *encoder, version byte) (byte, error) {
+	if version >= Version5 {
+		encodeReason(e, p.ReasonCode, &p.Properties)
+	}
+	return 0, nil
+}
+
+func (p *Disconnect) decode(d *decoder, _, version byte) error {
+	if version >= Version5 {
+		p.ReasonCode = decodeReason(d, &p.Properties)
+	}
+	return nil
+}
+
+// Auth the AUTH packet of MQTT 5.0.
+type Auth struct {
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Type implements Packet.
+func (p *Auth) Type() PacketType { return AUTH }
+
+func (p *Auth) encode(e *encoder, version byte) (byte, error) {
+	if version < Version5 {
+		return 0, fmt.Errorf("AUTH packet of MQTT 3.1.1")
+	}
+	encodeReason(e, p.ReasonCode, &p.Properties)
+	return 0, nil
+}
+
+func (p *Auth) decode(d *decoder, _, _ byte) error {
+	p.ReasonCode = decodeReason(d, &p.Properties)
+	return nil
+}
+
+// encodeReason encode the optional reason code and properties, both are omitted for the success without properties.
+func encodeReason(e *encoder, code ReasonCode, props *Properties) {
+	var body encoder
+	props.encode(&body)
+	if code == ReasonSuccess && len(body.buf) == 1 {
+		return
+	}
+	e.writeByte(byte(code))
+	if len(body.buf) > 1 {
+		e.buf = append(e.buf, body.buf...)
+	}
+}
+
+func decodeReason(d *decoder, props *Properties) ReasonCode {
+	if d.err != nil || len(d.data) == 0 {
+		return ReasonSuccess
+	}
+	code := ReasonCode(d.readByte())
+	if len(d.data) > 0 {
+		props.decode(d)
+	}
+	return code
+}
+
+func decodeReasonCodes(d *decoder) []ReasonCode {
+	if d.err != nil {
+		return nil
+	}
+	codes := make([]ReasonCode, len(d.data))
+	for i, b := range d.data {
+		codes[i] = ReasonCode(b)
+	}
+	d.data = nil
+	return codes
+}
@@ -0,0 +1,224 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+// the identifiers of MQTT 5.0 properties.
+const (
+	propPayloadFormatIndicator          = 0x01
+	propMessageExpiryInterval           = 0x02
+	propContentType                     = 0x03
+	propResponseTopic                   = 0x08
+	propCorrelationData                 = 0x09
+	propSubscriptionIdentifier          = 0x0B
+	propSessionExpiryInterval           = 0x11
+	propAssignedClientIdentifier        = 0x12
+	propServerKeepAlive                 = 0x13
+	propAuthenticationMethod            = 0x15
+	propAuthenticationData              = 0x16
+	propRequestProblemInformation       = 0x17
+	propWillDelayInterval               = 0x18
+	propRequestResponseInformation      = 0x19
+	propResponseInformation             = 0x1A
+	propServerReference                 = 0x1C
+	propReasonString                    = 0x1F
+	propReceiveMaximum                  = 0x21
+	propTopicAliasMaximum               = 0x22
+	propTopicAlias                      = 0x23
+	propMaximumQoS                      = 0x24
+	propRetainAvailable                 = 0x25
+	propUserProperty                    = 0x26
+	propMaximumPacketSize               = 0x27
+	propWildcardSubscriptionAvailable   = 0x28
+	propSubscriptionIdentifierAvailable = 0x29
+	propSharedSubscriptionAvailable     = 0x2A
+)
+
+// UserProperty the name value pair of the user property.
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// Properties the properties of MQTT 5.0 packets, nil pointers, empty strings and nil slices mean absent.
+// The properties are ignored when the codec speaks MQTT 3.1.1.
+type Properties struct {
+	PayloadFormatIndicator          *byte
+	MessageExpiryInterval           *uint32
+	ContentType                     string
+	ResponseTopic                   string
+	CorrelationData                 []byte
+	SubscriptionIdentifiers         []int
+	SessionExpiryInterval           *uint32
+	AssignedClientIdentifier        string
+	ServerKeepAlive                 *uint16
+	AuthenticationMethod            string
+	AuthenticationData              []byte
+	RequestProblemInformation       *byte
+	WillDelayInterval               *uint32
+	RequestResponseInformation      *byte
+	ResponseInformation             string
+	ServerReference                 string
+	ReasonString                    string
+	ReceiveMaximum                  *uint16
+	TopicAliasMaximum               *uint16
+	TopicAlias                      *uint16
+	MaximumQoS                      *byte
+	RetainAvailable                 *byte
+	MaximumPacketSize               *uint32
+	WildcardSubscriptionAvailable   *byte
+	SubscriptionIdentifierAvailable *byte
+	SharedSubscriptionAvailable     *byte
+	UserProperties                  []UserProperty
+}
+
+// Byte return the pointer of v, for the optional byte properties.
+func Byte(v byte) *byte { return &v }
+
+// Uint16 return the pointer of v, for the optional two byte integer properties.
+func Uint16(v uint16) *uint16 { return &v }
+
+// Uint32 return the pointer of v, for the optional four byte integer properties.
+func Uint32(v uint32) *uint32 { return &v }
+
+func (p *Properties) encode(e *encoder) {
+	var body encoder
+	if p != nil {
+		body.byteProp(propPayloadFormatIndicator, p.PayloadFormatIndicator)
+		body.uint32Prop(propMessageExpiryInterval, p.MessageExpiryInterval)
+		body.stringProp(propContentType, p.ContentType)
+		body.stringProp(propResponseTopic, p.ResponseTopic)
+		body.binaryProp(propCorrelationData, p.CorrelationData)
+		for _, id := range p.SubscriptionIdentifiers {
+			body.writeByte(propSubscriptionIdentifier)
+			body.writeVarint(id)
+		}
+		body.uint32Prop(propSessionExpiryInterval, p.SessionExpiryInterval)
+		body.stringProp(propAssignedClientIdentifier, p.AssignedClientIdentifier)
+		body.uint16Prop(propServerKeepAlive, p.ServerKeepAlive)
+		body.stringProp(propAuthenticationMethod, p.AuthenticationMethod)
+		body.binaryProp(propAuthenticationData, p.AuthenticationData)
+		body.byteProp(propRequestProblemInformation, p.RequestProblemInformation)
+		body.uint32Prop(propWillDelayInterval, p.WillDelayInterval)
+		body.byteProp(propRequestResponseInformation, p.RequestResponseInformation)
+		body.stringProp(propResponseInformation, p.ResponseInformation)
+		body.stringProp(propServerReference, p.ServerReference)
+		body.stringProp(propReasonString, p.ReasonString)
+		body.uint16Prop(propReceiveMaximum, p.ReceiveMaximum)
+		body.uint16Prop(propTopicAliasMaximum, p.TopicAliasMaximum)
+		body.uint16Prop(propTopicAlias, p.TopicAlias)
+		body.byteProp(propMaximumQoS, p.MaximumQoS)
+		body.byteProp(propRetainAvailable, p.RetainAvailable)
+		body.uint32Prop(propMaximumPacketSize, p.MaximumPacketSize)
+		body.byteProp(propWildcardSubscriptionAvailable, p.WildcardSubscriptionAvailable)
+		body.byteProp(propSubscriptionIdentifierAvailable, p.SubscriptionIdentifierAvailable)
+		body.byteProp(propSharedSubscriptionAvailable, p.SharedSubscriptionAvailable)
+		for _, up := range p.UserProperties {
+			body.writeByte(propUserProperty)
+			body.writeString(up.Key)
+			body.writeString(up.Value)
+		}
+	}
+	e.writeVarint(len(body.buf))
+	e.buf = append(e.buf, body.buf...)
+}
+
+func (p *Properties) decode(d *decoder) {
+	n := d.readVarint()
+	if d.err != nil {
+		return
+	}
+	if n > len(d.data) {
+		d.fail()
+		return
+	}
+	props := &decoder{data: d.data[:n]}
+	d.data = d.data[n:]
+	for props.err == nil && len(props.data) > 0 {
+		switch id := props.readVarint(); id {
+		case propPayloadFormatIndicator:
+			p.PayloadFormatIndicator = props.bytePtr(p.PayloadFormatIndicator)
+		case propMessageExpiryInterval:
+			p.MessageExpiryInterval = props.uint32Ptr(p.MessageExpiryInterval)
+		case propContentType:
+			p.ContentType = props.readString()
+		case propResponseTopic:
+			p.ResponseTopic = props.readString()
+		case propCorrelationData:
+			p.CorrelationData = props.readBinary()
+		case propSubscriptionIdentifier:
+			sid := props.readVarint()
+			if sid == 0 {
+				props.fail()
+			}
+			p.SubscriptionIdentifiers = append(p.SubscriptionIdentifiers, sid)
+		case propSessionExpiryInterval:
+			p.SessionExpiryInterval = props.uint32Ptr(p.SessionExpiryInterval)
+		case propAssignedClientIdentifier:
+			p.AssignedClientIdentifier = props.readString()
+		case propServerKeepAlive:
+			p.ServerKeepAlive = props.uint16Ptr(p.ServerKeepAlive)
+		case propAuthenticationMethod:
+			p.AuthenticationMethod = props.readString()
+		case propAuthenticationData:
+			p.AuthenticationData = props.readBinary()
+		case propRequestProblemInformation:
+			p.RequestProblemInformation = props.bytePtr(p.RequestProblemInformation)
+		case propWillDelayInterval:
+			p.WillDelayInterval = props.uint32Ptr(p.WillDelayInterval)
+		case propRequestResponseInformation:
+			p.RequestResponseInformation = props.bytePtr(p.RequestResponseInformation)
+		case propResponseInformation:
+			p.ResponseInformation = props.readString()
+		case propServerReference:
+			p.ServerReference = props.readString()
+		case propReasonString:
+			p.ReasonString = props.readString()
+		case propReceiveMaximum:
+			p.ReceiveMaximum = props.uint16Ptr(p.ReceiveMaximum)
+			if p.ReceiveMaximum != nil && *p.ReceiveMaximum == 0 {
+				props.fail()
+			}
+		case propTopicAliasMaximum:
+			p.TopicAliasMaximum = props.uint16Ptr(p.TopicAliasMaximum)
+		case propTopicAlias:
+			p.TopicAlias = props.uint16Ptr(p.TopicAlias)
+		case propMaximumQoS:
+			p.MaximumQoS = props.bytePtr(p.MaximumQoS)
+		case propRetainAvailable:
+			p.RetainAvailable = props.bytePtr(p.RetainAvailable)
+		case propUserProperty:
+			key := props.readString()
+			p.UserProperties = append(p.UserProperties, UserProperty{Key: key, Value: props.readString()})
+		case propMaximumPacketSize:
+			p.MaximumPacketSize = props.uint32Ptr(p.MaximumPacketSize)
+			if p.MaximumPacketSize != nil && *p.MaximumPacketSize == 0 {
+				props.fail()
+			}
+		case propWildcardSubscriptionAvailable:
+			p.WildcardSubscriptionAvailable = props.bytePtr(p.WildcardSubscriptionAvailable)
+		case propSubscriptionIdentifierAvailable:
+			p.SubscriptionIdentifierAvailable = props.bytePtr(p.SubscriptionIdentifierAvailable)
+		case propSharedSubscriptionAvailable:
+			p.SharedSubscriptionAvailable = props.bytePtr(p.SharedSubscriptionAvailable)
+		default:
+			props.fail()
+		}
+	}
+	if props.err != nil {
+		d.err = props.err
+	}
+}
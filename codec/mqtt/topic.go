@@ -0,0 +1,253 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const sharePrefix = "$share/"
+
+// ErrInvalidTopicFilter the topic filter is not valid.
+var ErrInvalidTopicFilter = errors.New("invalid mqtt topic filter")
+
+// ValidTopicName report whether name is a valid topic name of PUBLISH, it must be non-empty UTF-8
+// without the wildcards and the null character.
+func ValidTopicName(name string) bool {
+	return validTopic(name) && !strings.ContainsAny(name, "+#")
+}
+
+// ValidTopicFilter report whether filter is a valid topic filter of SUBSCRIBE, the multi-level wildcard '#'
+// must be the last level, and the wildcards must occupy an entire level. the shared subscriptions
+// '$share/{group}/{filter}' are valid if the group has no wildcards and the filter is valid.
+func ValidTopicFilter(filter string) bool {
+	if group, f, ok := SharedSubscription(filter); ok {
+		return group != "" && !strings.ContainsAny(group, "+#") && ValidTopicFilter(f)
+	}
+	if !validTopic(filter) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i == len(levels)-1, level == "+":
+		case strings.ContainsAny(level, "+#"):
+			return false
+		}
+	}
+	return true
+}
+
+func validTopic(s string) bool {
+	return s != "" && len(s) <= 65535 && utf8.ValidString(s) && strings.IndexByte(s, 0) < 0
+}
+
+// SharedSubscription split the shared subscription '$share/{group}/{filter}' into the group and the filter,
+// ok is false if filter is not a shared subscription.
+func SharedSubscription(filter string) (group, topicFilter string, ok bool) {
+	if !strings.HasPrefix(filter, sharePrefix) {
+		return "", "", false
+	}
+	rest := filter[len(sharePrefix):]
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return rest, "", true
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// MatchTopic report whether the topic name matches the topic filter, the filters starting with a
+// wildcard don't match the topic names starting with '$'.
+func MatchTopic(filter, name string) bool {
+	if _, f, ok := SharedSubscription(filter); ok {
+		filter = f
+	}
+	if strings.HasPrefix(name, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	for {
+		level, rest, more := cutLevel(filter)
+		if level == "#" {
+			return true
+		}
+		nameLevel, nameRest, nameMore := cutLevel(name)
+		if level != "+" && level != nameLevel {
+			return false
+		}
+		if !more || !nameMore {
+			// 'sport/#' matches 'sport'.
+			return more == nameMore || more && rest == "#"
+		}
+		filter, name = rest, nameRest
+	}
+}
+
+func cutLevel(s string) (level, rest string, more bool) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+// Subscriber the matched subscription of a client.
+type Subscriber struct {
+	ClientID string
+	// Group the group of the shared subscription, empty for the non-shared subscriptions.
+	Group string
+	Subscription
+}
+
+type subscriberKey struct {
+	clientID string
+	group    string
+}
+
+type topicNode struct {
+	children    map[string]*topicNode
+	subscribers map[subscriberKey]Subscription
+}
+
+// Subscriptions the subscriptions of the clients indexed by the levels of the topic filters, safe for concurrent use.
+type Subscriptions struct {
+	mu   sync.RWMutex
+	root *topicNode
+}
+
+// NewSubscriptions return an empty Subscriptions.
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{root: &topicNode{}}
+}
+
+// Subscribe add or replace the subscription of the client, report whether the subscription existed.
+func (t *Subscriptions) Subscribe(clientID string, sub Subscription) (bool, error) {
+	if !ValidTopicFilter(sub.Topic) {
+		return false, ErrInvalidTopicFilter
+	}
+	group, filter, _ := SharedSubscription(sub.Topic)
+	if group == "" {
+		filter = sub.Topic
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.root
+	for _, level := range strings.Split(filter, "/") {
+		child := node.children[level]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*topicNode)
+			}
+			child = &topicNode{}
+			node.children[level] = child
+		}
+		node = child
+	}
+	if node.subscribers == nil {
+		node.subscribers = make(map[subscriberKey]Subscription)
+	}
+	key := subscriberKey{clientID: clientID, group: group}
+	_, existed := node.subscribers[key]
+	node.subscribers[key] = sub
+	return existed, nil
+}
+
+// Unsubscribe remove the subscription of the client, report whether the subscription existed.
+func (t *Subscriptions) Unsubscribe(clientID, topicFilter string) bool {
+	group, filter, _ := SharedSubscription(topicFilter)
+	if group == "" {
+		filter = topicFilter
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	levels := strings.Split(filter, "/")
+	path := make([]*topicNode, 0, len(levels)+1)
+	path = append(path, t.root)
+	for _, level := range levels {
+		node := path[len(path)-1].children[level]
+		if node == nil {
+			return false
+		}
+		path = append(path, node)
+	}
+	key := subscriberKey{clientID: clientID, group: group}
+	node := path[len(path)-1]
+	if _, ok := node.subscribers[key]; !ok {
+		return false
+	}
+	delete(node.subscribers, key)
+	// prune the empty nodes from the leaf.
+	for i := len(path) - 1; i > 0; i-- {
+		if n := path[i]; len(n.subscribers) > 0 || len(n.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, levels[i-1])
+	}
+	return true
+}
+
+// Match return the subscribers of the topic name, the overlapping subscriptions of a client are merged into
+// the one with the maximum QoS. the members of a shared subscription group are all returned, the caller
+// chooses one of them for each group.
+func (t *Subscriptions) Match(name string) []Subscriber {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	matched := make(map[subscriberKey]Subscription)
+	t.root.match(strings.Split(name, "/"), strings.HasPrefix(name, "$"), matched)
+	subscribers := make([]Subscriber, 0, len(matched))
+	for key, sub := range matched {
+		subscribers = append(subscribers, Subscriber{ClientID: key.clientID, Group: key.group, Subscription: sub})
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		if subscribers[i].Group != subscribers[j].Group {
+			return subscribers[i].Group < subscribers[j].Group
+		}
+		return subscribers[i].ClientID < subscribers[j].ClientID
+	})
+	return subscribers
+}
+
+// match collect the subscribers of the levels, noWildcard prevents the wildcards matching the '$' topics.
+func (n *topicNode) match(levels []string, noWildcard bool, matched map[subscriberKey]Subscription) {
+	if !noWildcard {
+		if child := n.children["#"]; child != nil {
+			child.collect(matched)
+		}
+	}
+	if len(levels) == 0 {
+		n.collect(matched)
+		return
+	}
+	if !noWildcard {
+		if child := n.children["+"]; child != nil {
+			child.match(levels[1:], false, matched)
+		}
+	}
+	if child := n.children[levels[0]]; child != nil {
+		child.match(levels[1:], false, matched)
+	}
+}
+
+func (n *topicNode) collect(matched map[subscriberKey]Subscription) {
+	for key, sub := range n.subscribers {
+		if prev, ok := matched[key]; !ok || sub.QoS > prev.QoS {
+			matched[key] = sub
+		}
+	}
+}
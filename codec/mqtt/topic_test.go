@@ -0,0 +1,134 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidTopic(t *testing.T) {
+	for _, name := range []string{"a", "a/b", "/", "a//b", "$SYS/uptime"} {
+		assert.True(t, ValidTopicName(name), name)
+	}
+	for _, name := range []string{"", "a/+", "#", "a\x00b"} {
+		assert.False(t, ValidTopicName(name), name)
+	}
+
+	for _, filter := range []string{"#", "+", "a/#", "a/+/b", "+/+", "/+", "$share/g/a/#", "$SYS/#"} {
+		assert.True(t, ValidTopicFilter(filter), filter)
+	}
+	for _, filter := range []string{"", "a#", "a/#/b", "a+/b", "a/b+", "$share/g", "$share//a", "$share/g+/a", "$share/g/a#"} {
+		assert.False(t, ValidTopicFilter(filter), filter)
+	}
+}
+
+func TestSharedSubscription(t *testing.T) {
+	group, filter, ok := SharedSubscription("$share/consumers/a/+")
+	assert.True(t, ok)
+	assert.Equal(t, "consumers", group)
+	assert.Equal(t, "a/+", filter)
+
+	_, _, ok = SharedSubscription("a/+")
+	assert.False(t, ok)
+}
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter, name string
+		match        bool
+	}{
+		{"sport/tennis/player1/#", "sport/tennis/player1", true},
+		{"sport/tennis/player1/#", "sport/tennis/player1/ranking", true},
+		{"sport/tennis/player1/#", "sport/tennis/player2", false},
+		{"sport/#", "sport", true},
+		{"#", "sport/tennis", true},
+		{"sport/tennis/+", "sport/tennis/player1", true},
+		{"sport/tennis/+", "sport/tennis/player1/ranking", false},
+		{"sport/+", "sport", false},
+		{"sport/+", "sport/", true},
+		{"+/+", "/finance", true},
+		{"/+", "/finance", true},
+		{"+", "/finance", false},
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"$share/g/a/+", "a/b", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, MatchTopic(c.filter, c.name), c.filter+" "+c.name)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	subs := NewSubscriptions()
+	for _, s := range []struct {
+		client string
+		sub    Subscription
+	}{
+		{"c1", Subscription{Topic: "a/+", QoS: 0}},
+		{"c1", Subscription{Topic: "a/#", QoS: 2}},
+		{"c2", Subscription{Topic: "a/b", QoS: 1}},
+		{"c3", Subscription{Topic: "#", QoS: 1}},
+		{"c4", Subscription{Topic: "$share/g/a/b", QoS: 1}},
+		{"c5", Subscription{Topic: "$share/g/a/+", QoS: 0}},
+		{"c6", Subscription{Topic: "$SYS/#", QoS: 0}},
+	} {
+		existed, err := subs.Subscribe(s.client, s.sub)
+		assert.Nil(t, err)
+		assert.False(t, existed)
+	}
+	existed, err := subs.Subscribe("c2", Subscription{Topic: "a/b", QoS: 2})
+	assert.Nil(t, err)
+	assert.True(t, existed)
+	_, err = subs.Subscribe("c2", Subscription{Topic: "a/#/b"})
+	assert.Equal(t, ErrInvalidTopicFilter, err)
+
+	assert.Equal(t, []Subscriber{
+		{ClientID: "c1", Subscription: Subscription{Topic: "a/#", QoS: 2}},
+		{ClientID: "c2", Subscription: Subscription{Topic: "a/b", QoS: 2}},
+		{ClientID: "c3", Subscription: Subscription{Topic: "#", QoS: 1}},
+		{ClientID: "c4", Group: "g", Subscription: Subscription{Topic: "$share/g/a/b", QoS: 1}},
+		{ClientID: "c5", Group: "g", Subscription: Subscription{Topic: "$share/g/a/+", QoS: 0}},
+	}, subs.Match("a/b"))
+	assert.Equal(t, []Subscriber{
+		{ClientID: "c1", Subscription: Subscription{Topic: "a/#", QoS: 2}},
+		{ClientID: "c3", Subscription: Subscription{Topic: "#", QoS: 1}},
+	}, subs.Match("a"))
+	assert.Equal(t, []Subscriber{
+		{ClientID: "c6", Subscription: Subscription{Topic: "$SYS/#", QoS: 0}},
+	}, subs.Match("$SYS/uptime"))
+
+	assert.True(t, subs.Unsubscribe("c1", "a/#"))
+	assert.False(t, subs.Unsubscribe("c1", "a/#"))
+	assert.True(t, subs.Unsubscribe("c4", "$share/g/a/b"))
+	assert.False(t, subs.Unsubscribe("c9", "x/y"))
+	assert.Equal(t, []Subscriber{
+		{ClientID: "c1", Subscription: Subscription{Topic: "a/+", QoS: 0}},
+		{ClientID: "c2", Subscription: Subscription{Topic: "a/b", QoS: 2}},
+		{ClientID: "c3", Subscription: Subscription{Topic: "#", QoS: 1}},
+		{ClientID: "c5", Group: "g", Subscription: Subscription{Topic: "$share/g/a/+", QoS: 0}},
+	}, subs.Match("a/b"))
+
+	for _, u := range [][2]string{{"c1", "a/+"}, {"c2", "a/b"}, {"c3", "#"}, {"c5", "$share/g/a/+"}, {"c6", "$SYS/#"}} {
+		assert.True(t, subs.Unsubscribe(u[0], u[1]))
+	}
+	assert.Empty(t, subs.root.children)
+}
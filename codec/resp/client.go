@@ -0,0 +1,350 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Softwarekang/knetty"
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/session"
+)
+
+var (
+	// ErrClientClosed the client is closed.
+	ErrClientClosed = errors.New("resp client closed")
+	// ErrConnClosed the connection is closed before the reply is received.
+	ErrConnClosed = errors.New("resp connection closed before reply")
+)
+
+// ClientOption option for Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	codecOptions  []Option
+	knettyOptions []knetty.ClientOption
+	protocol      int
+	onPush        func(Value)
+}
+
+// WithCodecOptions set the options for the codecs of the connections.
+func WithCodecOptions(opts ...Option) ClientOption {
+	return func(opt *clientOptions) {
+		opt.codecOptions = opts
+	}
+}
+
+// WithKnettyClientOptions set the options for the knetty clients of the connections, e.g. the event loops.
+func WithKnettyClientOptions(opts ...knetty.ClientOption) ClientOption {
+	return func(opt *clientOptions) {
+		opt.knettyOptions = opts
+	}
+}
+
+// WithProtocol set the protocol version, HELLO 3 is sent after connecting for RESP3.
+func WithProtocol(version int) ClientOption {
+	return func(opt *clientOptions) {
+		if version == 2 || version == 3 {
+			opt.protocol = version
+		}
+	}
+}
+
+// WithPushHandler set the handler of the RESP3 pushes, e.g. the messages of the subscribed channels,
+// it runs in the event loop.
+func WithPushHandler(fn func(Value)) ClientOption {
+	return func(opt *clientOptions) {
+		opt.onPush = fn
+	}
+}
+
+// Client a RESP client of a Redis-like server, the commands are pipelined on a single connection
+// served by the knetty event loops, the connection is reestablished by the next command after it is closed.
+type Client struct {
+	addr    string
+	options clientOptions
+	mu      sync.Mutex
+	conn    *clientConn
+	closed  bool
+}
+
+// NewClient return a client of addr, the connection is established by the first command.
+func NewClient(addr string, opts ...ClientOption) *Client {
+	options := clientOptions{protocol: 2}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Client{addr: addr, options: options}
+}
+
+// Do send the command of args and return the reply, the error reply is returned as Error.
+// the arguments are encoded as bulk strings, e.g. string, []byte, integers, floats and bool.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (Value, error) {
+	if len(args) == 0 {
+		return Value{}, errors.New("resp: empty command")
+	}
+
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return Value{}, err
+	}
+
+	reply, err := conn.roundTrip(ctx, commandValue(args))
+	if err != nil {
+		return reply, err
+	}
+	return reply, reply.Err()
+}
+
+// Close close the client and its connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.closed, c.conn = true, nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.close()
+	}
+	return nil
+}
+
+func (c *Client) getConn(ctx context.Context) (*clientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	if c.conn != nil && !c.conn.isClosed() {
+		return c.conn, nil
+	}
+
+	// the commands are waiting for the new connection.
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *Client) dial(ctx context.Context) (*clientConn, error) {
+	conn := &clientConn{
+		codec:  NewClientCodec(c.options.codecOptions...),
+		onPush: c.options.onPush,
+		done:   make(chan struct{}),
+	}
+	opts := append([]knetty.ClientOption{knetty.WithClientNewSessionCallBackFunc(func(s session.Session) error {
+		s.SetCodec(conn.codec)
+		s.SetEventListener(conn)
+		return nil
+	})}, c.options.knettyOptions...)
+	client := knetty.NewClient("tcp", c.addr, opts...)
+
+	type result struct {
+		session session.Session
+		err     error
+	}
+	connected := make(chan result, 1)
+	go func() {
+		s, err := client.Connect()
+		connected <- result{session: s, err: err}
+	}()
+
+	select {
+	case r := <-connected:
+		if r.err != nil {
+			return nil, r.err
+		}
+		conn.client, conn.session = client, r.session
+	case <-ctx.Done():
+		// close the connection established after the command is canceled.
+		go func() {
+			if r := <-connected; r.err == nil {
+				_ = client.Shutdown(context.Background())
+			}
+		}()
+		return nil, ctx.Err()
+	}
+
+	if c.options.protocol == 3 {
+		reply, err := conn.roundTrip(ctx, commandValue([]interface{}{"HELLO", 3}))
+		if err == nil {
+			err = reply.Err()
+		}
+		if err != nil {
+			conn.close()
+			return nil, err
+		}
+		conn.codec.SetProtocol(3)
+	}
+	return conn, nil
+}
+
+// clientConn a connection of the client, the replies are matched with the pipelined commands in order.
+type clientConn struct {
+	client    *knetty.Client
+	session   session.Session
+	codec     *Codec
+	onPush    func(Value)
+	mu        sync.Mutex
+	pending   []chan Value
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *clientConn) roundTrip(ctx context.Context, cmd Value) (Value, error) {
+	reply := make(chan Value, 1)
+
+	// the command is written in the order of the pending replies.
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		return Value{}, ErrConnClosed
+	}
+	c.pending = append(c.pending, reply)
+	_, err := c.session.WritePkg(cmd)
+	if err == nil {
+		err = c.session.FlushBuffer()
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.close()
+		return Value{}, err
+	}
+
+	select {
+	case v := <-reply:
+		return v, nil
+	case <-c.done:
+		select {
+		case v := <-reply:
+			return v, nil
+		default:
+			return Value{}, ErrConnClosed
+		}
+	// the abandoned reply is dropped, the following replies are still matched in order.
+	case <-ctx.Done():
+		return Value{}, ctx.Err()
+	}
+}
+
+func (c *clientConn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *clientConn) close() {
+	_ = c.client.Shutdown(context.Background())
+}
+
+// OnConnect implements session.EventListener.
+func (c *clientConn) OnConnect(session.Session) {}
+
+// OnMessage implements session.EventListener.
+func (c *clientConn) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	v := pkg.(Value)
+	if v.Type == TypePush {
+		if c.onPush != nil {
+			c.onPush(v)
+		}
+		return session.Normal
+	}
+
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		log.Warnf("resp client session:%s drop the unexpected reply", s.Info())
+		return session.Normal
+	}
+	reply := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	reply <- v
+	return session.Normal
+}
+
+// OnError implements session.EventListener.
+func (c *clientConn) OnError(s session.Session, e error) {
+	log.Errorf("resp client session:%s err:%v", s.Info(), e)
+	_ = s.Close()
+}
+
+// OnClose implements session.EventListener.
+func (c *clientConn) OnClose(session.Session) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.pending = nil
+		close(c.done)
+		c.mu.Unlock()
+	})
+}
+
+// commandValue return the array of bulk strings of args.
+func commandValue(args []interface{}) Value {
+	elems := make([]Value, 0, len(args))
+	for _, arg := range args {
+		elems = append(elems, BulkString(argString(arg)))
+	}
+	return Array(elems...)
+}
+
+func argString(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	case int:
+		return strconv.Itoa(a)
+	case int64:
+		return strconv.FormatInt(a, 10)
+	case int32:
+		return strconv.FormatInt(int64(a), 10)
+	case uint:
+		return strconv.FormatUint(uint64(a), 10)
+	case uint64:
+		return strconv.FormatUint(a, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(a), 10)
+	case float64:
+		return strconv.FormatFloat(a, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(a), 'f', -1, 32)
+	case bool:
+		if a {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case fmt.Stringer:
+		return a.String()
+	default:
+		return fmt.Sprint(a)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	addr := serve(t, kvRouter())
+	client := NewClient(addr)
+	defer client.Close()
+	ctx := context.Background()
+
+	reply, err := client.Do(ctx, "SET", "k", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, SimpleString("OK"), reply)
+	reply, err = client.Do(ctx, "GET", []byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", reply.Text())
+	reply, err = client.Do(ctx, "GET", "missing")
+	assert.Nil(t, err)
+	assert.True(t, reply.IsNull())
+
+	_, err = client.Do(ctx, "NOPE")
+	assert.Equal(t, Error("ERR unknown command 'NOPE'"), err)
+
+	// the concurrent commands are pipelined on the connection.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reply, err := client.Do(ctx, "PING", i)
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprint(i), reply.Text())
+		}(i)
+	}
+	wg.Wait()
+
+	// the connection closed by the server is reestablished by the next command.
+	reply, err = client.Do(ctx, "QUIT")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply.Text())
+	client.mu.Lock()
+	done := client.conn.done
+	client.mu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the connection closed by the server is not closed")
+	}
+	reply, err = client.Do(ctx, "GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", reply.Text())
+
+	assert.Nil(t, client.Close())
+	_, err = client.Do(ctx, "PING")
+	assert.Equal(t, ErrClientClosed, err)
+}
+
+func TestClient_RESP3(t *testing.T) {
+	addr := serve(t, kvRouter())
+	pushes := make(chan Value, 2)
+	client := NewClient(addr, WithProtocol(3), WithPushHandler(func(v Value) {
+		pushes <- v
+	}))
+	defer client.Close()
+
+	reply, err := client.Do(context.Background(), "GET", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, Null(), reply)
+
+	// the pushes are not matched with the commands.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Do(ctx, "SUBSCRIBE", "news")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, Push(BulkString("subscribe"), BulkString("news"), Int(1)), <-pushes)
+	assert.Equal(t, Push(BulkString("message"), BulkString("news"), BulkString("hello")), <-pushes)
+}
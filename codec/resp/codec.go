@@ -0,0 +1,409 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/Softwarekang/knetty/pkg/math"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	// DefaultMaxBulkBytes the default maximum bytes of a bulk string.
+	DefaultMaxBulkBytes = 512 << 20
+	// DefaultMaxElements the default maximum elements of an aggregate value.
+	DefaultMaxElements = 1 << 20
+	// DefaultMaxInlineBytes the default maximum bytes of an inline command or a line.
+	DefaultMaxInlineBytes = 64 << 10
+	// DefaultMaxDepth the default maximum nesting depth of the aggregate values.
+	DefaultMaxDepth = 64
+)
+
+// Option option for codecs.
+type Option func(*Options)
+
+// Options options for codecs.
+type Options struct {
+	// MaxBulkBytes the maximum bytes of a bulk string
+	MaxBulkBytes int
+	// MaxElements the maximum elements of an aggregate value
+	MaxElements int
+	// MaxInlineBytes the maximum bytes of an inline command or a line
+	MaxInlineBytes int
+	// MaxDepth the maximum nesting depth of the aggregate values
+	MaxDepth int
+}
+
+// WithMaxBulkBytes set the maximum bytes of a bulk string.
+func WithMaxBulkBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxBulkBytes = n
+		}
+	}
+}
+
+// WithMaxElements set the maximum elements of an aggregate value.
+func WithMaxElements(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxElements = n
+		}
+	}
+}
+
+// WithMaxInlineBytes set the maximum bytes of an inline command or a line.
+func WithMaxInlineBytes(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxInlineBytes = n
+		}
+	}
+}
+
+// WithMaxDepth set the maximum nesting depth of the aggregate values.
+func WithMaxDepth(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxDepth = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		MaxBulkBytes:   DefaultMaxBulkBytes,
+		MaxElements:    DefaultMaxElements,
+		MaxInlineBytes: DefaultMaxInlineBytes,
+		MaxDepth:       DefaultMaxDepth,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// Codec the RESP codec, the packages are Value.
+// the RESP3 values are encoded as the RESP2 values until the protocol is switched to 3, e.g. by HELLO 3.
+type Codec struct {
+	options  *Options
+	inline   bool
+	protocol atomic.Int32
+}
+
+// NewServerCodec return a codec decoding the commands, including the inline commands, e.g. PING\r\n.
+func NewServerCodec(opts ...Option) *Codec {
+	c := NewClientCodec(opts...)
+	c.inline = true
+	return c
+}
+
+// NewClientCodec return a codec decoding the replies.
+func NewClientCodec(opts ...Option) *Codec {
+	c := &Codec{options: newOptions(opts...)}
+	c.protocol.Store(2)
+	return c
+}
+
+// SetProtocol set the protocol version 2 or 3 encoding the values.
+func (c *Codec) SetProtocol(version int) {
+	c.protocol.Store(int32(version))
+}
+
+// Protocol return the protocol version encoding the values.
+func (c *Codec) Protocol() int {
+	return int(c.protocol.Load())
+}
+
+// Encode implements session.Codec, pkg is Value, *Value, error or the encoded []byte.
+func (c *Codec) Encode(pkg interface{}) ([]byte, error) {
+	mode := encodeRESP2
+	if c.Protocol() == 3 {
+		mode = encodeRESP3
+	}
+	switch p := pkg.(type) {
+	case Value:
+		return appendValue(nil, p, mode), nil
+	case *Value:
+		return appendValue(nil, *p, mode), nil
+	case error:
+		return appendValue(nil, ErrorValue(p.Error()), mode), nil
+	case []byte:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("resp codec can not encode pkg type:%T", pkg)
+	}
+}
+
+// Decode implements session.Codec.
+func (c *Codec) Decode(data []byte) (interface{}, int, error) {
+	var skipped int
+	for c.inline && len(data) > 0 && !isType(data[0]) {
+		args, n, err := c.parseInline(data)
+		if err != nil || n == 0 {
+			return nil, 0, err
+		}
+
+		// the empty lines are skipped.
+		if len(args) > 0 {
+			return Array(args...), skipped + n, nil
+		}
+		data, skipped = data[n:], skipped+n
+	}
+
+	if len(data) == 0 {
+		// the skipped empty lines are consumed with the next command.
+		return nil, 0, nil
+	}
+
+	v, n, err := c.parse(data, 0)
+	if err != nil || n == 0 {
+		return nil, 0, err
+	}
+	return v, skipped + n, nil
+}
+
+func isType(b byte) bool {
+	switch Type(b) {
+	case TypeSimpleString, TypeError, TypeInteger, TypeBulkString, TypeArray, TypeNull, TypeBoolean, TypeDouble,
+		TypeBigNumber, TypeBulkError, TypeVerbatimString, TypeMap, TypeSet, TypeAttribute, TypePush:
+		return true
+	default:
+		return false
+	}
+}
+
+// readLine return the line without CRLF and the length including CRLF, the length is 0 for the half line.
+func (c *Codec) readLine(data []byte) ([]byte, int, error) {
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx < 0 {
+		if len(data) > c.options.MaxInlineBytes {
+			return nil, 0, fmt.Errorf("%w: line too long", ErrProtocol)
+		}
+		return nil, 0, nil
+	}
+	return data[:idx], idx + 2, nil
+}
+
+// parse decode a value, n is 0 if the data is incomplete.
+func (c *Codec) parse(data []byte, depth int) (Value, int, error) {
+	if depth > c.options.MaxDepth {
+		return Value{}, 0, fmt.Errorf("%w: nesting too deep", ErrProtocol)
+	}
+
+	line, n, err := c.readLine(data)
+	if err != nil || n == 0 {
+		return Value{}, 0, err
+	}
+	if len(line) == 0 {
+		return Value{}, 0, fmt.Errorf("%w: empty line", ErrProtocol)
+	}
+
+	t, body := Type(line[0]), string(line[1:])
+	v := Value{Type: t}
+	switch t {
+	case TypeSimpleString, TypeError, TypeBigNumber:
+		v.Str = body
+		return v, n, nil
+	case TypeInteger:
+		if v.Int, err = strconv.ParseInt(body, 10, 64); err != nil {
+			return v, 0, fmt.Errorf("%w: invalid integer %q", ErrProtocol, body)
+		}
+		return v, n, nil
+	case TypeNull:
+		if body != "" {
+			return v, 0, fmt.Errorf("%w: invalid null %q", ErrProtocol, body)
+		}
+		return v, n, nil
+	case TypeBoolean:
+		if body != "t" && body != "f" {
+			return v, 0, fmt.Errorf("%w: invalid boolean %q", ErrProtocol, body)
+		}
+		v.Bool = body == "t"
+		return v, n, nil
+	case TypeDouble:
+		if v.Float, err = strconv.ParseFloat(body, 64); err != nil {
+			return v, 0, fmt.Errorf("%w: invalid double %q", ErrProtocol, body)
+		}
+		return v, n, nil
+	case TypeBulkString, TypeBulkError, TypeVerbatimString:
+		return c.parseBulk(v, body, data, n)
+	case TypeArray, TypeMap, TypeSet, TypePush, TypeAttribute:
+		return c.parseAggregate(v, body, data, n, depth)
+	default:
+		return v, 0, fmt.Errorf("%w: invalid type %q", ErrProtocol, line[0])
+	}
+}
+
+func (c *Codec) parseBulk(v Value, body string, data []byte, n int) (Value, int, error) {
+	size, err := strconv.Atoi(body)
+	if err != nil || size < -1 {
+		return v, 0, fmt.Errorf("%w: invalid bulk length %q", ErrProtocol, body)
+	}
+	if size == -1 && v.Type == TypeBulkString {
+		v.Null = true
+		return v, n, nil
+	}
+	if size < 0 || size > c.options.MaxBulkBytes {
+		return v, 0, fmt.Errorf("%w: invalid bulk length %d", ErrProtocol, size)
+	}
+
+	end := n + size + 2
+	if len(data) < end {
+		return v, 0, nil
+	}
+	if data[end-2] != '\r' || data[end-1] != '\n' {
+		return v, 0, fmt.Errorf("%w: bulk without CRLF", ErrProtocol)
+	}
+
+	v.Str = string(data[n : end-2])
+	if v.Type == TypeVerbatimString {
+		if len(v.Str) < 4 || v.Str[3] != ':' {
+			return v, 0, fmt.Errorf("%w: invalid verbatim string", ErrProtocol)
+		}
+		v.Format, v.Str = v.Str[:3], v.Str[4:]
+	}
+	return v, end, nil
+}
+
+// maxPreallocElements the maximum elements preallocated for an aggregate value.
+const maxPreallocElements = 64
+
+func (c *Codec) parseAggregate(v Value, body string, data []byte, n, depth int) (Value, int, error) {
+	count, err := strconv.Atoi(body)
+	if err != nil || count < -1 {
+		return v, 0, fmt.Errorf("%w: invalid aggregate length %q", ErrProtocol, body)
+	}
+	if count == -1 && v.Type == TypeArray {
+		v.Null = true
+		return v, n, nil
+	}
+
+	// the maps and the attributes have the keys and the values.
+	if v.Type == TypeMap || v.Type == TypeAttribute {
+		count *= 2
+	}
+	if count < 0 || count > c.options.MaxElements {
+		return v, 0, fmt.Errorf("%w: invalid aggregate length %d", ErrProtocol, count)
+	}
+
+	// the count is not trusted before the elements arrive, the preallocation is capped.
+	elems := make([]Value, 0, math.Min(count, maxPreallocElements))
+	for i := 0; i < count; i++ {
+		elem, elemLen, err := c.parse(data[n:], depth+1)
+		if err != nil || elemLen == 0 {
+			return v, 0, err
+		}
+		elems, n = append(elems, elem), n+elemLen
+	}
+
+	if v.Type != TypeAttribute {
+		v.Elems = elems
+		return v, n, nil
+	}
+
+	// the attribute is attached to the following value.
+	next, nextLen, err := c.parse(data[n:], depth)
+	if err != nil || nextLen == 0 {
+		return v, 0, err
+	}
+	next.Attrs = elems
+	return next, n + nextLen, nil
+}
+
+// parseInline split the inline command into the bulk strings, the arguments may be quoted like redis-cli.
+func (c *Codec) parseInline(data []byte) ([]Value, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		if len(data) > c.options.MaxInlineBytes {
+			return nil, 0, fmt.Errorf("%w: inline command too long", ErrProtocol)
+		}
+		return nil, 0, nil
+	}
+
+	line := bytes.TrimSuffix(data[:idx], []byte("\r"))
+	var args []Value
+	for i := 0; i < len(line); {
+		switch b := line[i]; {
+		case b == ' ' || b == '\t':
+			i++
+		case b == '"' || b == '\'':
+			arg, n, err := unquote(line[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			args, i = append(args, BulkString(arg)), i+n
+		default:
+			end := bytes.IndexAny(line[i:], " \t")
+			if end < 0 {
+				end = len(line) - i
+			}
+			args, i = append(args, Bulk(line[i:i+end])), i+end
+		}
+	}
+	return args, idx + 1, nil
+}
+
+// unquote parse the quoted argument, the escapes are only interpreted in the double quotes.
+func unquote(line []byte) (string, int, error) {
+	quote := line[0]
+	var buf []byte
+	for i := 1; i < len(line); i++ {
+		switch b := line[i]; {
+		case b == quote:
+			if i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t' {
+				return "", 0, fmt.Errorf("%w: closing quote must be followed by a space", ErrProtocol)
+			}
+			return string(buf), i + 1, nil
+		case b == '\\' && i+1 < len(line):
+			i++
+			if quote == '\'' {
+				if line[i] != '\'' {
+					buf = append(buf, '\\')
+				}
+				buf = append(buf, line[i])
+				continue
+			}
+
+			switch line[i] {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'x':
+				if i+2 < len(line) {
+					if b, err := strconv.ParseUint(string(line[i+1:i+3]), 16, 8); err == nil {
+						buf, i = append(buf, byte(b)), i+2
+						continue
+					}
+				}
+				buf = append(buf, 'x')
+			default:
+				buf = append(buf, line[i])
+			}
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return "", 0, fmt.Errorf("%w: unbalanced quotes", ErrProtocol)
+}
@@ -0,0 +1,136 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec_Decode(t *testing.T) {
+	codec := NewServerCodec()
+
+	// the pipelined commands, the half command waits for more data.
+	data := []byte("*2\r\n$3\r\nGET\r\n$1\r\na\r\n*1\r\n$4\r\nPI")
+	pkg, n, err := codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, Array(BulkString("GET"), BulkString("a")), pkg)
+	pkg, n, err = codec.Decode(data[n:])
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	// the inline commands with quotes, the empty lines are skipped.
+	data = []byte("\r\n\nSET k \"a b\\x41\\n\" 'c\\'d'\r\n")
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, Array(BulkString("SET"), BulkString("k"), BulkString("a bA\n"), BulkString("c'd")), pkg)
+	_, _, err = codec.Decode([]byte("SET \"a\r\n"))
+	assert.ErrorIs(t, err, ErrProtocol)
+
+	// the client codec decodes no inline command.
+	_, _, err = NewClientCodec().Decode([]byte("PING\r\n"))
+	assert.ErrorIs(t, err, ErrProtocol)
+
+	tests := []struct {
+		data  string
+		value Value
+	}{
+		{data: "+OK\r\n", value: SimpleString("OK")},
+		{data: "-ERR bad\r\n", value: ErrorValue("ERR bad")},
+		{data: ":-12\r\n", value: Int(-12)},
+		{data: "$-1\r\n", value: NullBulk()},
+		{data: "*-1\r\n", value: NullArray()},
+		{data: "$0\r\n\r\n", value: BulkString("")},
+		{data: "_\r\n", value: Null()},
+		{data: "#t\r\n", value: Bool(true)},
+		{data: ",1.5\r\n", value: Double(1.5)},
+		{data: "(12345678901234567890\r\n", value: BigNumber("12345678901234567890")},
+		{data: "!5\r\nERR x\r\n", value: Value{Type: TypeBulkError, Str: "ERR x"}},
+		{data: "=7\r\ntxt:a b\r\n", value: VerbatimString("txt", "a b")},
+		{data: "%1\r\n+k\r\n:1\r\n", value: Map(SimpleString("k"), Int(1))},
+		{data: "~2\r\n:1\r\n:2\r\n", value: Set(Int(1), Int(2))},
+		{data: ">2\r\n+message\r\n*1\r\n$1\r\na\r\n", value: Push(SimpleString("message"), Array(BulkString("a")))},
+		{data: "|1\r\n+ttl\r\n:3\r\n+v\r\n", value: Value{Type: TypeSimpleString, Str: "v", Attrs: []Value{SimpleString("ttl"), Int(3)}}},
+	}
+	for _, tt := range tests {
+		codec := NewClientCodec()
+		// every prefix is a half value.
+		for i := 1; i < len(tt.data); i++ {
+			pkg, _, err := codec.Decode([]byte(tt.data[:i]))
+			assert.Nil(t, pkg, tt.data)
+			assert.Nil(t, err, tt.data)
+		}
+
+		pkg, n, err := codec.Decode([]byte(tt.data))
+		assert.Nil(t, err, tt.data)
+		assert.Equal(t, len(tt.data), n, tt.data)
+		assert.Equal(t, tt.value, pkg, tt.data)
+		assert.Equal(t, tt.data, string(tt.value.Append(nil)), tt.data)
+	}
+
+	codec = NewClientCodec(WithMaxBulkBytes(3), WithMaxDepth(1))
+	_, _, err = codec.Decode([]byte("$4\r\n"))
+	assert.ErrorIs(t, err, ErrProtocol)
+	_, _, err = codec.Decode([]byte("*1\r\n*1\r\n*1\r\n"))
+	assert.ErrorIs(t, err, ErrProtocol)
+	_, _, err = codec.Decode([]byte("$1\r\nab\r\n"))
+	assert.ErrorIs(t, err, ErrProtocol)
+}
+
+func TestCodec_Encode(t *testing.T) {
+	codec := NewServerCodec()
+	reply := Map(BulkString("a"), Double(math.Inf(1)), BulkString("b"), Bool(true), BulkString("c"), Null())
+
+	// the RESP3 types are downgraded for RESP2.
+	data, err := codec.Encode(reply)
+	assert.Nil(t, err)
+	assert.Equal(t, "*6\r\n$1\r\na\r\n$3\r\ninf\r\n$1\r\nb\r\n:1\r\n$1\r\nc\r\n$-1\r\n", string(data))
+
+	codec.SetProtocol(3)
+	data, err = codec.Encode(reply)
+	assert.Nil(t, err)
+	assert.Equal(t, "%3\r\n$1\r\na\r\n,inf\r\n$1\r\nb\r\n#t\r\n$1\r\nc\r\n_\r\n", string(data))
+
+	data, err = codec.Encode(Error("WRONGTYPE bad"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-WRONGTYPE bad\r\n", string(data))
+	assert.Equal(t, "WRONGTYPE", Error("WRONGTYPE bad").Code())
+
+	_, err = codec.Encode(1)
+	assert.NotNil(t, err)
+}
+
+func TestCodec_DecodeHugeAggregate(t *testing.T) {
+	// the nested headers of the maximum elements without the elements.
+	data := []byte(strings.Repeat("*1048576\r\n", 8))
+	codec := NewServerCodec()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	pkg, n, err := codec.Decode(data)
+	runtime.ReadMemStats(&after)
+	assert.Nil(t, err)
+	assert.Nil(t, pkg)
+	assert.Equal(t, 0, n)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
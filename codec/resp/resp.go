@@ -0,0 +1,317 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package resp impl the RESP2 and RESP3 codecs of the Redis protocol for knetty sessions,
+// the router serving the commands by name, and the client of Redis-like servers.
+package resp
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrProtocol the data violates the RESP syntax.
+var ErrProtocol = errors.New("resp protocol error")
+
+// Type the type of values, it is the first byte of the encoded value.
+type Type byte
+
+const (
+	TypeSimpleString   Type = '+'
+	TypeError          Type = '-'
+	TypeInteger        Type = ':'
+	TypeBulkString     Type = '$'
+	TypeArray          Type = '*'
+	TypeNull           Type = '_'
+	TypeBoolean        Type = '#'
+	TypeDouble         Type = ','
+	TypeBigNumber      Type = '('
+	TypeBulkError      Type = '!'
+	TypeVerbatimString Type = '='
+	TypeMap            Type = '%'
+	TypeSet            Type = '~'
+	TypeAttribute      Type = '|'
+	TypePush           Type = '>'
+)
+
+// Value a RESP value, the fields used depend on the type.
+type Value struct {
+	Type Type
+	// Str the content of strings, errors, big numbers and verbatim strings
+	Str string
+	// Format the format of verbatim strings, e.g. txt, mkd
+	Format string
+	Int    int64
+	Float  float64
+	Bool   bool
+	// Elems the elements of arrays, sets and pushes, the keys and the values in turn of maps
+	Elems []Value
+	// Null the null bulk string or the null array of RESP2
+	Null bool
+	// Attrs the keys and the values in turn of the attribute preceding the value in RESP3
+	Attrs []Value
+}
+
+// Error the error reply, the prefix of the message is the error code, e.g. ERR, WRONGTYPE.
+type Error string
+
+// Error implements error.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Code return the error code, the first word of the message.
+func (e Error) Code() string {
+	code, _, _ := strings.Cut(string(e), " ")
+	return code
+}
+
+// SimpleString return a simple string value.
+func SimpleString(s string) Value {
+	return Value{Type: TypeSimpleString, Str: s}
+}
+
+// ErrorValue return an error value.
+func ErrorValue(msg string) Value {
+	return Value{Type: TypeError, Str: msg}
+}
+
+// Int return an integer value.
+func Int(n int64) Value {
+	return Value{Type: TypeInteger, Int: n}
+}
+
+// BulkString return a bulk string value.
+func BulkString(s string) Value {
+	return Value{Type: TypeBulkString, Str: s}
+}
+
+// Bulk return a bulk string value of data.
+func Bulk(data []byte) Value {
+	return Value{Type: TypeBulkString, Str: string(data)}
+}
+
+// NullBulk return the null bulk string, it is the null of RESP3 if the codec speaks RESP3.
+func NullBulk() Value {
+	return Value{Type: TypeBulkString, Null: true}
+}
+
+// Array return an array value.
+func Array(elems ...Value) Value {
+	return Value{Type: TypeArray, Elems: elems}
+}
+
+// NullArray return the null array, it is the null of RESP3 if the codec speaks RESP3.
+func NullArray() Value {
+	return Value{Type: TypeArray, Null: true}
+}
+
+// Null return the null of RESP3.
+func Null() Value {
+	return Value{Type: TypeNull}
+}
+
+// Bool return a boolean value of RESP3.
+func Bool(b bool) Value {
+	return Value{Type: TypeBoolean, Bool: b}
+}
+
+// Double return a double value of RESP3.
+func Double(f float64) Value {
+	return Value{Type: TypeDouble, Float: f}
+}
+
+// BigNumber return a big number value of RESP3, n is the decimal digits.
+func BigNumber(n string) Value {
+	return Value{Type: TypeBigNumber, Str: n}
+}
+
+// VerbatimString return a verbatim string value of RESP3, format is 3 bytes, e.g. txt.
+func VerbatimString(format, s string) Value {
+	return Value{Type: TypeVerbatimString, Format: format, Str: s}
+}
+
+// Map return a map value of RESP3, kvs are the keys and the values in turn.
+func Map(kvs ...Value) Value {
+	return Value{Type: TypeMap, Elems: kvs}
+}
+
+// Set return a set value of RESP3.
+func Set(elems ...Value) Value {
+	return Value{Type: TypeSet, Elems: elems}
+}
+
+// Push return a push value of RESP3, e.g. the messages of pub/sub.
+func Push(elems ...Value) Value {
+	return Value{Type: TypePush, Elems: elems}
+}
+
+// IsNull return whether v is the null of RESP2 or RESP3.
+func (v Value) IsNull() bool {
+	return v.Type == TypeNull || v.Null
+}
+
+// Err return the Error of the error values, otherwise nil.
+func (v Value) Err() error {
+	if v.Type == TypeError || v.Type == TypeBulkError {
+		return Error(v.Str)
+	}
+	return nil
+}
+
+// Text return the text form of the scalar values.
+func (v Value) Text() string {
+	switch v.Type {
+	case TypeInteger:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeDouble:
+		return formatDouble(v.Float)
+	case TypeBoolean:
+		if v.Bool {
+			return "1"
+		}
+		return "0"
+	default:
+		return v.Str
+	}
+}
+
+// Append append the value encoded as it is to dst.
+func (v Value) Append(dst []byte) []byte {
+	return appendValue(dst, v, encodeAsIs)
+}
+
+// encodeMode how the values of the other protocol version are encoded.
+type encodeMode int
+
+const (
+	encodeAsIs encodeMode = iota
+	// encodeRESP2 the RESP3 types are encoded as the RESP2 types.
+	encodeRESP2
+	// encodeRESP3 the nulls of RESP2 are encoded as the null of RESP3.
+	encodeRESP3
+)
+
+func appendValue(dst []byte, v Value, mode encodeMode) []byte {
+	resp3 := mode != encodeRESP2
+	if resp3 && len(v.Attrs) > 0 {
+		dst = appendAggregate(dst, TypeAttribute, len(v.Attrs)/2, v.Attrs, mode)
+	}
+
+	switch v.Type {
+	case TypeSimpleString, TypeError, TypeBigNumber:
+		if v.Type == TypeBigNumber && !resp3 {
+			return appendBulk(dst, TypeBulkString, v.Str)
+		}
+		dst = append(append(dst, byte(v.Type)), v.Str...)
+		return append(dst, '\r', '\n')
+	case TypeInteger:
+		dst = strconv.AppendInt(append(dst, ':'), v.Int, 10)
+		return append(dst, '\r', '\n')
+	case TypeBulkString:
+		if v.Null {
+			if mode == encodeRESP3 {
+				return append(dst, "_\r\n"...)
+			}
+			return append(dst, "$-1\r\n"...)
+		}
+		return appendBulk(dst, TypeBulkString, v.Str)
+	case TypeArray:
+		if v.Null {
+			if mode == encodeRESP3 {
+				return append(dst, "_\r\n"...)
+			}
+			return append(dst, "*-1\r\n"...)
+		}
+		return appendAggregate(dst, TypeArray, len(v.Elems), v.Elems, mode)
+	case TypeNull:
+		if !resp3 {
+			return append(dst, "$-1\r\n"...)
+		}
+		return append(dst, "_\r\n"...)
+	case TypeBoolean:
+		if !resp3 {
+			var n int64
+			if v.Bool {
+				n = 1
+			}
+			return appendValue(dst, Int(n), mode)
+		}
+		if v.Bool {
+			return append(dst, "#t\r\n"...)
+		}
+		return append(dst, "#f\r\n"...)
+	case TypeDouble:
+		if !resp3 {
+			return appendBulk(dst, TypeBulkString, formatDouble(v.Float))
+		}
+		dst = append(append(dst, ','), formatDouble(v.Float)...)
+		return append(dst, '\r', '\n')
+	case TypeBulkError:
+		if !resp3 {
+			return appendValue(dst, ErrorValue(v.Str), mode)
+		}
+		return appendBulk(dst, TypeBulkError, v.Str)
+	case TypeVerbatimString:
+		if !resp3 {
+			return appendBulk(dst, TypeBulkString, v.Str)
+		}
+		return appendBulk(dst, TypeVerbatimString, v.Format+":"+v.Str)
+	case TypeMap:
+		if !resp3 {
+			return appendAggregate(dst, TypeArray, len(v.Elems), v.Elems, mode)
+		}
+		return appendAggregate(dst, TypeMap, len(v.Elems)/2, v.Elems, mode)
+	case TypeSet, TypePush:
+		if !resp3 {
+			return appendAggregate(dst, TypeArray, len(v.Elems), v.Elems, mode)
+		}
+		return appendAggregate(dst, v.Type, len(v.Elems), v.Elems, mode)
+	default:
+		// the zero value and the unknown types are encoded as the null.
+		return appendValue(dst, Null(), mode)
+	}
+}
+
+func appendBulk(dst []byte, t Type, s string) []byte {
+	dst = strconv.AppendInt(append(dst, byte(t)), int64(len(s)), 10)
+	dst = append(append(dst, '\r', '\n'), s...)
+	return append(dst, '\r', '\n')
+}
+
+func appendAggregate(dst []byte, t Type, n int, elems []Value, mode encodeMode) []byte {
+	dst = strconv.AppendInt(append(dst, byte(t)), int64(n), 10)
+	dst = append(dst, '\r', '\n')
+	for _, elem := range elems {
+		dst = appendValue(dst, elem, mode)
+	}
+	return dst
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	merr "github.com/Softwarekang/knetty/pkg/err"
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/session"
+)
+
+// Command a command sent by the client.
+type Command struct {
+	// Name the command name in upper case
+	Name string
+	// Args the arguments after the name
+	Args [][]byte
+}
+
+// Arg return the i-th argument as string, it is empty if i is out of range.
+func (c Command) Arg(i int) string {
+	if i < 0 || i >= len(c.Args) {
+		return ""
+	}
+	return string(c.Args[i])
+}
+
+// HandlerFunc serve a command and return the reply,
+// the zero Value means no reply, e.g. the handler writes the replies by itself.
+type HandlerFunc func(s session.Session, cmd Command) Value
+
+type route struct {
+	handler HandlerFunc
+	arity   int
+}
+
+// Router serve the commands by the handlers registered by name, the commands of a session are served
+// one by one in the event loop, so the replies of the pipelined commands are written in order.
+// HELLO is served by the router to switch the protocol if it is not registered.
+type Router struct {
+	mu       sync.RWMutex
+	routes   map[string]route
+	notFound HandlerFunc
+	opts     []Option
+}
+
+// NewRouter return a router, opts are used to create the codecs of the sessions.
+func NewRouter(opts ...Option) *Router {
+	return &Router{routes: make(map[string]route), opts: opts}
+}
+
+// Handle register handler for the command name, arity is the number of the arguments including the name
+// like the redis command table, the negative arity means at least -arity, and 0 means no check.
+func (r *Router) Handle(name string, arity int, handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[strings.ToUpper(name)] = route{handler: handler, arity: arity}
+}
+
+// NotFound set the handler of the unknown commands.
+func (r *Router) NotFound(handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = handler
+}
+
+// Setup install the codec and the eventListener serving the commands for the session,
+// it can be used in NewSessionCallBackFunc or as the setup of a sniffed protocol.
+func (r *Router) Setup(s session.Session) error {
+	codec := NewServerCodec(r.opts...)
+	s.SetCodec(codec)
+	s.SetEventListener(&routerConn{router: r, codec: codec})
+	return nil
+}
+
+// Serve serve cmd by the registered handler.
+func (r *Router) Serve(s session.Session, cmd Command) Value {
+	r.mu.RLock()
+	rt, ok := r.routes[cmd.Name]
+	notFound := r.notFound
+	r.mu.RUnlock()
+
+	if !ok {
+		if notFound != nil {
+			return notFound(s, cmd)
+		}
+		return ErrorValue(fmt.Sprintf("ERR unknown command '%s'", cmd.Name))
+	}
+
+	n := len(cmd.Args) + 1
+	if (rt.arity > 0 && n != rt.arity) || (rt.arity < 0 && n < -rt.arity) {
+		return ErrorValue(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name)))
+	}
+	return rt.handler(s, cmd)
+}
+
+// routerConn the eventListener of a session serving the commands.
+type routerConn struct {
+	router *Router
+	codec  *Codec
+}
+
+// OnConnect implements session.EventListener.
+func (c *routerConn) OnConnect(session.Session) {}
+
+// OnMessage implements session.EventListener.
+func (c *routerConn) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	cmd, err := commandOf(pkg.(Value))
+	if err != nil {
+		c.OnError(s, err)
+		return session.Normal
+	}
+
+	var reply Value
+	if cmd.Name == "HELLO" && !c.router.registered(cmd.Name) {
+		reply = c.hello(cmd)
+	} else {
+		reply = c.router.Serve(s, cmd)
+	}
+
+	if reply.Type == 0 {
+		return session.Normal
+	}
+	if _, err := s.WritePkg(reply); err != nil {
+		log.Errorf("resp session:%s write reply err:%v", s.Info(), err)
+		_ = s.Close()
+		return session.Normal
+	}
+	if err := s.FlushBuffer(); err != nil {
+		log.Errorf("resp session:%s flush reply err:%v", s.Info(), err)
+		_ = s.Close()
+	}
+	return session.Normal
+}
+
+// OnError implements session.EventListener, the protocol error is replied and the session is closed.
+func (c *routerConn) OnError(s session.Session, e error) {
+	if errors.Is(e, ErrProtocol) {
+		// the client is replied with the cause, without the session information.
+		var opErr *merr.OpError
+		if errors.As(e, &opErr) {
+			e = opErr.Err
+		}
+		if _, err := s.WritePkg(ErrorValue("ERR " + e.Error())); err == nil {
+			_ = s.FlushBuffer()
+		}
+	} else {
+		log.Errorf("resp session:%s err:%v", s.Info(), e)
+	}
+	_ = s.Close()
+}
+
+// OnClose implements session.EventListener.
+func (c *routerConn) OnClose(session.Session) {}
+
+// hello switch the protocol version, HELLO [protover].
+func (c *routerConn) hello(cmd Command) Value {
+	version := c.codec.Protocol()
+	if len(cmd.Args) > 0 {
+		v, err := strconv.Atoi(cmd.Arg(0))
+		if err != nil {
+			return ErrorValue("ERR Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 {
+			return ErrorValue("NOPROTO unsupported protocol version")
+		}
+		version = v
+	}
+
+	c.codec.SetProtocol(version)
+	return Map(
+		BulkString("server"), BulkString("knetty"),
+		BulkString("proto"), Int(int64(version)),
+	)
+}
+
+func (r *Router) registered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.routes[name]
+	return ok
+}
+
+// commandOf return the command of the array of strings.
+func commandOf(v Value) (Command, error) {
+	if v.Type != TypeArray || len(v.Elems) == 0 {
+		return Command{}, fmt.Errorf("%w: expect array of bulk strings", ErrProtocol)
+	}
+
+	cmd := Command{Args: make([][]byte, 0, len(v.Elems)-1)}
+	for i, elem := range v.Elems {
+		if elem.Type != TypeBulkString && elem.Type != TypeSimpleString || elem.Null {
+			return Command{}, fmt.Errorf("%w: expect array of bulk strings", ErrProtocol)
+		}
+		if i == 0 {
+			cmd.Name = strings.ToUpper(elem.Str)
+			continue
+		}
+		cmd.Args = append(cmd.Args, []byte(elem.Str))
+	}
+	return cmd, nil
+}
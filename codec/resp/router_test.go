@@ -0,0 +1,158 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package resp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve run a knetty server of the router, it returns the address of the server.
+func serve(t *testing.T, router *Router) string {
+	return knettytest.Serve(t, router.Setup).Addr()
+}
+
+// kvRouter return a router of a tiny key value store.
+func kvRouter() *Router {
+	var mu sync.Mutex
+	store := make(map[string]string)
+
+	router := NewRouter()
+	router.Handle("PING", -1, func(s session.Session, cmd Command) Value {
+		if len(cmd.Args) > 0 {
+			return Bulk(cmd.Args[0])
+		}
+		return SimpleString("PONG")
+	})
+	router.Handle("SET", 3, func(s session.Session, cmd Command) Value {
+		mu.Lock()
+		defer mu.Unlock()
+		store[cmd.Arg(0)] = cmd.Arg(1)
+		return SimpleString("OK")
+	})
+	router.Handle("GET", 2, func(s session.Session, cmd Command) Value {
+		mu.Lock()
+		defer mu.Unlock()
+		v, ok := store[cmd.Arg(0)]
+		if !ok {
+			return NullBulk()
+		}
+		return BulkString(v)
+	})
+	router.Handle("SUBSCRIBE", -2, func(s session.Session, cmd Command) Value {
+		for i, channel := range cmd.Args {
+			_, _ = s.WritePkg(Push(BulkString("subscribe"), Bulk(channel), Int(int64(i+1))))
+		}
+		_, _ = s.WritePkg(Push(BulkString("message"), Bulk(cmd.Args[0]), BulkString("hello")))
+		_ = s.FlushBuffer()
+		return Value{}
+	})
+	router.Handle("QUIT", 1, func(s session.Session, cmd Command) Value {
+		_, _ = s.WritePkg(SimpleString("OK"))
+		_ = s.FlushBuffer()
+		_ = s.Close()
+		return Value{}
+	})
+	return router
+}
+
+func TestRouter(t *testing.T) {
+	addr := serve(t, kvRouter())
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	readLines := func(n int) string {
+		var lines []string
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		for i := 0; i < n; i++ {
+			line, err := reader.ReadString('\n')
+			assert.Nil(t, err)
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "")
+	}
+
+	// the pipelined commands mixing the inline commands are replied in order.
+	_, err = conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\nGET k\r\nget missing\r\nPING\r\nping \"a b\"\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n$1\r\nv\r\n$-1\r\n+PONG\r\n$3\r\na b\r\n", readLines(7))
+
+	_, err = conn.Write([]byte("GET\r\nFOO bar\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n-ERR unknown command 'FOO'\r\n", readLines(2))
+
+	// HELLO 3 switches the protocol of the session.
+	_, err = conn.Write([]byte("HELLO 3\r\nGET missing\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "%2\r\n$6\r\nserver\r\n$6\r\nknetty\r\n$5\r\nproto\r\n:3\r\n_\r\n", readLines(9))
+	_, err = conn.Write([]byte("HELLO 4\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", readLines(1))
+
+	// the protocol error is replied and the session is closed.
+	_, err = conn.Write([]byte("*1\r\n:1\r\n"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(readLines(1), "-ERR resp protocol error"))
+	_, err = reader.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRouter_AsyncWrite(t *testing.T) {
+	router := NewRouter()
+	router.Handle("STREAM", 2, func(s session.Session, cmd Command) Value {
+		// the values are written by a goroutine other than the event loop flushing the session.
+		go func(value string) {
+			for i := 0; i < 1000; i++ {
+				_, _ = s.WritePkg(BulkString(value))
+				_ = s.FlushBuffer()
+			}
+		}(strings.Repeat(cmd.Arg(0), 1024))
+		return Value{}
+	})
+	addr := serve(t, router)
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("STREAM k\r\n"))
+	assert.Nil(t, err)
+
+	reader := bufio.NewReaderSize(conn, 512)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	want := "$1024\r\n" + strings.Repeat("k", 1024) + "\r\n"
+	buf := make([]byte, len(want))
+	for i := 0; i < 1000; i++ {
+		_, err := io.ReadFull(reader, buf)
+		if !assert.Nil(t, err) || !assert.Equal(t, want, string(buf)) {
+			return
+		}
+		if i%100 == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
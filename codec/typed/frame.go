@@ -0,0 +1,159 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package typed
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxFrameSize the default maximum payload size of the length field frames.
+const DefaultMaxFrameSize = 4 << 20
+
+// ErrFrameTooLarge the length field exceeds the maximum frame size.
+var ErrFrameTooLarge = errors.New("typed: frame too large")
+
+// Option option for LengthFieldCodec.
+type Option func(*Options)
+
+// Options options for LengthFieldCodec.
+type Options struct {
+	// LengthFieldSize the size of the length field, 1, 2, 4 or 8 bytes
+	LengthFieldSize int
+	// ByteOrder the byte order of the length field
+	ByteOrder binary.ByteOrder
+	// MaxFrameSize the maximum payload size of the frames
+	MaxFrameSize int
+}
+
+// WithLengthFieldSize set the size of the length field, 1, 2, 4 or 8 bytes, default 4.
+func WithLengthFieldSize(n int) Option {
+	return func(opt *Options) {
+		switch n {
+		case 1, 2, 4, 8:
+			opt.LengthFieldSize = n
+		}
+	}
+}
+
+// WithByteOrder set the byte order of the length field, default big endian.
+func WithByteOrder(order binary.ByteOrder) Option {
+	return func(opt *Options) {
+		if order != nil {
+			opt.ByteOrder = order
+		}
+	}
+}
+
+// WithMaxFrameSize set the maximum payload size of the frames.
+func WithMaxFrameSize(n int) Option {
+	return func(opt *Options) {
+		if n > 0 {
+			opt.MaxFrameSize = n
+		}
+	}
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{LengthFieldSize: 4, ByteOrder: binary.BigEndian, MaxFrameSize: DefaultMaxFrameSize}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// Serializer convert the messages of type T to the payloads and back,
+// the data of Unmarshal is only valid during the call.
+type Serializer[T any] interface {
+	Marshal(msg T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// LengthFieldCodec the Codec framing each message by a length field followed by the payload of the serializer.
+type LengthFieldCodec[T any] struct {
+	serializer Serializer[T]
+	options    *Options
+}
+
+// NewLengthFieldCodec return a length field codec of the serializer.
+func NewLengthFieldCodec[T any](serializer Serializer[T], opts ...Option) *LengthFieldCodec[T] {
+	return &LengthFieldCodec[T]{serializer: serializer, options: newOptions(opts...)}
+}
+
+// Encode implements Codec.
+func (c *LengthFieldCodec[T]) Encode(msg T) ([]byte, error) {
+	payload, err := c.serializer.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	size := c.options.LengthFieldSize
+	if len(payload) > c.options.MaxFrameSize || size < 8 && uint64(len(payload)) >= 1<<(8*size) {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, size, size+len(payload))
+	c.putLength(data, uint64(len(payload)))
+	return append(data, payload...), nil
+}
+
+// Decode implements Codec.
+func (c *LengthFieldCodec[T]) Decode(data []byte) (T, int, error) {
+	var zero T
+	size := c.options.LengthFieldSize
+	if len(data) < size {
+		return zero, 0, nil
+	}
+	length := c.length(data)
+	if length > uint64(c.options.MaxFrameSize) {
+		return zero, 0, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, length)
+	}
+	end := size + int(length)
+	if len(data) < end {
+		return zero, 0, nil
+	}
+	msg, err := c.serializer.Unmarshal(data[size:end])
+	if err != nil {
+		return zero, 0, err
+	}
+	return msg, end, nil
+}
+
+func (c *LengthFieldCodec[T]) putLength(b []byte, n uint64) {
+	switch order := c.options.ByteOrder; len(b) {
+	case 1:
+		b[0] = byte(n)
+	case 2:
+		order.PutUint16(b, uint16(n))
+	case 4:
+		order.PutUint32(b, uint32(n))
+	default:
+		order.PutUint64(b, n)
+	}
+}
+
+func (c *LengthFieldCodec[T]) length(data []byte) uint64 {
+	switch order := c.options.ByteOrder; c.options.LengthFieldSize {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(order.Uint16(data))
+	case 4:
+		return uint64(order.Uint32(data))
+	default:
+		return order.Uint64(data)
+	}
+}
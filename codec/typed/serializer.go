@@ -0,0 +1,123 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package typed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// JSON return the Serializer of encoding/json.
+func JSON[T any]() Serializer[T] {
+	return jsonSerializer[T]{}
+}
+
+type jsonSerializer[T any] struct{}
+
+func (jsonSerializer[T]) Marshal(msg T) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonSerializer[T]) Unmarshal(data []byte) (T, error) {
+	var msg T
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// Gob return the Serializer of encoding/gob, each payload carries the type information of the message,
+// so the frames are decoded independently.
+func Gob[T any]() Serializer[T] {
+	return gobSerializer[T]{}
+}
+
+type gobSerializer[T any] struct{}
+
+func (gobSerializer[T]) Marshal(msg T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobSerializer[T]) Unmarshal(data []byte) (T, error) {
+	var msg T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg)
+	return msg, err
+}
+
+// Msgpack return the Serializer of MessagePack.
+func Msgpack[T any]() Serializer[T] {
+	return msgpackSerializer[T]{}
+}
+
+type msgpackSerializer[T any] struct{}
+
+func (msgpackSerializer[T]) Marshal(msg T) ([]byte, error) {
+	return msgpack.Marshal(msg)
+}
+
+func (msgpackSerializer[T]) Unmarshal(data []byte) (T, error) {
+	var msg T
+	err := msgpack.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// Protobuf return the Serializer of protocol buffers, T is the pointer of the generated message.
+func Protobuf[T proto.Message]() Serializer[T] {
+	return protobufSerializer[T]{}
+}
+
+type protobufSerializer[T proto.Message] struct{}
+
+func (protobufSerializer[T]) Marshal(msg T) ([]byte, error) {
+	return proto.Marshal(msg)
+}
+
+func (protobufSerializer[T]) Unmarshal(data []byte) (T, error) {
+	var zero T
+	// the nil pointer of the generated message still reports its type.
+	msg := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return zero, err
+	}
+	return msg, nil
+}
+
+// NewJSONCodec return the length field Codec of JSON payloads.
+func NewJSONCodec[T any](opts ...Option) *LengthFieldCodec[T] {
+	return NewLengthFieldCodec(JSON[T](), opts...)
+}
+
+// NewGobCodec return the length field Codec of gob payloads.
+func NewGobCodec[T any](opts ...Option) *LengthFieldCodec[T] {
+	return NewLengthFieldCodec(Gob[T](), opts...)
+}
+
+// NewMsgpackCodec return the length field Codec of MessagePack payloads.
+func NewMsgpackCodec[T any](opts ...Option) *LengthFieldCodec[T] {
+	return NewLengthFieldCodec(Msgpack[T](), opts...)
+}
+
+// NewProtobufCodec return the length field Codec of protocol buffers payloads.
+func NewProtobufCodec[T proto.Message](opts ...Option) *LengthFieldCodec[T] {
+	return NewLengthFieldCodec(Protobuf[T](), opts...)
+}
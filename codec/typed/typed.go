@@ -0,0 +1,136 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package typed impl the generic typed layer over session.Codec and session.EventListener, so the handlers
+// receive and write the concrete message types instead of interface{}, and the codecs framing the messages
+// by a length field with the protobuf, JSON, msgpack or gob payload serializers.
+package typed
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/Softwarekang/knetty/session"
+)
+
+// Codec the typed codec of the messages of type T.
+type Codec[T any] interface {
+	// Encode convert msg to binary network data
+	Encode(msg T) ([]byte, error)
+	// Decode convert binary network data to a message, the return values follow session.Codec:
+	// exceptions: zero,0,err, half package: zero,0,nil, normal and sticky package: msg,pkgLen,nil
+	Decode(data []byte) (T, int, error)
+}
+
+// EventListener the typed listener of the session events, the messages are of type T.
+type EventListener[T any] interface {
+	// OnConnect runs when the connection initialized
+	OnConnect(s session.Session)
+	// OnMessage runs when the session gets a message
+	OnMessage(s session.Session, msg T) session.ExecStatus
+	// OnError runs when the session err
+	OnError(s session.Session, e error)
+	// OnClose runs before the session closed
+	OnClose(s session.Session)
+}
+
+// TypeError the message is not of the expected type.
+type TypeError struct {
+	Expected string
+	Actual   interface{}
+}
+
+// Error implements error.
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("typed: expected message of type %s, got %T", e.Expected, e.Actual)
+}
+
+func typeError[T any](actual interface{}) error {
+	return &TypeError{Expected: reflect.TypeOf((*T)(nil)).Elem().String(), Actual: actual}
+}
+
+// NewCodec adapt the typed codec to session.Codec, encoding a message not of type T fails with TypeError.
+func NewCodec[T any](codec Codec[T]) session.Codec {
+	return &codecAdapter[T]{codec: codec}
+}
+
+type codecAdapter[T any] struct {
+	codec Codec[T]
+}
+
+// Encode implements session.Codec.
+func (c *codecAdapter[T]) Encode(pkg interface{}) ([]byte, error) {
+	msg, ok := pkg.(T)
+	if !ok {
+		return nil, typeError[T](pkg)
+	}
+	return c.codec.Encode(msg)
+}
+
+// Decode implements session.Codec.
+func (c *codecAdapter[T]) Decode(data []byte) (interface{}, int, error) {
+	msg, n, err := c.codec.Decode(data)
+	if err != nil || n == 0 {
+		return nil, n, err
+	}
+	return msg, n, nil
+}
+
+// NewEventListener adapt the typed listener to session.EventListener, a message not of type T is
+// reported to OnError with TypeError.
+func NewEventListener[T any](listener EventListener[T]) session.EventListener {
+	return &listenerAdapter[T]{listener: listener}
+}
+
+type listenerAdapter[T any] struct {
+	listener EventListener[T]
+}
+
+// OnConnect implements session.EventListener.
+func (l *listenerAdapter[T]) OnConnect(s session.Session) {
+	l.listener.OnConnect(s)
+}
+
+// OnMessage implements session.EventListener.
+func (l *listenerAdapter[T]) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	msg, ok := pkg.(T)
+	if !ok {
+		l.listener.OnError(s, typeError[T](pkg))
+		return session.Normal
+	}
+	return l.listener.OnMessage(s, msg)
+}
+
+// OnError implements session.EventListener.
+func (l *listenerAdapter[T]) OnError(s session.Session, e error) {
+	l.listener.OnError(s, e)
+}
+
+// OnClose implements session.EventListener.
+func (l *listenerAdapter[T]) OnClose(s session.Session) {
+	l.listener.OnClose(s)
+}
+
+// Setup set the typed codec and listener to the session, it is usually called by the new session callback.
+func Setup[T any](s session.Session, codec Codec[T], listener EventListener[T]) {
+	s.SetCodec(NewCodec(codec))
+	s.SetEventListener(NewEventListener(listener))
+}
+
+// WriteMsg write the message of type T to the session, the type is checked at compile time.
+func WriteMsg[T any](s session.Session, msg T) (int, error) {
+	return s.WritePkg(msg)
+}
@@ -0,0 +1,157 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package typed
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type greeting struct {
+	ID   int
+	Text string
+	Tags []string
+}
+
+func testCodec[T any](t *testing.T, codec Codec[T], msg T, equal func(a, b T) bool) {
+	data, err := codec.Encode(msg)
+	assert.Nil(t, err)
+
+	// the half packages.
+	for i := 0; i < len(data); i++ {
+		_, n, err := codec.Decode(data[:i])
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	}
+	// the sticky packages.
+	got, n, err := codec.Decode(append(data, data...))
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.True(t, equal(msg, got))
+}
+
+func TestSerializers(t *testing.T) {
+	msg := &greeting{ID: 1, Text: "hello", Tags: []string{"a", "b"}}
+	equal := func(a, b *greeting) bool { return assert.ObjectsAreEqual(a, b) }
+	testCodec[*greeting](t, NewJSONCodec[*greeting](), msg, equal)
+	testCodec[*greeting](t, NewGobCodec[*greeting](), msg, equal)
+	testCodec[*greeting](t, NewMsgpackCodec[*greeting](), msg, equal)
+	testCodec[greeting](t, NewJSONCodec[greeting](), *msg, func(a, b greeting) bool { return assert.ObjectsAreEqual(a, b) })
+	testCodec[*wrapperspb.StringValue](t, NewProtobufCodec[*wrapperspb.StringValue](), wrapperspb.String("hello"),
+		func(a, b *wrapperspb.StringValue) bool { return proto.Equal(a, b) })
+}
+
+func TestLengthFieldCodec(t *testing.T) {
+	codec := NewJSONCodec[string](WithLengthFieldSize(2), WithByteOrder(binary.LittleEndian))
+	data, err := codec.Encode("hi")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 0, '"', 'h', 'i', '"'}, data)
+
+	codec = NewJSONCodec[string](WithLengthFieldSize(1))
+	data, err = codec.Encode("hi")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, '"', 'h', 'i', '"'}, data)
+	_, err = codec.Encode(string(make([]byte, 300)))
+	assert.True(t, errors.Is(err, ErrFrameTooLarge))
+
+	codec = NewJSONCodec[string](WithMaxFrameSize(8))
+	_, err = codec.Encode("0123456789")
+	assert.True(t, errors.Is(err, ErrFrameTooLarge))
+	_, _, err = codec.Decode([]byte{0, 0, 0, 9})
+	assert.True(t, errors.Is(err, ErrFrameTooLarge))
+
+	// the payload error.
+	_, _, err = codec.Decode([]byte{0, 0, 0, 1, '{'})
+	assert.NotNil(t, err)
+}
+
+func TestAdapters(t *testing.T) {
+	codec := NewCodec[*greeting](NewJSONCodec[*greeting]())
+	_, err := codec.Encode("not a greeting")
+	var typeErr *TypeError
+	assert.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "*typed.greeting", typeErr.Expected)
+	assert.Equal(t, "typed: expected message of type *typed.greeting, got string", err.Error())
+
+	data, err := codec.Encode(&greeting{Text: "hi"})
+	assert.Nil(t, err)
+	pkg, n, err := codec.Decode(data[:3])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	// the half package is nil rather than a typed nil pointer.
+	assert.Nil(t, pkg)
+	pkg, n, err = codec.Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, &greeting{Text: "hi"}, pkg)
+}
+
+// upperListener reply the greeting with the upper case text.
+type upperListener struct{}
+
+func (upperListener) OnConnect(session.Session) {}
+
+func (upperListener) OnMessage(s session.Session, msg *greeting) session.ExecStatus {
+	_, _ = WriteMsg(s, &greeting{ID: msg.ID, Text: strings.ToUpper(msg.Text)})
+	_ = s.FlushBuffer()
+	return session.Normal
+}
+
+func (upperListener) OnError(s session.Session, e error) {
+	_ = s.Close()
+}
+
+func (upperListener) OnClose(session.Session) {}
+
+func TestSetup(t *testing.T) {
+	addr := knettytest.Serve(t, func(s session.Session) error {
+		Setup[*greeting](s, NewMsgpackCodec[*greeting](), upperListener{})
+		return nil
+	}).Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	codec := NewMsgpackCodec[*greeting]()
+	data, err := codec.Encode(&greeting{ID: 7, Text: "hello"})
+	assert.Nil(t, err)
+	_, err = conn.Write(data)
+	assert.Nil(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	reply, _, err := codec.Decode(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, &greeting{ID: 7, Text: "HELLO"}, reply)
+}
@@ -0,0 +1,58 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"github.com/Softwarekang/knetty/internal/net/poll"
+)
+
+// EventLoopGroup a group of reactor pollers serving the connections of servers and clients.
+// a group can be shared by several servers and clients, its lifecycle is managed by the creator.
+type EventLoopGroup struct {
+	loops *poll.EventLoopGroup
+}
+
+// NewEventLoopGroup create a group running n reactor pollers with opts.
+func NewEventLoopGroup(n int, opts ...PollerOption) (*EventLoopGroup, error) {
+	loops, err := poll.NewEventLoopGroup(n, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventLoopGroup{loops: loops}, nil
+}
+
+// SetPollerNums set reactor goroutine nums of the group
+func (g *EventLoopGroup) SetPollerNums(n int) error {
+	return g.loops.SetPollerNums(n)
+}
+
+// SetStrategy set the strategy of picking reactor pollers in the group
+func (g *EventLoopGroup) SetStrategy(strategy PollerStrategy) {
+	g.loops.SetStrategy(strategy)
+}
+
+// Stats return the statistics of the reactor pollers in the group
+func (g *EventLoopGroup) Stats() []PollerStats {
+	return g.loops.Stats()
+}
+
+// Shutdown close all the reactor pollers in the group,
+// the connections served by the group can not be used anymore.
+func (g *EventLoopGroup) Shutdown() error {
+	return g.loops.Close()
+}
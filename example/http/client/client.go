@@ -20,10 +20,16 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+
+	"github.com/Softwarekang/knetty/codec/http1"
 )
 
 func main() {
-	response, err := http.DefaultClient.Get("http://127.0.0.1:8000/a?echo=hello")
+	// the requests are sent over knetty sessions by the http1 client.
+	transport := http1.NewClient()
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+	response, err := client.Get("http://127.0.0.1:8000/a?echo=hello")
 	if err != nil {
 		log.Fatalln(err)
 	}
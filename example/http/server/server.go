@@ -22,16 +22,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/Softwarekang/knetty"
-	"github.com/Softwarekang/knetty/session"
+	"github.com/Softwarekang/knetty/codec/http1"
 
-	"github.com/evanphx/wildcat"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,9 +42,9 @@ func init() {
 }
 
 func main() {
-	// setting optional options for the server
+	// setting optional options for the server, the sessions serve the net/http handler
 	options := []knetty.ServerOption{
-		knetty.WithServiceNewSessionCallBackFunc(newSessionCallBackFn),
+		knetty.WithServiceNewSessionCallBackFunc(http1.NewServer(newHandler()).Setup),
 	}
 
 	knetty.SetLogger(logger)
@@ -61,7 +59,7 @@ func main() {
 	}()
 
 	// Wait for interrupt signal to gracefully shutdown the server with
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be caught, so don't need to add it
@@ -93,84 +91,17 @@ func initLogger() {
 	})
 }
 
-// set the necessary parameters for the session to run.
-func newSessionCallBackFn(s session.Session) error {
-	s.SetCodec(newHttpEchoCodec())
-	s.SetEventListener(&httpEventListener{})
-	return nil
-}
-
-type httpEventListener struct {
-}
-
-func (e *httpEventListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
-	data := pkg.(string)
-	logger.Infof("server got data:%s", data)
-	if err := echoHello(s, data); err != nil {
-		logger.Infof("server echo err:%v", err)
-	}
-	return session.Normal
-}
-
-func echoHello(s session.Session, data string) error {
-	rsp := []byte("HTTP/1.1 200 OK\r\nServer: knetty\r\nContent-Type: text/plain\r\nDate: ")
-	rsp = time.Now().AppendFormat(rsp, "Mon, 02 Jan 2006 15:04:05 GMT")
-	rsp = append(rsp, fmt.Sprintf("\r\nContent-Length: %d\r\n\r\n%s!", len(data)+1, data)...)
-
-	if _, err := s.WriteBuffer(rsp); err != nil {
-		return err
-	}
-
-	return s.FlushBuffer()
-}
-
-func (e *httpEventListener) OnConnect(s session.Session) {
-	logger.Infof("local:%s get a remote:%s connection\n", s.LocalAddr(), s.RemoteAddr())
-}
-
-func (e *httpEventListener) OnClose(s session.Session) {
-	logger.Infof("server client:%s  closed", s.RemoteAddr())
-}
-
-func (e *httpEventListener) OnError(s session.Session, err error) {
-	logger.Errorf("session: %s got err :%v", s.Info(), err)
-}
-
-type httpEchoCodec struct {
-	httpParser *wildcat.HTTPParser
-}
-
-func newHttpEchoCodec() *httpEchoCodec {
-	return &httpEchoCodec{
-		httpParser: wildcat.NewHTTPParser(),
-	}
-}
-func (h *httpEchoCodec) Encode(pkg interface{}) ([]byte, error) {
-	return []byte(nil), nil
-}
-
-func (h *httpEchoCodec) Decode(bytes []byte) (interface{}, int, error) {
-	headerOffset, err := h.httpParser.Parse(bytes)
-	if err != nil {
-		if errors.Is(err, wildcat.ErrMissingData) {
-			return nil, 0, nil
+// newHandler return the net/http handler served over knetty sessions.
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		value := r.URL.Query().Get("echo")
+		if value == "" {
+			value = "default"
 		}
-
-		return nil, 0, err
-	}
-
-	if !h.httpParser.Get() {
-		return nil, 0, fmt.Errorf("http method need %value", http.MethodGet)
-	}
-
-	url, err := url.Parse(string(h.httpParser.Path))
-	if err != nil {
-		return nil, 0, err
-	}
-
-	value := url.Query().Get("echo")
-	if value == "" {
-		value = "default"
-	}
-	return value, headerOffset, nil
+		logger.Infof("server got data:%s", value)
+		w.Header().Set("Server", "knetty")
+		_, _ = fmt.Fprintf(w, "%s!", value)
+	})
+	return mux
 }
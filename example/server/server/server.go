@@ -49,7 +49,7 @@ func main() {
 	}()
 
 	// Wait for interrupt signal to gracefully shut down the server with
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be caught, so don't need to add it
@@ -0,0 +1,83 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package knettytest implements the helpers of the tests serving sessions by a knetty server.
+package knettytest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Softwarekang/knetty"
+	"github.com/Softwarekang/knetty/session"
+)
+
+// Serve run a knetty server on a free port of the loopback calling setup for the sessions,
+// the server is listening once it returns and is shut down when the test ends.
+func Serve(t testing.TB, setup func(session.Session) error, opts ...knetty.ServerOption) *knetty.Server {
+	t.Helper()
+	server := knetty.NewServer("tcp", "127.0.0.1:0", append(opts, knetty.WithServiceNewSessionCallBackFunc(setup))...)
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = server.Server()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown(context.Background())
+	})
+	return server
+}
+
+// LineCodec splits the data by '\n', the messages are strings.
+type LineCodec struct{}
+
+// Encode implements session.Codec.
+func (LineCodec) Encode(pkg interface{}) ([]byte, error) {
+	return []byte(pkg.(string) + "\n"), nil
+}
+
+// Decode implements session.Codec.
+func (LineCodec) Decode(data []byte) (interface{}, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		return nil, 0, nil
+	}
+	return string(data[:idx]), idx + 1, nil
+}
+
+// EchoListener writes the messages back, the session is closed on errors.
+type EchoListener struct{}
+
+// OnConnect implements session.EventListener.
+func (EchoListener) OnConnect(session.Session) {}
+
+// OnMessage implements session.EventListener.
+func (EchoListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	_, _ = s.WritePkg(pkg)
+	_ = s.FlushBuffer()
+	return session.Normal
+}
+
+// OnError implements session.EventListener.
+func (EchoListener) OnError(s session.Session, e error) {
+	_ = s.Close()
+}
+
+// OnClose implements session.EventListener.
+func (EchoListener) OnClose(session.Session) {}
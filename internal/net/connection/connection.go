@@ -18,6 +18,8 @@
 package connection
 
 import (
+	"time"
+
 	"github.com/Softwarekang/knetty/internal/net/poll"
 
 	"go.uber.org/atomic"
@@ -43,6 +45,12 @@ type EventTrigger interface {
 	OnConnHup()
 }
 
+// ReadNotifier is implemented by the EventTriggers counting the network data read, it is optional.
+type ReadNotifier interface {
+	// OnConnRead triggered when n bytes are read from the network, before OnConnReadable handles them.
+	OnConnRead(n int)
+}
+
 // Connection is a network connection oriented towards byte streams, based on an event-driven mechanism.
 type Connection interface {
 	// ID return a uin-type value that uniquely identifies each stream connection。
@@ -66,8 +74,13 @@ type Connection interface {
 	Len() int
 	// Type Return the current connection network type tcp/udp/ws.
 	Type() ConnType
+	// Stats return the statistics of the connection.
+	Stats() Stats
 	// Register register conn in poller with event.
 	Register(eventType poll.EventType) error
+	// PauseRead stop reading the network data for d, the data in the input buffer is still handled.
+	// it returns false if the reading can not be paused.
+	PauseRead(d time.Duration) bool
 	// Close the network connection, regardless of the ongoing blocking non-blocking read and write will return an error.
 	Close() error
 }
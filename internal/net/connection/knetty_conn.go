@@ -17,8 +17,12 @@
 package connection
 
 import (
+	"sync"
+	"time"
+
 	"github.com/Softwarekang/knetty/internal/net/poll"
 	"github.com/Softwarekang/knetty/pkg/buffer"
+	errors "github.com/Softwarekang/knetty/pkg/err"
 
 	"go.uber.org/atomic"
 )
@@ -32,10 +36,25 @@ type knettyConn struct {
 	poller        poll.Poll
 	inputBuffer   *buffer.RingBuffer
 	outputBuffer  *buffer.RingBuffer
-	netFd         *poll.NetFileDesc
-	writeable     bool
-	eventTrigger  EventTrigger
-	close         atomic.Int32
+	// outMu guards the output buffer and writeable, the session may be written by the goroutines
+	// other than the event loop.
+	outMu        sync.Mutex
+	netFd        *poll.NetFileDesc
+	writeable    bool
+	eventTrigger EventTrigger
+	readNotifier ReadNotifier
+	close        atomic.Int32
+	// sending the output buffer data submitted to the completion-based poller and not yet written.
+	sending    []byte
+	submitting atomic.Int32
+	// dirty the connection is marked to be flushed at the end of the event loop iteration.
+	dirty atomic.Int32
+	stats connStats
+	// paused the reading is paused until the event loop resumes it after resumeTimer fires.
+	paused      atomic.Int32
+	resuming    atomic.Int32
+	pauseMu     sync.Mutex
+	resumeTimer *time.Timer
 }
 
 // Register the network connection to poll.
@@ -56,6 +75,137 @@ func (c *knettyConn) initNetFd() {
 			OnRead:      c.OnRead,
 			OnInterrupt: c.OnInterrupt,
 			OnWrite:     c.OnWrite,
+			OnRecv:      c.OnRecv,
+			OnSent:      c.OnSent,
+			OnFlush:     c.OnFlush,
 		},
 	}
 }
+
+// markDirty mark the connection to be flushed at the end of the event loop iteration of the auto flush poller,
+// it returns false if the connection should be flushed by the caller.
+func (c *knettyConn) markDirty() bool {
+	batcher, ok := poll.BatcherOf(c.poller)
+	if !ok || c.netFd == nil {
+		return false
+	}
+
+	// the connection has been marked in this iteration.
+	if !c.dirty.CAS(0, 1) {
+		return true
+	}
+
+	if batcher.MarkDirty(c.netFd) {
+		return true
+	}
+
+	c.dirty.Store(0)
+	return false
+}
+
+// flush write the output buffer data to the network.
+func (c *knettyConn) flush() error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	// the completion-based poller writes the data to the network asynchronously.
+	if _, ok := poll.SubmitterOf(c.poller); ok {
+		return c.submit()
+	}
+
+	n, err := c.outputBuffer.WriteToFd(c.fd)
+	c.stats.wrote(n)
+	if err != nil {
+		return c.opError(errors.OpWrite, err)
+	}
+
+	if c.outputBuffer.IsEmpty() {
+		return nil
+	}
+
+	c.stats.flushEAGAIN.Inc()
+
+	if c.writeable {
+		c.writeable = false
+		// the write event is registered when the paused reading is resumed.
+		if c.paused.Load() != 0 {
+			return nil
+		}
+		// When the network data cannot be written, register the write event to poll,
+		// and write the buffer data to the network when it is writable again.
+		return c.Register(poll.ReadToRW)
+	}
+
+	return nil
+}
+
+// PauseRead implements Connection, it runs on the event loop while the input is handled.
+func (c *knettyConn) PauseRead(d time.Duration) bool {
+	// the multishot recv of the completion-based poller can not be paused.
+	if _, ok := poll.SubmitterOf(c.poller); ok || d <= 0 || c.netFd == nil {
+		return false
+	}
+
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.close.Load() != 0 || !c.paused.CAS(0, 1) {
+		return false
+	}
+
+	if err := c.Register(poll.PauseRead); err != nil {
+		c.paused.Store(0)
+		return false
+	}
+
+	c.resumeTimer = time.AfterFunc(d, c.wakeResume)
+	return true
+}
+
+// wakeResume make the poller report the paused connection FD writeable, so the reading is resumed on the event loop.
+func (c *knettyConn) wakeResume() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.close.Load() != 0 {
+		return
+	}
+
+	c.resuming.Store(1)
+	_ = c.Register(poll.ReadToRW)
+}
+
+// resume restart reading the network data, and writing the output buffer data left while paused.
+// it runs on the event loop with outMu held.
+func (c *knettyConn) resume() error {
+	if !c.resuming.CAS(1, 0) {
+		return nil
+	}
+
+	c.paused.Store(0)
+	if err := c.Register(poll.ResumeRead); err != nil {
+		return err
+	}
+	if !c.writeable {
+		return c.Register(poll.ReadToRW)
+	}
+	return nil
+}
+
+// notifyRead notify the EventTrigger of the n bytes read from the network.
+func (c *knettyConn) notifyRead(n int) {
+	if c.readNotifier != nil && n > 0 {
+		c.readNotifier.OnConnRead(n)
+	}
+}
+
+// stopResume stop resuming the closed connection, the FD may be reused once it is closed.
+func (c *knettyConn) stopResume() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resumeTimer != nil {
+		c.resumeTimer.Stop()
+	}
+}
+
+// opError wrap the error of op with the connection information.
+func (c *knettyConn) opError(op string, err error) error {
+	return &errors.OpError{Op: op, SessionID: c.id, LocalAddr: c.localAddress, RemoteAddr: c.remoteAddress, Err: err}
+}
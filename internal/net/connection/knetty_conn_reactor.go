@@ -18,6 +18,7 @@ package connection
 
 import (
 	"github.com/Softwarekang/knetty/internal/net/poll"
+	errors "github.com/Softwarekang/knetty/pkg/err"
 
 	"golang.org/x/sys/unix"
 )
@@ -26,46 +27,232 @@ import (
 // the network data first enters the connection buffer as much as possible,
 // and then drives the EventTrigger OnConnReadable function of the upper layer to process the data in the buffer.
 func (c *knettyConn) OnRead() (err error) {
-	if _, err = c.inputBuffer.CopyFromFd(c.fd); err != nil {
-		return
+	// the reading woken by the resume timer is resumed on the event loop.
+	if c.resuming.Load() != 0 {
+		c.outMu.Lock()
+		err = c.resume()
+		c.outMu.Unlock()
+		if err != nil {
+			return c.opError(errors.OpRead, err)
+		}
 	}
 
+	if c.poller.Options().TriggerMode == poll.EdgeTriggered {
+		return c.onEdgeTriggeredRead()
+	}
+
+	n, err := c.inputBuffer.CopyFromFd(c.fd)
+	c.stats.read(n)
+	if err != nil {
+		return c.opError(errors.OpRead, err)
+	}
+
+	c.notifyRead(n)
+	c.handleInput()
+	return
+}
+
+// onEdgeTriggeredRead the poller will not report the connection FD again until new data arrives,
+// so the network data is read until EAGAIN, as long as the read budget of this wakeup is not exhausted.
+func (c *knettyConn) onEdgeTriggeredRead() error {
+	budget := c.poller.Options().ReadBudget
+	for readBytes := 0; readBytes < budget; {
+		n, err := c.inputBuffer.CopyFromFd(c.fd)
+		c.stats.read(n)
+		if err != nil {
+			return c.opError(errors.OpRead, err)
+		}
+
+		if n == 0 {
+			// EAGAIN or EOF.
+			if !c.inputFull() {
+				return nil
+			}
+
+			// the input buffer can not grow anymore, no new edge is reported for the data left in the FD,
+			// so the reading goes on once the handler drains the buffer.
+			c.handleInput()
+			if c.inputFull() {
+				_ = c.OnInterrupt()
+				return c.opError(errors.OpRead, errors.BufferFullErr)
+			}
+			continue
+		}
+
+		readBytes += n
+		c.notifyRead(n)
+		c.handleInput()
+		// the paused connection FD is rearmed when the reading is resumed.
+		if c.paused.Load() != 0 {
+			return nil
+		}
+	}
+
+	// the budget is exhausted while the connection FD may still be readable,
+	// rearm it to let poll report it again after the other connections have been served.
+	return c.rearm()
+}
+
+// inputFull report whether the input buffer is full, a full buffer which can not grow anymore reads nothing.
+func (c *knettyConn) inputFull() bool {
+	return c.inputBuffer.Len() == c.inputBuffer.Cap()
+}
+
+func (c *knettyConn) handleInput() {
 	// return a copied buf for session
 	buf := c.inputBuffer.Bytes()
 	usedBufLen := c.eventTrigger.OnConnReadable(buf)
 	c.inputBuffer.Release(usedBufLen)
-	return
+}
+
+// rearm modify the connection FD with its current events.
+func (c *knettyConn) rearm() error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if c.writeable {
+		return c.Register(poll.RwToRead)
+	}
+
+	return c.Register(poll.ReadToRW)
 }
 
 // OnWrite executed when the network connection FD is writeable.
 // in some cases, there may be an `abnormality (EAGAIN)` in which data is written to the network.
 // When the network FD becomes writable, data should be written to the network as much as possible.
 func (c *knettyConn) OnWrite() (err error) {
-	if _, err = c.outputBuffer.WriteToFd(c.fd); err != nil {
-		return err
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if err = c.resume(); err != nil {
+		return c.opError(errors.OpWrite, err)
+	}
+
+	if c.poller.Options().TriggerMode == poll.EdgeTriggered {
+		// the writeable edge is reported once, write until the output buffer is empty or EAGAIN.
+		for !c.outputBuffer.IsEmpty() {
+			var n int
+			n, err = c.outputBuffer.WriteToFd(c.fd)
+			c.stats.wrote(n)
+			if err != nil {
+				return c.opError(errors.OpWrite, err)
+			}
+
+			if n == 0 {
+				c.stats.flushEAGAIN.Inc()
+				return
+			}
+		}
+	} else {
+		var n int
+		n, err = c.outputBuffer.WriteToFd(c.fd)
+		c.stats.wrote(n)
+		if err != nil {
+			return c.opError(errors.OpWrite, err)
+		}
 	}
 
 	if c.outputBuffer.IsEmpty() {
 		c.writeable = true
+		if c.paused.Load() != 0 {
+			return
+		}
 		// unregister the connection FD readable event to avoid too many invalid readable event triggers by poll.
 		return c.Register(poll.RwToRead)
 	}
 	return
 }
 
+// OnRecv executed when the completion-based poller receives data from the network connection FD.
+// the data is owned by the poller, so it is copied into the connection buffer before being processed.
+// the data not fitting in the input buffer is written after the handler drains the buffer, and the connection
+// is closed if the handler can not drain it, as the multishot recv can not be paused.
+func (c *knettyConn) OnRecv(data []byte) error {
+	for {
+		n, _ := c.inputBuffer.Write(data)
+		c.stats.read(n)
+		c.notifyRead(n)
+		data = data[n:]
+		buffered := c.inputBuffer.Len()
+		c.handleInput()
+		if len(data) == 0 || c.close.Load() != 0 {
+			return nil
+		}
+
+		if n == 0 && c.inputBuffer.Len() == buffered {
+			_ = c.OnInterrupt()
+			return c.opError(errors.OpRead, errors.BufferFullErr)
+		}
+	}
+}
+
+// OnSent executed when the completion-based poller has written n bytes of the submitted data to the network.
+func (c *knettyConn) OnSent(n int) error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	c.outputBuffer.Release(n)
+	c.stats.wrote(n)
+	if c.sending = c.sending[n:]; len(c.sending) > 0 {
+		return c.submitSending()
+	}
+
+	c.sending = nil
+	c.submitting.Store(0)
+	// the output buffer may be written while the previous data is being sent.
+	return c.submit()
+}
+
+// submit the output buffer data to the completion-based poller, there is at most one submission in flight,
+// the data written during the flight will be submitted when the flight completes. it runs with outMu held.
+func (c *knettyConn) submit() error {
+	if c.outputBuffer.IsEmpty() || !c.submitting.CAS(0, 1) {
+		return nil
+	}
+
+	if c.sending = c.outputBuffer.Bytes(); len(c.sending) == 0 {
+		c.submitting.Store(0)
+		return nil
+	}
+
+	return c.submitSending()
+}
+
+func (c *knettyConn) submitSending() error {
+	submitter, _ := poll.SubmitterOf(c.poller)
+	if err := submitter.Writev(c.netFd, [][]byte{c.sending}); err != nil {
+		c.sending = nil
+		c.submitting.Store(0)
+		return err
+	}
+
+	return nil
+}
+
+// OnFlush executed at the end of the event loop iteration in which the connection is written.
+func (c *knettyConn) OnFlush() error {
+	c.dirty.Store(0)
+	if c.close.Load() != 0 {
+		return nil
+	}
+
+	return c.flush()
+}
+
 // OnInterrupt executed when the network connection FD is close/hup.
 // when the network connection needs to be closed or the exception needs to close the entire connection.
 func (c *knettyConn) OnInterrupt() error {
-	// set connection status
-	c.close.Store(1)
+	// set connection status, the connection closed by the upper layer has released its FD.
+	if !c.close.CAS(0, 1) {
+		return nil
+	}
+	c.stopResume()
 	// trigger OnConnHup fn
 	c.eventTrigger.OnConnHup()
 	// clean up the connection FD in poll to avoid resource leaks
-	if err := c.poller.Register(&poll.NetFileDesc{
+	err := c.poller.Register(&poll.NetFileDesc{
 		FD: c.fd,
-	}, poll.DeleteRead); err != nil {
-		return err
+	}, poll.DeleteRead)
+	// the FD is closed even if the poller has been closed.
+	if closeErr := unix.Close(c.fd); err == nil {
+		err = closeErr
 	}
-
-	return unix.Close(c.fd)
+	return err
 }
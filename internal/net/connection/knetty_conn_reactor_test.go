@@ -0,0 +1,273 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package connection
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/net/poll"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"golang.org/x/sys/unix"
+)
+
+type countEventTrigger struct {
+	total  atomic.Int64
+	target int64
+	done   chan struct{}
+}
+
+func (c *countEventTrigger) OnConnReadable(buf []byte) int {
+	if c.total.Add(int64(len(buf))) == c.target {
+		close(c.done)
+	}
+	return len(buf)
+}
+
+func (c *countEventTrigger) OnConnHup() {}
+
+// newPairConn returns a connection registered in a poller created with opts and the peer fd of the connection.
+func newPairConn(t testing.TB, trigger EventTrigger, opts ...poll.Option) (*TcpConn, int, func()) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unix.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	poller := poll.NewDefaultPoller(opts...)
+	go func() {
+		_ = poller.Wait()
+	}()
+
+	conn := NewTcpConn(fds[0], nil, nil, poller)
+	conn.SetEventTrigger(trigger)
+	if err := conn.Register(poll.Read); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, fds[1], func() {
+		_ = conn.Close()
+		_ = poller.Close()
+		_ = unix.Close(fds[1])
+	}
+}
+
+func TestKnettyConn_OnReadEdgeTriggered(t *testing.T) {
+	data := bytes.Repeat([]byte("knetty"), 32*1024)
+	trigger := &countEventTrigger{target: int64(len(data)), done: make(chan struct{})}
+	// the read budget is much smaller than data, the connection must be rearmed to read all of them.
+	_, peer, closeFn := newPairConn(t, trigger, poll.WithTriggerMode(poll.EdgeTriggered), poll.WithReadBudget(1024))
+	defer closeFn()
+
+	go func() {
+		_, _ = unix.Write(peer, data)
+	}()
+
+	select {
+	case <-trigger.done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("edge-triggered connection read %d bytes, want %d", trigger.total.Load(), len(data))
+	}
+	assert.Equal(t, int64(len(data)), trigger.total.Load())
+}
+
+func TestKnettyConn_IOUring(t *testing.T) {
+	data := bytes.Repeat([]byte("knetty"), 32*1024)
+	trigger := &countEventTrigger{target: int64(len(data)), done: make(chan struct{})}
+	conn, peer, closeFn := newPairConn(t, trigger, poll.WithEngine(poll.IOUringEngine))
+	defer closeFn()
+	if _, ok := poll.SubmitterOf(conn.poller); !ok {
+		t.Skip("io_uring is unavailable")
+	}
+
+	go func() {
+		_, _ = unix.Write(peer, data)
+	}()
+
+	select {
+	case <-trigger.done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("io_uring connection received %d bytes, want %d", trigger.total.Load(), len(data))
+	}
+
+	n, err := conn.WriteBuffer(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Nil(t, conn.FlushBuffer())
+
+	buf := make([]byte, len(data))
+	for read := 0; read < len(data); {
+		n, err := unix.Read(peer, buf[read:])
+		assert.Nil(t, err)
+		read += n
+	}
+	assert.Equal(t, data, buf)
+}
+
+// splitEchoTrigger echoes the data byte by byte without flushing.
+type splitEchoTrigger struct {
+	conn *TcpConn
+}
+
+func (s *splitEchoTrigger) OnConnReadable(buf []byte) int {
+	for i := range buf {
+		if _, err := s.conn.WriteBuffer(buf[i : i+1]); err != nil {
+			return i
+		}
+	}
+	return len(buf)
+}
+
+func (s *splitEchoTrigger) OnConnHup() {}
+
+func TestKnettyConn_AutoFlush(t *testing.T) {
+	trigger := &splitEchoTrigger{}
+	conn, peer, closeFn := newPairConn(t, trigger, poll.WithAutoFlush())
+	defer closeFn()
+	trigger.conn = conn
+
+	// the data written in the event loop is flushed at the end of the iteration.
+	_, err := unix.Write(peer, []byte("knetty"))
+	assert.Nil(t, err)
+	buf := make([]byte, 6)
+	for read := 0; read < len(buf); {
+		n, err := unix.Read(peer, buf[read:])
+		assert.Nil(t, err)
+		read += n
+	}
+	assert.Equal(t, "knetty", string(buf))
+
+	// the data written outside the event loop is flushed by FlushBuffer.
+	_, err = conn.WriteBuffer([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, conn.FlushBuffer())
+	n, err := unix.Read(peer, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+}
+
+func benchmarkOnRead(b *testing.B, opts ...poll.Option) {
+	chunk := bytes.Repeat([]byte{'k'}, 4*1024)
+	trigger := &countEventTrigger{target: int64(b.N * len(chunk)), done: make(chan struct{})}
+	_, peer, closeFn := newPairConn(b, trigger, opts...)
+	defer closeFn()
+
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for written := 0; written < len(chunk); {
+			n, err := unix.Write(peer, chunk[written:])
+			if err != nil {
+				b.Fatal(err)
+			}
+			written += n
+		}
+	}
+	<-trigger.done
+}
+
+func BenchmarkKnettyConn_OnReadLevelTriggered(b *testing.B) {
+	benchmarkOnRead(b, poll.WithTriggerMode(poll.LevelTriggered))
+}
+
+func BenchmarkKnettyConn_OnReadEdgeTriggered(b *testing.B) {
+	benchmarkOnRead(b, poll.WithTriggerMode(poll.EdgeTriggered))
+}
+
+func BenchmarkKnettyConn_OnRecvIOUring(b *testing.B) {
+	benchmarkOnRead(b, poll.WithEngine(poll.IOUringEngine))
+}
+
+func TestKnettyConn_Stats(t *testing.T) {
+	data := bytes.Repeat([]byte("knetty"), 1024*1024)
+	trigger := &countEventTrigger{target: 6, done: make(chan struct{})}
+	conn, peer, closeFn := newPairConn(t, trigger)
+	defer closeFn()
+
+	_, err := unix.Write(peer, []byte("knetty"))
+	assert.Nil(t, err)
+	select {
+	case <-trigger.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection read nothing")
+	}
+
+	// the peer does not read, the data can not be written to the network completely.
+	n, err := conn.WriteBuffer(data)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.FlushBuffer())
+	stats := conn.Stats()
+	assert.Equal(t, uint64(6), stats.BytesIn)
+	assert.Equal(t, uint64(1), stats.FlushEAGAIN)
+	assert.Equal(t, n, int(stats.BytesOut)+stats.OutputBuffered)
+	assert.NotZero(t, stats.OutputBuffered)
+
+	buf := make([]byte, len(data))
+	for read := 0; read < len(data); {
+		n, err := unix.Read(peer, buf[read:])
+		assert.Nil(t, err)
+		read += n
+	}
+	// the statistics are updated after the writing returns.
+	for i := 0; i < 50 && conn.Stats().OutputBuffered != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats = conn.Stats()
+	assert.Equal(t, uint64(len(data)), stats.BytesOut)
+	assert.Equal(t, 0, stats.OutputBuffered)
+}
+
+type hupEventTrigger struct {
+	hups atomic.Int64
+}
+
+func (h *hupEventTrigger) OnConnReadable(buf []byte) int {
+	return len(buf)
+}
+
+func (h *hupEventTrigger) OnConnHup() {
+	h.hups.Inc()
+}
+
+func TestTcpConn_CloseOnce(t *testing.T) {
+	trigger := &hupEventTrigger{}
+	conn, _, closeFn := newPairConn(t, trigger)
+	defer closeFn()
+
+	// the connection is closed by the upper layer and interrupted concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = conn.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = conn.OnInterrupt()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), trigger.hups.Load())
+}
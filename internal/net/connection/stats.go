@@ -0,0 +1,71 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package connection
+
+import (
+	"go.uber.org/atomic"
+)
+
+// Stats statistics of a connection.
+type Stats struct {
+	// BytesIn the bytes read from the network.
+	BytesIn uint64
+	// BytesOut the bytes written to the network.
+	BytesOut uint64
+	// OutputBuffered the bytes in the output buffer waiting to be written to the network.
+	OutputBuffered int
+	// FlushEAGAIN the times the output buffer could not be written to the network completely,
+	// the remaining data is written when the network connection FD becomes writeable.
+	FlushEAGAIN uint64
+}
+
+// connStats records the statistics of a connection, it is updated by the event loop and the writers
+// and read by the others.
+type connStats struct {
+	bytesIn     atomic.Uint64
+	bytesOut    atomic.Uint64
+	buffered    atomic.Int64
+	flushEAGAIN atomic.Uint64
+}
+
+func (s *connStats) read(n int) {
+	if n > 0 {
+		s.bytesIn.Add(uint64(n))
+	}
+}
+
+func (s *connStats) buffer(n int) {
+	if n > 0 {
+		s.buffered.Add(int64(n))
+	}
+}
+
+func (s *connStats) wrote(n int) {
+	if n > 0 {
+		s.bytesOut.Add(uint64(n))
+		s.buffered.Sub(int64(n))
+	}
+}
+
+func (s *connStats) snapshot() Stats {
+	return Stats{
+		BytesIn:        s.bytesIn.Load(),
+		BytesOut:       s.bytesOut.Load(),
+		OutputBuffered: int(s.buffered.Load()),
+		FlushEAGAIN:    s.flushEAGAIN.Load(),
+	}
+}
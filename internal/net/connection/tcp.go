@@ -19,9 +19,12 @@ package connection
 import (
 	"net"
 	"syscall"
+	"time"
 
 	"github.com/Softwarekang/knetty/internal/net/poll"
 	"github.com/Softwarekang/knetty/pkg/buffer"
+	"github.com/Softwarekang/knetty/pkg/log"
+	syscallutil "github.com/Softwarekang/knetty/pkg/syscall"
 )
 
 // TcpConn tcp connection implements the Connection interface.
@@ -29,8 +32,8 @@ type TcpConn struct {
 	knettyConn
 }
 
-// NewTcpConn create a new tcp connection, conn implements Connection.
-func NewTcpConn(fd int, lsr, rsr net.Addr) *TcpConn {
+// NewTcpConn create a new tcp connection served by poller, conn implements Connection.
+func NewTcpConn(fd int, lsr, rsr net.Addr, poller poll.Poll) *TcpConn {
 	var localAddress, remoteAddress string
 	if lsr != nil {
 		localAddress = lsr.String()
@@ -40,6 +43,12 @@ func NewTcpConn(fd int, lsr, rsr net.Addr) *TcpConn {
 		remoteAddress = rsr.String()
 	}
 
+	if options := poller.Options(); options.BusyPoll > 0 {
+		if err := syscallutil.SetBusyPoll(fd, int(options.BusyPoll/time.Microsecond), options.PreferBusyPoll); err != nil {
+			log.Warnf("set busy poll for fd:%d err:%v", fd, err)
+		}
+	}
+
 	return &TcpConn{
 		knettyConn: knettyConn{
 			id:            idBuilder.Inc(),
@@ -47,7 +56,7 @@ func NewTcpConn(fd int, lsr, rsr net.Addr) *TcpConn {
 			localAddress:  localAddress,
 			writeable:     true,
 			remoteAddress: remoteAddress,
-			poller:        poll.PollerManager.Pick(),
+			poller:        poller,
 			inputBuffer:   buffer.NewRingBuffer(),
 			outputBuffer:  buffer.NewRingBuffer(),
 		},
@@ -75,28 +84,27 @@ func (t *TcpConn) RemoteAddr() string {
 }
 
 // WriteBuffer implements Connection.
+// the data written while the auto flush poller is dispatching events is flushed at the end of the iteration.
 func (t *TcpConn) WriteBuffer(bytes []byte) (int, error) {
-	return t.outputBuffer.Write(bytes)
+	t.outMu.Lock()
+	n, err := t.outputBuffer.Write(bytes)
+	t.outMu.Unlock()
+	t.stats.buffer(n)
+	if n > 0 {
+		t.markDirty()
+	}
+
+	return n, err
 }
 
 // FlushBuffer implements Connection.
 func (t *TcpConn) FlushBuffer() error {
-	if _, err := t.outputBuffer.WriteToFd(t.fd); err != nil {
-		return err
-	}
-
-	if t.outputBuffer.IsEmpty() {
+	// the auto flush poller flushes the connection once at the end of the event loop iteration.
+	if t.markDirty() {
 		return nil
 	}
 
-	if t.writeable {
-		t.writeable = false
-		// When the network data cannot be written, register the write event to poll,
-		// and write the buffer data to the network when it is writable again.
-		return t.Register(poll.ReadToRW)
-	}
-
-	return nil
+	return t.flush()
 }
 
 // Len implements Connection.
@@ -104,6 +112,11 @@ func (t *TcpConn) Len() int {
 	return t.inputBuffer.Len()
 }
 
+// Stats implements Connection.
+func (t *TcpConn) Stats() Stats {
+	return t.stats.snapshot()
+}
+
 func (t *TcpConn) isActive() bool {
 	return t.close.Load() == 0
 }
@@ -111,17 +124,23 @@ func (t *TcpConn) isActive() bool {
 // SetEventTrigger implements Connection.
 func (t *TcpConn) SetEventTrigger(trigger EventTrigger) {
 	t.eventTrigger = trigger
+	t.readNotifier, _ = trigger.(ReadNotifier)
 }
 
 // Close implements Connection.
 func (t *TcpConn) Close() error {
-	if !t.isActive() {
+	// the connection is closed once, either by Close or by the interruption.
+	if !t.close.CAS(0, 1) {
 		return nil
 	}
-	t.close.Store(1)
+	t.stopResume()
 	if et := t.eventTrigger; et != nil {
 		et.OnConnHup()
 	}
+	// the pending operations of the completion-based poller hold the connection FD until they are canceled.
+	if t.netFd != nil {
+		_ = t.poller.Register(t.netFd, poll.DeleteRead)
+	}
 	return syscall.Close(t.fd)
 }
 
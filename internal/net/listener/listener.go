@@ -17,19 +17,25 @@
 package listener
 
 import (
+	"net"
+
 	"github.com/Softwarekang/knetty/internal/net/connection"
+	"github.com/Softwarekang/knetty/internal/net/poll"
 	errors "github.com/Softwarekang/knetty/pkg/err"
 	netutil "github.com/Softwarekang/knetty/pkg/net"
-	"net"
 
 	"golang.org/x/sys/unix"
 )
 
 // Listener  A Listener is a generic network listener for stream-oriented protocols.
 type Listener interface {
-	// Accept waits for and returns the next connection to the listener.
+	// Accept waits for and returns the next admitted connection to the listener.
 	Accept() (connection.Connection, error)
 
+	// AcceptFd returns the connection of the fd which is accepted by a completion-based poller,
+	// or nil if the connection is rejected.
+	AcceptFd(fd int) (connection.Connection, error)
+
 	// Close closes the listener.
 	// Any blocked Accept operations will be unblocked and return errors.
 	Close() error
@@ -39,12 +45,23 @@ type Listener interface {
 
 	// FD returns the listener's fd
 	FD() int
+
+	// SetAdmitFunc set the func deciding whether an accepted connection is served.
+	SetAdmitFunc(admit AdmitFunc)
 }
 
+// AdmitFunc decides whether the connection of fd accepted from remoteAddr is served,
+// the rejected fd is owned by the func and has to be closed by it.
+type AdmitFunc func(fd int, remoteAddr net.Addr) bool
+
 // TcpListener tcp network listener.
 type TcpListener struct {
 	Fd      int
 	TcpAddr *net.TCPAddr
+	// Loops the event loop group serving the accepted connections
+	Loops *poll.EventLoopGroup
+	// Admit the func admitting the accepted connections before their buffers are allocated, nil admits all.
+	Admit AdmitFunc
 }
 
 // Accept implements Listener.
@@ -53,16 +70,41 @@ func (t *TcpListener) Accept() (connection.Connection, error) {
 		return nil, errors.IllegalListenerErr("tcp")
 	}
 
-	cfd, sa, err := unix.Accept(t.Fd)
-	if err != nil {
-		if err == unix.EAGAIN {
-			return nil, nil
+	// the rejected connections are skipped until an admitted one or no one is pending.
+	for {
+		cfd, sa, err := unix.Accept(t.Fd)
+		if err != nil {
+			if err == unix.EAGAIN {
+				return nil, nil
+			}
+			return nil, t.opError(err)
+		}
+
+		rsa := netutil.SocketAddrToAddr(sa)
+		if !t.admit(cfd, rsa) {
+			continue
 		}
-		return nil, err
+		return connection.NewTcpConn(cfd, t.TcpAddr, rsa, t.Loops.PickByAddr(rsa.String())), unix.SetNonblock(cfd, true)
+	}
+}
+
+// AcceptFd implements Listener.
+func (t *TcpListener) AcceptFd(fd int) (connection.Connection, error) {
+	if !t.ok() {
+		return nil, errors.IllegalListenerErr("tcp")
+	}
+
+	sa, err := unix.Getpeername(fd)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, t.opError(err)
 	}
 
 	rsa := netutil.SocketAddrToAddr(sa)
-	return connection.NewTcpConn(cfd, t.TcpAddr, rsa), unix.SetNonblock(cfd, true)
+	if !t.admit(fd, rsa) {
+		return nil, nil
+	}
+	return connection.NewTcpConn(fd, t.TcpAddr, rsa, t.Loops.PickByAddr(rsa.String())), unix.SetNonblock(fd, true)
 }
 
 // Close implements Listener.
@@ -84,8 +126,21 @@ func (t *TcpListener) FD() int {
 	return t.Fd
 }
 
+// opError wrap the error of accepting with the listener address.
+func (t *TcpListener) SetAdmitFunc(admit AdmitFunc) {
+	t.Admit = admit
+}
+
+func (t *TcpListener) admit(fd int, remoteAddr net.Addr) bool {
+	return t.Admit == nil || t.Admit(fd, remoteAddr)
+}
+
+func (t *TcpListener) opError(err error) error {
+	return &errors.OpError{Op: errors.OpAccept, LocalAddr: t.TcpAddr.String(), Err: err}
+}
+
 func (t *TcpListener) ok() bool {
-	if t.Fd != 0 && t.TcpAddr != nil {
+	if t.Fd != 0 && t.TcpAddr != nil && t.Loops != nil {
 		return true
 	}
 
@@ -17,87 +17,123 @@
 package net
 
 import (
-	"fmt"
 	"net"
 
 	"github.com/Softwarekang/knetty/internal/net/connection"
 	"github.com/Softwarekang/knetty/internal/net/listener"
+	"github.com/Softwarekang/knetty/internal/net/poll"
 	errors "github.com/Softwarekang/knetty/pkg/err"
 	netutil "github.com/Softwarekang/knetty/pkg/net"
 
 	"golang.org/x/sys/unix"
 )
 
-func Listen(network, address string) (listener.Listener, error) {
+// Listen announces on the local network address, the accepted connections are served by loops.
+func Listen(network, address string, loops *poll.EventLoopGroup) (listener.Listener, error) {
 	switch network {
 	case "tcp":
-		return listenTcp(network, address)
+		return listenTcp(network, address, loops)
 	default:
 		return nil, errors.UnKnowNetworkErr(network)
 	}
 
 }
 
-func listenTcp(network, address string) (*listener.TcpListener, error) {
+func listenTcp(network, address string, loops *poll.EventLoopGroup) (*listener.TcpListener, error) {
 	tcpAddr, err := net.ResolveTCPAddr(network, address)
 	if err != nil {
 		return nil, err
 	}
 
-	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	// the address without ip listens on all the IPv4 addresses.
+	var sa unix.Sockaddr = &unix.SockaddrInet4{Port: tcpAddr.Port}
+	if len(tcpAddr.IP) > 0 {
+		if sa, err = netutil.ResolveNetAddrToSocketAddr(tcpAddr); err != nil {
+			return nil, err
+		}
+	}
+
+	domain := unix.AF_INET
+	if _, ok := sa.(*unix.SockaddrInet6); ok {
+		domain = unix.AF_INET6
+	}
+
+	fd, err := unix.Socket(domain, unix.SOCK_STREAM, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := unix.Bind(fd, &unix.SockaddrInet4{
-		Port: tcpAddr.Port,
-		Addr: tcpAddr.AddrPort().Addr().As4(),
-	}); err != nil {
+	if err := unix.Bind(fd, sa); err != nil {
+		_ = unix.Close(fd)
 		return nil, err
 	}
 
 	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		_ = unix.Close(fd)
 		return nil, err
 	}
+
+	// the port 0 is chosen by the system.
+	if sa, err := unix.Getsockname(fd); err == nil {
+		switch sa := sa.(type) {
+		case *unix.SockaddrInet4:
+			tcpAddr.Port = sa.Port
+		case *unix.SockaddrInet6:
+			tcpAddr.Port = sa.Port
+		}
+	}
 	return &listener.TcpListener{
 		Fd:      fd,
 		TcpAddr: tcpAddr,
+		Loops:   loops,
 	}, unix.SetNonblock(fd, true)
 }
 
-func Dial(network, address string) (connection.Connection, error) {
+// Dial connects to the address on the named network, the connection is served by loops.
+func Dial(network, address string, loops *poll.EventLoopGroup) (connection.Connection, error) {
 	switch network {
 	case "tcp":
-		return dialTcp(network, address)
+		conn, err := dialTcp(network, address, loops)
+		if err != nil {
+			return nil, &errors.OpError{Op: errors.OpDial, RemoteAddr: address, Err: err}
+		}
+		return conn, nil
 	default:
 		return nil, errors.UnKnowNetworkErr(network)
 	}
 
 }
 
-func dialTcp(network string, address string) (*connection.TcpConn, error) {
+func dialTcp(network string, address string, loops *poll.EventLoopGroup) (*connection.TcpConn, error) {
 	tcpAddr, err := net.ResolveTCPAddr(network, address)
 	if err != nil {
 		return nil, err
 	}
 
-	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	rsa, err := netutil.ResolveNetAddrToSocketAddr(tcpAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	rsa, err := netutil.ResolveNetAddrToSocketAddr(tcpAddr)
+	domain := unix.AF_INET
+	if _, ok := rsa.(*unix.SockaddrInet6); ok {
+		domain = unix.AF_INET6
+	}
+
+	fd, err := unix.Socket(domain, unix.SOCK_STREAM, 0)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(rsa)
+
 	if err = unix.Connect(fd, rsa); err != nil {
+		_ = unix.Close(fd)
 		return nil, err
 	}
 
 	lsa, err := unix.Getsockname(fd)
 	if err != nil {
+		_ = unix.Close(fd)
 		return nil, err
 	}
-	return connection.NewTcpConn(fd, netutil.SocketAddrToAddr(lsa), netutil.SocketAddrToAddr(rsa)), unix.SetNonblock(fd, true)
+	return connection.NewTcpConn(fd, netutil.SocketAddrToAddr(lsa), netutil.SocketAddrToAddr(rsa), loops.PickByAddr(tcpAddr.String())), unix.SetNonblock(fd, true)
 }
@@ -0,0 +1,33 @@
+//go:build darwin || netbsd || freebsd || openbsd || dragonfly
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"errors"
+)
+
+// bindCPU binding OS threads to cpus is not supported on bsd.
+func bindCPU(cpu int) error {
+	return errors.New("binding cpu is not supported on bsd")
+}
+
+// threadID the thread id is not exposed on bsd.
+func threadID() int {
+	return 0
+}
@@ -0,0 +1,85 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"sync"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+)
+
+// batcher collects the net fds written while the event loop is dispatching events,
+// and flushes each of them once at the end of the iteration.
+type batcher struct {
+	enabled     bool
+	mu          sync.Mutex
+	dispatching bool
+	dirty       []*NetFileDesc
+	flushing    []*NetFileDesc
+}
+
+func newBatcher(options Options) *batcher {
+	return &batcher{enabled: options.AutoFlush}
+}
+
+// begin is called by the event loop before dispatching events.
+func (b *batcher) begin() {
+	if !b.enabled {
+		return
+	}
+
+	b.mu.Lock()
+	b.dispatching = true
+	b.mu.Unlock()
+}
+
+// end is called by the event loop after dispatching events, it flushes the dirty net fds.
+func (b *batcher) end() {
+	if !b.enabled {
+		return
+	}
+
+	b.mu.Lock()
+	b.dispatching = false
+	b.dirty, b.flushing = b.flushing[:0], b.dirty
+	b.mu.Unlock()
+
+	for idx, netFd := range b.flushing {
+		if netFd.OnFlush != nil {
+			if err := netFd.OnFlush(); err != nil {
+				log.Errorf("netFD OnFlush err:%v", err)
+			}
+		}
+		b.flushing[idx] = nil
+	}
+}
+
+// MarkDirty implements Batcher.
+func (b *batcher) MarkDirty(netFd *NetFileDesc) bool {
+	if !b.enabled {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.dispatching {
+		return false
+	}
+
+	b.dirty = append(b.dirty, netFd)
+	return true
+}
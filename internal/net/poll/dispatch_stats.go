@@ -0,0 +1,54 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// dispatchStats records the events dispatched by the event loop and how long they wait after
+// the event loop wakes up, the events reported together are dispatched one by one.
+type dispatchStats struct {
+	wakeups atomic.Uint64
+	events  atomic.Uint64
+	latency atomic.Int64
+}
+
+func newDispatchStats() *dispatchStats {
+	return &dispatchStats{}
+}
+
+// woke records the event loop woke up with n events, it returns the wake up time.
+func (d *dispatchStats) woke(n int) time.Time {
+	if n > 0 {
+		d.wakeups.Inc()
+	}
+	return time.Now()
+}
+
+// dispatched records an event is dispatched after the event loop woke up at wake.
+func (d *dispatchStats) dispatched(wake time.Time) {
+	d.events.Inc()
+	d.latency.Add(int64(time.Since(wake)))
+}
+
+// EventStats implements EventStats.
+func (d *dispatchStats) EventStats() (wakeups, events uint64, latency time.Duration) {
+	return d.wakeups.Load(), d.events.Load(), time.Duration(d.latency.Load())
+}
@@ -0,0 +1,66 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"sync"
+)
+
+// loopState tracks whether the Wait loop of a poller is running, the running loop releases the
+// resources of the poller when it stops, otherwise closing releases them.
+type loopState struct {
+	mu      sync.Mutex
+	running bool
+	closed  bool
+}
+
+// start marks the Wait loop running, it returns false if the poller is closed.
+func (s *loopState) start() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	s.running = true
+	return true
+}
+
+// stop marks the Wait loop stopped and releases the resources by release.
+func (s *loopState) stop(release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running, s.closed = false, true
+	release()
+}
+
+// close marks the poller closed, the running Wait loop is woken up by wake to stop, otherwise the
+// resources are released by release.
+func (s *loopState) close(wake func() error, release func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+	if s.running {
+		return wake()
+	}
+	release()
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"time"
+)
+
+const (
+	// defaultReadBudget the maximum bytes read from a single connection per wakeup in edge-triggered mode.
+	defaultReadBudget = 1 << 20
+)
+
+// TriggerMode the way the poller reports the readiness of a net fd.
+type TriggerMode int
+
+const (
+	// LevelTriggered the poller keeps reporting the net fd as long as it is readable/writeable.
+	LevelTriggered TriggerMode = iota
+	// EdgeTriggered the poller reports the net fd only when its readiness changes,
+	// so the listener needs to drain the net fd until EAGAIN.
+	EdgeTriggered
+)
+
+// Engine the io multiplexing mechanism of the poller.
+type Engine int
+
+const (
+	// DefaultEngine epoll on linux and kqueue on bsd.
+	DefaultEngine Engine = iota
+	// IOUringEngine io_uring on linux, it falls back to epoll when the kernel does not support it.
+	IOUringEngine
+)
+
+// Option option for poller
+type Option func(*Options)
+
+// Options options for poller
+type Options struct {
+	// Engine io multiplexing mechanism
+	Engine Engine
+	// TriggerMode level-triggered or edge-triggered
+	TriggerMode TriggerMode
+	// ReadBudget the maximum bytes read from a single net fd per wakeup in edge-triggered mode,
+	// which prevents a busy connection from starving the others registered in the same poller.
+	ReadBudget int
+	// LockOSThread lock the goroutine running the event loop to its OS thread.
+	LockOSThread bool
+	// CPUs the cpu list the event loops are bound to, the i-th event loop of a group is bound to
+	// CPUs[i%len(CPUs)], it implies LockOSThread.
+	CPUs []int
+	// SpinBudget the event loop waits with zero timeout for the duration after the last events are reported
+	// before blocking, it trades cpu for latency, zero means always blocking.
+	SpinBudget time.Duration
+	// BusyPoll set SO_BUSY_POLL on the connection sockets, the kernel busy polls the device queue for
+	// the duration on blocking receives, it is only supported on linux.
+	BusyPoll time.Duration
+	// PreferBusyPoll set SO_PREFER_BUSY_POLL on the connection sockets together with BusyPoll.
+	PreferBusyPoll bool
+	// AutoFlush the data written while the event loop is dispatching events is flushed once at the end of
+	// the iteration, instead of being written by each flush.
+	AutoFlush bool
+}
+
+// WithEngine set engine
+func WithEngine(engine Engine) Option {
+	return func(opt *Options) {
+		opt.Engine = engine
+	}
+}
+
+// WithTriggerMode set trigger mode
+func WithTriggerMode(mode TriggerMode) Option {
+	return func(opt *Options) {
+		opt.TriggerMode = mode
+	}
+}
+
+// WithReadBudget set read budget, a budget less than 1 means using the default budget(1 mb).
+func WithReadBudget(n int) Option {
+	return func(opt *Options) {
+		if n < 1 {
+			n = defaultReadBudget
+		}
+		opt.ReadBudget = n
+	}
+}
+
+// WithLockOSThread set the event loop locked to its OS thread.
+func WithLockOSThread() Option {
+	return func(opt *Options) {
+		opt.LockOSThread = true
+	}
+}
+
+// WithCPUs set the cpu list the event loops are bound to.
+func WithCPUs(cpus ...int) Option {
+	return func(opt *Options) {
+		opt.LockOSThread, opt.CPUs = true, cpus
+	}
+}
+
+// WithSpinBudget set spin budget, a budget less than 0 means zero.
+func WithSpinBudget(budget time.Duration) Option {
+	return func(opt *Options) {
+		if budget < 0 {
+			budget = 0
+		}
+		opt.SpinBudget = budget
+	}
+}
+
+// WithBusyPoll set SO_BUSY_POLL and SO_PREFER_BUSY_POLL on the connection sockets.
+func WithBusyPoll(busyPoll time.Duration, prefer bool) Option {
+	return func(opt *Options) {
+		opt.BusyPoll, opt.PreferBusyPoll = busyPoll, prefer
+	}
+}
+
+// WithAutoFlush set the pollers flush the written net fds at the end of each event loop iteration.
+func WithAutoFlush() Option {
+	return func(opt *Options) {
+		opt.AutoFlush = true
+	}
+}
+
+func newDefaultOptions() []Option {
+	return []Option{
+		WithEngine(DefaultEngine),
+		WithTriggerMode(LevelTriggered),
+		WithReadBudget(defaultReadBudget),
+	}
+}
+
+func newOptions(customOptions ...Option) Options {
+	var options Options
+	for _, opt := range append(newDefaultOptions(), customOptions...) {
+		opt(&options)
+	}
+
+	return options
+}
@@ -17,6 +17,10 @@
 // Package poll impl io multiplexing on different systems.
 package poll
 
+import (
+	"time"
+)
+
 // Poll define net poll interface.
 type Poll interface {
 	// Register netFd in the poller. events is the type of event that the poller focus on
@@ -29,6 +33,57 @@ type Poll interface {
 
 	// Close the poller
 	Close() error
+
+	// Options return the options used to create the poller
+	Options() Options
+}
+
+// Submitter is implemented by completion-based pollers, the I/O is submitted to the poller instead of
+// being executed by the caller, and the result is notified by the listener of the netFd.
+type Submitter interface {
+	// Writev submit writing bs to the netFd, OnSent will run when the writing completes.
+	// bs must not be modified until OnSent runs.
+	Writev(netFd *NetFileDesc, bs [][]byte) error
+}
+
+// WaitStats is implemented by pollers reporting the time spent in waiting.
+type WaitStats interface {
+	// WaitStats return the time spent in spinning with zero timeout and blocking
+	WaitStats() (spin, block time.Duration)
+}
+
+// EventStats is implemented by pollers reporting the dispatched events.
+type EventStats interface {
+	// EventStats return the times the event loop woke up with events, the number of the dispatched
+	// events and the total time the events waited between the wake up and their dispatching.
+	EventStats() (wakeups, events uint64, latency time.Duration)
+}
+
+// Batcher is implemented by pollers flushing the written net fds at the end of each event loop iteration.
+type Batcher interface {
+	// MarkDirty mark netFd to be flushed by OnFlush at the end of the current iteration,
+	// it returns false if auto flush is disabled or the poller is not dispatching events.
+	MarkDirty(netFd *NetFileDesc) bool
+}
+
+// SubmitterOf return the Submitter of the poller if the poller is completion-based.
+func SubmitterOf(p Poll) (Submitter, bool) {
+	submitter, ok := unwrap(p).(Submitter)
+	return submitter, ok
+}
+
+// BatcherOf return the Batcher of the poller.
+func BatcherOf(p Poll) (Batcher, bool) {
+	batcher, ok := unwrap(p).(Batcher)
+	return batcher, ok
+}
+
+func unwrap(p Poll) Poll {
+	if wrapped, ok := p.(interface{ Unwrap() Poll }); ok {
+		return wrapped.Unwrap()
+	}
+
+	return p
 }
 
 // NetFileDesc file-desc for net-fd
@@ -47,6 +102,14 @@ type NetPollListener struct {
 	OnWrite
 	// OnInterrupt will run where fd is interrupted
 	OnInterrupt
+	// OnAccept will run where a completion-based poller accepts a connection on the listener fd
+	OnAccept
+	// OnRecv will run where a completion-based poller receives data from fd
+	OnRecv
+	// OnSent will run where a completion-based poller completes the writing submitted by Submitter
+	OnSent
+	// OnFlush will run where the event loop iteration in which fd is marked dirty ends
+	OnFlush
 }
 
 // OnRead the callback function when the net fd state is readable
@@ -58,6 +121,18 @@ type OnWrite func() error
 // OnInterrupt The callback function when the net fd state is interrupt
 type OnInterrupt func() error
 
+// OnAccept The callback function when a connection fd is accepted
+type OnAccept func(fd int) error
+
+// OnRecv The callback function when data is received, data is only valid until the callback returns
+type OnRecv func(data []byte) error
+
+// OnSent The callback function when n bytes are written to the net fd
+type OnSent func(n int) error
+
+// OnFlush The callback function when the output of the net fd should be flushed
+type OnFlush func() error
+
 // EventType event type for poller
 type EventType int
 
@@ -67,4 +142,9 @@ const (
 	ReadToRW
 	RwToRead
 	OnceWrite
+	// PauseRead stop reporting the registered net fd until ResumeRead, it is not supported by
+	// the completion-based pollers.
+	PauseRead
+	// ResumeRead report the readable events of the net fd paused by PauseRead again.
+	ResumeRead
 )
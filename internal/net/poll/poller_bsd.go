@@ -21,21 +21,28 @@ package poll
 import (
 	"fmt"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
 // Kqueue poller for kqueue.
 type Kqueue struct {
-	fd int
+	fd      int
+	options Options
+	spinner *spinner
+	state   *loopState
+	*batcher
+	*dispatchStats
 }
 
 // NewDefaultPoller return a  kqueue poller.
-func NewDefaultPoller() Poll {
+func NewDefaultPoller(opts ...Option) Poll {
 	fd, err := syscall.Kqueue()
 	if err != nil {
 		panic(err)
 	}
 
+	// the user event wakes up the Wait loop when the poller is closed.
 	if _, err := syscall.Kevent(fd, []syscall.Kevent_t{{
 		Ident:  0,
 		Filter: syscall.EVFILT_USER,
@@ -44,7 +51,15 @@ func NewDefaultPoller() Poll {
 		panic(err)
 	}
 
-	return &Kqueue{fd: fd}
+	options := newOptions(opts...)
+	return &Kqueue{
+		fd:            fd,
+		options:       options,
+		spinner:       newSpinner(options.SpinBudget),
+		state:         &loopState{},
+		batcher:       newBatcher(options),
+		dispatchStats: newDispatchStats(),
+	}
 }
 
 // Register implements Poll.
@@ -62,15 +77,39 @@ func (k Kqueue) Register(netFd *NetFileDesc, eventType EventType) error {
 		filter, flags = syscall.EVFILT_READ, syscall.EV_DELETE|syscall.EV_ONESHOT
 	case OnceWrite:
 		filter, flags = syscall.EVFILT_WRITE, syscall.EV_ADD|syscall.EV_ENABLE|syscall.EV_ONESHOT
+	case PauseRead:
+		filter, flags = syscall.EVFILT_READ, syscall.EV_DISABLE
+	case ResumeRead:
+		filter, flags = syscall.EVFILT_READ, syscall.EV_ENABLE
 	default:
 		return fmt.Errorf("kqueue not support the event type:%d", int(eventType))
 	}
-	if _, err := syscall.Kevent(k.fd, []syscall.Kevent_t{{
+
+	// EV_CLEAR makes kqueue report the state change only, which equals to the epoll edge-triggered mode.
+	if k.options.TriggerMode == EdgeTriggered && flags&syscall.EV_ADD != 0 {
+		flags |= syscall.EV_CLEAR
+	}
+	changes := []syscall.Kevent_t{{
 		Ident:  uint64(netFd.FD),
 		Filter: filter,
 		Flags:  flags,
 		Udata:  *(**byte)(unsafe.Pointer(&netFd)),
-	}}, nil, nil); err != nil {
+	}}
+	// modifying the events rearms the edge-triggered net fd like epoll, the read filter is added again to
+	// report the net fd if it is still readable, and it keeps disabled if the reading is paused.
+	if k.options.TriggerMode == EdgeTriggered && (eventType == ReadToRW || eventType == RwToRead) {
+		changes = append([]syscall.Kevent_t{{
+			Ident:  uint64(netFd.FD),
+			Filter: syscall.EVFILT_READ,
+			Flags:  syscall.EV_ADD | syscall.EV_CLEAR,
+			Udata:  *(**byte)(unsafe.Pointer(&netFd)),
+		}}, changes...)
+	}
+	if _, err := syscall.Kevent(k.fd, changes, nil, nil); err != nil {
+		// the write filter is not added if the net fd has never been waited for writing.
+		if err == syscall.ENOENT && eventType == RwToRead {
+			return nil
+		}
 		return err
 	}
 
@@ -79,9 +118,21 @@ func (k Kqueue) Register(netFd *NetFileDesc, eventType EventType) error {
 
 // Wait  implements Poll.
 func (k Kqueue) Wait() error {
+	if !k.state.start() {
+		return nil
+	}
+	defer k.state.stop(k.release)
+
 	events := make([]syscall.Kevent_t, 1024)
+	zero := &syscall.Timespec{}
 	for {
-		n, err := syscall.Kevent(k.fd, nil, events, nil)
+		start := time.Now()
+		blocking, timeout := k.spinner.blocking(start), zero
+		if blocking {
+			timeout = nil
+		}
+		n, err := syscall.Kevent(k.fd, nil, events, timeout)
+		k.spinner.waited(start, blocking, n)
 		if err != nil {
 			// kqueue fd is illegal
 			if err == syscall.EBADF {
@@ -90,11 +141,22 @@ func (k Kqueue) Wait() error {
 			continue
 		}
 
+		wake, closed := k.woke(n), false
+		k.begin()
 		for i := 0; i < n; i++ {
 			event := events[i]
+			if event.Filter == syscall.EVFILT_USER {
+				closed = true
+				continue
+			}
 			netFD := *(**NetFileDesc)(unsafe.Pointer(&event.Udata))
+			k.dispatched(wake)
 			// check interrupt
 			if event.Flags&syscall.EV_EOF != 0 {
+				// the data arriving together with FIN is read before the net fd is interrupted.
+				if event.Filter == syscall.EVFILT_READ && event.Data > 0 && netFD.OnRead != nil {
+					_ = netFD.OnRead()
+				}
 				if netFD.OnInterrupt != nil {
 					_ = netFD.OnInterrupt()
 				}
@@ -117,10 +179,38 @@ func (k Kqueue) Wait() error {
 				continue
 			}
 		}
+		k.end()
+		if closed {
+			return nil
+		}
 	}
 }
 
 // Close  implements Poll.
 func (k Kqueue) Close() error {
-	return syscall.Close(k.fd)
+	return k.state.close(k.wake, k.release)
+}
+
+// wake up the Wait loop, it releases the kqueue fd when it stops.
+func (k Kqueue) wake() error {
+	_, err := syscall.Kevent(k.fd, []syscall.Kevent_t{{
+		Ident:  0,
+		Filter: syscall.EVFILT_USER,
+		Fflags: syscall.NOTE_TRIGGER,
+	}}, nil, nil)
+	return err
+}
+
+func (k Kqueue) release() {
+	_ = syscall.Close(k.fd)
+}
+
+// Options implements Poll.
+func (k Kqueue) Options() Options {
+	return k.options
+}
+
+// WaitStats implements WaitStats.
+func (k Kqueue) WaitStats() (spin, block time.Duration) {
+	return k.spinner.stats()
 }
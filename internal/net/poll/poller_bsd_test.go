@@ -0,0 +1,72 @@
+//go:build (darwin || netbsd || freebsd || openbsd || dragonfly) && !race
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestKqueue_EdgeTriggeredRearm(t *testing.T) {
+	poller := NewDefaultPoller(WithTriggerMode(EdgeTriggered))
+	go func() {
+		assert.Nil(t, poller.Wait())
+	}()
+	defer poller.Close()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	assert.Nil(t, err)
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	// the data is left in the net fd, so only rearming reports it again.
+	read := make(chan struct{}, 4)
+	netFd := &NetFileDesc{FD: fds[0], NetPollListener: NetPollListener{OnRead: func() error {
+		read <- struct{}{}
+		return nil
+	}}}
+	assert.Nil(t, poller.Register(netFd, Read))
+	_, err = unix.Write(fds[1], []byte("knetty"))
+	assert.Nil(t, err)
+	waitRead(t, read)
+
+	// the write filter is never added before.
+	assert.Nil(t, poller.Register(netFd, RwToRead))
+	waitRead(t, read)
+
+	assert.Nil(t, poller.Register(netFd, PauseRead))
+	assert.Nil(t, poller.Register(netFd, RwToRead))
+	select {
+	case <-read:
+		t.Fatal("the paused net fd is reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func waitRead(t *testing.T, read <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-read:
+	case <-time.After(3 * time.Second):
+		t.Fatal("kqueue poller does not report the readable net fd")
+	}
+}
@@ -21,25 +21,59 @@ package poll
 import (
 	"fmt"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/Softwarekang/knetty/pkg/log"
 	syscallutil "github.com/Softwarekang/knetty/pkg/syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // Epoll poller for epoll.
 type Epoll struct {
-	fd int
+	fd      int
+	wakeFd  int // the eventfd waking up the Wait loop when the poller is closed
+	options Options
+	spinner *spinner
+	state   loopState
+	*batcher
+	*dispatchStats
 }
 
-// NewDefaultPoller return a  kqueue poller.
-func NewDefaultPoller() Poll {
+// NewDefaultPoller return a  epoll poller, or an io_uring poller if the IOUringEngine is set and
+// supported by the kernel.
+func NewDefaultPoller(opts ...Option) Poll {
+	options := newOptions(opts...)
+	if options.Engine == IOUringEngine {
+		uring, err := newURing(options)
+		if err == nil {
+			return uring
+		}
+		log.Warnf("io_uring poller is unavailable and falls back to epoll, caused by:%v", err)
+	}
+
 	fd, err := syscall.EpollCreate1(0)
 	if err != nil {
 		panic(err)
 	}
+
+	// the wake event carries no net fd.
+	wakeFd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		panic(err)
+	}
+	if err := syscallutil.EpollCtl(fd, syscall.EPOLL_CTL_ADD, wakeFd, &syscallutil.EpollEvent{Events: syscall.EPOLLIN}); err != nil {
+		panic(err)
+	}
+
 	return &Epoll{
-		fd: fd,
+		fd:            fd,
+		wakeFd:        wakeFd,
+		options:       options,
+		spinner:       newSpinner(options.SpinBudget),
+		batcher:       newBatcher(options),
+		dispatchStats: newDispatchStats(),
 	}
 }
 
@@ -59,10 +93,23 @@ func (e *Epoll) Register(netFd *NetFileDesc, eventType EventType) error {
 	case OnceWrite:
 		// once write use et trigger
 		op, events = syscall.EPOLL_CTL_ADD, uint32(syscallutil.EpollET|syscall.EPOLLOUT)
+	case PauseRead:
+		// the half closed peer is reported after the reading is resumed, the pending data is read before.
+		return syscallutil.EpollCtl(e.fd, syscall.EPOLL_CTL_MOD, netFd.FD, &syscallutil.EpollEvent{
+			Events: syscall.EPOLLHUP | syscall.EPOLLERR,
+			Udata:  *(*[8]byte)(unsafe.Pointer(&netFd)),
+		})
+	case ResumeRead:
+		op, events = syscall.EPOLL_CTL_MOD, syscall.EPOLLIN
 	default:
 		return fmt.Errorf("epoll not support the event type:%d", int(eventType))
 	}
 
+	// EPOLL_CTL_MOD also rearms an edge-triggered fd, the poller will report it again if it is still ready.
+	if e.options.TriggerMode == EdgeTriggered && op != syscall.EPOLL_CTL_DEL {
+		events |= uint32(syscallutil.EpollET)
+	}
+
 	return syscallutil.EpollCtl(e.fd, op, netFd.FD, &syscallutil.EpollEvent{
 		Events: events | syscall.EPOLLHUP | syscall.EPOLLRDHUP | syscall.EPOLLERR,
 		Udata:  *(*[8]byte)(unsafe.Pointer(&netFd)),
@@ -71,20 +118,45 @@ func (e *Epoll) Register(netFd *NetFileDesc, eventType EventType) error {
 
 // Wait implements Poll.
 func (e *Epoll) Wait() error {
+	if !e.state.start() {
+		return nil
+	}
+	defer e.state.stop(e.release)
+
 	events := make([]syscallutil.EpollEvent, 1024)
 	for {
-		n, err := syscallutil.EpollWait(e.fd, events, -1)
+		start := time.Now()
+		blocking, msec := e.spinner.blocking(start), -1
+		if !blocking {
+			msec = 0
+		}
+		n, err := syscallutil.EpollWait(e.fd, events, msec)
+		e.spinner.waited(start, blocking, n)
 		if err != nil {
 			if err == syscall.EINTR {
 				continue
 			}
 			return err
 		}
+
+		wake, closed := e.woke(n), false
+		e.begin()
 		for i := 0; i < n; i++ {
 			event := events[i]
 			netFD := *(**NetFileDesc)(unsafe.Pointer(&event.Udata))
+			if netFD == nil {
+				closed = true
+				continue
+			}
+			e.dispatched(wake)
 			// check interrupt
 			if event.Events&(syscall.EPOLLHUP|syscall.EPOLLRDHUP|syscall.EPOLLERR) != 0 {
+				// the data arriving together with FIN is read before the net fd is interrupted.
+				if event.Events&syscall.EPOLLIN != 0 && event.Events&syscall.EPOLLERR == 0 && netFD.OnRead != nil && readable(netFD.FD) {
+					if err := netFD.OnRead(); err != nil {
+						log.Errorf("netFD OnRead err:%v", err)
+					}
+				}
 				if netFD.OnInterrupt != nil {
 					if err := netFD.OnInterrupt(); err != nil {
 						log.Errorf("netFD onInterrupt err:%v", err)
@@ -100,7 +172,10 @@ func (e *Epoll) Wait() error {
 						log.Errorf("netFD OnRead err:%v", err)
 					}
 				}
-				continue
+				// an edge-triggered writeable event arriving together with the readable one will not be reported again.
+				if e.options.TriggerMode != EdgeTriggered || event.Events&syscall.EPOLLOUT == 0 {
+					continue
+				}
 			}
 
 			// check write
@@ -113,10 +188,42 @@ func (e *Epoll) Wait() error {
 				continue
 			}
 		}
+		e.end()
+		if closed {
+			return nil
+		}
 	}
 }
 
 // Close implements Poll.
 func (e *Epoll) Close() error {
-	return syscall.Close(e.fd)
+	return e.state.close(e.wake, e.release)
+}
+
+// wake up the Wait loop, it releases the fds when it stops.
+func (e *Epoll) wake() error {
+	one := uint64(1)
+	_, err := unix.Write(e.wakeFd, (*[8]byte)(unsafe.Pointer(&one))[:])
+	return err
+}
+
+func (e *Epoll) release() {
+	_ = syscall.Close(e.wakeFd)
+	_ = syscall.Close(e.fd)
+}
+
+// Options implements Poll.
+func (e *Epoll) Options() Options {
+	return e.options
+}
+
+// WaitStats implements WaitStats.
+func (e *Epoll) WaitStats() (spin, block time.Duration) {
+	return e.spinner.stats()
+}
+
+// readable return whether there is data to read in the net fd.
+func readable(fd int) bool {
+	n, err := unix.IoctlGetInt(fd, unix.SIOCINQ)
+	return err == nil && n > 0
 }
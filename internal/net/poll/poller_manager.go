@@ -18,78 +18,326 @@ package poll
 
 import (
 	"fmt"
+	"hash/fnv"
 	"log"
 	"math/rand"
+	"net"
 	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
 )
 
-var PollerManager *pollerManager
+// PollerManager the default event loop group shared by the servers and clients without their own groups.
+var PollerManager *EventLoopGroup
 
 func init() {
 	var loops = runtime.GOMAXPROCS(0)/20 + 1
-	PollerManager = &pollerManager{}
+	PollerManager = &EventLoopGroup{}
 	_ = PollerManager.SetPollerNums(loops)
 }
 
-type pollerManager struct {
+// Strategy the way to pick a poller for a new net fd.
+type Strategy int
+
+const (
+	// Random pick a poller randomly.
+	Random Strategy = iota
+	// RoundRobin pick the pollers in turn.
+	RoundRobin
+	// LeastConnections pick the poller with the least registered net fds.
+	LeastConnections
+	// SourceAddrHash pick the poller by the hash of the remote ip, the connections from the same ip
+	// are served by the same poller.
+	SourceAddrHash
+)
+
+// Stats statistics of a poller.
+type Stats struct {
+	// Conns the number of the net fds registered in the poller.
+	Conns int
+	// LockedOSThread whether the event loop is locked to its OS thread.
+	LockedOSThread bool
+	// ThreadID the id of the OS thread running the locked event loop.
+	ThreadID int
+	// CPU the cpu the event loop is bound to, it is valid only when Pinned is true.
+	CPU int
+	// Pinned whether the event loop is bound to CPU.
+	Pinned bool
+	// SpinTime the time the event loop spent in polling with zero timeout.
+	SpinTime time.Duration
+	// BlockTime the time the event loop spent in blocking for events.
+	BlockTime time.Duration
+	// Wakeups the times the event loop woke up with events.
+	Wakeups uint64
+	// Events the number of the events dispatched by the event loop.
+	Events uint64
+	// WakeLatency the total time the events waited between the wake up of the event loop and their
+	// dispatching, WakeLatency / Events is the average latency.
+	WakeLatency time.Duration
+}
+
+// EventLoopGroup a group of pollers, each poller runs its event loop in a goroutine.
+type EventLoopGroup struct {
 	NumLoops int
-	pollers  []Poll // all the pollers
+	mu       sync.RWMutex
+	pollers  []*managedPoller // all the pollers
+	retired  []*managedPoller // the pollers removed by shrinking, closed when all their net fds are unregistered
+	options  []Option         // options for creating pollers
+	strategy Strategy
+	next     atomic.Uint64
+}
+
+// managedPoller records the net fds registered in the poller.
+type managedPoller struct {
+	Poll
+	group *EventLoopGroup
+	mu    sync.Mutex
+	fds   map[int]struct{}
+	stats Stats
+}
+
+// Register implements Poll.
+func (p *managedPoller) Register(netFd *NetFileDesc, eventType EventType) error {
+	if err := p.Poll.Register(netFd, eventType); err != nil {
+		return err
+	}
+
+	switch eventType {
+	case Read:
+		p.mu.Lock()
+		p.fds[netFd.FD] = struct{}{}
+		p.mu.Unlock()
+	case DeleteRead:
+		p.mu.Lock()
+		delete(p.fds, netFd.FD)
+		empty := len(p.fds) == 0
+		p.mu.Unlock()
+		if empty {
+			p.group.closeRetired(p)
+		}
+	}
+	return nil
+}
+
+// Unwrap return the underlying poller.
+func (p *managedPoller) Unwrap() Poll {
+	return p.Poll
+}
+
+// run the event loop of the poller, the event loop is locked to its OS thread and bound to cpu
+// if the options require.
+func (p *managedPoller) run(options Options, cpu int) {
+	if options.LockOSThread {
+		runtime.LockOSThread()
+		p.mu.Lock()
+		p.stats.LockedOSThread, p.stats.ThreadID = true, threadID()
+		p.mu.Unlock()
+	}
+
+	pinned := false
+	if options.LockOSThread && len(options.CPUs) > 0 {
+		if err := bindCPU(cpu); err != nil {
+			log.Printf("bind poller to cpu:%d err:%v\n", cpu, err)
+		} else {
+			pinned = true
+			p.mu.Lock()
+			p.stats.CPU, p.stats.Pinned = cpu, true
+			p.mu.Unlock()
+		}
+	}
+
+	// the OS thread is returned to the runtime when the event loop stops, except the pinned one which
+	// is terminated with the goroutine so its cpu affinity is not inherited by other goroutines.
+	if options.LockOSThread && !pinned {
+		defer runtime.UnlockOSThread()
+	}
+
+	if err := p.Wait(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (p *managedPoller) conns() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.fds)
+}
+
+// NewEventLoopGroup return a group running n pollers created with opts.
+func NewEventLoopGroup(n int, opts ...Option) (*EventLoopGroup, error) {
+	group := &EventLoopGroup{options: opts}
+	if err := group.SetPollerNums(n); err != nil {
+		return nil, err
+	}
+
+	return group, nil
 }
 
 // SetPollerNums setup num for pollers.
-func (m *pollerManager) SetPollerNums(n int) error {
+// when shrinking, the removed pollers stop serving new net fds and are closed after all their net fds are
+// unregistered, so the established connections are not affected.
+func (m *EventLoopGroup) SetPollerNums(n int) error {
 	if n < 1 {
 		return fmt.Errorf("SetPollerNums(n int):@n < 0")
 	}
 
+	m.mu.Lock()
 	if n < m.NumLoops {
-		var polls = make([]Poll, n)
-		for idx := 0; idx < m.NumLoops; idx++ {
-			if idx < n {
-				polls[idx] = m.pollers[idx]
-			} else {
-				if err := m.pollers[idx].Close(); err != nil {
-					log.Printf("close poller err: %v\n", err)
-				}
+		retired := m.pollers[n:]
+		m.NumLoops, m.pollers = n, m.pollers[:n:n]
+		m.retired = append(m.retired, retired...)
+		m.mu.Unlock()
+		for _, poller := range retired {
+			if poller.conns() == 0 {
+				m.closeRetired(poller)
 			}
 		}
-		m.NumLoops = n
-		m.pollers = polls
 		return nil
 	}
 
 	m.NumLoops = n
+	m.mu.Unlock()
 	return m.Run()
 }
 
+// SetPollerOptions setup options for pollers.
+// the running pollers will be closed and recreated with the new options,
+// so it must be called before any net fd is registered.
+func (m *EventLoopGroup) SetPollerOptions(opts ...Option) error {
+	n := m.NumLoops
+	if err := m.Close(); err != nil {
+		return err
+	}
+
+	m.options = opts
+	if n < 1 {
+		return nil
+	}
+
+	return m.SetPollerNums(n)
+}
+
+// SetStrategy setup the strategy for picking pollers.
+func (m *EventLoopGroup) SetStrategy(strategy Strategy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategy = strategy
+}
+
 // Close release all resources.
-func (m *pollerManager) Close() error {
-	for _, poller := range m.pollers {
+func (m *EventLoopGroup) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, poller := range append(m.pollers, m.retired...) {
 		if err := poller.Close(); err != nil {
 			log.Printf("close poller err:%v \n", err)
 		}
 	}
-	m.NumLoops, m.pollers = 0, nil
+	m.NumLoops, m.pollers, m.retired = 0, nil, nil
 	return nil
 }
 
 // Run all pollers
-func (m *pollerManager) Run() error {
+func (m *EventLoopGroup) Run() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	options := newOptions(m.options...)
 	for idx := len(m.pollers); idx < m.NumLoops; idx++ {
-		var poller = NewDefaultPoller()
+		// reuse the retired pollers which are still running first.
+		if len(m.retired) > 0 {
+			m.pollers = append(m.pollers, m.retired[0])
+			m.retired = m.retired[1:]
+			continue
+		}
+
+		var poller = &managedPoller{
+			Poll:  NewDefaultPoller(m.options...),
+			group: m,
+			fds:   make(map[int]struct{}),
+		}
 		m.pollers = append(m.pollers, poller)
 
-		go func() {
-			if err := poller.Wait(); err != nil {
-				log.Println(err)
-			}
-		}()
+		var cpu int
+		if len(options.CPUs) > 0 {
+			cpu = options.CPUs[idx%len(options.CPUs)]
+		}
+		go poller.run(options, cpu)
 	}
 
 	return nil
 }
 
-// Pick rand get a poller
-func (m *pollerManager) Pick() Poll {
-	return m.pollers[rand.Intn(m.NumLoops)]
+// Pick get a poller by the strategy, SourceAddrHash works as RoundRobin because of no remote address.
+func (m *EventLoopGroup) Pick() Poll {
+	return m.PickByAddr("")
+}
+
+// PickByAddr get a poller by the strategy for the net fd connected to remoteAddr.
+func (m *EventLoopGroup) PickByAddr(remoteAddr string) Poll {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	switch m.strategy {
+	case RoundRobin:
+		return m.pollers[m.next.Inc()%uint64(m.NumLoops)]
+	case LeastConnections:
+		var picked *managedPoller
+		least := -1
+		for _, poller := range m.pollers {
+			if conns := poller.conns(); least < 0 || conns < least {
+				picked, least = poller, conns
+			}
+		}
+		return picked
+	case SourceAddrHash:
+		if remoteAddr == "" {
+			return m.pollers[m.next.Inc()%uint64(m.NumLoops)]
+		}
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(remoteAddr))
+		return m.pollers[h.Sum32()%uint32(m.NumLoops)]
+	default:
+		return m.pollers[rand.Intn(m.NumLoops)]
+	}
+}
+
+// Stats return the statistics of all the pollers serving new net fds.
+func (m *EventLoopGroup) Stats() []Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make([]Stats, 0, len(m.pollers))
+	for _, poller := range m.pollers {
+		poller.mu.Lock()
+		poller.stats.Conns = len(poller.fds)
+		if waitStats, ok := poller.Poll.(WaitStats); ok {
+			poller.stats.SpinTime, poller.stats.BlockTime = waitStats.WaitStats()
+		}
+		if eventStats, ok := poller.Poll.(EventStats); ok {
+			poller.stats.Wakeups, poller.stats.Events, poller.stats.WakeLatency = eventStats.EventStats()
+		}
+		stats = append(stats, poller.stats)
+		poller.mu.Unlock()
+	}
+	return stats
+}
+
+// closeRetired close the poller if it is retired and no net fd is registered.
+func (m *EventLoopGroup) closeRetired(poller *managedPoller) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, retired := range m.retired {
+		if retired != poller || poller.conns() != 0 {
+			continue
+		}
+
+		m.retired = append(m.retired[:idx], m.retired[idx+1:]...)
+		if err := poller.Close(); err != nil {
+			log.Printf("close poller err: %v\n", err)
+		}
+		return
+	}
 }
@@ -17,9 +17,12 @@
 package poll
 
 import (
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 )
 
 // test  for poller manager
@@ -41,3 +44,140 @@ func TestPollerManager(t *testing.T) {
 	err = PollerManager.Close()
 	assert.Nil(t, err)
 }
+
+func TestPollerManager_SetPollerOptions(t *testing.T) {
+	err := PollerManager.SetPollerNums(2)
+	assert.Nil(t, err)
+
+	err = PollerManager.SetPollerOptions(WithTriggerMode(EdgeTriggered), WithReadBudget(0))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, PollerManager.NumLoops)
+	assert.Equal(t, Options{TriggerMode: EdgeTriggered, ReadBudget: defaultReadBudget}, PollerManager.Pick().Options())
+
+	err = PollerManager.SetPollerOptions()
+	assert.Nil(t, err)
+	assert.Equal(t, LevelTriggered, PollerManager.Pick().Options().TriggerMode)
+
+	err = PollerManager.Close()
+	assert.Nil(t, err)
+}
+
+func registerSocketPair(t *testing.T, poller Poll) *NetFileDesc {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = unix.Close(fds[0])
+		_ = unix.Close(fds[1])
+	})
+
+	netFd := &NetFileDesc{FD: fds[0]}
+	assert.Nil(t, poller.Register(netFd, Read))
+	return netFd
+}
+
+func TestPollerManager_Strategy(t *testing.T) {
+	manager := &EventLoopGroup{}
+	assert.Nil(t, manager.SetPollerNums(3))
+	defer manager.Close()
+
+	manager.SetStrategy(RoundRobin)
+	first := manager.Pick()
+	assert.NotEqual(t, first, manager.Pick())
+	assert.NotEqual(t, first, manager.Pick())
+	assert.Equal(t, first, manager.Pick())
+
+	manager.SetStrategy(SourceAddrHash)
+	assert.Equal(t, manager.PickByAddr("192.0.2.1:25"), manager.PickByAddr("192.0.2.1:80"))
+
+	manager.SetStrategy(LeastConnections)
+	for i := 0; i < 6; i++ {
+		registerSocketPair(t, manager.Pick())
+	}
+	assert.Equal(t, []Stats{{Conns: 2}, {Conns: 2}, {Conns: 2}}, manager.Stats())
+}
+
+func TestPollerManager_ShrinkRetiresPoller(t *testing.T) {
+	manager := &EventLoopGroup{}
+	assert.Nil(t, manager.SetPollerNums(2))
+	defer manager.Close()
+
+	retired := manager.pollers[1]
+	registerSocketPair(t, manager.pollers[0])
+	netFd := registerSocketPair(t, retired)
+
+	// the retired poller keeps serving its net fd until it is unregistered.
+	assert.Nil(t, manager.SetPollerNums(1))
+	assert.Equal(t, []Stats{{Conns: 1}}, manager.Stats())
+	assert.Equal(t, []*managedPoller{retired}, manager.retired)
+
+	assert.Nil(t, retired.Register(netFd, DeleteRead))
+	assert.Empty(t, manager.retired)
+}
+
+func TestEventLoopGroup_CloseStopsPollers(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithLockOSThread()}, {WithCPUs(0)}} {
+		goroutines := runtime.NumGoroutine()
+		for i := 0; i < 5; i++ {
+			group, err := NewEventLoopGroup(4, opts...)
+			assert.Nil(t, err)
+			// wait for the event loops blocking in waiting.
+			time.Sleep(10 * time.Millisecond)
+			assert.Nil(t, group.Close())
+		}
+
+		// the goroutines are counted without assert.Eventually which runs the condition in another goroutine.
+		for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+	}
+}
+
+func TestEventLoopGroup_LockOSThread(t *testing.T) {
+	group, err := NewEventLoopGroup(2, WithCPUs(0))
+	assert.Nil(t, err)
+	defer group.Close()
+
+	// wait for the event loops running.
+	time.Sleep(100 * time.Millisecond)
+	for _, stats := range group.Stats() {
+		assert.True(t, stats.LockedOSThread)
+		if runtime.GOOS == "linux" {
+			assert.NotZero(t, stats.ThreadID)
+			assert.True(t, stats.Pinned)
+			assert.Equal(t, 0, stats.CPU)
+		}
+	}
+}
+
+func TestEventLoopGroup_Spin(t *testing.T) {
+	group, err := NewEventLoopGroup(1, WithSpinBudget(50*time.Millisecond))
+	assert.Nil(t, err)
+	defer group.Close()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	assert.Nil(t, err)
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	read := make(chan struct{}, 1)
+	netFd := &NetFileDesc{FD: fds[0], NetPollListener: NetPollListener{OnRead: func() error {
+		buf := make([]byte, 16)
+		_, _ = unix.Read(fds[0], buf)
+		read <- struct{}{}
+		return nil
+	}}}
+	assert.Nil(t, group.Pick().Register(netFd, Read))
+
+	_, err = unix.Write(fds[1], []byte("knetty"))
+	assert.Nil(t, err)
+	<-read
+	// the event loop spins within the budget after the event and blocks after that.
+	time.Sleep(100 * time.Millisecond)
+	stats := group.Stats()[0]
+	assert.NotZero(t, stats.SpinTime)
+	assert.NotZero(t, stats.BlockTime)
+	assert.Equal(t, uint64(1), stats.Wakeups)
+	assert.Equal(t, uint64(1), stats.Events)
+	assert.NotZero(t, stats.WakeLatency)
+}
@@ -0,0 +1,744 @@
+//go:build linux && !race
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	merr "github.com/Softwarekang/knetty/pkg/err"
+	"github.com/Softwarekang/knetty/pkg/log"
+	syscallutil "github.com/Softwarekang/knetty/pkg/syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// uringEntries the size of the submission queue.
+	uringEntries = 1024
+	// uringBufEntries the number of the provided buffers for recv, must be power of 2.
+	uringBufEntries = 256
+	// uringBufSize the size of each provided buffer.
+	uringBufSize = 16 * 1024
+	// uringBufGroup the buffer group id of the provided buffers.
+	uringBufGroup = 0
+	// uringWakeUserData the user data of the nop which wakes up the Wait loop when closing.
+	uringWakeUserData = 0
+)
+
+// the kinds of the submitted ops, stored in the lowest byte of the user data.
+const (
+	uringPollIn uint8 = iota + 1
+	uringPollOut
+	uringAccept
+	uringRecv
+	uringSend
+	uringCancel
+)
+
+// URing poller for io_uring.
+// the listener fd is served by multishot accept, the connection fd is served by multishot recv with
+// provided buffers, and the writing is submitted by Submitter, all the submissions produced while
+// dispatching the completions are batched into one io_uring_enter.
+type URing struct {
+	fd      int
+	options Options
+	*batcher
+	*dispatchStats
+
+	mu          sync.Mutex
+	closed      bool
+	running     bool
+	dispatching bool
+	pending     uint32
+
+	// submission queue
+	sqRing  []byte
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []syscallutil.IoUringSqe
+	sqesMem []byte
+	tail    uint32
+
+	// completion queue
+	cqRing []byte
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []syscallutil.IoUringCqe
+
+	// provided buffers
+	bufRing []byte
+	bufs    []byte
+	bufTail uint16
+
+	nextID  uint64
+	files   map[int]*uringFile
+	entries map[uint64]*uringFile
+}
+
+// uringFile the registration of a net fd.
+type uringFile struct {
+	id       uint64
+	netFd    *NetFileDesc
+	readOp   uint8
+	pollOut  bool
+	inflight int
+	closing  bool
+	// keep the submitted data alive until the kernel completes the writing.
+	sending [][]byte
+	iovecs  []unix.Iovec
+}
+
+// newURing return an io_uring poller, err is returned if the kernel does not support the features in use.
+func newURing(options Options) (*URing, error) {
+	if err := checkURingKernel(); err != nil {
+		return nil, err
+	}
+
+	var params syscallutil.IoUringParams
+	fd, err := syscallutil.IoUringSetup(uringEntries, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &URing{
+		fd:            fd,
+		options:       options,
+		batcher:       newBatcher(options),
+		dispatchStats: newDispatchStats(),
+		files:         make(map[int]*uringFile),
+		entries:       make(map[uint64]*uringFile),
+	}
+	if err := r.setup(&params); err != nil {
+		r.release()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// checkURingKernel multishot recv requires linux 6.0+.
+func checkURingKernel() error {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return err
+	}
+
+	release := unix.ByteSliceToString(uname.Release[:])
+	versions := strings.SplitN(release, ".", 3)
+	if len(versions) < 2 {
+		return fmt.Errorf("unknown kernel release:%s", release)
+	}
+
+	major, err := strconv.Atoi(versions[0])
+	if err != nil {
+		return fmt.Errorf("unknown kernel release:%s", release)
+	}
+
+	if major < 6 {
+		return fmt.Errorf("io_uring poller requires linux 6.0+, got:%s", release)
+	}
+	return nil
+}
+
+func (r *URing) setup(params *syscallutil.IoUringParams) error {
+	if err := r.probe(); err != nil {
+		return err
+	}
+
+	sqRingSize := int(params.SqOff.Array + params.SqEntries*4)
+	cqRingSize := int(params.CqOff.Cqes + params.CqEntries*uint32(unsafe.Sizeof(syscallutil.IoUringCqe{})))
+	if params.Features&syscallutil.IoRingFeatSingleMmap != 0 && cqRingSize > sqRingSize {
+		sqRingSize = cqRingSize
+	}
+
+	var err error
+	if r.sqRing, err = mmapRing(r.fd, syscallutil.IoRingOffSqRing, sqRingSize); err != nil {
+		return err
+	}
+
+	r.cqRing = r.sqRing
+	if params.Features&syscallutil.IoRingFeatSingleMmap == 0 {
+		if r.cqRing, err = mmapRing(r.fd, syscallutil.IoRingOffCqRing, cqRingSize); err != nil {
+			return err
+		}
+	}
+
+	sqesSize := int(params.SqEntries) * int(unsafe.Sizeof(syscallutil.IoUringSqe{}))
+	if r.sqesMem, err = mmapRing(r.fd, syscallutil.IoRingOffSqes, sqesSize); err != nil {
+		return err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[params.SqOff.Head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[params.SqOff.Tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[params.SqOff.RingMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[params.SqOff.Array])), params.SqEntries)
+	r.sqes = unsafe.Slice((*syscallutil.IoUringSqe)(unsafe.Pointer(&r.sqesMem[0])), params.SqEntries)
+	r.tail = atomic.LoadUint32(r.sqTail)
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[params.CqOff.Head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[params.CqOff.Tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[params.CqOff.RingMask]))
+	r.cqes = unsafe.Slice((*syscallutil.IoUringCqe)(unsafe.Pointer(&r.cqRing[params.CqOff.Cqes])), params.CqEntries)
+
+	return r.setupBufRing()
+}
+
+// probe check the kernel supports all the ops in use.
+func (r *URing) probe() error {
+	var probe syscallutil.IoUringProbe
+	if err := syscallutil.IoUringRegister(r.fd, syscallutil.IoRingRegisterProbe, unsafe.Pointer(&probe), syscallutil.IoRingOpLast); err != nil {
+		return err
+	}
+
+	for _, op := range []uint8{
+		syscallutil.IoRingOpNop, syscallutil.IoRingOpWritev, syscallutil.IoRingOpPollAdd,
+		syscallutil.IoRingOpAccept, syscallutil.IoRingOpAsyncCancel, syscallutil.IoRingOpSend, syscallutil.IoRingOpRecv,
+	} {
+		if op > probe.LastOp || probe.Ops[op].Flags&syscallutil.IoRingOpSupported == 0 {
+			return fmt.Errorf("io_uring op:%d is not supported", op)
+		}
+	}
+	return nil
+}
+
+// setupBufRing register the provided buffers ring used by multishot recv.
+func (r *URing) setupBufRing() error {
+	var err error
+	if r.bufRing, err = mmapAnon(uringBufEntries * int(unsafe.Sizeof(syscallutil.IoUringBuf{}))); err != nil {
+		return err
+	}
+
+	if r.bufs, err = mmapAnon(uringBufEntries * uringBufSize); err != nil {
+		return err
+	}
+
+	reg := syscallutil.IoUringBufReg{
+		RingAddr:    uint64(uintptr(unsafe.Pointer(&r.bufRing[0]))),
+		RingEntries: uringBufEntries,
+		Bgid:        uringBufGroup,
+	}
+	if err := syscallutil.IoUringRegister(r.fd, syscallutil.IoRingRegisterPbufRing, unsafe.Pointer(&reg), 1); err != nil {
+		return err
+	}
+
+	for bid := 0; bid < uringBufEntries; bid++ {
+		r.addBuf(uint16(bid))
+	}
+	r.publishBufs()
+	return nil
+}
+
+func (r *URing) addBuf(bid uint16) {
+	idx := int(r.bufTail) & (uringBufEntries - 1)
+	buf := (*syscallutil.IoUringBuf)(unsafe.Pointer(&r.bufRing[idx*int(unsafe.Sizeof(syscallutil.IoUringBuf{}))]))
+	buf.Addr = uint64(uintptr(unsafe.Pointer(&r.bufs[int(bid)*uringBufSize])))
+	buf.Len = uringBufSize
+	buf.Bid = bid
+	r.bufTail++
+}
+
+// publishBufs make the added buffers visible to the kernel.
+// the 16 bits tail of the buffer ring overlaps the resv field of the first buffer,
+// it is stored together with the bid of the first buffer as a 32 bits word(little endian).
+func (r *URing) publishBufs() {
+	word := (*uint32)(unsafe.Pointer(&r.bufRing[12]))
+	first := (*syscallutil.IoUringBuf)(unsafe.Pointer(&r.bufRing[0]))
+	atomic.StoreUint32(word, uint32(first.Bid)|uint32(r.bufTail)<<16)
+}
+
+// Register implements Poll.
+func (r *URing) Register(netFd *NetFileDesc, eventType EventType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		if eventType == DeleteRead {
+			return nil
+		}
+		return errors.New("io_uring poller is closed")
+	}
+
+	switch eventType {
+	case Read:
+		file := r.file(netFd)
+		switch {
+		case netFd.OnAccept != nil:
+			file.readOp = uringAccept
+		case netFd.OnRecv != nil:
+			file.readOp = uringRecv
+		default:
+			file.readOp = uringPollIn
+		}
+		if err := r.prepRead(file); err != nil {
+			return err
+		}
+	case ReadToRW, OnceWrite:
+		file := r.file(netFd)
+		if file.pollOut {
+			return nil
+		}
+		if err := r.prepPollOut(file); err != nil {
+			return err
+		}
+	case RwToRead:
+		// the writeable poll is oneshot.
+		return nil
+	case DeleteRead:
+		file, ok := r.files[netFd.FD]
+		if !ok {
+			return nil
+		}
+		if err := r.prepCancel(file); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("io_uring not support the event type:%d", int(eventType))
+	}
+
+	return r.submitLocked()
+}
+
+// Writev implements Submitter.
+func (r *URing) Writev(netFd *NetFileDesc, bs [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[netFd.FD]
+	if r.closed || !ok || file.closing {
+		return merr.ConnClosedErr
+	}
+
+	// the empty buffers are skipped, the send of a single buffer avoids the iovecs.
+	var single []byte
+	file.iovecs = file.iovecs[:0]
+	for _, b := range bs {
+		if len(b) == 0 {
+			continue
+		}
+		single = b
+		iovec := unix.Iovec{Base: &b[0]}
+		iovec.SetLen(len(b))
+		file.iovecs = append(file.iovecs, iovec)
+	}
+	if len(file.iovecs) == 0 {
+		return errors.New("io_uring writev nothing to write")
+	}
+
+	sqe, err := r.getSqe()
+	if err != nil {
+		file.iovecs = file.iovecs[:0]
+		return err
+	}
+
+	file.sending = bs
+	if len(file.iovecs) == 1 {
+		sqe.Opcode, sqe.Fd = syscallutil.IoRingOpSend, int32(netFd.FD)
+		sqe.Addr, sqe.Len = uint64(uintptr(unsafe.Pointer(&single[0]))), uint32(len(single))
+		sqe.OpFlags = unix.MSG_NOSIGNAL
+	} else {
+		sqe.Opcode, sqe.Fd = syscallutil.IoRingOpWritev, int32(netFd.FD)
+		sqe.Addr, sqe.Len = uint64(uintptr(unsafe.Pointer(&file.iovecs[0]))), uint32(len(file.iovecs))
+	}
+	sqe.UserData = userData(file.id, uringSend)
+	r.publish(file)
+	return r.submitLocked()
+}
+
+// Wait implements Poll.
+func (r *URing) Wait() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.running = true
+	r.mu.Unlock()
+	defer r.release()
+
+	for {
+		r.mu.Lock()
+		toSubmit := r.pending
+		r.pending, r.dispatching = 0, false
+		r.mu.Unlock()
+
+		if _, err := syscallutil.IoUringEnter(r.fd, toSubmit, 1, syscallutil.IoRingEnterGetEvents); err != nil {
+			r.mu.Lock()
+			r.pending += toSubmit
+			r.mu.Unlock()
+			if err == syscall.EINTR || err == syscall.EAGAIN || err == syscall.EBUSY {
+				continue
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		r.dispatching = true
+		r.mu.Unlock()
+		r.begin()
+		if r.reap() {
+			return nil
+		}
+		// the writing submitted by flushing is batched with the others of this iteration.
+		r.end()
+	}
+}
+
+// reap dispatch all the completions, it returns true if the poller is closed.
+func (r *URing) reap() bool {
+	head := atomic.LoadUint32(r.cqHead)
+	wake := r.woke(int(atomic.LoadUint32(r.cqTail) - head))
+	for {
+		tail := atomic.LoadUint32(r.cqTail)
+		if head == tail {
+			return false
+		}
+
+		for ; head != tail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+			if cqe.UserData == uringWakeUserData {
+				atomic.StoreUint32(r.cqHead, head+1)
+				return true
+			}
+			r.dispatched(wake)
+			r.dispatch(cqe)
+		}
+		atomic.StoreUint32(r.cqHead, head)
+		r.publishBufs()
+	}
+}
+
+func (r *URing) dispatch(cqe syscallutil.IoUringCqe) {
+	id, op := cqe.UserData>>8, uint8(cqe.UserData)
+	more := cqe.Flags&syscallutil.IoRingCqeFMore != 0
+
+	r.mu.Lock()
+	file := r.entries[id]
+	if file != nil && !more {
+		r.complete(file, op)
+	}
+	r.mu.Unlock()
+
+	var data []byte
+	if cqe.Flags&syscallutil.IoRingCqeFBuffer != 0 {
+		bid := uint16(cqe.Flags >> syscallutil.IoRingCqeBufferShift)
+		if cqe.Res > 0 {
+			data = r.bufs[int(bid)*uringBufSize : int(bid)*uringBufSize+int(cqe.Res)]
+		}
+		// the data is consumed by the callback before the buffer is published again.
+		defer r.addBuf(bid)
+	}
+
+	if file == nil || file.closing || cqe.Res == -int32(syscall.ECANCELED) {
+		return
+	}
+
+	netFd, err := file.netFd, error(nil)
+	switch op {
+	case uringPollIn:
+		err = r.onPollIn(netFd, cqe.Res)
+	case uringPollOut:
+		if cqe.Res > 0 && netFd.OnWrite != nil {
+			err = netFd.OnWrite()
+		}
+	case uringAccept:
+		if cqe.Res >= 0 {
+			err = netFd.OnAccept(int(cqe.Res))
+		} else {
+			err = syscall.Errno(-cqe.Res)
+		}
+	case uringRecv:
+		err = r.onRecv(netFd, cqe.Res, data)
+	case uringSend:
+		if cqe.Res < 0 {
+			err = r.interrupt(netFd)
+		} else if netFd.OnSent != nil {
+			err = netFd.OnSent(int(cqe.Res))
+		}
+	}
+	if err != nil {
+		log.Errorf("netFD op:%d err:%v", op, err)
+	}
+
+	// the multishot op is terminated by the kernel, e.g. the provided buffers are exhausted.
+	if !more && op == file.readOp {
+		r.mu.Lock()
+		if !r.closed && !file.closing {
+			if err := r.prepRead(file); err != nil {
+				log.Errorf("io_uring rearm op:%d err:%v", op, err)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *URing) onPollIn(netFd *NetFileDesc, res int32) error {
+	if res < 0 || res&(unix.POLLHUP|unix.POLLRDHUP|unix.POLLERR) != 0 {
+		return r.interrupt(netFd)
+	}
+
+	if res&unix.POLLIN != 0 && netFd.OnRead != nil {
+		return netFd.OnRead()
+	}
+	return nil
+}
+
+func (r *URing) onRecv(netFd *NetFileDesc, res int32, data []byte) error {
+	switch {
+	case res > 0:
+		return netFd.OnRecv(data)
+	case res == -int32(syscall.ENOBUFS):
+		// all the provided buffers are in use, the recv will be rearmed.
+		return nil
+	default:
+		// EOF or error
+		return r.interrupt(netFd)
+	}
+}
+
+func (r *URing) interrupt(netFd *NetFileDesc) error {
+	if netFd.OnInterrupt != nil {
+		return netFd.OnInterrupt()
+	}
+	return nil
+}
+
+// complete the final completion of the op is reaped.
+func (r *URing) complete(file *uringFile, op uint8) {
+	switch op {
+	case uringPollOut:
+		file.pollOut = false
+	case uringSend:
+		file.sending, file.iovecs = nil, file.iovecs[:0]
+	}
+
+	file.inflight--
+	if file.closing && file.inflight == 0 {
+		delete(r.entries, file.id)
+	}
+}
+
+// file return the registration of netFd, a new registration is created if netFd is not registered.
+func (r *URing) file(netFd *NetFileDesc) *uringFile {
+	if file, ok := r.files[netFd.FD]; ok {
+		file.netFd = netFd
+		return file
+	}
+
+	r.nextID++
+	file := &uringFile{id: r.nextID, netFd: netFd}
+	r.files[netFd.FD], r.entries[file.id] = file, file
+	return file
+}
+
+func (r *URing) prepRead(file *uringFile) error {
+	sqe, err := r.getSqe()
+	if err != nil {
+		return err
+	}
+
+	sqe.Fd = int32(file.netFd.FD)
+	switch file.readOp {
+	case uringAccept:
+		sqe.Opcode, sqe.Ioprio = syscallutil.IoRingOpAccept, syscallutil.IoRingAcceptMultishot
+		sqe.OpFlags = unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC
+	case uringRecv:
+		sqe.Opcode, sqe.Ioprio = syscallutil.IoRingOpRecv, syscallutil.IoRingRecvMultishot
+		sqe.Flags, sqe.BufIndex = syscallutil.IoSqeBufferSelect, uringBufGroup
+	default:
+		sqe.Opcode, sqe.Len = syscallutil.IoRingOpPollAdd, syscallutil.IoRingPollAddMulti
+		sqe.OpFlags = unix.POLLIN | unix.POLLRDHUP
+	}
+	sqe.UserData = userData(file.id, file.readOp)
+	r.publish(file)
+	return nil
+}
+
+func (r *URing) prepPollOut(file *uringFile) error {
+	sqe, err := r.getSqe()
+	if err != nil {
+		return err
+	}
+
+	sqe.Opcode, sqe.Fd = syscallutil.IoRingOpPollAdd, int32(file.netFd.FD)
+	sqe.OpFlags = unix.POLLOUT
+	sqe.UserData = userData(file.id, uringPollOut)
+	file.pollOut = true
+	r.publish(file)
+	return nil
+}
+
+// prepCancel cancel the pending ops of file by user data.
+// the fd may be closed and reused right after being unregistered, so the ops are not canceled by fd.
+func (r *URing) prepCancel(file *uringFile) error {
+	delete(r.files, file.netFd.FD)
+	file.closing = true
+	ops := []uint8{file.readOp}
+	if file.pollOut {
+		ops = append(ops, uringPollOut)
+	}
+
+	for _, op := range ops {
+		if op == 0 {
+			continue
+		}
+		sqe, err := r.getSqe()
+		if err != nil {
+			return err
+		}
+		sqe.Opcode, sqe.Fd = syscallutil.IoRingOpAsyncCancel, -1
+		sqe.Addr, sqe.OpFlags = userData(file.id, op), syscallutil.IoRingAsyncCancelAll
+		sqe.UserData = userData(file.id, uringCancel)
+		r.publish(file)
+	}
+
+	if file.inflight == 0 {
+		delete(r.entries, file.id)
+	}
+	return nil
+}
+
+// getSqe return a zeroed sqe, the caller must hold the lock.
+func (r *URing) getSqe() (*syscallutil.IoUringSqe, error) {
+	if r.tail-atomic.LoadUint32(r.sqHead) > r.sqMask {
+		// the submission queue is full, submit the pending sqes.
+		if err := r.enterLocked(); err != nil {
+			return nil, err
+		}
+		if r.tail-atomic.LoadUint32(r.sqHead) > r.sqMask {
+			return nil, errors.New("io_uring submission queue is full")
+		}
+	}
+
+	sqe := &r.sqes[r.tail&r.sqMask]
+	*sqe = syscallutil.IoUringSqe{}
+	return sqe, nil
+}
+
+// publish make the sqe got by getSqe visible to the kernel.
+func (r *URing) publish(file *uringFile) {
+	idx := r.tail & r.sqMask
+	r.sqArray[idx] = idx
+	r.tail++
+	atomic.StoreUint32(r.sqTail, r.tail)
+	r.pending++
+	if file != nil {
+		file.inflight++
+	}
+}
+
+// submitLocked submit the pending sqes, they are submitted by the Wait loop when dispatching completions.
+func (r *URing) submitLocked() error {
+	if r.dispatching {
+		return nil
+	}
+	return r.enterLocked()
+}
+
+func (r *URing) enterLocked() error {
+	for r.pending > 0 {
+		n, err := syscallutil.IoUringEnter(r.fd, r.pending, 0, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			// the completion queue is overflowing, the Wait loop will submit them.
+			if err == syscall.EBUSY || err == syscall.EAGAIN {
+				return nil
+			}
+			return err
+		}
+		r.pending -= uint32(n)
+	}
+	return nil
+}
+
+// Close implements Poll.
+func (r *URing) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+
+	r.closed = true
+	if !r.running {
+		r.mu.Unlock()
+		r.release()
+		return nil
+	}
+
+	// wake up the Wait loop, it releases all the resources.
+	sqe, err := r.getSqe()
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	sqe.Opcode, sqe.UserData = syscallutil.IoRingOpNop, uringWakeUserData
+	r.publish(nil)
+	err = r.enterLocked()
+	r.mu.Unlock()
+	return err
+}
+
+// Options implements Poll.
+func (r *URing) Options() Options {
+	return r.options
+}
+
+func (r *URing) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for _, mem := range [][]byte{r.sqesMem, r.bufRing, r.bufs} {
+		if mem != nil {
+			_ = unix.Munmap(mem)
+		}
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		_ = unix.Munmap(r.cqRing)
+	}
+	if r.sqRing != nil {
+		_ = unix.Munmap(r.sqRing)
+	}
+	r.sqesMem, r.bufRing, r.bufs, r.cqRing, r.sqRing = nil, nil, nil, nil, nil
+	if r.fd > 0 {
+		_ = syscall.Close(r.fd)
+		r.fd = -1
+	}
+}
+
+func userData(id uint64, op uint8) uint64 {
+	return id<<8 | uint64(op)
+}
+
+func mmapRing(fd int, offset int64, size int) ([]byte, error) {
+	return unix.Mmap(fd, offset, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+}
+
+func mmapAnon(size int) ([]byte, error) {
+	return unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+}
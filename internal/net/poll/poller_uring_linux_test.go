@@ -0,0 +1,99 @@
+//go:build linux && !race
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestURing(t *testing.T) {
+	uring, err := newURing(newOptions(WithEngine(IOUringEngine)))
+	if err != nil {
+		t.Skipf("io_uring is unavailable:%v", err)
+	}
+	go func() {
+		assert.Nil(t, uring.Wait())
+	}()
+
+	lfd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	assert.Nil(t, err)
+	defer unix.Close(lfd)
+	assert.Nil(t, unix.Bind(lfd, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	assert.Nil(t, unix.Listen(lfd, unix.SOMAXCONN))
+	sa, err := unix.Getsockname(lfd)
+	assert.Nil(t, err)
+
+	interrupted := make(chan struct{})
+	// echo the received data by Submitter
+	assert.Nil(t, uring.Register(&NetFileDesc{
+		FD: lfd,
+		NetPollListener: NetPollListener{
+			OnAccept: func(fd int) error {
+				var connFd *NetFileDesc
+				connFd = &NetFileDesc{
+					FD: fd,
+					NetPollListener: NetPollListener{
+						OnRecv: func(data []byte) error {
+							// the empty buffers are skipped.
+							assert.NotNil(t, uring.Writev(connFd, [][]byte{nil, {}}))
+							data = append([]byte(nil), data...)
+							return uring.Writev(connFd, [][]byte{data[:len(data)/2], nil, data[len(data)/2:]})
+						},
+						OnSent: func(n int) error {
+							return nil
+						},
+						OnInterrupt: func() error {
+							close(interrupted)
+							if err := uring.Register(connFd, DeleteRead); err != nil {
+								return err
+							}
+							return unix.Close(fd)
+						},
+					},
+				}
+				return uring.Register(connFd, Read)
+			},
+		},
+	}, Read))
+
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*unix.SockaddrInet4).Port})
+	assert.Nil(t, err)
+	_, err = conn.Write([]byte("hello knetty"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, len("hello knetty"))
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello knetty", string(buf))
+
+	assert.Nil(t, conn.Close())
+	select {
+	case <-interrupted:
+	case <-time.After(3 * time.Second):
+		t.Fatal("io_uring poller does not report the closed connection")
+	}
+	assert.Nil(t, uring.Close())
+}
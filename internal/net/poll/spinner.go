@@ -0,0 +1,61 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package poll
+
+import (
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// spinner decides whether the event loop blocks in waiting, the event loop keeps polling with zero
+// timeout within the spin budget after the last events are reported, so the events arriving soon
+// are handled without the cost of sleeping and waking up the thread.
+type spinner struct {
+	budget    time.Duration
+	lastEvent time.Time
+	spin      atomic.Int64
+	block     atomic.Int64
+}
+
+func newSpinner(budget time.Duration) *spinner {
+	return &spinner{budget: budget}
+}
+
+// blocking return whether the next waiting should block, it is only called by the event loop.
+func (s *spinner) blocking(now time.Time) bool {
+	return s.budget <= 0 || now.Sub(s.lastEvent) >= s.budget
+}
+
+// waited records the waiting started at start, n is the number of the reported events.
+func (s *spinner) waited(start time.Time, blocking bool, n int) {
+	now := time.Now()
+	if blocking {
+		s.block.Add(int64(now.Sub(start)))
+	} else {
+		s.spin.Add(int64(now.Sub(start)))
+	}
+
+	if n > 0 {
+		s.lastEvent = now
+	}
+}
+
+// stats return the time spent in spinning and blocking.
+func (s *spinner) stats() (spin, block time.Duration) {
+	return time.Duration(s.spin.Load()), time.Duration(s.block.Load())
+}
@@ -18,6 +18,8 @@
 package knetty
 
 import (
+	"time"
+
 	"github.com/Softwarekang/knetty/internal/net/poll"
 	"github.com/Softwarekang/knetty/pkg/log"
 )
@@ -27,7 +29,90 @@ func SetPollerNums(n int) error {
 	return poll.PollerManager.SetPollerNums(n)
 }
 
+// PollerOption option for reactor pollers
+type PollerOption = poll.Option
+
+// WithPollerEdgeTriggered set pollers working in edge-triggered mode,
+// readBudget is the maximum bytes read from a single connection per wakeup, a budget less than 1 means 1 mb.
+func WithPollerEdgeTriggered(readBudget int) PollerOption {
+	return func(opt *poll.Options) {
+		poll.WithTriggerMode(poll.EdgeTriggered)(opt)
+		poll.WithReadBudget(readBudget)(opt)
+	}
+}
+
+// WithPollerIOUring set pollers using io_uring on linux, it falls back to epoll on the kernel without support.
+func WithPollerIOUring() PollerOption {
+	return poll.WithEngine(poll.IOUringEngine)
+}
+
+// WithPollerLockOSThread set each poller goroutine locked to an OS thread.
+func WithPollerLockOSThread() PollerOption {
+	return poll.WithLockOSThread()
+}
+
+// WithPollerCPUs set each poller goroutine locked to an OS thread and bound to a cpu in cpus in turn,
+// it is only supported on linux.
+func WithPollerCPUs(cpus ...int) PollerOption {
+	return poll.WithCPUs(cpus...)
+}
+
+// WithPollerSpin set the pollers keep polling without blocking for budget after the last events,
+// it reduces the latency of wakeup at the cost of cpu.
+func WithPollerSpin(budget time.Duration) PollerOption {
+	return poll.WithSpinBudget(budget)
+}
+
+// WithPollerBusyPoll set SO_BUSY_POLL on the connection sockets, and SO_PREFER_BUSY_POLL if prefer is true,
+// it is only supported on linux.
+func WithPollerBusyPoll(busyPoll time.Duration, prefer bool) PollerOption {
+	return poll.WithBusyPoll(busyPoll, prefer)
+}
+
+// WithPollerAutoFlush set the pollers flush the sessions written in the event loop once at the end of
+// each iteration, the handlers need not call FlushBuffer, and the small packages are sent in one syscall.
+func WithPollerAutoFlush() PollerOption {
+	return poll.WithAutoFlush()
+}
+
+// SetPollerOptions set options for reactor pollers, it must be called before any server or client runs.
+func SetPollerOptions(opts ...PollerOption) error {
+	return poll.PollerManager.SetPollerOptions(opts...)
+}
+
+// PollerStrategy the way to pick a reactor poller for a new connection
+type PollerStrategy = poll.Strategy
+
+const (
+	// PollerRandom pick a poller randomly, it is the default strategy.
+	PollerRandom = poll.Random
+	// PollerRoundRobin pick the pollers in turn.
+	PollerRoundRobin = poll.RoundRobin
+	// PollerLeastConnections pick the poller with the least connections.
+	PollerLeastConnections = poll.LeastConnections
+	// PollerSourceAddrHash pick the poller by the hash of the remote ip.
+	PollerSourceAddrHash = poll.SourceAddrHash
+)
+
+// SetPollerStrategy set the strategy of picking reactor pollers
+func SetPollerStrategy(strategy PollerStrategy) {
+	poll.PollerManager.SetStrategy(strategy)
+}
+
+// PollerStats statistics of a reactor poller
+type PollerStats = poll.Stats
+
+// GetPollerStats return the statistics of all the reactor pollers
+func GetPollerStats() []PollerStats {
+	return poll.PollerManager.Stats()
+}
+
 // SetLogger set custom log
 func SetLogger(logger log.Logger) {
 	log.DefaultLogger = logger
 }
+
+// SetLogLevel set the minimum level of the messages logged by the default logger
+func SetLogLevel(level log.Level) {
+	log.SetLevel(level)
+}
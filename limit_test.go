@@ -0,0 +1,168 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lineCodec splits the data by '\n'.
+type lineCodec struct{}
+
+func (lineCodec) Encode(pkg interface{}) ([]byte, error) {
+	return []byte(pkg.(string) + "\n"), nil
+}
+
+func (lineCodec) Decode(data []byte) (interface{}, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		return nil, 0, nil
+	}
+	return string(data[:idx]), idx + 1, nil
+}
+
+type echoEventListener struct {
+	nopEventListener
+}
+
+func (echoEventListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	_, _ = s.WritePkg(pkg)
+	_ = s.FlushBuffer()
+	return session.Normal
+}
+
+func TestServer_ReadLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ServerOption
+	}{
+		{name: "session bytes", opts: []ServerOption{WithServerSessionReadLimit(Rate{PerSecond: 10000, Burst: 1000}, Rate{})}},
+		{name: "session messages", opts: []ServerOption{WithServerSessionReadLimit(Rate{}, Rate{PerSecond: 10, Burst: 1})}},
+		{name: "server bytes", opts: []ServerOption{WithServerReadLimit(Rate{PerSecond: 10000, Burst: 1000}, Rate{})}},
+		{name: "edge-triggered", opts: []ServerOption{WithServerEventLoops(1, WithPollerEdgeTriggered(0)),
+			WithServerSessionReadLimit(Rate{}, Rate{PerSecond: 10, Burst: 1})}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testReadLimit(t, test.opts...)
+		})
+	}
+}
+
+// testReadLimit the reading is paused for about 200ms after the 3 lines of 3000 bytes are handled,
+// until the tokens taken in advance are refilled.
+func testReadLimit(t *testing.T, opts ...ServerOption) {
+	server := serve(t, append(opts, WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+		s.SetCodec(lineCodec{})
+		s.SetEventListener(echoEventListener{})
+		return nil
+	}))...)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	line := strings.Repeat("a", 999) + "\n"
+	_, err = conn.Write([]byte(line + line + line))
+	assert.Nil(t, err)
+	assert.Nil(t, readN(conn, 3*len(line)))
+
+	_, err = conn.Write([]byte("b\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, readN(conn, 2))
+	assert.Greater(t, time.Since(start), 100*time.Millisecond)
+
+	stats := server.Stats()
+	assert.Equal(t, uint64(4), stats.Sessions.PacketsIn)
+	assert.Greater(t, stats.Sessions.Throttled, 100*time.Millisecond)
+}
+
+// partialCodec notify the data of the half lines decoded.
+type partialCodec struct {
+	lineCodec
+	partial chan int
+}
+
+func (c partialCodec) Decode(data []byte) (interface{}, int, error) {
+	pkg, n, err := c.lineCodec.Decode(data)
+	if pkg == nil && err == nil {
+		select {
+		case c.partial <- len(data):
+		default:
+		}
+	}
+	return pkg, n, err
+}
+
+func TestServer_ReadLimitPartialMessage(t *testing.T) {
+	partial := make(chan int, 1)
+	server := serve(t, WithServerSessionReadLimit(Rate{PerSecond: 10000, Burst: 1000}, Rate{}),
+		WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+			s.SetCodec(partialCodec{partial: partial})
+			s.SetEventListener(echoEventListener{})
+			return nil
+		}))
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// the bytes read from the network are charged before they are decoded, so the reading of the rest of
+	// the line is paused for about 200ms.
+	_, err = conn.Write([]byte(strings.Repeat("a", 3000)))
+	assert.Nil(t, err)
+	for n := 0; n < 3000; {
+		select {
+		case n = <-partial:
+		case <-time.After(3 * time.Second):
+			t.Fatal("the half line is not read")
+		}
+	}
+
+	start := time.Now()
+	_, err = conn.Write([]byte("\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, readN(conn, 3001))
+	assert.Greater(t, time.Since(start), 100*time.Millisecond)
+	assert.Greater(t, server.Stats().Sessions.Throttled, 100*time.Millisecond)
+}
+
+func readN(conn net.Conn, n int) error {
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, n)
+	for read := 0; read < n; {
+		m, err := conn.Read(buf[read:])
+		if err != nil {
+			return err
+		}
+		read += m
+	}
+	return nil
+}
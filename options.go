@@ -17,6 +17,12 @@
 package knetty
 
 import (
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/net/poll"
+	"github.com/Softwarekang/knetty/pkg/ipfilter"
+	"github.com/Softwarekang/knetty/pkg/metrics"
+	"github.com/Softwarekang/knetty/pkg/ratelimit"
 	"github.com/Softwarekang/knetty/session"
 )
 
@@ -34,6 +40,68 @@ type ServerOptions struct {
 	network    string
 	address    string
 	newSession NewSessionCallBackFunc
+	eventLoops loopsOptions
+	// proxyProtocol the accepted connections start with the PROXY protocol header.
+	proxyProtocol bool
+	proxyOptions  []session.ProxyOption
+	metrics       reporterOptions
+	admissionOptions
+	// sessionLimit the limits of reading each session, and serverLimit the limits of all the sessions in aggregate.
+	sessionLimit readLimit
+	serverLimit  readLimit
+}
+
+// DefaultReportInterval the default interval of reporting the metrics.
+const DefaultReportInterval = 10 * time.Second
+
+// reporterOptions the reporter consuming the metrics periodically.
+type reporterOptions struct {
+	reporter metrics.Reporter
+	interval time.Duration
+}
+
+func newReporterOptions(reporter metrics.Reporter, interval time.Duration) reporterOptions {
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	return reporterOptions{reporter: reporter, interval: interval}
+}
+
+// Rate the token bucket rate limit of PerSecond tokens with bursts of Burst tokens at most,
+// the zero PerSecond is unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (r Rate) newLimiter() *ratelimit.Limiter {
+	if r.PerSecond <= 0 {
+		return nil
+	}
+	return ratelimit.New(r.PerSecond, r.Burst)
+}
+
+// readLimit the rate limits of the bytes read and the messages decoded.
+type readLimit struct {
+	bytes    Rate
+	messages Rate
+}
+
+func (l readLimit) newLimiters() session.Limiters {
+	return session.Limiters{Bytes: l.bytes.newLimiter(), Messages: l.messages.newLimiter()}
+}
+
+func (l readLimit) limited() bool {
+	return l.bytes.PerSecond > 0 || l.messages.PerSecond > 0
+}
+
+// loopsOptions the event loops serving a server or client.
+// the group is shared if it is given, otherwise a private group is created when numLoops > 0,
+// or the default group is used.
+type loopsOptions struct {
+	group         *EventLoopGroup
+	numLoops      int
+	pollerOptions []PollerOption
 }
 
 // withServerNetwork set network
@@ -57,6 +125,104 @@ func WithServiceNewSessionCallBackFunc(f NewSessionCallBackFunc) ServerOption {
 	}
 }
 
+// WithServerEventLoopGroup set the shared group serving the server, the server will not shut it down.
+func WithServerEventLoopGroup(group *EventLoopGroup) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.eventLoops.group = group
+	}
+}
+
+// WithServerEventLoops set the server owning a group of n reactor pollers created with opts,
+// the group is shut down together with the server.
+func WithServerEventLoops(n int, opts ...PollerOption) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.eventLoops.numLoops, opt.eventLoops.pollerOptions = n, opts
+	}
+}
+
+// WithServerProxyProtocol set the accepted connections starting with the HAProxy PROXY protocol v1 or v2 header,
+// the header is consumed before the codec of the session, and the addresses of the session are the addresses
+// of the header. the connections from the untrusted sources or without a valid header are closed.
+func WithServerProxyProtocol(opts ...session.ProxyOption) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.proxyProtocol, opt.proxyOptions = true, opts
+	}
+}
+
+// WithServerMetricsReporter set the reporter consuming the metrics of the server every interval,
+// DefaultReportInterval is used if interval is not positive.
+func WithServerMetricsReporter(reporter metrics.Reporter, interval time.Duration) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.metrics = newReporterOptions(reporter, interval)
+	}
+}
+
+// WithServerMaxConns set the max number of the connections served at the same time,
+// the connections accepted beyond it are rejected.
+func WithServerMaxConns(n int) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.maxConns = n
+	}
+}
+
+// WithServerMaxConnsPerIP set the max number of the connections from a remote ip served at the same time,
+// the connections accepted beyond it are rejected.
+func WithServerMaxConnsPerIP(n int) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.maxConnsPerIP = n
+	}
+}
+
+// WithServerAcceptRate set the connections admitted at rate per second with bursts of burst at most,
+// the connections accepted beyond it are rejected.
+func WithServerAcceptRate(rate float64, burst int) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.acceptRate, opt.acceptBurst = rate, burst
+	}
+}
+
+// WithServerOnAccept set the hook deciding by the remote address whether an accepted connection is served,
+// it runs on the event loop before the session of the connection is created.
+func WithServerOnAccept(f AcceptFunc) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.onAccept = f
+	}
+}
+
+// WithServerIPFilter set the filter of the remote ips of the accepted connections, the connections from
+// the denied ips are rejected. the lists of the filter can be updated while the server is running.
+func WithServerIPFilter(f *ipfilter.Filter) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.ipFilter = f
+	}
+}
+
+// WithServerSessionReadLimit set the rate limits of the bytes read and the messages decoded by each session,
+// the reading of the session is paused while it exceeds the limits.
+// the io_uring pollers can not pause the reading, the limits are not enforced by them.
+func WithServerSessionReadLimit(bytes, messages Rate) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.sessionLimit = readLimit{bytes: bytes, messages: messages}
+	}
+}
+
+// WithServerReadLimit set the rate limits of the bytes read and the messages decoded by all the sessions
+// of the server in aggregate, the reading of the sessions exceeding the limits is paused.
+// the io_uring pollers can not pause the reading, the limits are not enforced by them.
+func WithServerReadLimit(bytes, messages Rate) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.serverLimit = readLimit{bytes: bytes, messages: messages}
+	}
+}
+
+// WithServerRejectMode set how the rejected connections are closed, the farewell is written before
+// the graceful close of RejectClose, and ignored by RejectReset.
+func WithServerRejectMode(mode RejectMode, farewell []byte) ServerOption {
+	return func(opt *ServerOptions) {
+		opt.rejectMode, opt.farewell = mode, farewell
+	}
+}
+
 func newDefaultServerOptions() []ServerOption {
 	return []ServerOption{
 		withServerAddress("127.0.0.1:8000"),
@@ -76,6 +242,8 @@ type ClientOptions struct {
 	network    string
 	address    string
 	newSession NewSessionCallBackFunc
+	eventLoops loopsOptions
+	metrics    reporterOptions
 }
 
 // withClientNetwork set network
@@ -99,6 +267,29 @@ func WithClientNewSessionCallBackFunc(f NewSessionCallBackFunc) ClientOption {
 	}
 }
 
+// WithClientEventLoopGroup set the shared group serving the client, the client will not shut it down.
+func WithClientEventLoopGroup(group *EventLoopGroup) ClientOption {
+	return func(opt *ClientOptions) {
+		opt.eventLoops.group = group
+	}
+}
+
+// WithClientEventLoops set the client owning a group of n reactor pollers created with opts,
+// the group is shut down together with the client.
+func WithClientEventLoops(n int, opts ...PollerOption) ClientOption {
+	return func(opt *ClientOptions) {
+		opt.eventLoops.numLoops, opt.eventLoops.pollerOptions = n, opts
+	}
+}
+
+// WithClientMetricsReporter set the reporter consuming the metrics of the client every interval,
+// DefaultReportInterval is used if interval is not positive.
+func WithClientMetricsReporter(reporter metrics.Reporter, interval time.Duration) ClientOption {
+	return func(opt *ClientOptions) {
+		opt.metrics = newReporterOptions(reporter, interval)
+	}
+}
+
 func newDefaultClientOptions() []ClientOption {
 	return []ClientOption{
 		withClientAddress("127.0.0.1:8000"),
@@ -109,3 +300,17 @@ func newDefaultClientOptions() []ClientOption {
 func mergeCustomClientOptions(customClientOptions ...ClientOption) []ClientOption {
 	return append(newDefaultClientOptions(), customClientOptions...)
 }
+
+// newLoops return the event loop group and whether it is owned by the caller.
+func (o loopsOptions) newLoops() (*poll.EventLoopGroup, bool, error) {
+	if o.group != nil {
+		return o.group.loops, false, nil
+	}
+
+	if o.numLoops > 0 {
+		loops, err := poll.NewEventLoopGroup(o.numLoops, o.pollerOptions...)
+		return loops, true, err
+	}
+
+	return poll.PollerManager, false, nil
+}
@@ -85,8 +85,12 @@ func (r *RingBuffer) CopyFromFd(fd int) (int, error) {
 	writeIndex, readIndex := r.index(r.w), r.index(r.r)
 	if writeIndex < readIndex {
 		n, err := unix.Read(fd, r.p[writeIndex:readIndex])
-		if err != nil && (err != unix.EAGAIN && err != unix.EWOULDBLOCK) {
-			return 0, err
+		if err != nil {
+			if err != unix.EAGAIN && err != unix.EWOULDBLOCK {
+				return 0, err
+			}
+			// the syscall returns -1 when the fd is not ready.
+			n = 0
 		}
 
 		r.w += n
@@ -98,8 +102,11 @@ func (r *RingBuffer) CopyFromFd(fd int) (int, error) {
 		r.p[:readIndex],
 	}
 	n, err := syscallutil.Readv(fd, bs)
-	if err != nil && (err != unix.EAGAIN && err != unix.EWOULDBLOCK) {
-		return 0, err
+	if err != nil {
+		if err != unix.EAGAIN && err != unix.EWOULDBLOCK {
+			return 0, err
+		}
+		n = 0
 	}
 
 	r.w += n
@@ -116,8 +123,12 @@ func (r *RingBuffer) WriteToFd(fd int) (int, error) {
 	writeIndex, readIndex := r.index(r.w), r.index(r.r)
 	if readIndex < writeIndex {
 		n, err := unix.Write(fd, r.p[readIndex:writeIndex])
-		if err != nil && (err != unix.EAGAIN && err != unix.EWOULDBLOCK) {
-			return 0, err
+		if err != nil {
+			if err != unix.EAGAIN && err != unix.EWOULDBLOCK {
+				return 0, err
+			}
+			// the syscall returns -1 when the fd is not ready.
+			n = 0
 		}
 		r.r += n
 		return n, nil
@@ -128,8 +139,11 @@ func (r *RingBuffer) WriteToFd(fd int) (int, error) {
 		r.p[:writeIndex],
 	}
 	n, err := syscallutil.Writev(fd, bs)
-	if err != nil && (err != unix.EAGAIN && err != unix.EWOULDBLOCK) {
-		return 0, err
+	if err != nil {
+		if err != unix.EAGAIN && err != unix.EWOULDBLOCK {
+			return 0, err
+		}
+		n = 0
 	}
 	r.r += n
 	return n, nil
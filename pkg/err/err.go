@@ -17,6 +17,10 @@
 // Package err wrapped err for knetty
 package err
 
+import (
+	"net"
+)
+
 // knettyErr wrapped err for net
 type knettyErr interface {
 	error
@@ -42,6 +46,11 @@ func (c *connClosedErr) Error() string {
 	return "net connection is closed"
 }
 
+// Is make errors.Is(ConnClosedErr, net.ErrClosed) true.
+func (c *connClosedErr) Is(target error) bool {
+	return target == net.ErrClosed
+}
+
 type clientClosedErr struct{}
 
 // Error implements error.
@@ -78,3 +87,8 @@ func (e UnKnowNetworkErr) Error() string { return "unKnowErr network " + string(
 type IllegalListenerErr string
 
 func (e IllegalListenerErr) Error() string { return "illegal listener " + string(e) }
+
+// ConnRejectedErr the reason an accepted connection is rejected.
+type ConnRejectedErr string
+
+func (e ConnRejectedErr) Error() string { return "connection rejected: " + string(e) }
@@ -17,6 +17,10 @@
 package err
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,3 +40,35 @@ func TestKnettyError(t *testing.T) {
 	assert.Equal(t, "server has already been closed", serverClosedErrp.Error())
 
 }
+
+// timeoutErr a temporary timeout error like the ones of the net package.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestOpError(t *testing.T) {
+	err := error(&OpError{Op: OpRead, SessionID: 3, LocalAddr: "127.0.0.1:8000", RemoteAddr: "127.0.0.1:9000", Err: syscall.ECONNRESET})
+	assert.Equal(t, "read session 3 127.0.0.1:8000->127.0.0.1:9000: connection reset by peer", err.Error())
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+	assert.True(t, IsOp(err, OpRead))
+	assert.False(t, IsOp(err, OpWrite))
+	assert.False(t, IsTimeout(err))
+	assert.False(t, IsTemporary(err))
+
+	// the wrapped OpError.
+	err = fmt.Errorf("serve: %w", &OpError{Op: OpAccept, LocalAddr: "127.0.0.1:8000", Err: syscall.EMFILE})
+	var opErr *OpError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "accept 127.0.0.1:8000->: too many open files", opErr.Error())
+	assert.True(t, IsTemporary(err))
+
+	err = &OpError{Op: OpDial, RemoteAddr: "127.0.0.1:9000", Err: timeoutErr{}}
+	assert.True(t, err.(*OpError).Timeout())
+	assert.True(t, IsTimeout(fmt.Errorf("connect: %w", err)))
+	assert.False(t, IsTimeout(&OpError{Op: OpDecode, Err: errors.New("malformed")}))
+	assert.False(t, IsTemporary(&OpError{Op: OpDecode, Err: errors.New("malformed")}))
+
+	assert.True(t, errors.Is(&OpError{Op: OpRead, Err: ConnClosedErr}, net.ErrClosed))
+}
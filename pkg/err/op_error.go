@@ -0,0 +1,114 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package err
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// the operations of OpError.
+const (
+	OpAccept = "accept"
+	OpDial   = "dial"
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpDecode = "decode"
+	OpEncode = "encode"
+)
+
+// OpError the error of an operation on a session or a connection, it wraps the cause,
+// so errors.Is and errors.As see through it, e.g. errors.Is(err, syscall.ECONNRESET).
+type OpError struct {
+	// Op the failed operation, e.g. OpRead or OpDecode.
+	Op string
+	// SessionID the id of the connection of the session, 0 if there is no connection yet.
+	SessionID uint64
+	// LocalAddr and RemoteAddr the addresses of the connection, they may be empty.
+	LocalAddr  string
+	RemoteAddr string
+	// Err the cause of the error.
+	Err error
+}
+
+// Error implements error.
+func (e *OpError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	if e.SessionID != 0 {
+		b.WriteString(" session ")
+		b.WriteString(strconv.FormatUint(e.SessionID, 10))
+	}
+	if e.LocalAddr != "" || e.RemoteAddr != "" {
+		b.WriteString(" ")
+		b.WriteString(e.LocalAddr)
+		b.WriteString("->")
+		b.WriteString(e.RemoteAddr)
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap return the cause of the error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout return whether the cause is a timeout, e.g. ETIMEDOUT.
+func (e *OpError) Timeout() bool {
+	return IsTimeout(e.Err)
+}
+
+// Temporary return whether the cause is temporary and the operation may succeed later,
+// e.g. EINTR, EMFILE or EAGAIN.
+func (e *OpError) Temporary() bool {
+	return IsTemporary(e.Err)
+}
+
+// IsTimeout return whether err or one of the errors it wraps is a timeout.
+func IsTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	for err != nil {
+		if errors.As(err, &t) && t.Timeout() {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// IsTemporary return whether err or one of the errors it wraps is temporary.
+func IsTemporary(err error) bool {
+	var t interface{ Temporary() bool }
+	for err != nil {
+		if errors.As(err, &t) && t.Temporary() {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// IsOp return whether err is an OpError of op.
+func IsOp(err error, op string) bool {
+	var opErr *OpError
+	return errors.As(err, &opErr) && opErr.Op == op
+}
@@ -0,0 +1,120 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package ipfilter filter the ips by the CIDR allow and deny lists
+package ipfilter
+
+import (
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Filter matches the ips against the CIDR allow and deny lists of IPv4 and IPv6, the lists can be
+// reloaded at runtime. An ip is allowed if it is not denied and the allow list is empty or contains it.
+type Filter struct {
+	lists atomic.Value
+}
+
+// lists the prefixes of the allow and deny lists.
+type lists struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// New return a filter of the allow and deny lists, the entries are CIDR prefixes like
+// 10.0.0.0/8 and fd00::/8, or single ips.
+func New(allow, deny []string) (*Filter, error) {
+	f := &Filter{}
+	if err := f.Update(allow, deny); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Update replace the allow and deny lists, the lists are kept if any entry is invalid.
+func (f *Filter) Update(allow, deny []string) error {
+	allowPrefixes, err := parsePrefixes(allow)
+	if err != nil {
+		return err
+	}
+	denyPrefixes, err := parsePrefixes(deny)
+	if err != nil {
+		return err
+	}
+
+	f.lists.Store(&lists{allow: allowPrefixes, deny: denyPrefixes})
+	return nil
+}
+
+// Allowed report whether ip is allowed, the IPv4-mapped IPv6 addresses are matched as IPv4.
+func (f *Filter) Allowed(ip netip.Addr) bool {
+	l, _ := f.lists.Load().(*lists)
+	if l == nil {
+		return true
+	}
+
+	ip = ip.Unmap().WithZone("")
+	if contains(l.deny, ip) {
+		return false
+	}
+	return len(l.allow) == 0 || contains(l.allow, ip)
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := parsePrefix(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if !strings.Contains(entry, "/") {
+		ip, err := netip.ParseAddr(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		ip = ip.Unmap()
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	// an IPv4-mapped IPv6 prefix covering the IPv4 space is matched as IPv4.
+	if ip := prefix.Addr(); ip.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(ip.Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
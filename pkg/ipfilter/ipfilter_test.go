@@ -0,0 +1,60 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ipfilter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Allowed(t *testing.T) {
+	f, err := New(nil, nil)
+	assert.Nil(t, err)
+	assert.True(t, f.Allowed(netip.MustParseAddr("1.2.3.4")))
+
+	f, err = New([]string{"10.0.0.0/8", "2001:db8::/32", " 192.168.1.1 "}, []string{"10.1.0.0/16", "::ffff:10.2.0.0/112"})
+	assert.Nil(t, err)
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"10.1.2.3", false},
+		{"10.2.2.3", false},
+		{"11.0.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"2001:db8::1", true},
+		{"2001:db8::1%eth0", true},
+		{"2001:db9::1", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.allowed, f.Allowed(netip.MustParseAddr(test.ip)), test.ip)
+	}
+
+	// the lists are kept if the update fails.
+	assert.NotNil(t, f.Update(nil, []string{"10.0.0.0/33"}))
+	assert.NotNil(t, f.Update([]string{"localhost"}, nil))
+	assert.True(t, f.Allowed(netip.MustParseAddr("10.0.0.1")))
+
+	assert.Nil(t, f.Update(nil, []string{"::/0"}))
+	assert.True(t, f.Allowed(netip.MustParseAddr("11.0.0.1")))
+	assert.False(t, f.Allowed(netip.MustParseAddr("2001:db9::1")))
+}
@@ -17,51 +17,69 @@
 package log
 
 import (
+	"io"
 	"log"
 	"os"
+	"strings"
+
+	"go.uber.org/atomic"
 )
 
 // newDefaultLogger returns a Logger which will write log messages to stdout, and
 // use same formatting runes as the stdlib log.Logger
 func newDefaultLogger() Logger {
-	return &defaultLogger{
-		logger: log.New(os.Stdout, "", log.LstdFlags),
-	}
+	return New(os.Stdout, InfoLevel)
 }
 
-// A defaultLogger provides a minimalistic logger satisfying the Logger interface.
-type defaultLogger struct {
-	logger *log.Logger
+// New return a FieldLogger writing the messages of level and above to w, in the format of
+// the stdlib log.Logger followed by the level, the message and the fields as key=value.
+func New(w io.Writer, level Level) FieldLogger {
+	h := &defaultHandler{logger: log.New(w, "", log.LstdFlags), level: atomic.NewInt32(int32(level))}
+	return &defaultLogger{fieldLogger: fieldLogger{handler: h}, handler: h}
 }
 
-func (l defaultLogger) Errorf(format string, args ...interface{}) {
-	log.Printf(format, args...)
-}
-
-func (l defaultLogger) Fatalf(format string, args ...interface{}) {
-	log.Fatalf(format, args...)
+// A defaultLogger provides a minimalistic logger satisfying the FieldLogger interface.
+type defaultLogger struct {
+	fieldLogger
+	handler *defaultHandler
 }
 
-func (l defaultLogger) Fatal(args ...interface{}) {
-	log.Fatal(args...)
+// SetLevel set the minimum level of the logged messages, the loggers derived by With share the level.
+func (l *defaultLogger) SetLevel(level Level) {
+	l.handler.level.Store(int32(level))
 }
 
-func (l defaultLogger) Infof(format string, args ...interface{}) {
-	log.Printf(format, args...)
+func (l *defaultLogger) With(fields ...Field) FieldLogger {
+	if len(fields) == 0 {
+		return l
+	}
+	h := l.handler.WithFields(fields).(*defaultHandler)
+	return &defaultLogger{fieldLogger: fieldLogger{handler: h}, handler: h}
 }
 
-func (l defaultLogger) Info(args ...interface{}) {
-	log.Print(args...)
+// defaultHandler writes the messages by the stdlib log.Logger.
+type defaultHandler struct {
+	logger *log.Logger
+	level  *atomic.Int32
+	fields []Field
 }
 
-func (l defaultLogger) Warnf(format string, args ...interface{}) {
-	log.Printf(format, args...)
+func (h *defaultHandler) Enabled(level Level) bool {
+	return level >= Level(h.level.Load())
 }
 
-func (l defaultLogger) Debugf(format string, args ...interface{}) {
-	log.Printf(format, args...)
+func (h *defaultHandler) Handle(level Level, msg string, fields []Field) {
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	b.WriteString(msg)
+	appendFields(&b, h.fields)
+	appendFields(&b, fields)
+	// the caller of the FieldLogger methods.
+	_ = h.logger.Output(4, b.String())
 }
 
-func (l defaultLogger) Debug(args ...interface{}) {
-	log.Print(args...)
+func (h *defaultHandler) WithFields(fields []Field) Handler {
+	return &defaultHandler{logger: h.logger, level: h.level, fields: concatFields(h.fields, fields)}
 }
@@ -16,6 +16,12 @@
 
 package log
 
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
 var (
 	DefaultLogger Logger
 )
@@ -37,34 +43,280 @@ type Logger interface {
 	Debug(args ...interface{})
 }
 
+// Level the severity of a message.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// String return the upper case name of the level.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	case FatalLevel:
+		return "FATAL"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// Field a key-value pair attached to a message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Any return a field of key and value.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err return a field of the error keyed "error".
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// FieldLogger a structured and leveled Logger, the messages carry key-value fields and the ones below
+// the enabled level are dropped.
+type FieldLogger interface {
+	Logger
+	// Enabled return whether the messages of level are logged
+	Enabled(level Level) bool
+	// Log the message of level with fields, the message of FatalLevel exits the process
+	Log(level Level, msg string, fields ...Field)
+	// With return a logger adding fields to all its messages
+	With(fields ...Field) FieldLogger
+}
+
+// Handler the backend of FieldLogger, e.g. an adapter of the logging libraries.
+type Handler interface {
+	// Enabled return whether the messages of level are handled
+	Enabled(level Level) bool
+	// Handle the message of level with fields, it is called only if the level is enabled
+	Handle(level Level, msg string, fields []Field)
+	// WithFields return a handler adding fields to all its messages
+	WithFields(fields []Field) Handler
+}
+
+// NewFieldLogger return a FieldLogger logging the messages by h.
+func NewFieldLogger(h Handler) FieldLogger {
+	return &fieldLogger{handler: h}
+}
+
+// Structured return l if it is a FieldLogger, otherwise a FieldLogger logging by l,
+// the fields are appended to the messages as key=value.
+func Structured(l Logger) FieldLogger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl
+	}
+	return NewFieldLogger(&loggerHandler{logger: l})
+}
+
+// LevelFilter return a handler dropping the messages of h below level.
+func LevelFilter(h Handler, level Level) Handler {
+	return &levelFilter{Handler: h, level: level}
+}
+
+// SetLevel set the minimum level of the messages logged by the default logger, it takes no effect
+// if DefaultLogger is replaced by a logger without SetLevel(Level).
+func SetLevel(level Level) {
+	if l, ok := DefaultLogger.(interface{ SetLevel(Level) }); ok {
+		l.SetLevel(level)
+	}
+}
+
+// With return a FieldLogger of DefaultLogger adding fields to all its messages.
+func With(fields ...Field) FieldLogger {
+	return Structured(DefaultLogger).With(fields...)
+}
+
+// Log the message of level with fields by DefaultLogger.
+func Log(level Level, msg string, fields ...Field) {
+	Structured(DefaultLogger).Log(level, msg, fields...)
+}
+
 func Errorf(format string, args ...interface{}) {
-	DefaultLogger.Errorf(format, args)
+	DefaultLogger.Errorf(format, args...)
 }
 
 func Fatalf(format string, args ...interface{}) {
-	DefaultLogger.Fatalf(format, args)
+	DefaultLogger.Fatalf(format, args...)
 }
 
 func Fatal(args ...interface{}) {
-	DefaultLogger.Fatal(args)
+	DefaultLogger.Fatal(args...)
 }
 
 func Infof(format string, args ...interface{}) {
-	DefaultLogger.Infof(format, args)
+	DefaultLogger.Infof(format, args...)
 }
 
 func Info(args ...interface{}) {
-	DefaultLogger.Info(args)
+	DefaultLogger.Info(args...)
 }
 
 func Warnf(format string, args ...interface{}) {
-	DefaultLogger.Warnf(format, args)
+	DefaultLogger.Warnf(format, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	DefaultLogger.Debugf(format, args)
+	DefaultLogger.Debugf(format, args...)
 }
 
 func Debug(args ...interface{}) {
-	DefaultLogger.Debug(args)
+	DefaultLogger.Debug(args...)
+}
+
+// fieldLogger implements FieldLogger by a Handler.
+type fieldLogger struct {
+	handler Handler
+}
+
+func (l *fieldLogger) Enabled(level Level) bool {
+	return l.handler.Enabled(level)
+}
+
+func (l *fieldLogger) Log(level Level, msg string, fields ...Field) {
+	l.handle(level, msg, fields)
+	if level >= FatalLevel {
+		os.Exit(1)
+	}
+}
+
+func (l *fieldLogger) With(fields ...Field) FieldLogger {
+	if len(fields) == 0 {
+		return l
+	}
+	return &fieldLogger{handler: l.handler.WithFields(fields)}
+}
+
+// handle, logf and log keep the same depth of the caller for the handlers reporting it.
+func (l *fieldLogger) handle(level Level, msg string, fields []Field) {
+	if l.handler.Enabled(level) {
+		l.handler.Handle(level, msg, fields)
+	}
+}
+
+func (l *fieldLogger) logf(level Level, format string, args []interface{}) {
+	if l.handler.Enabled(level) {
+		l.handler.Handle(level, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (l *fieldLogger) log(level Level, args []interface{}) {
+	if l.handler.Enabled(level) {
+		l.handler.Handle(level, fmt.Sprint(args...), nil)
+	}
+}
+
+func (l *fieldLogger) Errorf(format string, args ...interface{}) {
+	l.logf(ErrorLevel, format, args)
+}
+
+func (l *fieldLogger) Fatalf(format string, args ...interface{}) {
+	l.logf(FatalLevel, format, args)
+	os.Exit(1)
+}
+
+func (l *fieldLogger) Fatal(args ...interface{}) {
+	l.log(FatalLevel, args)
+	os.Exit(1)
+}
+
+func (l *fieldLogger) Infof(format string, args ...interface{}) {
+	l.logf(InfoLevel, format, args)
+}
+
+func (l *fieldLogger) Info(args ...interface{}) {
+	l.log(InfoLevel, args)
+}
+
+func (l *fieldLogger) Warnf(format string, args ...interface{}) {
+	l.logf(WarnLevel, format, args)
+}
+
+func (l *fieldLogger) Debugf(format string, args ...interface{}) {
+	l.logf(DebugLevel, format, args)
+}
+
+func (l *fieldLogger) Debug(args ...interface{}) {
+	l.log(DebugLevel, args)
+}
+
+// loggerHandler adapts a Logger to Handler, the levels are filtered by the logger itself.
+type loggerHandler struct {
+	logger Logger
+	fields []Field
+}
+
+func (h *loggerHandler) Enabled(Level) bool {
+	return true
+}
+
+func (h *loggerHandler) Handle(level Level, msg string, fields []Field) {
+	var b strings.Builder
+	b.WriteString(msg)
+	appendFields(&b, h.fields)
+	appendFields(&b, fields)
+	switch level {
+	case DebugLevel:
+		h.logger.Debugf("%s", b.String())
+	case InfoLevel:
+		h.logger.Infof("%s", b.String())
+	case WarnLevel:
+		h.logger.Warnf("%s", b.String())
+	default:
+		// the fatal message is logged as an error, the process exits by the FieldLogger.
+		h.logger.Errorf("%s", b.String())
+	}
+}
+
+func (h *loggerHandler) WithFields(fields []Field) Handler {
+	return &loggerHandler{logger: h.logger, fields: concatFields(h.fields, fields)}
+}
+
+// levelFilter drops the messages below level.
+type levelFilter struct {
+	Handler
+	level Level
+}
+
+func (f *levelFilter) Enabled(level Level) bool {
+	return level >= f.level && f.Handler.Enabled(level)
+}
+
+func (f *levelFilter) WithFields(fields []Field) Handler {
+	return &levelFilter{Handler: f.Handler.WithFields(fields), level: f.level}
+}
+
+// concatFields return a new slice of a followed by b.
+func concatFields(a, b []Field) []Field {
+	fields := make([]Field, 0, len(a)+len(b))
+	return append(append(fields, a...), b...)
+}
+
+// appendFields append the fields as " key=value", the values containing spaces, quotes or '=' are quoted.
+func appendFields(b *strings.Builder, fields []Field) {
+	for _, field := range fields {
+		b.WriteByte(' ')
+		b.WriteString(field.Key)
+		b.WriteByte('=')
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		b.WriteString(value)
+	}
 }
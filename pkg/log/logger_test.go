@@ -0,0 +1,102 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogger records the messages of a plain Logger.
+type recordLogger struct {
+	messages []string
+}
+
+func (r *recordLogger) record(level, format string, args ...interface{}) {
+	r.messages = append(r.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordLogger) Errorf(format string, args ...interface{}) { r.record("error", format, args...) }
+func (r *recordLogger) Fatalf(format string, args ...interface{}) { r.record("fatal", format, args...) }
+func (r *recordLogger) Fatal(args ...interface{})                 { r.record("fatal", fmt.Sprint(args...)) }
+func (r *recordLogger) Infof(format string, args ...interface{})  { r.record("info", format, args...) }
+func (r *recordLogger) Info(args ...interface{})                  { r.record("info", fmt.Sprint(args...)) }
+func (r *recordLogger) Warnf(format string, args ...interface{})  { r.record("warn", format, args...) }
+func (r *recordLogger) Debugf(format string, args ...interface{}) { r.record("debug", format, args...) }
+func (r *recordLogger) Debug(args ...interface{})                 { r.record("debug", fmt.Sprint(args...)) }
+
+func withDefaultLogger(t *testing.T, logger Logger) {
+	previous := DefaultLogger
+	DefaultLogger = logger
+	t.Cleanup(func() {
+		DefaultLogger = previous
+	})
+}
+
+func TestHelpers(t *testing.T) {
+	recorder := &recordLogger{}
+	withDefaultLogger(t, recorder)
+
+	Errorf("%s:%d", "conn", 1)
+	Infof("%s:%d", "conn", 2)
+	Warnf("%s:%d", "conn", 3)
+	Debugf("%s:%d", "conn", 4)
+	Log(WarnLevel, "closed", Any("conn_id", 5), Err(errors.New("reset by peer")))
+	With(Any("addr", "127.0.0.1:8000")).Infof("accepted")
+	assert.Equal(t, []string{
+		"error conn:1",
+		"info conn:2",
+		"warn conn:3",
+		"debug conn:4",
+		`warn closed conn_id=5 error="reset by peer"`,
+		"info accepted addr=127.0.0.1:8000",
+	}, recorder.messages)
+}
+
+func TestDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, InfoLevel)
+	withDefaultLogger(t, logger)
+
+	logger.Debugf("dropped %d", 1)
+	logger.With(Any("conn_id", 1)).Log(InfoLevel, "connected", Any("addr", "127.0.0.1:8000"))
+	assert.Contains(t, buf.String(), "[INFO] connected conn_id=1 addr=127.0.0.1:8000\n")
+	assert.NotContains(t, buf.String(), "dropped")
+
+	// the level is shared by the derived loggers.
+	derived := logger.With(Any("conn_id", 2))
+	SetLevel(ErrorLevel)
+	assert.False(t, derived.Enabled(WarnLevel))
+	derived.Warnf("dropped")
+	derived.Errorf("failed %s", "write")
+	assert.Contains(t, buf.String(), "[ERROR] failed write conn_id=2\n")
+	assert.NotContains(t, buf.String(), "dropped")
+}
+
+func TestLevelFilter(t *testing.T) {
+	recorder := &recordLogger{}
+	logger := NewFieldLogger(LevelFilter(&loggerHandler{logger: recorder}, WarnLevel)).With(Any("k", "a b"))
+	logger.Info("dropped")
+	logger.Warnf("kept")
+	logger.Log(ErrorLevel, "kept", Any("empty", ""))
+	assert.Equal(t, []string{`warn kept k="a b"`, `error kept k="a b" empty=""`}, recorder.messages)
+	assert.Equal(t, "WARN", WarnLevel.String())
+}
@@ -0,0 +1,74 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package logruslog adapts the logrus logger to the knetty FieldLogger.
+package logruslog
+
+import (
+	"github.com/Softwarekang/knetty/pkg/log"
+
+	"github.com/sirupsen/logrus"
+)
+
+// New return a FieldLogger logging the messages by l.
+func New(l *logrus.Logger) log.FieldLogger {
+	return log.NewFieldLogger(NewHandler(logrus.NewEntry(l)))
+}
+
+// NewHandler return a Handler logging the messages by entry, the fields of entry are kept.
+func NewHandler(entry *logrus.Entry) log.Handler {
+	return &handler{entry: entry}
+}
+
+type handler struct {
+	entry *logrus.Entry
+}
+
+func (h *handler) Enabled(level log.Level) bool {
+	return h.entry.Logger.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *handler) Handle(level log.Level, msg string, fields []log.Field) {
+	// the fatal message is logged without exiting, the process exits by the FieldLogger.
+	h.entry.WithFields(logrusFields(fields)).Log(logrusLevel(level), msg)
+}
+
+func (h *handler) WithFields(fields []log.Field) log.Handler {
+	return &handler{entry: h.entry.WithFields(logrusFields(fields))}
+}
+
+func logrusLevel(level log.Level) logrus.Level {
+	switch level {
+	case log.DebugLevel:
+		return logrus.DebugLevel
+	case log.InfoLevel:
+		return logrus.InfoLevel
+	case log.WarnLevel:
+		return logrus.WarnLevel
+	case log.ErrorLevel:
+		return logrus.ErrorLevel
+	default:
+		return logrus.FatalLevel
+	}
+}
+
+func logrusFields(fields []log.Field) logrus.Fields {
+	logrusFields := make(logrus.Fields, len(fields))
+	for _, field := range fields {
+		logrusFields[field.Key] = field.Value
+	}
+	return logrusFields
+}
@@ -0,0 +1,46 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package logruslog
+
+import (
+	"testing"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	l.SetLevel(logrus.InfoLevel)
+	logger := New(l)
+
+	logger.Debugf("dropped")
+	logger.With(log.Any("conn_id", 1)).Log(log.WarnLevel, "closed", log.Any("addr", "127.0.0.1:8000"))
+	logger.Errorf("write %s", "failed")
+	assert.False(t, logger.Enabled(log.DebugLevel))
+
+	if assert.Len(t, hook.AllEntries(), 2) {
+		entry := hook.AllEntries()[0]
+		assert.Equal(t, logrus.WarnLevel, entry.Level)
+		assert.Equal(t, "closed", entry.Message)
+		assert.Equal(t, logrus.Fields{"conn_id": 1, "addr": "127.0.0.1:8000"}, entry.Data)
+		assert.Equal(t, "write failed", hook.LastEntry().Message)
+	}
+}
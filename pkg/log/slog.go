@@ -0,0 +1,74 @@
+//go:build go1.21
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogHandler return a Handler logging the messages by l, FatalLevel is mapped to slog.LevelError+4.
+func NewSlogHandler(l *slog.Logger) Handler {
+	return &slogHandler{logger: l}
+}
+
+// slogHandler adapts slog.Logger to Handler.
+type slogHandler struct {
+	logger *slog.Logger
+}
+
+func (h *slogHandler) Enabled(level Level) bool {
+	return h.logger.Enabled(context.Background(), slogLevel(level))
+}
+
+func (h *slogHandler) Handle(level Level, msg string, fields []Field) {
+	h.logger.LogAttrs(context.Background(), slogLevel(level), msg, slogAttrs(fields)...)
+}
+
+func (h *slogHandler) WithFields(fields []Field) Handler {
+	attrs := slogAttrs(fields)
+	args := make([]interface{}, len(attrs))
+	for i, attr := range attrs {
+		args[i] = attr
+	}
+	return &slogHandler{logger: h.logger.With(args...)}
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
+func slogAttrs(fields []Field) []slog.Attr {
+	attrs := make([]slog.Attr, len(fields))
+	for i, field := range fields {
+		attrs[i] = slog.Any(field.Key, field.Value)
+	}
+	return attrs
+}
@@ -0,0 +1,38 @@
+//go:build go1.21
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewFieldLogger(NewSlogHandler(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))))
+
+	logger.Debugf("dropped")
+	logger.With(Any("conn_id", 1)).Log(WarnLevel, "closed", Any("addr", "127.0.0.1:8000"))
+	assert.False(t, logger.Enabled(DebugLevel))
+	assert.NotContains(t, buf.String(), "dropped")
+	assert.Contains(t, buf.String(), `level=WARN msg=closed conn_id=1 addr=127.0.0.1:8000`)
+}
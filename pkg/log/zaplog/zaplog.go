@@ -0,0 +1,77 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package zaplog adapts the zap logger to the knetty FieldLogger.
+package zaplog
+
+import (
+	"github.com/Softwarekang/knetty/pkg/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New return a FieldLogger logging the messages by l.
+func New(l *zap.Logger) log.FieldLogger {
+	return log.NewFieldLogger(NewHandler(l))
+}
+
+// NewHandler return a Handler logging the messages by l.
+func NewHandler(l *zap.Logger) log.Handler {
+	// the caller of the knetty logger is reported instead of the adapter.
+	return &handler{logger: l.WithOptions(zap.AddCallerSkip(3))}
+}
+
+type handler struct {
+	logger *zap.Logger
+}
+
+func (h *handler) Enabled(level log.Level) bool {
+	return h.logger.Core().Enabled(zapLevel(level))
+}
+
+func (h *handler) Handle(level log.Level, msg string, fields []log.Field) {
+	if ce := h.logger.Check(zapLevel(level), msg); ce != nil {
+		ce.Write(zapFields(fields)...)
+	}
+}
+
+func (h *handler) WithFields(fields []log.Field) log.Handler {
+	return &handler{logger: h.logger.With(zapFields(fields)...)}
+}
+
+func zapLevel(level log.Level) zapcore.Level {
+	switch level {
+	case log.DebugLevel:
+		return zapcore.DebugLevel
+	case log.InfoLevel:
+		return zapcore.InfoLevel
+	case log.WarnLevel:
+		return zapcore.WarnLevel
+	case log.ErrorLevel:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.FatalLevel
+	}
+}
+
+func zapFields(fields []log.Field) []zap.Field {
+	zapFields := make([]zap.Field, len(fields))
+	for i, field := range fields {
+		zapFields[i] = zap.Any(field.Key, field.Value)
+	}
+	return zapFields
+}
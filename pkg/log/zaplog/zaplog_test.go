@@ -0,0 +1,47 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package zaplog
+
+import (
+	"testing"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := New(zap.New(core))
+
+	logger.Debugf("dropped")
+	logger.With(log.Any("conn_id", 1)).Log(log.WarnLevel, "closed", log.Any("addr", "127.0.0.1:8000"))
+	logger.Errorf("write %s", "failed")
+	assert.False(t, logger.Enabled(log.DebugLevel))
+
+	entries := logs.AllUntimed()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+		assert.Equal(t, "closed", entries[0].Message)
+		assert.Equal(t, map[string]interface{}{"conn_id": int64(1), "addr": "127.0.0.1:8000"}, entries[0].ContextMap())
+		assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+		assert.Equal(t, "write failed", entries[1].Message)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package metrics define the samples of the runtime statistics, the collectors producing them,
+// the reporters consuming them and the Prometheus text exposition of them.
+package metrics
+
+import (
+	"time"
+)
+
+// Kind the kind of a sample.
+type Kind int
+
+const (
+	// Counter a value that only goes up.
+	Counter Kind = iota
+	// Gauge a value that can go up and down.
+	Gauge
+)
+
+// String return the Prometheus type name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	default:
+		return "untyped"
+	}
+}
+
+// Label a name value pair identifying a sample among the ones with the same name.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample a value of a metric at the time of collecting.
+type Sample struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels []Label
+	Value  float64
+}
+
+// Collector produces the samples of its current statistics.
+type Collector interface {
+	// Collect return the samples, it is safe to be called concurrently.
+	Collect() []Sample
+}
+
+// CollectorFunc adapts a function to Collector.
+type CollectorFunc func() []Sample
+
+// Collect implements Collector.
+func (f CollectorFunc) Collect() []Sample {
+	return f()
+}
+
+// Reporter consumes the samples collected periodically, e.g. pushes them to a monitoring system.
+type Reporter interface {
+	// Report the samples collected at the same time.
+	Report(samples []Sample) error
+}
+
+// ReporterFunc adapts a function to Reporter.
+type ReporterFunc func(samples []Sample) error
+
+// Report implements Reporter.
+func (f ReporterFunc) Report(samples []Sample) error {
+	return f(samples)
+}
+
+// WithLabels return a collector adding labels to the samples of c, e.g. to tell the servers apart.
+func WithLabels(c Collector, labels ...Label) Collector {
+	return CollectorFunc(func() []Sample {
+		samples := c.Collect()
+		for i := range samples {
+			samples[i].Labels = append(append([]Label(nil), labels...), samples[i].Labels...)
+		}
+		return samples
+	})
+}
+
+// Gather return the samples of all the collectors.
+func Gather(collectors ...Collector) []Sample {
+	var samples []Sample
+	for _, c := range collectors {
+		samples = append(samples, c.Collect()...)
+	}
+	return samples
+}
+
+// Report collect the samples of c and report them to r every interval until done is closed.
+// the errors of the reporter are passed to onError if it is not nil.
+func Report(r Reporter, c Collector, interval time.Duration, done <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := r.Report(c.Collect()); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
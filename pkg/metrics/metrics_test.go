@@ -0,0 +1,191 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty"
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/pkg/metrics"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lineCodec splits the data by '\n', the line "bad" can not be decoded.
+type lineCodec struct {
+	knettytest.LineCodec
+}
+
+func (c lineCodec) Decode(data []byte) (interface{}, int, error) {
+	if bytes.HasPrefix(data, []byte("bad\n")) {
+		return nil, 0, errors.New("bad line")
+	}
+	return c.LineCodec.Decode(data)
+}
+
+// notifyListener notify the messages received.
+type notifyListener struct {
+	messages chan struct{}
+}
+
+func (notifyListener) OnConnect(session.Session) {}
+
+func (l notifyListener) OnMessage(session.Session, interface{}) session.ExecStatus {
+	l.messages <- struct{}{}
+	return session.Normal
+}
+
+func (notifyListener) OnError(session.Session, error) {}
+
+func (notifyListener) OnClose(session.Session) {}
+
+func TestStats(t *testing.T) {
+	// the samples are reported in order until the test ends.
+	reported, done := make(chan []metrics.Sample), make(chan struct{})
+	defer close(done)
+	server := knettytest.Serve(t, func(s session.Session) error {
+		s.SetCodec(lineCodec{})
+		s.SetEventListener(knettytest.EchoListener{})
+		return nil
+	}, knetty.WithServerEventLoops(1),
+		knetty.WithServerMetricsReporter(metrics.ReporterFunc(func(samples []metrics.Sample) error {
+			select {
+			case reported <- samples:
+			case <-done:
+			}
+			return nil
+		}), 10*time.Millisecond))
+	addr := server.Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// the echoed lines are read back before the bad line closes the session.
+	_, err = conn.Write([]byte("hello\nknetty\n"))
+	assert.Nil(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 13)
+	for n := 0; n < len(buf); {
+		m, err := conn.Read(buf[n:])
+		if !assert.Nil(t, err) {
+			return
+		}
+		n += m
+	}
+	assert.Equal(t, "hello\nknetty\n", string(buf))
+
+	stats := server.Stats()
+	assert.Equal(t, 1, stats.ActiveSessions)
+	assert.Equal(t, uint64(1), stats.Accepts)
+	assert.Equal(t, uint64(13), stats.Sessions.BytesIn)
+	assert.Equal(t, uint64(13), stats.Sessions.BytesOut)
+	assert.Equal(t, uint64(2), stats.Sessions.PacketsIn)
+	assert.Equal(t, uint64(2), stats.Sessions.PacketsOut)
+	assert.Equal(t, 0, stats.Sessions.OutputBuffered)
+	if assert.Len(t, stats.Pollers, 1) {
+		assert.NotZero(t, stats.Pollers[0].Events)
+	}
+
+	_, err = conn.Write([]byte("bad\n"))
+	assert.Nil(t, err)
+	_, err = conn.Read(buf)
+	assert.NotNil(t, err)
+	assert.Nil(t, conn.Close())
+
+	// the statistics of the closed session are kept, the samples collected before the close are skipped.
+	<-reported
+	timeout := time.After(3 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case samples := <-reported:
+			if !assert.Equal(t, "knetty_server_active_sessions", samples[0].Name) {
+				return
+			}
+			closed = samples[0].Value == 0
+		case <-timeout:
+			t.Fatal("the closed session is not reported")
+		}
+	}
+	stats = server.Stats()
+	assert.Equal(t, 0, stats.ActiveSessions)
+	assert.Equal(t, uint64(17), stats.Sessions.BytesIn)
+	assert.Equal(t, uint64(1), stats.Sessions.DecodeErrors)
+
+	var exposition bytes.Buffer
+	assert.Nil(t, metrics.WritePrometheus(&exposition, server.Collect()))
+	assert.Contains(t, exposition.String(), `knetty_server_accepts_total{address="`+addr+`"} 1`)
+	assert.Contains(t, exposition.String(), `knetty_session_decode_errors_total{address="`+addr+`"} 1`)
+	assert.Contains(t, exposition.String(), `knetty_poller_events_total{address="`+addr+`",poller="0"}`)
+}
+
+func TestClientStats(t *testing.T) {
+	lsr, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer lsr.Close()
+	// the connection is kept open until the test ends.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := lsr.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		_, _ = conn.Write(buf[:n])
+		<-done
+	}()
+
+	messages := make(chan struct{}, 1)
+	client := knetty.NewClient("tcp", lsr.Addr().String(), knetty.WithClientNewSessionCallBackFunc(func(s session.Session) error {
+		s.SetCodec(lineCodec{})
+		s.SetEventListener(notifyListener{messages: messages})
+		return nil
+	}))
+	defer client.Shutdown(context.Background())
+	s, err := client.Connect()
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = s.WritePkg("ping")
+	assert.Nil(t, err)
+	assert.Nil(t, s.FlushBuffer())
+
+	select {
+	case <-messages:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the echoed message is not received")
+	}
+	stats := client.Stats()
+	assert.Equal(t, uint64(5), stats.Session.BytesIn)
+	assert.Equal(t, uint64(5), stats.Session.BytesOut)
+	assert.Equal(t, uint64(1), stats.Session.PacketsIn)
+	assert.Equal(t, uint64(1), stats.Session.PacketsOut)
+	assert.Equal(t, lsr.Addr().String(), client.Collect()[0].Labels[0].Value)
+}
@@ -0,0 +1,133 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusContentType the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prometheus exposes the samples in the Prometheus text exposition format, the samples are
+// collected from the registered collectors on each scrape, together with the latest reported ones.
+type Prometheus struct {
+	mu         sync.RWMutex
+	collectors []Collector
+	reported   []Sample
+}
+
+// NewPrometheus return a Prometheus exposing the samples of collectors.
+func NewPrometheus(collectors ...Collector) *Prometheus {
+	return &Prometheus{collectors: collectors}
+}
+
+// Register add a collector whose samples are exposed.
+func (p *Prometheus) Register(c Collector) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.collectors = append(p.collectors, c)
+}
+
+// Report implements Reporter, the samples replace the ones reported before.
+func (p *Prometheus) Report(samples []Sample) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reported = samples
+	return nil
+}
+
+// Gather return the latest reported samples and the samples of the registered collectors.
+func (p *Prometheus) Gather() []Sample {
+	p.mu.RLock()
+	collectors, reported := p.collectors, p.reported
+	p.mu.RUnlock()
+	return append(append([]Sample(nil), reported...), Gather(collectors...)...)
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", PrometheusContentType)
+	_ = WritePrometheus(w, p.Gather())
+}
+
+// WritePrometheus write the samples to w in the Prometheus text exposition format,
+// the samples with the same name are written together after their HELP and TYPE lines.
+func WritePrometheus(w io.Writer, samples []Sample) error {
+	var names []string
+	groups := make(map[string][]Sample)
+	for _, sample := range samples {
+		if _, ok := groups[sample.Name]; !ok {
+			names = append(names, sample.Name)
+		}
+		groups[sample.Name] = append(groups[sample.Name], sample)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		group := groups[name]
+		if help := group[0].Help; help != "" {
+			_, _ = bw.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+		}
+		_, _ = bw.WriteString("# TYPE " + name + " " + group[0].Kind.String() + "\n")
+		for _, sample := range group {
+			_, _ = bw.WriteString(name)
+			writeLabels(bw, sample.Labels)
+			_, _ = bw.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeLabels(bw *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+
+	_ = bw.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			_ = bw.WriteByte(',')
+		}
+		_, _ = bw.WriteString(label.Name + `="` + labelValueEscaper.Replace(label.Value) + `"`)
+	}
+	_ = bw.WriteByte('}')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
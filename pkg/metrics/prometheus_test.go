@@ -0,0 +1,67 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	samples := []Sample{
+		{Name: "requests_total", Help: "The requests.\nAll of them.", Kind: Counter,
+			Labels: []Label{{Name: "path", Value: `/a"b\`}}, Value: 3},
+		{Name: "temperature", Kind: Gauge, Value: -1.5},
+		{Name: "requests_total", Help: "The requests.", Kind: Counter,
+			Labels: []Label{{Name: "path", Value: "/"}}, Value: 1e21},
+		{Name: "ratio", Kind: Gauge, Value: math.Inf(1)},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, samples))
+	assert.Equal(t, `# HELP requests_total The requests.\nAll of them.
+# TYPE requests_total counter
+requests_total{path="/a\"b\\"} 3
+requests_total{path="/"} 1e+21
+# TYPE temperature gauge
+temperature -1.5
+# TYPE ratio gauge
+ratio +Inf
+`, buf.String())
+}
+
+func TestPrometheus(t *testing.T) {
+	collector := CollectorFunc(func() []Sample {
+		return []Sample{{Name: "conns", Kind: Gauge, Value: 2}}
+	})
+	p := NewPrometheus(WithLabels(collector, Label{Name: "server", Value: "a"}))
+	assert.Nil(t, p.Report([]Sample{{Name: "pushed_total", Kind: Counter, Value: 1}}))
+	assert.Nil(t, p.Report([]Sample{{Name: "pushed_total", Kind: Counter, Value: 5}}))
+
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, PrometheusContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `# TYPE pushed_total counter
+pushed_total 5
+# TYPE conns gauge
+conns{server="a"} 2
+`, recorder.Body.String())
+}
@@ -0,0 +1,382 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package proxyproto impl the parser and the builder of the HAProxy PROXY protocol headers,
+// the text format of version 1 and the binary format of version 2 with TLVs.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// v1MaxLength the maximum length of the version 1 header, including the CRLF.
+	v1MaxLength = 107
+	// v2HeaderLength the length of the fixed part of the version 2 header.
+	v2HeaderLength = 16
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+var (
+	// ErrNoHeader the data does not start with a PROXY protocol header.
+	ErrNoHeader = errors.New("proxyproto: no proxy protocol header")
+	// ErrInvalidHeader the header violates the PROXY protocol.
+	ErrInvalidHeader = errors.New("proxyproto: invalid proxy protocol header")
+)
+
+// Command the command of the header.
+type Command byte
+
+const (
+	// Local the connection is established by the proxy itself, e.g. the health checks,
+	// the addresses of the connection are kept.
+	Local Command = 0x0
+	// Proxy the connection is relayed on behalf of the client.
+	Proxy Command = 0x1
+)
+
+// Transport the address family and the transport protocol of the header, the same as the byte of version 2.
+type Transport byte
+
+const (
+	Unspec     Transport = 0x00
+	TCP4       Transport = 0x11
+	UDP4       Transport = 0x12
+	TCP6       Transport = 0x21
+	UDP6       Transport = 0x22
+	UnixStream Transport = 0x31
+	UnixDgram  Transport = 0x32
+)
+
+// the types of TLVs.
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+)
+
+// TLV the type-length-value of the version 2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header the PROXY protocol header.
+type Header struct {
+	// Version 1 or 2
+	Version   byte
+	Command   Command
+	Transport Transport
+	// Source and Destination the addresses of the client and the proxy, invalid for Unspec and the unix sockets
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+	TLVs        []TLV
+}
+
+// TLV return the value of the first TLV of typ.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ALPN return the application protocol negotiated by the proxy.
+func (h *Header) ALPN() string {
+	v, _ := h.TLV(TypeALPN)
+	return string(v)
+}
+
+// Authority return the host name presented by the client, e.g. the SNI of TLS.
+func (h *Header) Authority() string {
+	v, _ := h.TLV(TypeAuthority)
+	return string(v)
+}
+
+// UniqueID return the unique identifier of the connection given by the proxy.
+func (h *Header) UniqueID() []byte {
+	v, _ := h.TLV(TypeUniqueID)
+	return v
+}
+
+// Parse parse the header at the beginning of data, return the header and its length, or nil,0,nil
+// if data is not a whole header. ErrNoHeader is returned if data does not start with a header.
+func Parse(data []byte) (*Header, int, error) {
+	switch {
+	case hasPrefix(data, v2Signature):
+		if len(data) < len(v2Signature) {
+			return nil, 0, nil
+		}
+		return parseV2(data)
+	case hasPrefix(data, v1Signature):
+		if len(data) < len(v1Signature) {
+			return nil, 0, nil
+		}
+		return parseV1(data)
+	default:
+		return nil, 0, ErrNoHeader
+	}
+}
+
+// hasPrefix report whether data starts with prefix, or is a prefix of it.
+func hasPrefix(data, prefix []byte) bool {
+	if len(data) < len(prefix) {
+		return bytes.HasPrefix(prefix, data)
+	}
+	return bytes.HasPrefix(data, prefix)
+}
+
+func parseV1(data []byte) (*Header, int, error) {
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		if len(data) >= v1MaxLength {
+			return nil, 0, fmt.Errorf("%w: version 1 header exceeds %d bytes", ErrInvalidHeader, v1MaxLength)
+		}
+		return nil, 0, nil
+	}
+	if end+2 > v1MaxLength {
+		return nil, 0, fmt.Errorf("%w: version 1 header exceeds %d bytes", ErrInvalidHeader, v1MaxLength)
+	}
+
+	h := &Header{Version: 1, Command: Proxy}
+	fields := strings.Split(string(data[len(v1Signature):end]), " ")
+	switch fields[0] {
+	case "UNKNOWN":
+		// the rest of the line is ignored.
+		return h, end + 2, nil
+	case "TCP4":
+		h.Transport = TCP4
+	case "TCP6":
+		h.Transport = TCP6
+	default:
+		return nil, 0, fmt.Errorf("%w: protocol %q", ErrInvalidHeader, fields[0])
+	}
+	if len(fields) != 5 {
+		return nil, 0, fmt.Errorf("%w: %d fields", ErrInvalidHeader, len(fields))
+	}
+
+	var err error
+	if h.Source, err = parseV1Addr(h.Transport, fields[1], fields[3]); err != nil {
+		return nil, 0, err
+	}
+	if h.Destination, err = parseV1Addr(h.Transport, fields[2], fields[4]); err != nil {
+		return nil, 0, err
+	}
+	return h, end + 2, nil
+}
+
+func parseV1Addr(transport Transport, ip, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != (transport == TCP4) || addr.Zone() != "" {
+		return netip.AddrPort{}, fmt.Errorf("%w: address %q", ErrInvalidHeader, ip)
+	}
+	// the port is a decimal without the leading zeros.
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || len(port) > 1 && port[0] == '0' {
+		return netip.AddrPort{}, fmt.Errorf("%w: port %q", ErrInvalidHeader, port)
+	}
+	return netip.AddrPortFrom(addr, uint16(p)), nil
+}
+
+func parseV2(data []byte) (*Header, int, error) {
+	if len(data) < v2HeaderLength {
+		return nil, 0, nil
+	}
+	length := v2HeaderLength + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < length {
+		return nil, 0, nil
+	}
+
+	verCmd := data[12]
+	if verCmd>>4 != 2 {
+		return nil, 0, fmt.Errorf("%w: version %d", ErrInvalidHeader, verCmd>>4)
+	}
+	h := &Header{Version: 2, Command: Command(verCmd & 0x0F), Transport: Transport(data[13])}
+	if h.Command != Local && h.Command != Proxy {
+		return nil, 0, fmt.Errorf("%w: command %#x", ErrInvalidHeader, byte(h.Command))
+	}
+
+	switch h.Transport {
+	case Unspec, TCP4, UDP4, TCP6, UDP6, UnixStream, UnixDgram:
+	default:
+		return nil, 0, fmt.Errorf("%w: transport %#x", ErrInvalidHeader, byte(h.Transport))
+	}
+	body, n := data[v2HeaderLength:length], addrLength(h.Transport)
+	if len(body) < n {
+		return nil, 0, fmt.Errorf("%w: addresses of %d bytes", ErrInvalidHeader, len(body))
+	}
+
+	switch n {
+	case 12:
+		h.Source = netip.AddrPortFrom(netip.AddrFrom4(*(*[4]byte)(body[0:4])), binary.BigEndian.Uint16(body[8:10]))
+		h.Destination = netip.AddrPortFrom(netip.AddrFrom4(*(*[4]byte)(body[4:8])), binary.BigEndian.Uint16(body[10:12]))
+	case 36:
+		h.Source = netip.AddrPortFrom(netip.AddrFrom16(*(*[16]byte)(body[0:16])), binary.BigEndian.Uint16(body[32:34]))
+		h.Destination = netip.AddrPortFrom(netip.AddrFrom16(*(*[16]byte)(body[16:32])), binary.BigEndian.Uint16(body[34:36]))
+	}
+	// the LOCAL command ignores the addresses.
+	if h.Command == Local {
+		h.Source, h.Destination = netip.AddrPort{}, netip.AddrPort{}
+	}
+
+	tlvs := body[n:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, 0, fmt.Errorf("%w: truncated tlv", ErrInvalidHeader)
+		}
+		end := 3 + int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < end {
+			return nil, 0, fmt.Errorf("%w: truncated tlv", ErrInvalidHeader)
+		}
+		h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: append([]byte(nil), tlvs[3:end]...)})
+		tlvs = tlvs[end:]
+	}
+
+	if checksum, ok := h.TLV(TypeCRC32C); ok {
+		if len(checksum) != 4 || binary.BigEndian.Uint32(checksum) != checksumV2(data[:length]) {
+			return nil, 0, fmt.Errorf("%w: crc32c mismatch", ErrInvalidHeader)
+		}
+	}
+	return h, length, nil
+}
+
+// checksumV2 return the CRC32c of the version 2 header, the value of the CRC32C TLV is taken as zero.
+func checksumV2(header []byte) uint32 {
+	header = append([]byte(nil), header...)
+	for tlvs := header[v2HeaderLength+addrLength(Transport(header[13])):]; len(tlvs) >= 3; {
+		n := 3 + int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if n > len(tlvs) {
+			break
+		}
+		if tlvs[0] == TypeCRC32C {
+			for i := 3; i < n; i++ {
+				tlvs[i] = 0
+			}
+		}
+		tlvs = tlvs[n:]
+	}
+	return crc32.Checksum(header, crc32.MakeTable(crc32.Castagnoli))
+}
+
+func addrLength(transport Transport) int {
+	switch transport {
+	case TCP4, UDP4:
+		return 12
+	case TCP6, UDP6:
+		return 36
+	case UnixStream, UnixDgram:
+		return 216
+	default:
+		return 0
+	}
+}
+
+// Append append the encoded header to dst, the CRC32C TLV is filled if it is present.
+func (h *Header) Append(dst []byte) ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.appendV1(dst)
+	case 2:
+		return h.appendV2(dst)
+	default:
+		return nil, fmt.Errorf("proxyproto: unknown version %d", h.Version)
+	}
+}
+
+func (h *Header) appendV1(dst []byte) ([]byte, error) {
+	dst = append(dst, v1Signature...)
+	var protocol string
+	switch h.Transport {
+	case TCP4:
+		protocol = "TCP4"
+	case TCP6:
+		protocol = "TCP6"
+	default:
+		return append(dst, "UNKNOWN\r\n"...), nil
+	}
+	if !h.Source.IsValid() || !h.Destination.IsValid() {
+		return nil, errors.New("proxyproto: invalid addresses")
+	}
+	return append(dst, fmt.Sprintf("%s %s %s %d %d\r\n", protocol, h.Source.Addr().Unmap(), h.Destination.Addr().Unmap(),
+		h.Source.Port(), h.Destination.Port())...), nil
+}
+
+func (h *Header) appendV2(dst []byte) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, v2Signature...)
+	dst = append(dst, 0x20|byte(h.Command), byte(h.Transport), 0, 0)
+	switch n := addrLength(h.Transport); n {
+	case 12:
+		src, dstAddr := h.Source.Addr().Unmap(), h.Destination.Addr().Unmap()
+		if !src.Is4() || !dstAddr.Is4() {
+			return nil, errors.New("proxyproto: invalid ipv4 addresses")
+		}
+		s4, d4 := src.As4(), dstAddr.As4()
+		dst = append(append(dst, s4[:]...), d4[:]...)
+		dst = appendPorts(dst, h.Source.Port(), h.Destination.Port())
+	case 36:
+		if !h.Source.IsValid() || !h.Destination.IsValid() {
+			return nil, errors.New("proxyproto: invalid ipv6 addresses")
+		}
+		s16, d16 := h.Source.Addr().As16(), h.Destination.Addr().As16()
+		dst = append(append(dst, s16[:]...), d16[:]...)
+		dst = appendPorts(dst, h.Source.Port(), h.Destination.Port())
+	default:
+		dst = append(dst, make([]byte, n)...)
+	}
+	crc := -1
+	for _, tlv := range h.TLVs {
+		if len(tlv.Value) > 0xFFFF {
+			return nil, errors.New("proxyproto: tlv too large")
+		}
+		if tlv.Type == TypeCRC32C {
+			crc = len(dst) + 3
+			tlv.Value = make([]byte, 4)
+		}
+		dst = append(dst, tlv.Type, byte(len(tlv.Value)>>8), byte(len(tlv.Value)))
+		dst = append(dst, tlv.Value...)
+	}
+	length := len(dst) - start - v2HeaderLength
+	if length > 0xFFFF {
+		return nil, errors.New("proxyproto: header too large")
+	}
+	binary.BigEndian.PutUint16(dst[start+14:], uint16(length))
+	if crc >= 0 {
+		binary.BigEndian.PutUint32(dst[crc:], checksumV2(dst[start:]))
+	}
+	return dst, nil
+}
+
+func appendPorts(dst []byte, src, dstPort uint16) []byte {
+	return append(dst, byte(src>>8), byte(src), byte(dstPort>>8), byte(dstPort))
+}
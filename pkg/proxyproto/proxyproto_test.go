@@ -0,0 +1,174 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package proxyproto
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseV1(t *testing.T) {
+	data := []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET /")
+	h, n, err := Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data)-5, n)
+	assert.Equal(t, &Header{Version: 1, Command: Proxy, Transport: TCP4,
+		Source:      netip.MustParseAddrPort("192.0.2.1:56324"),
+		Destination: netip.MustParseAddrPort("198.51.100.1:443")}, h)
+
+	h, _, err = Parse([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 1 2\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "[2001:db8::1]:1", h.Source.String())
+
+	h, n, err = Parse([]byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 35, n)
+	assert.Equal(t, Unspec, h.Transport)
+	assert.False(t, h.Source.IsValid())
+
+	// the half headers.
+	for _, half := range []string{"", "PRO", "PROXY TCP4 192.0.2.1"} {
+		h, n, err = Parse([]byte(half))
+		assert.Nil(t, err)
+		assert.Nil(t, h)
+		assert.Equal(t, 0, n)
+	}
+
+	for _, invalid := range []string{
+		"PROXY TCP5 192.0.2.1 198.51.100.1 1 2\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 1\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 01 2\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 65536 2\r\n",
+		"PROXY TCP4 " + string(make([]byte, 100)),
+	} {
+		_, _, err = Parse([]byte(invalid))
+		assert.True(t, errors.Is(err, ErrInvalidHeader), invalid)
+	}
+
+	_, _, err = Parse([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, ErrNoHeader, err)
+}
+
+func TestParseV2(t *testing.T) {
+	header := &Header{Version: 2, Command: Proxy, Transport: TCP4,
+		Source:      netip.MustParseAddrPort("192.0.2.1:56324"),
+		Destination: netip.MustParseAddrPort("198.51.100.1:443"),
+		TLVs: []TLV{
+			{Type: TypeALPN, Value: []byte("h2")},
+			{Type: TypeAuthority, Value: []byte("example.com")},
+			{Type: TypeUniqueID, Value: []byte{1, 2, 3}},
+		}}
+	data, err := header.Append(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11"), data[:14])
+
+	// the half headers.
+	for i := 0; i < len(data); i++ {
+		h, n, err := Parse(data[:i])
+		assert.Nil(t, err)
+		assert.Nil(t, h)
+		assert.Equal(t, 0, n)
+	}
+	h, n, err := Parse(append(data, "payload"...))
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, header, h)
+	assert.Equal(t, "h2", h.ALPN())
+	assert.Equal(t, "example.com", h.Authority())
+	assert.Equal(t, []byte{1, 2, 3}, h.UniqueID())
+
+	header = &Header{Version: 2, Command: Proxy, Transport: TCP6,
+		Source:      netip.MustParseAddrPort("[2001:db8::1]:1"),
+		Destination: netip.MustParseAddrPort("[2001:db8::2]:2")}
+	data, err = header.Append(nil)
+	assert.Nil(t, err)
+	h, _, err = Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, header, h)
+
+	// the LOCAL command ignores the addresses.
+	h, _, err = Parse([]byte("\r\n\r\n\x00\r\nQUIT\n\x20\x11\x00\x0c\xc0\x00\x02\x01\xc6\x33\x64\x01\x00\x01\x00\x02"))
+	assert.Nil(t, err)
+	assert.Equal(t, &Header{Version: 2, Command: Local, Transport: TCP4}, h)
+
+	// the unix socket addresses are skipped.
+	data, err = (&Header{Version: 2, Command: Proxy, Transport: UnixStream}).Append(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 16+216, len(data))
+	h, _, err = Parse(data)
+	assert.Nil(t, err)
+	assert.Equal(t, UnixStream, h.Transport)
+}
+
+func TestParseV2_Invalid(t *testing.T) {
+	valid, err := (&Header{Version: 2, Command: Proxy, Transport: TCP4,
+		Source:      netip.MustParseAddrPort("192.0.2.1:1"),
+		Destination: netip.MustParseAddrPort("192.0.2.2:2")}).Append(nil)
+	assert.Nil(t, err)
+
+	mutate := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	cases := map[string][]byte{
+		"version":   mutate(func(b []byte) []byte { b[12] = 0x11; return b }),
+		"command":   mutate(func(b []byte) []byte { b[12] = 0x22; return b }),
+		"transport": mutate(func(b []byte) []byte { b[13] = 0x41; return b }),
+		"addresses": mutate(func(b []byte) []byte { b[15] = 4; return b[:20] }),
+		"tlv":       mutate(func(b []byte) []byte { b[15] = 14; return append(b, 0x01, 0x00) }),
+	}
+	for name, data := range cases {
+		_, _, err := Parse(data)
+		assert.True(t, errors.Is(err, ErrInvalidHeader), name)
+	}
+}
+
+func TestCRC32C(t *testing.T) {
+	header := &Header{Version: 2, Command: Proxy, Transport: TCP4,
+		Source:      netip.MustParseAddrPort("192.0.2.1:1"),
+		Destination: netip.MustParseAddrPort("192.0.2.2:2"),
+		TLVs:        []TLV{{Type: TypeCRC32C}, {Type: TypeNoop, Value: []byte{0}}}}
+	data, err := header.Append(nil)
+	assert.Nil(t, err)
+	h, _, err := Parse(data)
+	assert.Nil(t, err)
+	checksum, ok := h.TLV(TypeCRC32C)
+	assert.True(t, ok)
+	assert.Len(t, checksum, 4)
+
+	data[len(data)-1] ^= 0xFF
+	_, _, err = Parse(data)
+	assert.True(t, errors.Is(err, ErrInvalidHeader))
+}
+
+func TestAppendV1(t *testing.T) {
+	data, err := (&Header{Version: 1, Transport: TCP4,
+		Source:      netip.MustParseAddrPort("192.0.2.1:56324"),
+		Destination: netip.MustParseAddrPort("198.51.100.1:443")}).Append(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", string(data))
+
+	data, err = (&Header{Version: 1}).Append(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "PROXY UNKNOWN\r\n", string(data))
+
+	_, err = (&Header{Version: 3}).Append(nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package ratelimit token bucket rate limiter
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter a token bucket refilled with rate tokens per second up to burst tokens, it starts full.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New return a limiter of rate tokens per second and burst tokens at most, burst is at least 1.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Allow report whether a token can be taken now.
+func (l *Limiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN report whether n tokens can be taken at now, the tokens are taken if so.
+func (l *Limiter) AllowN(now time.Time, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	if l.tokens < float64(n) {
+		return false
+	}
+
+	l.tokens -= float64(n)
+	return true
+}
+
+// ReserveN take n tokens at now even if they are not enough, and return the time to wait
+// until the tokens taken in advance are refilled.
+func (l *Limiter) ReserveN(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// advance refill the tokens for the time elapsed since the last call.
+func (l *Limiter) advance(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+}
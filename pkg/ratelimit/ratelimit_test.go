@@ -0,0 +1,58 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_AllowN(t *testing.T) {
+	now := time.Now()
+	l := New(10, 2)
+	assert.True(t, l.AllowN(now, 1))
+	assert.True(t, l.AllowN(now, 1))
+	assert.False(t, l.AllowN(now, 1))
+
+	// 100ms refills one token.
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, l.AllowN(now, 1))
+	assert.False(t, l.AllowN(now, 1))
+
+	// the tokens never exceed the burst.
+	now = now.Add(time.Hour)
+	assert.False(t, l.AllowN(now, 3))
+	assert.True(t, l.AllowN(now, 2))
+
+	// the clock going backwards refills nothing.
+	assert.False(t, l.AllowN(now.Add(-time.Second), 1))
+}
+
+func TestLimiter_ReserveN(t *testing.T) {
+	now := time.Now()
+	l := New(100, 10)
+	assert.Zero(t, l.ReserveN(now, 10))
+	// 20 tokens are taken in advance.
+	assert.Equal(t, 200*time.Millisecond, l.ReserveN(now, 20))
+	assert.False(t, l.AllowN(now.Add(100*time.Millisecond), 1))
+
+	now = now.Add(200 * time.Millisecond)
+	assert.Zero(t, l.ReserveN(now, 0))
+	assert.Equal(t, 10*time.Millisecond, l.ReserveN(now, 1))
+}
@@ -0,0 +1,223 @@
+//go:build linux
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package syscall
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// io_uring syscall numbers, they are the same on all architectures.
+const (
+	sysIoUringSetup    = 425
+	sysIoUringEnter    = 426
+	sysIoUringRegister = 427
+)
+
+// io_uring mmap offsets
+const (
+	IoRingOffSqRing = 0
+	IoRingOffCqRing = 0x8000000
+	IoRingOffSqes   = 0x10000000
+)
+
+// io_uring features
+const (
+	IoRingFeatSingleMmap = 1 << 0
+	IoRingFeatNoDrop     = 1 << 1
+)
+
+// io_uring enter flags
+const (
+	IoRingEnterGetEvents = 1 << 0
+)
+
+// io_uring register opcodes
+const (
+	IoRingRegisterProbe    = 8
+	IoRingRegisterPbufRing = 22
+)
+
+// io_uring opcodes
+const (
+	IoRingOpNop         = 0
+	IoRingOpWritev      = 2
+	IoRingOpPollAdd     = 6
+	IoRingOpPollRemove  = 7
+	IoRingOpAccept      = 13
+	IoRingOpAsyncCancel = 14
+	IoRingOpSend        = 26
+	IoRingOpRecv        = 27
+	IoRingOpLast        = 48
+)
+
+// io_uring sqe flags
+const (
+	IoSqeBufferSelect = 1 << 5
+)
+
+// io_uring sqe op flags
+const (
+	// IoRingPollAddMulti set in sqe len, poll keeps reporting events.
+	IoRingPollAddMulti = 1 << 0
+	// IoRingAcceptMultishot set in sqe ioprio, accept keeps accepting connections.
+	IoRingAcceptMultishot = 1 << 0
+	// IoRingRecvMultishot set in sqe ioprio, recv keeps receiving data into the provided buffers.
+	IoRingRecvMultishot = 1 << 1
+	// IoRingAsyncCancelAll cancel all requests that match the given criteria.
+	IoRingAsyncCancelAll = 1 << 0
+	// IoRingAsyncCancelFd match the requests by fd.
+	IoRingAsyncCancelFd = 1 << 1
+)
+
+// io_uring cqe flags
+const (
+	IoRingCqeFBuffer     = 1 << 0
+	IoRingCqeFMore       = 1 << 1
+	IoRingCqeBufferShift = 16
+)
+
+// IoRingOpSupported set in the probe op flags if the op is supported by the kernel.
+const IoRingOpSupported = 1 << 0
+
+// IoSqringOffsets offsets of the submission queue ring fields.
+type IoSqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Flags       uint32
+	Dropped     uint32
+	Array       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+// IoCqringOffsets offsets of the completion queue ring fields.
+type IoCqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Overflow    uint32
+	Cqes        uint32
+	Flags       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+// IoUringParams params for io_uring_setup.
+type IoUringParams struct {
+	SqEntries    uint32
+	CqEntries    uint32
+	Flags        uint32
+	SqThreadCPU  uint32
+	SqThreadIdle uint32
+	Features     uint32
+	WqFd         uint32
+	Resv         [3]uint32
+	SqOff        IoSqringOffsets
+	CqOff        IoCqringOffsets
+}
+
+// IoUringSqe submission queue entry.
+type IoUringSqe struct {
+	Opcode      uint8
+	Flags       uint8
+	Ioprio      uint16
+	Fd          int32
+	Off         uint64
+	Addr        uint64
+	Len         uint32
+	OpFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	SpliceFdIn  int32
+	Addr3       uint64
+	_           uint64
+}
+
+// IoUringCqe completion queue entry.
+type IoUringCqe struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// IoUringBuf provided buffer in the buffer ring.
+type IoUringBuf struct {
+	Addr uint64
+	Len  uint32
+	Bid  uint16
+	Resv uint16
+}
+
+// IoUringBufReg params for registering a buffer ring.
+type IoUringBufReg struct {
+	RingAddr    uint64
+	RingEntries uint32
+	Bgid        uint16
+	Pad         uint16
+	Resv        [3]uint64
+}
+
+// IoUringProbeOp the op in probe.
+type IoUringProbeOp struct {
+	Op    uint8
+	Resv  uint8
+	Flags uint16
+	Resv2 uint32
+}
+
+// IoUringProbe the io_uring ops supported by the kernel.
+type IoUringProbe struct {
+	LastOp uint8
+	OpsLen uint8
+	Resv   uint16
+	Resv2  [3]uint32
+	Ops    [IoRingOpLast]IoUringProbeOp
+}
+
+// IoUringSetup setup an io_uring instance with entries.
+func IoUringSetup(entries uint32, params *IoUringParams) (int, error) {
+	fd, _, errno := syscall.Syscall(sysIoUringSetup, uintptr(entries), uintptr(unsafe.Pointer(params)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(fd), nil
+}
+
+// IoUringEnter submit toSubmit sqes and wait for minComplete cqes.
+func IoUringEnter(fd int, toSubmit, minComplete, flags uint32) (int, error) {
+	n, _, errno := syscall.Syscall6(sysIoUringEnter, uintptr(fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// IoUringRegister register resources for io_uring.
+func IoUringRegister(fd int, opcode uint32, arg unsafe.Pointer, nrArgs uint32) error {
+	_, _, errno := syscall.Syscall6(sysIoUringRegister, uintptr(fd), uintptr(opcode), uintptr(arg), uintptr(nrArgs), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package syscall
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// SetBusyPoll set SO_BUSY_POLL with usec on the socket fd, and SO_PREFER_BUSY_POLL if prefer is true.
+// setting a value greater than net.core.busy_read requires CAP_NET_ADMIN.
+func SetBusyPoll(fd, usec int, prefer bool) error {
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BUSY_POLL, usec); err != nil {
+		return err
+	}
+
+	if !prefer {
+		return nil
+	}
+
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PREFER_BUSY_POLL, 1)
+}
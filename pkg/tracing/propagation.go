@@ -0,0 +1,117 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ErrMalformed the encoded trace context is malformed.
+var ErrMalformed = errors.New("tracing: malformed trace context")
+
+// Message is implemented by the messages carrying the trace context, e.g. in their headers or metadata.
+// the trace context is injected into the messages written by the traced session, and extracted from the
+// messages passed to OnMessage.
+type Message interface {
+	// Carrier return the carrier of the trace context in the message
+	Carrier() propagation.TextMapCarrier
+}
+
+// AppendContext append the trace context of ctx to dst in binary, for the frames without a place for
+// the text headers. the fields of the propagator are encoded as the uvarint count of the fields
+// followed by the uvarint length prefixed keys and values. the global propagator is used if propagator is nil.
+func AppendContext(dst []byte, ctx context.Context, propagator propagation.TextMapPropagator) []byte {
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	dst = appendUvarint(dst, uint64(len(carrier)))
+	// the fields of the propagator are encoded in a fixed order.
+	for _, key := range propagator.Fields() {
+		value, ok := carrier[key]
+		if !ok {
+			continue
+		}
+		dst = appendUvarint(dst, uint64(len(key)))
+		dst = append(dst, key...)
+		dst = appendUvarint(dst, uint64(len(value)))
+		dst = append(dst, value...)
+		delete(carrier, key)
+	}
+	for key, value := range carrier {
+		dst = appendUvarint(dst, uint64(len(key)))
+		dst = append(dst, key...)
+		dst = appendUvarint(dst, uint64(len(value)))
+		dst = append(dst, value...)
+	}
+	return dst
+}
+
+// ParseContext parse the trace context appended by AppendContext at the beginning of data into ctx,
+// it returns the context and the length of the parsed data. the global propagator is used if propagator is nil.
+func ParseContext(ctx context.Context, data []byte, propagator propagation.TextMapPropagator) (context.Context, int, error) {
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return ctx, 0, ErrMalformed
+	}
+
+	carrier := make(propagation.MapCarrier, count)
+	for i := uint64(0); i < count; i++ {
+		key, m := readString(data[n:])
+		if m <= 0 {
+			return ctx, 0, ErrMalformed
+		}
+		n += m
+
+		value, m := readString(data[n:])
+		if m <= 0 {
+			return ctx, 0, ErrMalformed
+		}
+		n += m
+		carrier[key] = value
+	}
+
+	return propagator.Extract(ctx, carrier), n, nil
+}
+
+// readString read a uvarint length prefixed string, the returned length is not positive if data is short.
+func readString(data []byte) (string, int) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return "", 0
+	}
+	return string(data[n : n+int(size)]), n + int(size)
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
@@ -0,0 +1,256 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package tracing impl the OpenTelemetry tracing of the sessions, the spans of the session lifetime,
+// the handling of the decoded messages and the flushes, and the propagation of the trace context in the frames.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Softwarekang/knetty/session"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+// instrumentationName the name of the tracer.
+const instrumentationName = "github.com/Softwarekang/knetty/pkg/tracing"
+
+// the names of the spans.
+const (
+	SessionSpanName = "knetty.session"
+	MessageSpanName = "knetty.message"
+	FlushSpanName   = "knetty.flush"
+)
+
+// the attributes of the spans.
+const (
+	LocalAddrKey   = attribute.Key("knetty.local.addr")
+	RemoteAddrKey  = attribute.Key("knetty.remote.addr")
+	ConnIDKey      = attribute.Key("knetty.conn.id")
+	MessageTypeKey = attribute.Key("knetty.message.type")
+	BufferedKey    = attribute.Key("knetty.flush.buffered")
+)
+
+// Options for tracing.
+type Options struct {
+	// TracerProvider the provider of the tracer, it is the global one by default.
+	TracerProvider trace.TracerProvider
+	// Propagator the propagator of the trace context in the messages, it is the global one by default.
+	Propagator propagation.TextMapPropagator
+	// SpanKind the kind of the session and message spans, it is SpanKindServer by default.
+	SpanKind trace.SpanKind
+	// MessageSpanName return the name of the message span, it is MessageSpanName by default.
+	MessageSpanName func(pkg interface{}) string
+}
+
+// Option for tracing.
+type Option func(*Options)
+
+// WithTracerProvider set the provider of the tracer.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = provider
+	}
+}
+
+// WithPropagator set the propagator of the trace context in the messages.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *Options) {
+		o.Propagator = propagator
+	}
+}
+
+// WithSpanKind set the kind of the session and message spans, e.g. SpanKindClient for the client sessions.
+func WithSpanKind(kind trace.SpanKind) Option {
+	return func(o *Options) {
+		o.SpanKind = kind
+	}
+}
+
+// WithMessageSpanName set the name of the message span by the message, e.g. the command of the message.
+func WithMessageSpanName(fn func(pkg interface{}) string) Option {
+	return func(o *Options) {
+		o.MessageSpanName = fn
+	}
+}
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		TracerProvider: otel.GetTracerProvider(),
+		Propagator:     otel.GetTextMapPropagator(),
+		SpanKind:       trace.SpanKindServer,
+		MessageSpanName: func(interface{}) string {
+			return MessageSpanName
+		},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// Setup set the listener of s traced, it returns the traced session passed to the listener.
+// the session span lasts from OnConnect to OnClose, each message passed to OnMessage is handled in a message span,
+// and the flushes of the traced session are in flush spans. the message span is the child of the trace context
+// carried by the message if it is a Message, otherwise the child of the session span.
+func Setup(s session.Session, listener session.EventListener, opts ...Option) session.Session {
+	options := newOptions(opts...)
+	traced := &tracedSession{
+		Session: s,
+		options: options,
+		tracer:  options.TracerProvider.Tracer(instrumentationName),
+	}
+	s.SetEventListener(&eventListener{session: traced, listener: listener})
+	return traced
+}
+
+// ContextFromSession return the context of the message being handled by the traced session,
+// or the context of the session span if there is no such message.
+func ContextFromSession(s session.Session) context.Context {
+	if traced, ok := s.(*tracedSession); ok {
+		return traced.context()
+	}
+	return context.Background()
+}
+
+// contextHolder keep the type stored in atomic.Value consistent.
+type contextHolder struct {
+	ctx context.Context
+}
+
+// tracedSession traces the flushes and injects the trace context into the written messages.
+type tracedSession struct {
+	session.Session
+	options Options
+	tracer  trace.Tracer
+	attrs   atomic.Value
+	// root the context of the session span, current the context of the message being handled.
+	root    atomic.Value
+	current atomic.Value
+}
+
+func (s *tracedSession) context() context.Context {
+	if holder, ok := s.current.Load().(contextHolder); ok && holder.ctx != nil {
+		return holder.ctx
+	}
+	if holder, ok := s.root.Load().(contextHolder); ok {
+		return holder.ctx
+	}
+	return context.Background()
+}
+
+func (s *tracedSession) attributes() []attribute.KeyValue {
+	attrs, _ := s.attrs.Load().([]attribute.KeyValue)
+	return attrs
+}
+
+// ID report the id of the connection of the traced session for session.IDOf.
+func (s *tracedSession) ID() uint64 {
+	return session.IDOf(s.Session)
+}
+
+// WritePkg implements session.Session, the trace context is injected into pkg if it is a Message.
+func (s *tracedSession) WritePkg(pkg interface{}) (int, error) {
+	if msg, ok := pkg.(Message); ok {
+		s.options.Propagator.Inject(s.context(), msg.Carrier())
+	}
+	return s.Session.WritePkg(pkg)
+}
+
+// FlushBuffer implements session.Session.
+func (s *tracedSession) FlushBuffer() error {
+	_, span := s.tracer.Start(s.context(), FlushSpanName, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(s.attributes()...), trace.WithAttributes(BufferedKey.Int(s.Stats().OutputBuffered)))
+	defer span.End()
+
+	err := s.Session.FlushBuffer()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// eventListener starts and ends the spans around the listener.
+type eventListener struct {
+	session  *tracedSession
+	listener session.EventListener
+}
+
+// OnConnect implements session.EventListener.
+func (l *eventListener) OnConnect(s session.Session) {
+	traced := l.session
+	attrs := []attribute.KeyValue{
+		LocalAddrKey.String(s.LocalAddr()),
+		RemoteAddrKey.String(s.RemoteAddr()),
+		ConnIDKey.Int64(int64(session.IDOf(s))),
+	}
+	traced.attrs.Store(attrs)
+	ctx, _ := traced.tracer.Start(context.Background(), SessionSpanName,
+		trace.WithSpanKind(traced.options.SpanKind), trace.WithAttributes(attrs...))
+	traced.root.Store(contextHolder{ctx: ctx})
+	l.listener.OnConnect(traced)
+}
+
+// OnMessage implements session.EventListener.
+func (l *eventListener) OnMessage(_ session.Session, pkg interface{}) session.ExecStatus {
+	traced := l.session
+	parent := traced.context()
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(traced.options.SpanKind),
+		trace.WithAttributes(traced.attributes()...),
+		trace.WithAttributes(MessageTypeKey.String(fmt.Sprintf("%T", pkg))),
+	}
+	if msg, ok := pkg.(Message); ok {
+		remote := traced.options.Propagator.Extract(context.Background(), msg.Carrier())
+		if trace.SpanContextFromContext(remote).IsValid() {
+			// the message span belongs to the trace of the peer, and links to the session span.
+			opts = append(opts, trace.WithLinks(trace.LinkFromContext(parent)))
+			parent = remote
+		}
+	}
+
+	ctx, span := traced.tracer.Start(parent, traced.options.MessageSpanName(pkg), opts...)
+	defer span.End()
+	previous, _ := traced.current.Load().(contextHolder)
+	traced.current.Store(contextHolder{ctx: ctx})
+	defer traced.current.Store(previous)
+
+	return l.listener.OnMessage(traced, pkg)
+}
+
+// OnError implements session.EventListener.
+func (l *eventListener) OnError(_ session.Session, e error) {
+	span := trace.SpanFromContext(l.session.context())
+	span.RecordError(e)
+	span.SetStatus(codes.Error, e.Error())
+	l.listener.OnError(l.session, e)
+}
+
+// OnClose implements session.EventListener.
+func (l *eventListener) OnClose(_ session.Session) {
+	l.listener.OnClose(l.session)
+	if holder, ok := l.session.root.Load().(contextHolder); ok {
+		trace.SpanFromContext(holder.ctx).End()
+	}
+}
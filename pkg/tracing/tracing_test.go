@@ -0,0 +1,200 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Softwarekang/knetty/internal/knettytest"
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// frame is a line "traceparent|body", the traceparent may be empty.
+type frame struct {
+	header propagation.MapCarrier
+	body   string
+}
+
+func (f *frame) Carrier() propagation.TextMapCarrier {
+	return f.header
+}
+
+type frameCodec struct{}
+
+func (frameCodec) Encode(pkg interface{}) ([]byte, error) {
+	f := pkg.(*frame)
+	return []byte(f.header.Get("traceparent") + "|" + f.body + "\n"), nil
+}
+
+func (frameCodec) Decode(data []byte) (interface{}, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		return nil, 0, nil
+	}
+	parts := strings.SplitN(string(data[:idx]), "|", 2)
+	f := &frame{header: propagation.MapCarrier{}, body: parts[1]}
+	if parts[0] != "" {
+		f.header.Set("traceparent", parts[0])
+	}
+	return f, idx + 1, nil
+}
+
+type echoListener struct {
+	closed chan struct{}
+	ids    chan uint64
+}
+
+func (l echoListener) OnConnect(s session.Session) {
+	l.ids <- session.IDOf(s)
+}
+
+func (echoListener) OnMessage(s session.Session, pkg interface{}) session.ExecStatus {
+	_, _ = s.WritePkg(&frame{header: propagation.MapCarrier{}, body: pkg.(*frame).body})
+	_ = s.FlushBuffer()
+	return session.Normal
+}
+
+func (echoListener) OnError(session.Session, error) {}
+
+func (l echoListener) OnClose(session.Session) {
+	close(l.closed)
+}
+
+func TestSetup(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	propagator := propagation.TraceContext{}
+
+	closed, ids, id := make(chan struct{}), make(chan uint64, 1), uint64(0)
+	addr := knettytest.Serve(t, func(s session.Session) error {
+		id = session.IDOf(s)
+		s.SetCodec(frameCodec{})
+		Setup(s, echoListener{closed: closed, ids: ids}, WithTracerProvider(provider), WithPropagator(propagator),
+			WithMessageSpanName(func(pkg interface{}) string {
+				return "echo " + pkg.(*frame).body
+			}))
+		return nil
+	}).Addr()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithRemoteSpanContext(context.Background(), remote), carrier)
+	_, err = conn.Write([]byte("|hello\n" + carrier.Get("traceparent") + "|world\n"))
+	assert.Nil(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var received string
+	buf := make([]byte, 256)
+	for strings.Count(received, "\n") < 2 {
+		n, err := conn.Read(buf)
+		if !assert.Nil(t, err) {
+			return
+		}
+		received += string(buf[:n])
+	}
+	assert.Nil(t, conn.Close())
+	// the traced session reports the id of the connection.
+	assert.NotZero(t, id)
+	assert.Equal(t, id, <-ids)
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("session is not closed")
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	flushParents := make(map[trace.SpanID]bool)
+	for _, span := range recorder.Ended() {
+		if span.Name() == FlushSpanName {
+			flushParents[span.Parent().SpanID()] = true
+			continue
+		}
+		spans[span.Name()] = span
+	}
+	sessionSpan, hello, world := spans[SessionSpanName], spans["echo hello"], spans["echo world"]
+	if !assert.NotNil(t, sessionSpan) || !assert.NotNil(t, hello) || !assert.NotNil(t, world) {
+		return
+	}
+
+	assert.Equal(t, trace.SpanKindServer, sessionSpan.SpanKind())
+	assert.Contains(t, sessionSpan.Attributes(), LocalAddrKey.String(addr))
+	assert.Contains(t, hello.Attributes(), MessageTypeKey.String("*tracing.frame"))
+	// the message without the trace context is the child of the session span.
+	assert.Equal(t, sessionSpan.SpanContext().SpanID(), hello.Parent().SpanID())
+	// the message with the trace context belongs to the trace of the peer.
+	assert.Equal(t, remote.TraceID(), world.SpanContext().TraceID())
+	assert.Equal(t, remote.SpanID(), world.Parent().SpanID())
+	if assert.Len(t, world.Links(), 1) {
+		assert.Equal(t, sessionSpan.SpanContext().SpanID(), world.Links()[0].SpanContext.SpanID())
+	}
+	assert.Equal(t, map[trace.SpanID]bool{hello.SpanContext().SpanID(): true, world.SpanContext().SpanID(): true}, flushParents)
+	// the written messages carry the trace context of the message spans.
+	assert.Contains(t, received, hello.SpanContext().SpanID().String()+"-01|hello\n")
+	assert.Contains(t, received, world.SpanContext().SpanID().String()+"-01|world\n")
+}
+
+func TestContext(t *testing.T) {
+	propagator := propagation.TraceContext{}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	data := AppendContext([]byte("head"), trace.ContextWithSpanContext(context.Background(), sc), propagator)
+	data = append(data, "body"...)
+
+	ctx, n, err := ParseContext(context.Background(), data[4:], propagator)
+	assert.Nil(t, err)
+	assert.Equal(t, "body", string(data[4+n:]))
+	parsed := trace.SpanContextFromContext(ctx)
+	assert.Equal(t, sc.TraceID(), parsed.TraceID())
+	assert.Equal(t, sc.SpanID(), parsed.SpanID())
+	assert.True(t, parsed.IsRemote())
+
+	// no trace context.
+	data = AppendContext(nil, context.Background(), propagator)
+	assert.Equal(t, []byte{0}, data)
+	ctx, n, err = ParseContext(context.Background(), data, propagator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+
+	for _, malformed := range [][]byte{nil, {1}, {1, 5, 'a'}, {1, 1, 'a', 9, 'b'}} {
+		_, _, err = ParseContext(context.Background(), malformed, propagator)
+		assert.Equal(t, ErrMalformed, err)
+	}
+}
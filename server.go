@@ -21,13 +21,17 @@ import (
 	"fmt"
 	"net/netip"
 	"sync"
+	"syscall"
 
 	"github.com/Softwarekang/knetty/internal/net"
+	"github.com/Softwarekang/knetty/internal/net/connection"
 	"github.com/Softwarekang/knetty/internal/net/listener"
 	"github.com/Softwarekang/knetty/internal/net/poll"
 	errors "github.com/Softwarekang/knetty/pkg/err"
 	"github.com/Softwarekang/knetty/pkg/log"
 	"github.com/Softwarekang/knetty/session"
+
+	"go.uber.org/atomic"
 )
 
 // Server for knetty
@@ -35,11 +39,21 @@ type Server struct {
 	ServerOptions
 
 	mu          sync.Mutex
-	sessions    map[session.Session]struct{}
+	sessions    map[session.Session]netip.Addr
 	tcpListener listener.Listener
 	netFd       *poll.NetFileDesc
+	loops       *poll.EventLoopGroup
+	ownLoops    bool
 	poller      poll.Poll
 	closeCh     chan struct{}
+	admission   *admission
+	// limiters the limiters shared by all the sessions.
+	limiters session.Limiters
+
+	accepts      atomic.Uint64
+	acceptErrors atomic.Uint64
+	// closedStats the statistics summed over the closed sessions.
+	closedStats session.Stats
 }
 
 // NewServer init the server
@@ -48,8 +62,7 @@ type Server struct {
 // address like 127.0.0.1:8000、localhost:8000.
 func NewServer(network, address string, opts ...ServerOption) *Server {
 	s := &Server{
-		poller:   poll.PollerManager.Pick(),
-		sessions: make(map[session.Session]struct{}),
+		sessions: make(map[session.Session]netip.Addr),
 		closeCh:  make(chan struct{}),
 	}
 
@@ -58,25 +71,39 @@ func NewServer(network, address string, opts ...ServerOption) *Server {
 		opt(&s.ServerOptions)
 	}
 
+	s.admission = newAdmission(s.admissionOptions)
+	s.limiters = s.serverLimit.newLimiters()
 	return s
 }
 
-// Server listen and run event-loop
+// Server listen and run event-loop, it blocks until the server is shut down.
 func (s *Server) Server() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	s.waitQuit()
+	return nil
+}
+
+// Listen listen on the address and serve the accepted connections without blocking, the connections can be
+// dialed once it returns. it is optional before Server.
+func (s *Server) Listen() error {
+	if s.tcpListener != nil {
+		return nil
+	}
+
 	switch s.network {
 	case "tcp":
-		return s.tcpServer()
+		return s.listenTcp()
 	default:
 		return fmt.Errorf("server not support network:%v", s.network)
 	}
 }
 
-func (s *Server) tcpServer() error {
-	if err := s.listenTcp(); err != nil {
-		return err
-	}
-
-	return nil
+// Addr return the address the server listens on, the port chosen by the system is set once it listens.
+func (s *Server) Addr() string {
+	return s.address
 }
 
 func (s *Server) listenTcp() error {
@@ -86,16 +113,26 @@ func (s *Server) listenTcp() error {
 		return err
 	}
 
-	streamListener, err := net.Listen(s.network, address.String())
+	if s.loops, s.ownLoops, err = s.eventLoops.newLoops(); err != nil {
+		return err
+	}
+
+	s.poller = s.loops.Pick()
+	streamListener, err := net.Listen(s.network, address.String(), s.loops)
 	if err != nil {
+		if s.ownLoops {
+			_ = s.loops.Close()
+		}
 		return err
 	}
 
 	s.tcpListener, s.address = streamListener, streamListener.Addr().String()
+	s.tcpListener.SetAdmitFunc(s.admission.admit)
 	s.netFd = &poll.NetFileDesc{
 		FD: s.tcpListener.FD(),
 		NetPollListener: poll.NetPollListener{
-			OnRead: s.onRead,
+			OnRead:   s.onRead,
+			OnAccept: s.onAccept,
 		},
 	}
 	if err := s.poller.Register(s.netFd, poll.Read); err != nil {
@@ -103,7 +140,7 @@ func (s *Server) listenTcp() error {
 	}
 
 	log.Infof("sever started listen on: [%s]....", s.address)
-	s.waitQuit()
+	reportMetrics(s.metrics, s, s.closeCh)
 	return nil
 }
 
@@ -112,26 +149,124 @@ func (s *Server) onRead() error {
 		return errors.ServerClosedErr
 	}
 
+	// the edge-triggered listener fd will not be reported again until a new connection arrives,
+	// so all the pending connections need to be accepted.
+	if s.poller.Options().TriggerMode == poll.EdgeTriggered {
+		for {
+			netConn, err := s.accept()
+			if err != nil || netConn == nil {
+				return err
+			}
+
+			if err := s.serveConn(netConn); err != nil {
+				log.Errorf("server serve conn err:%v", err)
+			}
+		}
+	}
+
+	netConn, err := s.accept()
+	if err != nil || netConn == nil {
+		return err
+	}
+
+	return s.serveConn(netConn)
+}
+
+func (s *Server) accept() (connection.Connection, error) {
 	netConn, err := s.tcpListener.Accept()
 	if err != nil {
+		s.acceptErrors.Inc()
+	}
+	return netConn, err
+}
+
+// onAccept runs when the completion-based poller accepts a connection.
+func (s *Server) onAccept(fd int) error {
+	if !s.isActive() {
+		_ = syscall.Close(fd)
+		return errors.ServerClosedErr
+	}
+
+	netConn, err := s.tcpListener.AcceptFd(fd)
+	if err != nil {
+		s.acceptErrors.Inc()
 		return err
 	}
+	if netConn == nil {
+		return nil
+	}
+
+	return s.serveConn(netConn)
+}
 
+func (s *Server) serveConn(netConn connection.Connection) error {
+	s.accepts.Inc()
+	// the admitted connection is released with its session, or now if the session is not served.
+	ip := remoteIP(netConn)
 	newSession := session.NewSession(netConn)
-	if err := s.newSession(newSession); err != nil {
+	if s.proxyProtocol {
+		// the session is set up after the PROXY protocol header.
+		if err := session.AcceptProxy(newSession, s.newSession, s.proxyOptions...); err != nil {
+			s.admission.release(ip)
+			_ = netConn.Close()
+			return err
+		}
+	} else if err := s.newSession(newSession); err != nil {
+		s.admission.release(ip)
+		_ = netConn.Close()
+		return err
+	}
+
+	s.setLimiters(newSession)
+	// the connection is closed out of the lock, its close callback removes the session with the lock.
+	if err := s.runSession(newSession, netConn, ip); err != nil {
+		newSession.Logger().Log(log.ErrorLevel, "server session run err", log.Err(err))
+		_ = netConn.Close()
 		return err
 	}
 
+	return nil
+}
+
+// runSession run the session and register its connection, the failed session is removed and its
+// admission is released.
+func (s *Server) runSession(newSession session.Session, netConn connection.Connection, ip netip.Addr) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.sessions[newSession] = struct{}{}
+	s.sessions[newSession] = ip
 	newSession.SetCloseCallBackFunc(s.onSessionClose)
-	if err := newSession.Run(); err != nil {
-		log.Errorf("server session run err:%v", err)
-		return err
+	err := newSession.Run()
+	if err == nil {
+		err = netConn.Register(poll.Read)
+	}
+	if err != nil {
+		delete(s.sessions, newSession)
+		s.admission.release(ip)
+	}
+	return err
+}
+
+// setLimiters set the limiters of the session and the ones shared by all the sessions.
+func (s *Server) setLimiters(ss session.Session) {
+	var limiters []session.Limiters
+	if s.sessionLimit.limited() {
+		limiters = append(limiters, s.sessionLimit.newLimiters())
+	}
+	if s.serverLimit.limited() {
+		limiters = append(limiters, s.limiters)
+	}
+	if len(limiters) > 0 {
+		ss.SetLimiters(limiters...)
 	}
+}
 
-	return netConn.Register(poll.Read)
+// remoteIP return the ip the connection is accepted from, it is the key of the admission.
+func remoteIP(netConn connection.Connection) netip.Addr {
+	addr, err := netip.ParseAddrPort(netConn.RemoteAddr())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Addr().Unmap()
 }
 
 func (s *Server) waitQuit() {
@@ -144,7 +279,17 @@ func (s *Server) onSessionClose(session session.Session) {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ip, ok := s.sessions[session]
+	if !ok {
+		return
+	}
+
 	delete(s.sessions, session)
+	s.admission.release(ip)
+	stats := session.Stats()
+	// nothing of a closed session is buffered anymore.
+	stats.OutputBuffered = 0
+	s.closedStats = s.closedStats.Add(stats)
 }
 
 func (s *Server) isActive() bool {
@@ -167,6 +312,10 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		default:
 			s.closeServerCloseCh()
 			if s.tcpListener != nil {
+				// the loops may be shared with others, only the listener fd is removed from the poller.
+				if err := s.poller.Register(s.netFd, poll.DeleteRead); err != nil {
+					log.Errorf("poller unregister tcpListener err caused by:%s", err.Error())
+				}
 				if err := s.tcpListener.Close(); err != nil {
 					log.Errorf("tcpListener closeCh err caused by:%s", err.Error())
 				}
@@ -180,7 +329,10 @@ func (s *Server) Shutdown(ctx context.Context) error {
 			}
 			s.mu.Unlock()
 			s.sessions = nil
-			return s.poller.Close()
+			if s.ownLoops {
+				return s.loops.Close()
+			}
+			return nil
 		}
 	}
 }
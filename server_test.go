@@ -0,0 +1,62 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Softwarekang/knetty/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ListenIPv6(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 is unavailable:%v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	connected := make(chan struct{}, 1)
+	server := NewServer("tcp", "[::1]:0", WithServiceNewSessionCallBackFunc(func(s session.Session) error {
+		s.SetCodec(nopCodec{})
+		s.SetEventListener(connectListener{connected: connected})
+		return nil
+	}))
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = server.Server()
+	}()
+	defer server.Shutdown(context.Background())
+
+	// the port chosen by the system is reported.
+	host, port, err := net.SplitHostPort(server.Addr())
+	assert.Nil(t, err)
+	assert.Equal(t, "::1", host)
+	assert.NotEqual(t, "0", port)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	waitConnected(t, connected)
+}
@@ -0,0 +1,75 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"time"
+
+	"github.com/Softwarekang/knetty/pkg/ratelimit"
+)
+
+// Limiters the token bucket limiters of reading a session, the nil limiters are unlimited.
+// the limiters can be shared by the sessions to limit them in aggregate.
+type Limiters struct {
+	// Bytes the limiter of the bytes read from the network.
+	Bytes *ratelimit.Limiter
+	// Messages the limiter of the messages decoded.
+	Messages *ratelimit.Limiter
+}
+
+type limitersHolder struct {
+	limiters []Limiters
+}
+
+// SetLimiters implements Session.
+func (s *session) SetLimiters(limiters ...Limiters) {
+	s.limiters.Store(limitersHolder{limiters})
+}
+
+// throttle take the bytes read from the network and the messages decoded from the limiters, the reading of
+// the connection is paused until the tokens taken in advance are refilled, so the network data is not buffered
+// without bound. it runs on the event loop after the read bytes are counted by OnConnRead.
+func (s *session) throttle(messages int) {
+	bytes := s.readBytes
+	s.readBytes = 0
+	holder, _ := s.limiters.Load().(limitersHolder)
+	if len(holder.limiters) == 0 || (bytes == 0 && messages == 0) {
+		return
+	}
+
+	var delay time.Duration
+	now := time.Now()
+	for _, limiters := range holder.limiters {
+		if limiters.Bytes != nil && bytes > 0 {
+			delay = maxDuration(delay, limiters.Bytes.ReserveN(now, bytes))
+		}
+		if limiters.Messages != nil && messages > 0 {
+			delay = maxDuration(delay, limiters.Messages.ReserveN(now, messages))
+		}
+	}
+
+	if delay > 0 && s.conn.PauseRead(delay) {
+		s.throttled.Add(delay)
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return b
+	}
+	return a
+}
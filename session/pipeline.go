@@ -0,0 +1,391 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	merr "github.com/Softwarekang/knetty/pkg/err"
+)
+
+// Handler a stage of the pipeline, it must implement InboundHandler, OutboundHandler or both.
+type Handler interface{}
+
+// InboundHandler handles the messages read from the network, from the head to the tail of the pipeline.
+type InboundHandler interface {
+	// HandleRead handles msg and passes the result to the next inbound handler by ctx.FireRead
+	HandleRead(ctx HandlerContext, msg interface{}) error
+}
+
+// OutboundHandler handles the messages written to the network, from the tail to the head of the pipeline.
+type OutboundHandler interface {
+	// HandleWrite handles msg and passes the result to the previous outbound handler by ctx.Write
+	HandleWrite(ctx HandlerContext, msg interface{}) error
+}
+
+// InboundHandlerFunc adapts a function to InboundHandler.
+type InboundHandlerFunc func(ctx HandlerContext, msg interface{}) error
+
+// HandleRead implements InboundHandler.
+func (f InboundHandlerFunc) HandleRead(ctx HandlerContext, msg interface{}) error {
+	return f(ctx, msg)
+}
+
+// OutboundHandlerFunc adapts a function to OutboundHandler.
+type OutboundHandlerFunc func(ctx HandlerContext, msg interface{}) error
+
+// HandleWrite implements OutboundHandler.
+func (f OutboundHandlerFunc) HandleWrite(ctx HandlerContext, msg interface{}) error {
+	return f(ctx, msg)
+}
+
+// HandlerContext the context of a handler in the pipeline.
+type HandlerContext interface {
+	// Name return the name of the handler
+	Name() string
+	// Session return the session owning the pipeline
+	Session() Session
+	// Pipeline return the pipeline the handler belongs to
+	Pipeline() Pipeline
+	// FireRead pass msg to the next inbound handler, the last one is the EventListener of the session
+	FireRead(msg interface{}) error
+	// Write pass msg to the previous outbound handler, the first one writes msg to the conn buffer,
+	// msg must be []byte when it reaches the head, unless the session has a codec to encode it.
+	Write(msg interface{}) error
+}
+
+// Pipeline an ordered chain of handlers around the session, the messages decoded by the codec of the session
+// are passed through the inbound handlers to the EventListener, and the messages written by WritePkg are passed
+// through the outbound handlers to the codec. if the session has no codec, the inbound handlers receive the
+// network data as []byte, and the outbound handlers must produce []byte.
+// handlers can be added, removed and replaced at runtime, even by the handlers themselves.
+type Pipeline interface {
+	// AddFirst add handler at the head of the pipeline
+	AddFirst(name string, handler Handler) error
+	// AddLast add handler at the tail of the pipeline
+	AddLast(name string, handler Handler) error
+	// AddBefore add handler before the handler named baseName
+	AddBefore(baseName, name string, handler Handler) error
+	// AddAfter add handler after the handler named baseName
+	AddAfter(baseName, name string, handler Handler) error
+	// Remove the handler named name
+	Remove(name string) error
+	// Replace the handler named oldName with handler named name
+	Replace(oldName, name string, handler Handler) error
+	// Get return the handler named name, or nil if there is no such handler
+	Get(name string) Handler
+	// Names return the names of the handlers from the head to the tail
+	Names() []string
+}
+
+type pipeline struct {
+	session *session
+	mu      sync.RWMutex
+	head    *handlerContext
+	tail    *handlerContext
+	names   map[string]*handlerContext
+	// outbounds the number of the outbound handlers
+	outbounds int
+}
+
+type handlerContext struct {
+	pipeline *pipeline
+	name     string
+	handler  Handler
+	inbound  InboundHandler
+	outbound OutboundHandler
+	// prev and next are kept after the handler is removed, so a removed handler can still pass
+	// the message it is handling.
+	prev, next *handlerContext
+}
+
+func newPipeline(s *session) *pipeline {
+	p := &pipeline{session: s, names: make(map[string]*handlerContext)}
+	p.head = &handlerContext{pipeline: p, name: "head", outbound: OutboundHandlerFunc(s.writeToConn)}
+	p.tail = &handlerContext{pipeline: p, name: "tail", inbound: InboundHandlerFunc(s.onMessage)}
+	p.head.next, p.tail.prev = p.tail, p.head
+	return p
+}
+
+// AddFirst implements Pipeline.
+func (p *pipeline) AddFirst(name string, handler Handler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.insertAfter(p.head, name, handler)
+}
+
+// AddLast implements Pipeline.
+func (p *pipeline) AddLast(name string, handler Handler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.insertAfter(p.tail.prev, name, handler)
+}
+
+// AddBefore implements Pipeline.
+func (p *pipeline) AddBefore(baseName, name string, handler Handler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	base, err := p.context(baseName)
+	if err != nil {
+		return err
+	}
+
+	return p.insertAfter(base.prev, name, handler)
+}
+
+// AddAfter implements Pipeline.
+func (p *pipeline) AddAfter(baseName, name string, handler Handler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	base, err := p.context(baseName)
+	if err != nil {
+		return err
+	}
+
+	return p.insertAfter(base, name, handler)
+}
+
+// Remove implements Pipeline.
+func (p *pipeline) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ctx, err := p.context(name)
+	if err != nil {
+		return err
+	}
+
+	p.remove(ctx)
+	return nil
+}
+
+// Replace implements Pipeline.
+func (p *pipeline) Replace(oldName, name string, handler Handler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, err := p.context(oldName)
+	if err != nil {
+		return err
+	}
+
+	if oldName != name {
+		if _, ok := p.names[name]; ok {
+			return fmt.Errorf("duplicate handler name:%s", name)
+		}
+	}
+
+	ctx, err := p.newContext(name, handler)
+	if err != nil {
+		return err
+	}
+
+	prev := old.prev
+	p.remove(old)
+	p.link(prev, ctx)
+	return nil
+}
+
+// Get implements Pipeline.
+func (p *pipeline) Get(name string) Handler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if ctx, ok := p.names[name]; ok {
+		return ctx.handler
+	}
+
+	return nil
+}
+
+// Names implements Pipeline.
+func (p *pipeline) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.names))
+	for ctx := p.head.next; ctx != p.tail; ctx = ctx.next {
+		names = append(names, ctx.name)
+	}
+	return names
+}
+
+func (p *pipeline) context(name string) (*handlerContext, error) {
+	ctx, ok := p.names[name]
+	if !ok {
+		return nil, fmt.Errorf("handler:%s not found", name)
+	}
+
+	return ctx, nil
+}
+
+func (p *pipeline) newContext(name string, handler Handler) (*handlerContext, error) {
+	if name == "" {
+		return nil, errors.New("handler name is empty")
+	}
+
+	ctx := &handlerContext{pipeline: p, name: name, handler: handler}
+	ctx.inbound, _ = handler.(InboundHandler)
+	ctx.outbound, _ = handler.(OutboundHandler)
+	if ctx.inbound == nil && ctx.outbound == nil {
+		return nil, fmt.Errorf("handler:%s implements neither InboundHandler nor OutboundHandler", name)
+	}
+
+	return ctx, nil
+}
+
+func (p *pipeline) insertAfter(prev *handlerContext, name string, handler Handler) error {
+	if _, ok := p.names[name]; ok {
+		return fmt.Errorf("duplicate handler name:%s", name)
+	}
+
+	ctx, err := p.newContext(name, handler)
+	if err != nil {
+		return err
+	}
+
+	p.link(prev, ctx)
+	return nil
+}
+
+func (p *pipeline) link(prev, ctx *handlerContext) {
+	ctx.prev, ctx.next = prev, prev.next
+	prev.next.prev = ctx
+	prev.next = ctx
+	p.names[ctx.name] = ctx
+	if ctx.outbound != nil {
+		p.outbounds++
+	}
+}
+
+func (p *pipeline) remove(ctx *handlerContext) {
+	ctx.prev.next = ctx.next
+	ctx.next.prev = ctx.prev
+	delete(p.names, ctx.name)
+	if ctx.outbound != nil {
+		p.outbounds--
+	}
+}
+
+// hasOutbounds return whether there are outbound handlers in the pipeline.
+func (p *pipeline) hasOutbounds() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.outbounds > 0
+}
+
+// fireRead pass msg from the head of the pipeline.
+func (p *pipeline) fireRead(msg interface{}) error {
+	return p.head.FireRead(msg)
+}
+
+// write pass msg from the tail of the pipeline.
+func (p *pipeline) write(msg interface{}) error {
+	return p.tail.Write(msg)
+}
+
+// Name implements HandlerContext.
+func (c *handlerContext) Name() string {
+	return c.name
+}
+
+// Session implements HandlerContext.
+func (c *handlerContext) Session() Session {
+	return c.pipeline.session
+}
+
+// Pipeline implements HandlerContext.
+func (c *handlerContext) Pipeline() Pipeline {
+	return c.pipeline
+}
+
+// FireRead implements HandlerContext.
+func (c *handlerContext) FireRead(msg interface{}) error {
+	c.pipeline.mu.RLock()
+	next := c.next
+	for next.inbound == nil {
+		next = next.next
+	}
+	c.pipeline.mu.RUnlock()
+	return next.inbound.HandleRead(next, msg)
+}
+
+// Write implements HandlerContext.
+func (c *handlerContext) Write(msg interface{}) error {
+	c.pipeline.mu.RLock()
+	prev := c.prev
+	for prev.outbound == nil {
+		prev = prev.prev
+	}
+	c.pipeline.mu.RUnlock()
+	return prev.outbound.HandleWrite(prev, msg)
+}
+
+// codecHandler the pipeline stage of Codec.
+type codecHandler struct {
+	codec Codec
+	// cumulation the inbound data not yet decoded as a whole package.
+	cumulation []byte
+}
+
+// NewCodecHandler return a pipeline stage decoding the inbound []byte and encoding the outbound messages by codec,
+// the half package is kept until the rest data arrives.
+func NewCodecHandler(codec Codec) Handler {
+	return &codecHandler{codec: codec}
+}
+
+// HandleRead implements InboundHandler.
+func (c *codecHandler) HandleRead(ctx HandlerContext, msg interface{}) error {
+	data, ok := msg.([]byte)
+	if !ok {
+		return ctx.FireRead(msg)
+	}
+
+	if len(c.cumulation) > 0 {
+		data = append(c.cumulation, data...)
+	}
+
+	for len(data) > 0 {
+		pkg, pkgLen, err := c.codec.Decode(data)
+		if err != nil {
+			c.cumulation = nil
+			return newOpError(ctx.Session(), merr.OpDecode, err)
+		}
+
+		if pkg == nil {
+			break
+		}
+
+		data = data[pkgLen:]
+		if err := ctx.FireRead(pkg); err != nil {
+			c.cumulation = append(c.cumulation[:0], data...)
+			return err
+		}
+	}
+
+	// copy the half package, data may be reused by the previous handler.
+	c.cumulation = append(c.cumulation[:0], data...)
+	return nil
+}
+
+// HandleWrite implements OutboundHandler.
+func (c *codecHandler) HandleWrite(ctx HandlerContext, msg interface{}) error {
+	data, err := c.codec.Encode(msg)
+	if err != nil {
+		return newOpError(ctx.Session(), merr.OpEncode, err)
+	}
+
+	return ctx.Write(data)
+}
@@ -0,0 +1,223 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Softwarekang/knetty/internal/net/connection"
+	merr "github.com/Softwarekang/knetty/pkg/err"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	connection.Connection
+	output bytes.Buffer
+}
+
+func (f *fakeConn) WriteBuffer(data []byte) (int, error) {
+	return f.output.Write(data)
+}
+
+func (f *fakeConn) ID() uint64 {
+	return 1
+}
+
+func (f *fakeConn) Type() connection.ConnType {
+	return connection.TCPCONNECTION
+}
+
+func (f *fakeConn) LocalAddr() string {
+	return "127.0.0.1:8000"
+}
+
+func (f *fakeConn) RemoteAddr() string {
+	return "127.0.0.1:9000"
+}
+
+func (f *fakeConn) SetEventTrigger(connection.EventTrigger) {}
+
+// lineCodec splits the data by '\n'.
+type lineCodec struct{}
+
+func (lineCodec) Encode(pkg interface{}) ([]byte, error) {
+	return []byte(pkg.(string) + "\n"), nil
+}
+
+func (lineCodec) Decode(data []byte) (interface{}, int, error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx < 0 {
+		return nil, 0, nil
+	}
+	return string(data[:idx]), idx + 1, nil
+}
+
+type recordListener struct {
+	messages []interface{}
+	errs     []error
+}
+
+func (r *recordListener) OnConnect(Session) {}
+
+func (r *recordListener) OnMessage(_ Session, pkg interface{}) ExecStatus {
+	r.messages = append(r.messages, pkg)
+	return Normal
+}
+
+func (r *recordListener) OnError(_ Session, e error) {
+	r.errs = append(r.errs, e)
+}
+
+func (r *recordListener) OnClose(Session) {}
+
+func upperHandler() Handler {
+	return InboundHandlerFunc(func(ctx HandlerContext, msg interface{}) error {
+		return ctx.FireRead(strings.ToUpper(msg.(string)))
+	})
+}
+
+func newTestSession(t *testing.T, codec Codec) (*session, *fakeConn, *recordListener) {
+	conn := &fakeConn{}
+	listener := &recordListener{}
+	s := NewSession(conn).(*session)
+	if codec != nil {
+		s.SetCodec(codec)
+	}
+	s.SetEventListener(listener)
+	return s, conn, listener
+}
+
+func TestPipeline_Codec(t *testing.T) {
+	s, conn, listener := newTestSession(t, lineCodec{})
+	assert.Nil(t, s.Pipeline().AddLast("upper", upperHandler()))
+	assert.Nil(t, s.Pipeline().AddFirst("prefix", OutboundHandlerFunc(func(ctx HandlerContext, msg interface{}) error {
+		return ctx.Write("> " + msg.(string))
+	})))
+	assert.Nil(t, s.Run())
+
+	assert.Equal(t, 8, s.handlePkg([]byte("foo\nbar\nba")))
+	assert.Equal(t, []interface{}{"FOO", "BAR"}, listener.messages)
+
+	_, err := s.WritePkg("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "> hello\n", conn.output.String())
+}
+
+func TestPipeline_CodecHandler(t *testing.T) {
+	s, conn, listener := newTestSession(t, nil)
+	assert.NotNil(t, s.Run())
+	assert.Nil(t, s.Pipeline().AddLast("codec", NewCodecHandler(lineCodec{})))
+	assert.Nil(t, s.Pipeline().AddLast("upper", upperHandler()))
+	assert.Nil(t, s.Run())
+
+	// the codec handler keeps the half package.
+	assert.Equal(t, 6, s.handlePkg([]byte("foo\nba")))
+	assert.Equal(t, 2, s.handlePkg([]byte("r\n")))
+	assert.Equal(t, []interface{}{"FOO", "BAR"}, listener.messages)
+
+	_, err := s.WritePkg("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\n", conn.output.String())
+}
+
+func TestPipeline_Modify(t *testing.T) {
+	s, _, listener := newTestSession(t, lineCodec{})
+	p := s.Pipeline()
+	assert.Nil(t, p.AddLast("b", upperHandler()))
+	assert.Nil(t, p.AddBefore("b", "a", upperHandler()))
+	assert.Nil(t, p.AddAfter("b", "c", upperHandler()))
+	assert.Equal(t, []string{"a", "b", "c"}, p.Names())
+	assert.NotNil(t, p.AddLast("a", upperHandler()))
+	assert.NotNil(t, p.AddLast("d", struct{}{}))
+	assert.NotNil(t, p.Remove("d"))
+
+	// the handler removes itself after handling the first message.
+	assert.Nil(t, p.Replace("b", "once", InboundHandlerFunc(func(ctx HandlerContext, msg interface{}) error {
+		if err := ctx.Pipeline().Remove(ctx.Name()); err != nil {
+			return err
+		}
+		return ctx.FireRead(msg.(string) + "!")
+	})))
+	assert.Nil(t, p.Remove("a"))
+	assert.Nil(t, p.Remove("c"))
+	assert.Equal(t, []string{"once"}, p.Names())
+	assert.Nil(t, s.Run())
+
+	s.handlePkg([]byte("foo\nbar\n"))
+	assert.Equal(t, []interface{}{"foo!", "bar"}, listener.messages)
+	assert.Nil(t, p.Get("once"))
+}
+
+func TestPipeline_Error(t *testing.T) {
+	s, _, listener := newTestSession(t, lineCodec{})
+	errAuth := errors.New("unauthorized")
+	assert.Nil(t, s.Pipeline().AddLast("auth", InboundHandlerFunc(func(ctx HandlerContext, msg interface{}) error {
+		if msg != "token" {
+			return errAuth
+		}
+		return ctx.FireRead(msg)
+	})))
+	assert.Nil(t, s.Run())
+
+	assert.Equal(t, 10, s.handlePkg([]byte("token\nfoo\n")))
+	assert.Equal(t, []interface{}{"token"}, listener.messages)
+	assert.Equal(t, []error{errAuth}, listener.errs)
+}
+
+// failCodec can not decode the data.
+type failCodec struct{}
+
+var errBadData = errors.New("bad data")
+
+func (failCodec) Encode(interface{}) ([]byte, error) {
+	return nil, errBadData
+}
+
+func (failCodec) Decode([]byte) (interface{}, int, error) {
+	return nil, 0, errBadData
+}
+
+func TestPipeline_OpError(t *testing.T) {
+	s, _, listener := newTestSession(t, nil)
+	assert.Nil(t, s.Pipeline().AddLast("codec", NewCodecHandler(failCodec{})))
+	assert.Nil(t, s.Run())
+
+	s.handlePkg([]byte("foo"))
+	if assert.Len(t, listener.errs, 1) {
+		err := listener.errs[0]
+		var opErr *merr.OpError
+		assert.True(t, errors.As(err, &opErr))
+		assert.True(t, errors.Is(err, errBadData))
+		assert.True(t, merr.IsOp(err, merr.OpDecode))
+		assert.Equal(t, uint64(1), opErr.SessionID)
+		assert.Equal(t, "decode session 1 127.0.0.1:8000->127.0.0.1:9000: bad data", err.Error())
+	}
+
+	_, err := s.WritePkg("foo")
+	assert.True(t, merr.IsOp(err, merr.OpEncode))
+	assert.True(t, errors.Is(err, errBadData))
+}
+
+func TestIDOf(t *testing.T) {
+	assert.Equal(t, uint64(1), IDOf(NewSession(&fakeConn{})))
+	// the sessions without the ID method.
+	assert.Equal(t, uint64(0), IDOf(struct{ Session }{}))
+}
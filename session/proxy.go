@@ -0,0 +1,199 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/pkg/proxyproto"
+)
+
+const (
+	// DefaultProxyHeaderTimeout the default time limit of receiving the PROXY protocol header.
+	DefaultProxyHeaderTimeout = 5 * time.Second
+)
+
+// ErrUntrustedProxy the connection comes from a source not trusted to send the PROXY protocol header.
+var ErrUntrustedProxy = errors.New("untrusted proxy protocol source")
+
+// ProxyOption option for the PROXY protocol.
+type ProxyOption func(*proxyOptions)
+
+type proxyOptions struct {
+	trusted       []netip.Prefix
+	headerTimeout time.Duration
+}
+
+// WithProxyTrustedSources set the networks of the proxies, the connections from other sources are rejected.
+// all the sources are trusted by default.
+func WithProxyTrustedSources(prefixes ...netip.Prefix) ProxyOption {
+	return func(opt *proxyOptions) {
+		opt.trusted = append(opt.trusted, prefixes...)
+	}
+}
+
+// WithProxyHeaderTimeout set the time limit of receiving the header, the session is closed when it expires,
+// zero disables the limit.
+func WithProxyHeaderTimeout(d time.Duration) ProxyOption {
+	return func(opt *proxyOptions) {
+		opt.headerTimeout = d
+	}
+}
+
+// proxyAcceptor parses the PROXY protocol header of the session, it works as the codec and the eventListener
+// of the session until the header is parsed, then the session is set up by the setup.
+type proxyAcceptor struct {
+	session Session
+	setup   func(s Session) error
+	mu      sync.Mutex
+	timer   *time.Timer
+	done    bool
+}
+
+// AcceptProxy set the session parsing the PROXY protocol header before setup, the header is consumed and
+// the addresses of the session are replaced by the addresses of the header, then the session is set up by setup
+// and the OnConnect of its eventListener runs. ErrUntrustedProxy is returned if the remote address of the
+// connection is not one of the trusted sources, the session should be closed by the caller.
+func AcceptProxy(s Session, setup func(s Session) error, opts ...ProxyOption) error {
+	options := &proxyOptions{headerTimeout: DefaultProxyHeaderTimeout}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if !options.trust(s.RemoteAddr()) {
+		return fmt.Errorf("%w: %s", ErrUntrustedProxy, s.RemoteAddr())
+	}
+
+	a := &proxyAcceptor{session: s, setup: setup}
+	s.SetCodec(a)
+	s.SetEventListener(a)
+	if options.headerTimeout > 0 {
+		a.timer = time.AfterFunc(options.headerTimeout, a.onTimeout)
+	}
+	return nil
+}
+
+func (o *proxyOptions) trust(remoteAddr string) bool {
+	if len(o.trusted) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range o.trusted {
+		if prefix.Contains(addr.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyHeader return the PROXY protocol header of the session, nil if the session is not accepted by AcceptProxy.
+func ProxyHeader(s Session) *proxyproto.Header {
+	if ss, ok := s.(*session); ok {
+		return ss.proxyHeader()
+	}
+	return nil
+}
+
+// Encode implements Codec.
+func (a *proxyAcceptor) Encode(interface{}) ([]byte, error) {
+	return nil, errors.New("session proxy protocol header is not received yet")
+}
+
+// Decode implements Codec, the header is passed to OnMessage.
+func (a *proxyAcceptor) Decode(data []byte) (interface{}, int, error) {
+	header, n, err := proxyproto.Parse(data)
+	if err != nil || header == nil {
+		return nil, 0, err
+	}
+	return header, n, nil
+}
+
+// OnConnect implements EventListener.
+func (a *proxyAcceptor) OnConnect(Session) {}
+
+// OnMessage implements EventListener, it installs the setup after the header.
+func (a *proxyAcceptor) OnMessage(s Session, pkg interface{}) ExecStatus {
+	header, ok := pkg.(*proxyproto.Header)
+	if !ok || !a.stopTimer() {
+		return Normal
+	}
+
+	if ss, ok := s.(*session); ok {
+		ss.proxy.Store(header)
+	}
+	if err := a.setup(s); err != nil {
+		a.OnError(s, fmt.Errorf("setup session after proxy protocol header err:%w", err))
+		return Normal
+	}
+	if s.EventListener() == EventListener(a) {
+		a.OnError(s, errors.New("setup session after proxy protocol header without eventListener"))
+		return Normal
+	}
+	if s.Codec() == Codec(a) {
+		s.SetCodec(nil)
+	}
+
+	s.EventListener().OnConnect(s)
+	return Normal
+}
+
+// OnError implements EventListener, the session is closed if the header is invalid.
+func (a *proxyAcceptor) OnError(s Session, e error) {
+	a.stopTimer()
+	s.Logger().Log(log.ErrorLevel, "proxy protocol err", log.Err(e))
+	if err := s.Close(); err != nil {
+		s.Logger().Log(log.ErrorLevel, "close session err", log.Err(err))
+	}
+}
+
+// OnClose implements EventListener.
+func (a *proxyAcceptor) OnClose(Session) {
+	a.stopTimer()
+}
+
+// stopTimer stop the header timer, return false if the header has been handled or the timer expired.
+func (a *proxyAcceptor) stopTimer() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.done {
+		return false
+	}
+	a.done = true
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	return true
+}
+
+func (a *proxyAcceptor) onTimeout() {
+	if !a.stopTimer() {
+		return
+	}
+	a.session.Logger().Log(log.ErrorLevel, "proxy protocol header timeout")
+	if err := a.session.Close(); err != nil {
+		a.session.Logger().Log(log.ErrorLevel, "close session err", log.Err(err))
+	}
+}
@@ -0,0 +1,78 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptProxy(t *testing.T) {
+	listener := &recordListener{}
+	setup := func(s Session) error {
+		s.SetCodec(lineCodec{})
+		s.SetEventListener(listener)
+		return nil
+	}
+
+	s := NewSession(&fakeConn{}).(*session)
+	assert.Nil(t, AcceptProxy(s, setup, WithProxyTrustedSources(netip.MustParsePrefix("127.0.0.0/8"))))
+	assert.Nil(t, s.Run())
+	assert.Equal(t, "127.0.0.1:9000", s.RemoteAddr())
+	// the half header.
+	assert.Equal(t, 0, s.handlePkg([]byte("PROXY TCP4 192.0.2.1")))
+	data := "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello\n"
+	assert.Equal(t, len(data), s.handlePkg([]byte(data)))
+	assert.Equal(t, []interface{}{"hello"}, listener.messages)
+	assert.Equal(t, "192.0.2.1:56324", s.RemoteAddr())
+	assert.Equal(t, "198.51.100.1:443", s.LocalAddr())
+	assert.Equal(t, byte(1), ProxyHeader(s).Version)
+
+	// the LOCAL command keeps the addresses of the connection.
+	s = NewSession(&fakeConn{}).(*session)
+	assert.Nil(t, AcceptProxy(s, setup))
+	assert.Nil(t, s.Run())
+	local := []byte("\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00")
+	assert.Equal(t, len(local), s.handlePkg(local))
+	assert.Equal(t, "127.0.0.1:9000", s.RemoteAddr())
+	assert.NotNil(t, ProxyHeader(s))
+
+	// the untrusted source.
+	s = NewSession(&fakeConn{}).(*session)
+	err := AcceptProxy(s, setup, WithProxyTrustedSources(netip.MustParsePrefix("10.0.0.0/8")))
+	assert.True(t, errors.Is(err, ErrUntrustedProxy))
+
+	// the connection without the header.
+	conn := &closableConn{}
+	s = NewSession(conn).(*session)
+	assert.Nil(t, AcceptProxy(s, setup))
+	assert.Nil(t, s.Run())
+	s.handlePkg([]byte("GET / HTTP/1.1\r\n"))
+	assert.True(t, conn.closed)
+	assert.Nil(t, ProxyHeader(s))
+
+	// the header timeout.
+	conn = &closableConn{}
+	s = NewSession(conn).(*session)
+	assert.Nil(t, AcceptProxy(s, setup, WithProxyHeaderTimeout(10*time.Millisecond)))
+	assert.Nil(t, s.Run())
+	assert.Eventually(t, func() bool { return !s.isActive() }, time.Second, 5*time.Millisecond)
+}
@@ -23,6 +23,8 @@ import (
 
 	"github.com/Softwarekang/knetty/internal/net/connection"
 	merr "github.com/Softwarekang/knetty/pkg/err"
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/pkg/proxyproto"
 
 	"go.uber.org/atomic"
 )
@@ -42,10 +44,19 @@ type Session interface {
 	LocalAddr() string
 	// RemoteAddr return remote address (for example, "192.0.2.1:25", "[2001:db8::1]:80")
 	RemoteAddr() string
-	// SetCodec setting yourself codec is necessary, otherwise a panic will occur at runtime
+	// SetCodec setting yourself codec, it can be switched at runtime, e.g. after a protocol upgrade,
+	// the packages after the current one are decoded by the new codec.
+	// a nil codec means the pipeline handlers receive the network data as []byte.
 	SetCodec(Codec)
-	// SetEventListener setting yourself eventListener is necessary, otherwise a panic will occur at runtime
+	// Codec return the codec of the session
+	Codec() Codec
+	// SetEventListener setting yourself eventListener is necessary, otherwise a panic will occur at runtime,
+	// it can be switched at runtime like the codec.
 	SetEventListener(EventListener)
+	// EventListener return the eventListener of the session
+	EventListener() EventListener
+	// Pipeline return the handler pipeline around the codec and the eventListener
+	Pipeline() Pipeline
 	// WritePkg will encode any type of data as a []byte type using the codec and writes it to the conn buffer.
 	// If you want the other end of the network to receive it,
 	// call the FlushBuffer API to send all the data from the conn buffer out
@@ -60,6 +71,12 @@ type Session interface {
 	SetCloseCallBackFunc(fn CloseCallBackFunc)
 	// Info return session info
 	Info() string
+	// Stats return the statistics of the session
+	Stats() Stats
+	// SetLimiters set the limiters of reading the session, the reading is paused while the limits are exceeded.
+	SetLimiters(limiters ...Limiters)
+	// Logger return the logger of the session, its messages carry the connection id and the addresses
+	Logger() log.FieldLogger
 	// Close will stop session
 	Close() error
 }
@@ -67,9 +84,20 @@ type Session interface {
 type session struct {
 	conn            connection.Connection
 	closeCallBackFn CloseCallBackFunc
-	pkgCodec        Codec
-	eventListener   EventListener
+	pkgCodec        atomic.Value
+	codecVersion    atomic.Uint64
+	eventListener   atomic.Value
+	pipeline        *pipeline
 	close           atomic.Int32
+	// proxy the PROXY protocol header of the session.
+	proxy        atomic.Value
+	packetsIn    atomic.Uint64
+	packetsOut   atomic.Uint64
+	decodeErrors atomic.Uint64
+	limiters     atomic.Value
+	throttled    atomic.Duration
+	// readBytes the bytes read from the network and not yet charged to the limiters, it is used by the event loop.
+	readBytes int
 }
 
 // NewSession create new session.
@@ -77,26 +105,64 @@ func NewSession(conn connection.Connection) Session {
 	s := &session{
 		conn: conn,
 	}
+	s.pipeline = newPipeline(s)
 
 	return s
 }
 
-// LocalAddr  implements Session.
+// ID return the id of the connection of the session, it is unique in the process.
+func (s *session) ID() uint64 {
+	return s.conn.ID()
+}
+
+// IDOf return the id of the connection of s, it is zero if s does not report the id by an ID method.
+func IDOf(s Session) uint64 {
+	if identified, ok := s.(interface{ ID() uint64 }); ok {
+		return identified.ID()
+	}
+	return 0
+}
+
+// LocalAddr  implements Session, it is the destination address of the PROXY protocol header if there is one.
 func (s *session) LocalAddr() string {
+	if h := s.proxyHeader(); h != nil && h.Destination.IsValid() {
+		return h.Destination.String()
+	}
 	return s.conn.LocalAddr()
 }
 
-// RemoteAddr implements Session.
+// RemoteAddr implements Session, it is the source address of the PROXY protocol header if there is one.
 func (s *session) RemoteAddr() string {
+	if h := s.proxyHeader(); h != nil && h.Source.IsValid() {
+		return h.Source.String()
+	}
 	return s.conn.RemoteAddr()
 }
 
+func (s *session) proxyHeader() *proxyproto.Header {
+	h, _ := s.proxy.Load().(*proxyproto.Header)
+	return h
+}
+
+// codecHolder and listenerHolder keep the type stored in atomic.Value consistent.
+type codecHolder struct {
+	Codec
+}
+
+type listenerHolder struct {
+	EventListener
+}
+
 // SetCodec implements Session.
 func (s *session) SetCodec(codec Codec) {
-	if codec == nil {
-		panic("codec is nil")
-	}
-	s.pkgCodec = codec
+	s.pkgCodec.Store(codecHolder{codec})
+	s.codecVersion.Inc()
+}
+
+// Codec implements Session.
+func (s *session) Codec() Codec {
+	holder, _ := s.pkgCodec.Load().(codecHolder)
+	return holder.Codec
 }
 
 // SetEventListener implements Session.
@@ -104,19 +170,68 @@ func (s *session) SetEventListener(eventListener EventListener) {
 	if eventListener == nil {
 		panic("eventListener is nil")
 	}
-	s.eventListener = eventListener
+	s.eventListener.Store(listenerHolder{eventListener})
+}
+
+// EventListener implements Session.
+func (s *session) EventListener() EventListener {
+	holder, _ := s.eventListener.Load().(listenerHolder)
+	return holder.EventListener
+}
+
+// Pipeline implements Session.
+func (s *session) Pipeline() Pipeline {
+	return s.pipeline
 }
 
 // WritePkg implements Session.
+// the written length is 0 if pkg is passed through the outbound handlers, they may split, merge or drop it.
 func (s *session) WritePkg(pkg interface{}) (int, error) {
-	data, err := s.pkgCodec.Encode(pkg)
+	if s.pipeline.hasOutbounds() {
+		return 0, s.pipeline.write(pkg)
+	}
+
+	data, err := s.encode(pkg)
 	if err != nil {
-		return 0, err
+		return 0, newOpError(s, merr.OpEncode, err)
 	}
 
+	s.packetsOut.Inc()
 	return s.conn.WriteBuffer(data)
 }
 
+// encode pkg by the codec, pkg must be []byte if the session has no codec.
+func (s *session) encode(pkg interface{}) ([]byte, error) {
+	if codec := s.Codec(); codec != nil {
+		return codec.Encode(pkg)
+	}
+
+	data, ok := pkg.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("session without codec can not write pkg type:%T", pkg)
+	}
+
+	return data, nil
+}
+
+// writeToConn the head of the pipeline writes msg to the conn buffer.
+func (s *session) writeToConn(_ HandlerContext, msg interface{}) error {
+	data, err := s.encode(msg)
+	if err != nil {
+		return newOpError(s, merr.OpEncode, err)
+	}
+
+	s.packetsOut.Inc()
+	_, err = s.conn.WriteBuffer(data)
+	return err
+}
+
+// onMessage the tail of the pipeline notifies the eventListener.
+func (s *session) onMessage(_ HandlerContext, msg interface{}) error {
+	s.EventListener().OnMessage(s, msg)
+	return nil
+}
+
 // WriteBuffer implements Session.
 func (s *session) WriteBuffer(data []byte) (int, error) {
 	return s.conn.WriteBuffer(data)
@@ -129,11 +244,12 @@ func (s *session) FlushBuffer() error {
 
 // Run implements Session.
 func (s *session) Run() error {
-	if s.pkgCodec == nil {
+	// the handlers of the pipeline decode the network data if there is no codec.
+	if s.Codec() == nil && len(s.pipeline.Names()) == 0 {
 		return errors.New("session pkgCodec is nil")
 	}
 
-	if s.eventListener == nil {
+	if s.EventListener() == nil {
 		return errors.New("session eventListener is nil")
 	}
 
@@ -142,7 +258,7 @@ func (s *session) Run() error {
 	}
 
 	// notify listen onConnection func
-	s.eventListener.OnConnect(s)
+	s.EventListener().OnConnect(s)
 	// set conn eventTrigger
 	s.conn.SetEventTrigger(NewSessionEventTrigger(s))
 	return nil
@@ -160,6 +276,11 @@ func (s *session) SetCloseCallBackFunc(fn CloseCallBackFunc) {
 	s.closeCallBackFn = fn
 }
 
+// Logger implements Session.
+func (s *session) Logger() log.FieldLogger {
+	return log.With(log.Any("conn_id", s.ID()), log.Any("local_addr", s.LocalAddr()), log.Any("remote_addr", s.RemoteAddr()))
+}
+
 // Info implements Session.
 func (s *session) Info() string {
 	return fmt.Sprintf("[localAddr:%s remoteAddr:%s]", s.LocalAddr(), s.RemoteAddr())
@@ -175,13 +296,16 @@ func (s *session) handlePkg(buf []byte) (usedBufLen int) {
 	var err error
 	defer func() {
 		if err != nil {
-			s.eventListener.OnError(s, err)
+			s.EventListener().OnError(s, err)
 		}
 	}()
 
 	switch s.conn.Type() {
 	case connection.TCPCONNECTION:
-		if usedBufLen, err = s.handleTcpPkg(buf); err != nil {
+		packetsIn := s.packetsIn.Load()
+		usedBufLen, err = s.handleTcpPkg(buf)
+		s.throttle(int(s.packetsIn.Load() - packetsIn))
+		if err != nil {
 			return
 		}
 	default:
@@ -200,20 +324,37 @@ func (s *session) handleTcpPkg(buf []byte) (int, error) {
 			return processedBufLen, merr.ConnClosedErr
 		}
 
-		pkg, pkgLen, err := s.pkgCodec.Decode(buf)
+		version := s.codecVersion.Load()
+		codec := s.Codec()
+		if codec == nil {
+			if len(buf) == 0 {
+				return processedBufLen, nil
+			}
+
+			// the handlers keep the half package by themselves.
+			s.packetsIn.Inc()
+			return processedBufLen + len(buf), s.pipeline.fireRead(buf)
+		}
+
+		pkg, pkgLen, err := codec.Decode(buf)
 		if err != nil {
-			return processedBufLen, err
+			s.decodeErrors.Inc()
+			return processedBufLen, newOpError(s, merr.OpDecode, err)
 		}
 
 		if pkg == nil {
+			// the codec is switched while decoding, e.g. by the protocol sniffer, decode the data by the new one.
+			if s.codecVersion.Load() != version {
+				continue
+			}
 			return processedBufLen, nil
 		}
 
 		processedBufLen += pkgLen
 		buf = buf[pkgLen:]
-		switch s.eventListener.OnMessage(s, pkg) {
-		case Normal:
-			continue
+		s.packetsIn.Inc()
+		if err := s.pipeline.fireRead(pkg); err != nil {
+			return processedBufLen, err
 		}
 	}
 }
@@ -224,7 +365,7 @@ func (s *session) onClose() {
 	}
 
 	s.close.Store(1)
-	s.eventListener.OnClose(s)
+	s.EventListener().OnClose(s)
 	if s.closeCallBackFn != nil {
 		s.closeCallBackFn(s)
 	}
@@ -244,3 +385,13 @@ func (s WrappedEventTrigger) OnConnReadable(buf []byte) int {
 func (s WrappedEventTrigger) OnConnHup() {
 	s.session.onClose()
 }
+
+// OnConnRead implements connection.ReadNotifier, the bytes are charged to the limiters when they are handled.
+func (s WrappedEventTrigger) OnConnRead(n int) {
+	s.session.readBytes += n
+}
+
+// newOpError wrap the error of op with the session information.
+func newOpError(s Session, op string, err error) error {
+	return &merr.OpError{Op: op, SessionID: IDOf(s), LocalAddr: s.LocalAddr(), RemoteAddr: s.RemoteAddr(), Err: err}
+}
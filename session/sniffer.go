@@ -0,0 +1,241 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+)
+
+const (
+	// defaultSniffMaxBytes the maximum bytes the sniffer peeks before deciding the protocol.
+	defaultSniffMaxBytes = 64
+)
+
+// MatchResult the result of matching the first bytes of a connection with a protocol.
+type MatchResult int
+
+const (
+	// Mismatch the data does not start with the protocol.
+	Mismatch MatchResult = iota
+	// Match the data starts with the protocol.
+	Match
+	// NeedMore the data is not enough to decide.
+	NeedMore
+)
+
+// Matcher peeks the first bytes of a connection to decide whether it speaks a protocol.
+type Matcher func(data []byte) MatchResult
+
+// Protocol a protocol served by the sniffer.
+type Protocol struct {
+	// Name of the protocol
+	Name string
+	// Match decide whether the connection speaks the protocol
+	Match Matcher
+	// Setup install the codec, eventListener and pipeline handlers of the protocol for the session,
+	// the codec is cleared if Setup does not set it, then the pipeline handlers receive the network data.
+	Setup func(s Session) error
+}
+
+// SnifferOption option for the sniffer.
+type SnifferOption func(*sniffer)
+
+// WithSniffFallback set the setup for the connections matching none of the protocols,
+// these connections are closed by default.
+func WithSniffFallback(setup func(s Session) error) SnifferOption {
+	return func(f *sniffer) {
+		f.fallback = setup
+	}
+}
+
+// WithSniffMaxBytes set the maximum bytes peeked, the protocols still needing more data are treated as mismatched.
+func WithSniffMaxBytes(n int) SnifferOption {
+	return func(f *sniffer) {
+		if n > 0 {
+			f.maxBytes = n
+		}
+	}
+}
+
+// sniffer peeks the first bytes of the session and installs the matching protocol, it works as the codec
+// and the eventListener of the session until the protocol is decided.
+type sniffer struct {
+	session   Session
+	protocols []Protocol
+	fallback  func(s Session) error
+	maxBytes  int
+}
+
+// Sniff set the session serving the protocol matching its first bytes, the protocols are matched in order,
+// so one server can serve multiple protocols on the same port.
+// it replaces the codec and the eventListener of the session, so it should be called in NewSessionCallBackFunc
+// instead of SetCodec and SetEventListener.
+func Sniff(s Session, protocols []Protocol, opts ...SnifferOption) {
+	f := &sniffer{session: s, protocols: protocols, maxBytes: defaultSniffMaxBytes}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	s.SetCodec(f)
+	s.SetEventListener(f)
+}
+
+// Encode implements Codec.
+func (f *sniffer) Encode(interface{}) ([]byte, error) {
+	return nil, errors.New("session protocol is not decided yet")
+}
+
+// Decode implements Codec, the data is never consumed, it is decoded again by the codec of the matched protocol.
+func (f *sniffer) Decode(data []byte) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+
+	peeked := data
+	if len(peeked) > f.maxBytes {
+		peeked = peeked[:f.maxBytes]
+	}
+
+	for _, protocol := range f.protocols {
+		switch protocol.Match(peeked) {
+		case Match:
+			return nil, 0, f.install(protocol.Name, protocol.Setup)
+		case NeedMore:
+			// wait for more data to respect the order of the protocols.
+			if len(peeked) < f.maxBytes {
+				return nil, 0, nil
+			}
+		}
+	}
+
+	if f.fallback == nil {
+		return nil, 0, fmt.Errorf("session:%s speaks unknown protocol", f.session.Info())
+	}
+
+	return nil, 0, f.install("fallback", f.fallback)
+}
+
+func (f *sniffer) install(name string, setup func(s Session) error) error {
+	if err := setup(f.session); err != nil {
+		return fmt.Errorf("setup protocol:%s err:%w", name, err)
+	}
+
+	if f.session.EventListener() == EventListener(f) {
+		return fmt.Errorf("setup protocol:%s without eventListener", name)
+	}
+
+	if f.session.Codec() == Codec(f) {
+		f.session.SetCodec(nil)
+	}
+
+	f.session.EventListener().OnConnect(f.session)
+	return nil
+}
+
+// OnConnect implements EventListener.
+func (f *sniffer) OnConnect(Session) {}
+
+// OnMessage implements EventListener.
+func (f *sniffer) OnMessage(Session, interface{}) ExecStatus {
+	return Normal
+}
+
+// OnError implements EventListener, the session is closed if the protocol can not be decided.
+func (f *sniffer) OnError(s Session, e error) {
+	s.Logger().Log(log.ErrorLevel, "sniff protocol err", log.Err(e))
+	if err := s.Close(); err != nil {
+		s.Logger().Log(log.ErrorLevel, "close session err", log.Err(err))
+	}
+}
+
+// OnClose implements EventListener.
+func (f *sniffer) OnClose(Session) {}
+
+// MatchPrefix return a Matcher matching the data starting with prefix, e.g. the magic number of a binary protocol.
+func MatchPrefix(prefix []byte) Matcher {
+	return func(data []byte) MatchResult {
+		if len(data) < len(prefix) {
+			if bytes.HasPrefix(prefix, data) {
+				return NeedMore
+			}
+			return Mismatch
+		}
+
+		if bytes.HasPrefix(data, prefix) {
+			return Match
+		}
+		return Mismatch
+	}
+}
+
+// MatchAny return a Matcher matching the data matched by any of matchers.
+func MatchAny(matchers ...Matcher) Matcher {
+	return func(data []byte) MatchResult {
+		result := Mismatch
+		for _, matcher := range matchers {
+			switch matcher(data) {
+			case Match:
+				return Match
+			case NeedMore:
+				result = NeedMore
+			}
+		}
+		return result
+	}
+}
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("HEAD "), []byte("POST "), []byte("PUT "), []byte("DELETE "),
+	[]byte("CONNECT "), []byte("OPTIONS "), []byte("TRACE "), []byte("PATCH "),
+}
+
+// MatchHTTP return a Matcher matching the HTTP/1.x requests, and the HTTP/2 connection preface which starts with
+// "PRI * HTTP/2.0".
+func MatchHTTP() Matcher {
+	matchers := make([]Matcher, 0, len(httpMethods)+1)
+	for _, method := range httpMethods {
+		matchers = append(matchers, MatchPrefix(method))
+	}
+	return MatchAny(append(matchers, MatchPrefix([]byte("PRI * HTTP/2.0")))...)
+}
+
+// MatchTLS return a Matcher matching the TLS ClientHello, the handshake record of SSL 3.0 and TLS 1.x.
+func MatchTLS() Matcher {
+	return func(data []byte) MatchResult {
+		// content type handshake(22), major version 3.
+		for idx, b := range []byte{0x16, 0x03} {
+			if idx >= len(data) {
+				return NeedMore
+			}
+			if data[idx] != b {
+				return Mismatch
+			}
+		}
+
+		if len(data) < 3 {
+			return NeedMore
+		}
+		if data[2] > 0x04 {
+			return Mismatch
+		}
+		return Match
+	}
+}
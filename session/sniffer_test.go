@@ -0,0 +1,122 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// closableConn records whether the connection is closed.
+type closableConn struct {
+	fakeConn
+	closed bool
+}
+
+func (c *closableConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSniff(t *testing.T) {
+	magic, http := &recordListener{}, &recordListener{}
+	protocols := []Protocol{
+		{Name: "tls", Match: MatchTLS(), Setup: func(s Session) error {
+			return nil
+		}},
+		{Name: "magic", Match: MatchPrefix([]byte("KN")), Setup: func(s Session) error {
+			s.SetCodec(lineCodec{})
+			s.SetEventListener(magic)
+			return nil
+		}},
+		{Name: "http", Match: MatchHTTP(), Setup: func(s Session) error {
+			s.SetEventListener(http)
+			return s.Pipeline().AddLast("codec", NewCodecHandler(lineCodec{}))
+		}},
+	}
+
+	s := NewSession(&fakeConn{}).(*session)
+	Sniff(s, protocols)
+	assert.Nil(t, s.Run())
+	// wait for more data to decide.
+	assert.Equal(t, 0, s.handlePkg([]byte("K")))
+	assert.Equal(t, 7, s.handlePkg([]byte("KN foo\n")))
+	assert.Equal(t, []interface{}{"KN foo"}, magic.messages)
+
+	s = NewSession(&fakeConn{}).(*session)
+	Sniff(s, protocols)
+	assert.Nil(t, s.Run())
+	assert.Equal(t, 15, s.handlePkg([]byte("GET / HTTP/1.1\n")))
+	assert.Equal(t, []interface{}{"GET / HTTP/1.1"}, http.messages)
+
+	// the tls setup sets no eventListener.
+	conn := &closableConn{}
+	s = NewSession(conn).(*session)
+	Sniff(s, protocols)
+	assert.Nil(t, s.Run())
+	s.handlePkg([]byte{0x16, 0x03, 0x01})
+	assert.True(t, conn.closed)
+
+	// unknown protocol.
+	conn = &closableConn{}
+	s = NewSession(conn).(*session)
+	Sniff(s, protocols)
+	assert.Nil(t, s.Run())
+	s.handlePkg([]byte("SSH-2.0"))
+	assert.True(t, conn.closed)
+
+	fallback := &recordListener{}
+	s = NewSession(&fakeConn{}).(*session)
+	Sniff(s, protocols, WithSniffFallback(func(s Session) error {
+		s.SetCodec(lineCodec{})
+		s.SetEventListener(fallback)
+		return nil
+	}))
+	assert.Nil(t, s.Run())
+	assert.Equal(t, 8, s.handlePkg([]byte("SSH-2.0\n")))
+	assert.Equal(t, []interface{}{"SSH-2.0"}, fallback.messages)
+}
+
+// upgradeListener switches the codec after the upgrade message.
+type upgradeListener struct {
+	recordListener
+}
+
+func (u *upgradeListener) OnMessage(s Session, pkg interface{}) ExecStatus {
+	if pkg == "upgrade" {
+		s.SetCodec(nil)
+		u.messages = append(u.messages, pkg)
+		return Normal
+	}
+	if data, ok := pkg.([]byte); ok {
+		pkg = string(data)
+	}
+	return u.recordListener.OnMessage(s, pkg)
+}
+
+func TestSession_SwitchCodec(t *testing.T) {
+	listener := &upgradeListener{}
+	s := NewSession(&fakeConn{}).(*session)
+	s.SetCodec(lineCodec{})
+	s.SetEventListener(listener)
+	assert.Nil(t, s.Run())
+
+	// the data after the upgrade message is passed to the pipeline as []byte.
+	assert.Equal(t, 13, s.handlePkg([]byte("upgrade\nraw\n\n")))
+	assert.Equal(t, []interface{}{"upgrade", "raw\n\n"}, listener.messages)
+}
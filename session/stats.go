@@ -0,0 +1,68 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package session
+
+import "time"
+
+// Stats statistics of a session.
+type Stats struct {
+	// BytesIn the bytes read from the network.
+	BytesIn uint64
+	// BytesOut the bytes written to the network.
+	BytesOut uint64
+	// PacketsIn the packages decoded by the codec, or the data chunks passed to the pipeline if there is no codec.
+	PacketsIn uint64
+	// PacketsOut the packages encoded and written to the output buffer.
+	PacketsOut uint64
+	// DecodeErrors the times the codec failed to decode the network data.
+	DecodeErrors uint64
+	// OutputBuffered the bytes in the output buffer waiting to be written to the network.
+	OutputBuffered int
+	// FlushEAGAIN the times the output buffer could not be written to the network completely.
+	FlushEAGAIN uint64
+	// Throttled the time the reading is paused by the limiters.
+	Throttled time.Duration
+}
+
+// Add return the sum of the two statistics.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		BytesIn:        s.BytesIn + o.BytesIn,
+		BytesOut:       s.BytesOut + o.BytesOut,
+		PacketsIn:      s.PacketsIn + o.PacketsIn,
+		PacketsOut:     s.PacketsOut + o.PacketsOut,
+		DecodeErrors:   s.DecodeErrors + o.DecodeErrors,
+		OutputBuffered: s.OutputBuffered + o.OutputBuffered,
+		FlushEAGAIN:    s.FlushEAGAIN + o.FlushEAGAIN,
+		Throttled:      s.Throttled + o.Throttled,
+	}
+}
+
+// Stats implements Session.
+func (s *session) Stats() Stats {
+	conn := s.conn.Stats()
+	return Stats{
+		BytesIn:        conn.BytesIn,
+		BytesOut:       conn.BytesOut,
+		PacketsIn:      s.packetsIn.Load(),
+		PacketsOut:     s.packetsOut.Load(),
+		DecodeErrors:   s.decodeErrors.Load(),
+		OutputBuffered: conn.OutputBuffered,
+		FlushEAGAIN:    conn.FlushEAGAIN,
+		Throttled:      s.throttled.Load(),
+	}
+}
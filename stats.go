@@ -0,0 +1,167 @@
+/*
+	Copyright 2022 Phoenix
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package knetty
+
+import (
+	"strconv"
+
+	"github.com/Softwarekang/knetty/pkg/log"
+	"github.com/Softwarekang/knetty/pkg/metrics"
+	"github.com/Softwarekang/knetty/session"
+)
+
+// ServerStats statistics of a server.
+type ServerStats struct {
+	// ActiveSessions the number of the sessions being served.
+	ActiveSessions int
+	// Accepts the number of the accepted connections.
+	Accepts uint64
+	// AcceptErrors the times accepting a connection failed.
+	AcceptErrors uint64
+	// Rejected the number of the accepted connections rejected by the admission control.
+	Rejected uint64
+	// Denied the number of the accepted connections rejected by the ip filter, they are counted in Rejected too.
+	Denied uint64
+	// Sessions the statistics summed over all the sessions served, including the closed ones.
+	Sessions session.Stats
+	// Pollers the statistics of the reactor pollers serving the server, they may be shared with others.
+	Pollers []PollerStats
+}
+
+// ClientStats statistics of a client.
+type ClientStats struct {
+	// Session the statistics of the session of the client.
+	Session session.Stats
+	// Pollers the statistics of the reactor pollers serving the client, they may be shared with others.
+	Pollers []PollerStats
+}
+
+// Stats return the statistics of the server.
+func (s *Server) Stats() ServerStats {
+	s.mu.Lock()
+	stats := ServerStats{
+		ActiveSessions: len(s.sessions),
+		Accepts:        s.accepts.Load(),
+		AcceptErrors:   s.acceptErrors.Load(),
+		Rejected:       s.admission.rejected.Load(),
+		Denied:         s.admission.denied.Load(),
+		Sessions:       s.closedStats,
+	}
+	for ss := range s.sessions {
+		stats.Sessions = stats.Sessions.Add(ss.Stats())
+	}
+	loops := s.loops
+	s.mu.Unlock()
+
+	if loops != nil {
+		stats.Pollers = loops.Stats()
+	}
+	return stats
+}
+
+// Collect implements metrics.Collector, the samples are labeled with the address of the server.
+func (s *Server) Collect() []metrics.Sample {
+	stats := s.Stats()
+	labels := []metrics.Label{{Name: "address", Value: s.address}}
+	samples := []metrics.Sample{
+		{Name: "knetty_server_active_sessions", Help: "The number of the sessions being served.",
+			Kind: metrics.Gauge, Labels: labels, Value: float64(stats.ActiveSessions)},
+		{Name: "knetty_server_accepts_total", Help: "The number of the accepted connections.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.Accepts)},
+		{Name: "knetty_server_accept_errors_total", Help: "The times accepting a connection failed.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.AcceptErrors)},
+		{Name: "knetty_server_rejected_total", Help: "The number of the accepted connections rejected by the admission control.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.Rejected)},
+		{Name: "knetty_server_denied_total", Help: "The number of the accepted connections rejected by the ip filter.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.Denied)},
+	}
+	samples = append(samples, sessionSamples(stats.Sessions, labels)...)
+	return append(samples, pollerSamples(stats.Pollers, labels)...)
+}
+
+// Stats return the statistics of the client.
+func (c *Client) Stats() ClientStats {
+	var stats ClientStats
+	if c.session != nil {
+		stats.Session = c.session.Stats()
+	}
+	if c.loops != nil {
+		stats.Pollers = c.loops.Stats()
+	}
+	return stats
+}
+
+// Collect implements metrics.Collector, the samples are labeled with the address of the server connected.
+func (c *Client) Collect() []metrics.Sample {
+	stats := c.Stats()
+	labels := []metrics.Label{{Name: "address", Value: c.address}}
+	return append(sessionSamples(stats.Session, labels), pollerSamples(stats.Pollers, labels)...)
+}
+
+func sessionSamples(stats session.Stats, labels []metrics.Label) []metrics.Sample {
+	return []metrics.Sample{
+		{Name: "knetty_session_bytes_in_total", Help: "The bytes read from the network.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.BytesIn)},
+		{Name: "knetty_session_bytes_out_total", Help: "The bytes written to the network.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.BytesOut)},
+		{Name: "knetty_session_packets_in_total", Help: "The packages decoded from the network data.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.PacketsIn)},
+		{Name: "knetty_session_packets_out_total", Help: "The packages encoded and written to the output buffer.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.PacketsOut)},
+		{Name: "knetty_session_decode_errors_total", Help: "The times the codec failed to decode the network data.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.DecodeErrors)},
+		{Name: "knetty_session_output_buffered_bytes", Help: "The bytes in the output buffers waiting to be written.",
+			Kind: metrics.Gauge, Labels: labels, Value: float64(stats.OutputBuffered)},
+		{Name: "knetty_session_flush_eagain_total", Help: "The times the output buffer could not be written completely.",
+			Kind: metrics.Counter, Labels: labels, Value: float64(stats.FlushEAGAIN)},
+		{Name: "knetty_session_throttled_seconds_total", Help: "The time the reading is paused by the rate limits.",
+			Kind: metrics.Counter, Labels: labels, Value: stats.Throttled.Seconds()},
+	}
+}
+
+func pollerSamples(pollers []PollerStats, labels []metrics.Label) []metrics.Sample {
+	samples := make([]metrics.Sample, 0, 6*len(pollers))
+	for idx, stats := range pollers {
+		pollerLabels := append(append([]metrics.Label(nil), labels...), metrics.Label{Name: "poller", Value: strconv.Itoa(idx)})
+		samples = append(samples,
+			metrics.Sample{Name: "knetty_poller_conns", Help: "The number of the net fds registered in the poller.",
+				Kind: metrics.Gauge, Labels: pollerLabels, Value: float64(stats.Conns)},
+			metrics.Sample{Name: "knetty_poller_wakeups_total", Help: "The times the event loop woke up with events.",
+				Kind: metrics.Counter, Labels: pollerLabels, Value: float64(stats.Wakeups)},
+			metrics.Sample{Name: "knetty_poller_events_total", Help: "The number of the events dispatched by the event loop.",
+				Kind: metrics.Counter, Labels: pollerLabels, Value: float64(stats.Events)},
+			metrics.Sample{Name: "knetty_poller_wake_latency_seconds_total", Help: "The time the events waited between the wake up and their dispatching.",
+				Kind: metrics.Counter, Labels: pollerLabels, Value: stats.WakeLatency.Seconds()},
+			metrics.Sample{Name: "knetty_poller_spin_seconds_total", Help: "The time the event loop spent in polling with zero timeout.",
+				Kind: metrics.Counter, Labels: pollerLabels, Value: stats.SpinTime.Seconds()},
+			metrics.Sample{Name: "knetty_poller_block_seconds_total", Help: "The time the event loop spent in blocking for events.",
+				Kind: metrics.Counter, Labels: pollerLabels, Value: stats.BlockTime.Seconds()},
+		)
+	}
+	return samples
+}
+
+// reportMetrics report the samples of c to the reporter of the options until done is closed.
+func reportMetrics(opts reporterOptions, c metrics.Collector, done <-chan struct{}) {
+	if opts.reporter == nil {
+		return
+	}
+
+	go metrics.Report(opts.reporter, c, opts.interval, done, func(err error) {
+		log.Errorf("metrics report err:%v", err)
+	})
+}